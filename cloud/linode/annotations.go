@@ -0,0 +1,174 @@
+package linode
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// perPortAnnotationPrefixes are the prefixes of the annotations configuring a single port, which
+// are followed by the port number.
+var perPortAnnotationPrefixes = []string{
+	annLinodePortConfigPrefix,
+	annLinodePortTLSSecretPrefix,
+	annLinodePortTLSObjectURLPrefix,
+	annLinodePortProxyProtocolPrefix,
+	annLinodePortAlgorithmPrefix,
+	annLinodePortStickinessPrefix,
+	annLinodePortSSLCipherPrefix,
+	annLinodePortThrottlePrefix,
+	annLinodePortSkipPrefix,
+	annLinodePortNodePortPrefix,
+	annLinodePortCheckPortPrefix,
+	annLinodePortTimeoutPrefix,
+	annLinodePortCheckTypePrefix,
+	annLinodePortConfigIDPrefix,
+}
+
+// validateServiceAnnotations returns the combinations of annotations of service the NodeBalancer
+// can't be configured with, aggregated so that they can all be reported at once before anything
+// is changed rather than as Linode API errors one port at a time.
+func validateServiceAnnotations(service *v1.Service) error {
+	var errs []error
+
+	servicePorts := make(map[int]bool, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		if servicePorts[int(port.Port)] {
+			errs = append(errs, fmt.Errorf("port %d is requested for several protocols, but a NodeBalancer port only balances one", port.Port))
+		}
+		servicePorts[int(port.Port)] = true
+	}
+
+	names := make([]string, 0, len(service.Annotations))
+	for name := range service.Annotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, prefix := range perPortAnnotationPrefixes {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if port, err := strconv.Atoi(strings.TrimPrefix(name, prefix)); err != nil || !servicePorts[port] {
+				errs = append(errs, fmt.Errorf("annotation %q doesn't refer to a port of the service", name))
+			}
+		}
+	}
+
+	// Errors parsing the annotation are reported along with the config of the ports.
+	tlsAnnotations, _ := getTLSAnnotationsDeprecated(service)
+	tlsCertificates := make(map[int]int, len(tlsAnnotations))
+	for _, tlsAnnotation := range tlsAnnotations {
+		tlsCertificates[tlsAnnotation.Port]++
+		if tlsCertificates[tlsAnnotation.Port] == 2 {
+			errs = append(errs, fmt.Errorf("port %d has several TLS certificates in annotation %q, but NodeBalancer configs only hold one certificate and don't support SNI", tlsAnnotation.Port, annLinodeLoadBalancerTLSDeprecated))
+		}
+	}
+
+	// The body of http checks, which only check the status code, and of disabled checks is
+	// ignored with an event by buildNodeBalancerConfig.
+	checkType := linodego.ConfigCheck(service.Annotations[annLinodeHealthCheckType])
+	body, hasBody := service.Annotations[annLinodeCheckBody]
+	if hasBody && checkType != linodego.CheckHTTPBody && checkType != linodego.CheckHTTP && checkType != linodego.CheckNone {
+		errs = append(errs, fmt.Errorf("annotation %q requires %q to be %q", annLinodeCheckBody, annLinodeHealthCheckType, linodego.CheckHTTPBody))
+	}
+	if checkType == linodego.CheckHTTPBody && body == "" {
+		errs = append(errs, fmt.Errorf("annotation %q is %q, which requires the regex matching the response body in annotation %q", annLinodeHealthCheckType, linodego.CheckHTTPBody, annLinodeCheckBody))
+	}
+	if hasBody && body != "" {
+		if _, err := getCheckBodyRegex(service, body); err != nil {
+			errs = append(errs, err)
+		}
+	} else if _, ok := service.Annotations[annLinodeCheckBodyMatch]; ok {
+		errs = append(errs, fmt.Errorf("annotation %q requires %q", annLinodeCheckBodyMatch, annLinodeCheckBody))
+	}
+
+	if _, err := getCheckPassive(service, linodego.ProtocolTCP, linodego.CheckConnection); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := getNodeLabelTemplate(service); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := getBackupNodeSelector(service); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := getExcludeNodeSelector(service); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := getWaitForBackendsTimeout(service); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := getDNSRecordAnnotation(service); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, port := range getNodeBalancerPorts(service) {
+		if checkPort, ok := getServiceAnnotation(service, annLinodePortCheckPortPrefix+strconv.Itoa(int(port.Port))); ok {
+			errs = append(errs, fmt.Errorf("port %d requests health checks on port %s, but NodeBalancers can only check the port receiving traffic: serve the health check on that port and set %q instead", port.Port, checkPort, annLinodeCheckPath))
+		}
+
+		if raw, ok := getServiceAnnotation(service, annLinodePortTimeoutPrefix+strconv.Itoa(int(port.Port))); ok {
+			if timeout, err := strconv.Atoi(raw); err != nil || timeout < 1 {
+				errs = append(errs, fmt.Errorf("invalid value %q for %q: must be a number of seconds", raw, annLinodePortTimeoutPrefix+strconv.Itoa(int(port.Port))))
+			}
+		}
+
+		if _, ok, err := getPortConfigID(service, int(port.Port)); err != nil {
+			errs = append(errs, err)
+		} else if _, hasNodeBalancerID := getServiceAnnotation(service, annLinodeNodeBalancerID); ok && !hasNodeBalancerID {
+			errs = append(errs, fmt.Errorf("annotation %q requires %q, as it refers to a config of an existing NodeBalancer", annLinodePortConfigIDPrefix+strconv.Itoa(int(port.Port)), annLinodeNodeBalancerID))
+		}
+
+		portConfig, err := getPortConfig(service, int(port.Port))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("port %d: %v", port.Port, err))
+			continue
+		}
+		if (portConfig.Protocol == protocolUDP) != (port.Protocol == v1.ProtocolUDP) {
+			errs = append(errs, fmt.Errorf("port %d of the service is %s but uses protocol %s", port.Port, getServicePortProtocol(service, int(port.Port)), portConfig.Protocol))
+		}
+		if portConfig.Protocol == protocolUDP && getServiceBoolAnnotation(service, annLinodeHealthCheckPassive) {
+			errs = append(errs, fmt.Errorf("port %d uses protocol udp, which doesn't support the passive checks enabled in annotation %q", port.Port, annLinodeHealthCheckPassive))
+		}
+		if portConfig.Protocol == linodego.ProtocolHTTPS && portConfig.TLSSecretName == "" && portConfig.TLSObjectURL == "" {
+			errs = append(errs, fmt.Errorf("port %d uses https but no TLS secret is specified in annotation %q", port.Port, annLinodePortTLSSecretPrefix+strconv.Itoa(portConfig.Port)))
+		}
+		if portConfig.TLSSecretName != "" && portConfig.TLSObjectURL != "" {
+			errs = append(errs, fmt.Errorf("port %d has both a TLS secret and the certificate of %q: only one can be used", port.Port, annLinodePortTLSObjectURLPrefix+strconv.Itoa(portConfig.Port)))
+		}
+		if portConfig.Protocol != linodego.ProtocolHTTPS && portConfig.TLSObjectURL != "" {
+			errs = append(errs, fmt.Errorf("port %d uses protocol %s, but only https ports use the certificate of %q", port.Port, portConfig.Protocol, annLinodePortTLSObjectURLPrefix+strconv.Itoa(portConfig.Port)))
+		}
+
+		proxyProtocol, err := getPortProxyProtocol(service, portConfig.Port)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("port %d: %v", port.Port, err))
+		} else if proxyProtocol != linodego.ProxyProtocolNone && portConfig.Protocol != linodego.ProtocolTCP {
+			errs = append(errs, fmt.Errorf("port %d uses proxy protocol %s with protocol %s: NodeBalancers only support proxy protocol for tcp", port.Port, proxyProtocol, portConfig.Protocol))
+		}
+
+		if _, err = getPortCipherSuite(service, portConfig.Port, portConfig.Protocol); err != nil {
+			errs = append(errs, err)
+		}
+
+		if stickiness, ok, err := getPortStickiness(service, portConfig.Port); err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			if err = checkStickinessProtocol(stickiness, portConfig.Protocol); err != nil {
+				errs = append(errs, fmt.Errorf("port %d: %v", port.Port, err))
+			}
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
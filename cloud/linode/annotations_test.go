@@ -0,0 +1,288 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestValidateServiceAnnotations(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		errors      []string
+	}{
+		{
+			name: "valid",
+			annotations: map[string]string{
+				annLinodeDefaultProtocol:                  "http",
+				annLinodePortTLSSecretPrefix + "443":      "tls-secret",
+				annLinodePortProxyProtocolPrefix + "8080": "v2",
+				annLinodePortConfigPrefix + "8080":        `{"protocol": "tcp"}`,
+				annLinodeHealthCheckType:                  "http_body",
+				annLinodeCheckBody:                        "ok",
+			},
+		},
+		{
+			name:        "https without TLS secret",
+			annotations: map[string]string{annLinodePortConfigPrefix + "443": `{"protocol": "https"}`},
+			errors:      []string{"port 443 uses https but no TLS secret"},
+		},
+		{
+			name:        "https from an object storage URL",
+			annotations: map[string]string{annLinodePortTLSObjectURLPrefix + "443": "https://us-east-1.linodeobjects.com/certs/bundle.pem?X-Amz-Signature=abc"},
+		},
+		{
+			name:        "object storage URL without https",
+			annotations: map[string]string{annLinodePortTLSObjectURLPrefix + "443": "http://us-east-1.linodeobjects.com/certs/bundle.pem"},
+			errors:      []string{`port 443: invalid value for "service.beta.kubernetes.io/linode-loadbalancer-tls-object-url-443": must be an https URL`},
+		},
+		{
+			name: "object storage URL and TLS secret",
+			annotations: map[string]string{
+				annLinodePortTLSObjectURLPrefix + "443": "https://us-east-1.linodeobjects.com/certs/bundle.pem",
+				annLinodePortTLSSecretPrefix + "443":    "tls-secret",
+			},
+			errors: []string{"port 443 has both a TLS secret and the certificate of"},
+		},
+		{
+			name: "object storage URL on tcp port",
+			annotations: map[string]string{
+				annLinodePortTLSObjectURLPrefix + "8080": "https://us-east-1.linodeobjects.com/certs/bundle.pem",
+				annLinodePortConfigPrefix + "8080":       `{"protocol": "tcp"}`,
+			},
+			errors: []string{"port 8080 uses protocol tcp, but only https ports use the certificate of"},
+		},
+		{
+			name:        "check body without http_body check",
+			annotations: map[string]string{annLinodeHealthCheckType: "connection", annLinodeCheckBody: "ok"},
+			errors:      []string{`requires "service.beta.kubernetes.io/linode-loadbalancer-check-type" to be "http_body"`},
+		},
+		{
+			// The body is ignored with a CheckBodyIgnored event.
+			name:        "check body with http check",
+			annotations: map[string]string{annLinodeHealthCheckType: "http", annLinodeCheckBody: "ok"},
+		},
+		{
+			name:        "http_body check without check body",
+			annotations: map[string]string{annLinodeHealthCheckType: "http_body"},
+			errors:      []string{`"service.beta.kubernetes.io/linode-loadbalancer-check-type" is "http_body", which requires the regex matching the response body`},
+		},
+		{
+			name:        "http_body check with empty check body",
+			annotations: map[string]string{annLinodeHealthCheckType: "http_body", annLinodeCheckBody: ""},
+			errors:      []string{`is "http_body", which requires the regex matching the response body`},
+		},
+		{
+			name:        "check body match without check body",
+			annotations: map[string]string{annLinodeHealthCheckType: "http_body", annLinodeCheckBodyMatch: "substring"},
+			errors:      []string{`"service.beta.kubernetes.io/linode-loadbalancer-check-body-match" requires "service.beta.kubernetes.io/linode-loadbalancer-check-body"`},
+		},
+		{
+			name:        "invalid check body regex",
+			annotations: map[string]string{annLinodeHealthCheckType: "http_body", annLinodeCheckBody: "(ok", annLinodeCheckBodyMatch: "regex"},
+			errors:      []string{`invalid regex "(ok"`},
+		},
+		{
+			name:        "proxy protocol on http port",
+			annotations: map[string]string{annLinodeDefaultProtocol: "http", annLinodePortProxyProtocolPrefix + "8080": "v1"},
+			errors:      []string{"port 8080 uses proxy protocol v1 with protocol http"},
+		},
+		{
+			name:        "cookie stickiness on tcp port",
+			annotations: map[string]string{annLinodePortStickinessPrefix + "8080": "http_cookie"},
+			errors:      []string{"port 8080: stickiness http_cookie requires protocol http or https, not tcp"},
+		},
+		{
+			name:        "invalid stickiness",
+			annotations: map[string]string{annLinodePortStickinessPrefix + "8080": "cookie"},
+			errors:      []string{"invalid NodeBalancer stickiness value 'cookie' for port 8080"},
+		},
+		{
+			name:        "invalid cipher suite",
+			annotations: map[string]string{annLinodePortSSLCipherPrefix + "8080": "modern"},
+			errors:      []string{"invalid NodeBalancer cipher suite value 'modern' for port 8080"},
+		},
+		{
+			name: "per-port annotations for unknown ports",
+			annotations: map[string]string{
+				annLinodePortThrottlePrefix + "9000": "5",
+				annLinodePortAlgorithmPrefix + "abc": "source",
+			},
+			errors: []string{"throttle-9000\" doesn't refer to a port", "algorithm-abc\" doesn't refer to a port"},
+		},
+		{
+			name:        "health check port",
+			annotations: map[string]string{annLinodePortCheckPortPrefix + "8080": "8081"},
+			errors:      []string{"port 8080 requests health checks on port 8081, but NodeBalancers can only check the port receiving traffic"},
+		},
+		{
+			name:        "invalid timeout",
+			annotations: map[string]string{annLinodePortTimeoutPrefix + "443": "5m"},
+			errors:      []string{`invalid value "5m" for "service.beta.kubernetes.io/linode-loadbalancer-timeout-443": must be a number of seconds`},
+		},
+		{
+			name:        "invalid wait for backends",
+			annotations: map[string]string{annLinodeWaitForBackends: "120"},
+			errors:      []string{`invalid value "120" for service.beta.kubernetes.io/linode-loadbalancer-wait-for-backends: must be a positive duration`},
+		},
+		{
+			name:        "config id without NodeBalancer id",
+			annotations: map[string]string{annLinodePortConfigIDPrefix + "443": "12345"},
+			errors:      []string{`annotation "service.beta.kubernetes.io/linode-loadbalancer-config-id-443" requires "service.beta.kubernetes.io/linode-loadbalancer-nodebalancer-id"`},
+		},
+		{
+			name: "invalid config id",
+			annotations: map[string]string{
+				annLinodeNodeBalancerID:             "12345",
+				annLinodePortConfigIDPrefix + "443": "config",
+			},
+			errors: []string{`invalid value "config" for "service.beta.kubernetes.io/linode-loadbalancer-config-id-443": must be the ID of a NodeBalancer config`},
+		},
+		{
+			name:        "invalid passive checks",
+			annotations: map[string]string{annLinodeHealthCheckPassive: "sometimes"},
+			errors:      []string{`invalid value "sometimes" for "service.beta.kubernetes.io/linode-loadbalancer-check-passive": must be a bool`},
+		},
+		{
+			name: "several TLS certificates for a port",
+			annotations: map[string]string{
+				annLinodeLoadBalancerTLSDeprecated: `[{"tls-secret-name": "a-tls", "hostname": "a.example.com", "port": 443}, {"tls-secret-name": "b-tls", "hostname": "b.example.com", "port": 443}]`,
+			},
+			errors: []string{"port 443 has several TLS certificates", "don't support SNI"},
+		},
+		{
+			name: "udp protocol on tcp port",
+			annotations: map[string]string{
+				annLinodePortConfigPrefix + "8080": `{"protocol": "udp"}`,
+				annLinodeHealthCheckPassive:        "true",
+			},
+			errors: []string{
+				"port 8080 of the service is TCP but uses protocol udp",
+				"port 8080 uses protocol udp, which doesn't support the passive checks",
+			},
+		},
+		{
+			name: "all errors are aggregated",
+			annotations: map[string]string{
+				annLinodeDefaultProtocol:       "https",
+				annLinodeProxyProtocol:         "v2",
+				annLinodeCheckBody:             "ok",
+				annLinodePortSkipPrefix + "22": "true",
+			},
+			errors: []string{
+				"skip-port-22\" doesn't refer to a port",
+				"linode-loadbalancer-check-body\" requires",
+				"port 443 uses https but no TLS secret",
+				"port 443 uses proxy protocol v2 with protocol https",
+				"port 8080 uses https but no TLS secret",
+				"port 8080 uses proxy protocol v2 with protocol https",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: tc.annotations},
+				Spec: v1.ServiceSpec{
+					Ports: []v1.ServicePort{
+						{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30000},
+						{Name: "alt", Protocol: "TCP", Port: 8080, NodePort: 30001},
+					},
+				},
+			}
+
+			err := validateServiceAnnotations(svc)
+			if len(tc.errors) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tc.errors)
+			}
+			for _, expected := range tc.errors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error to contain %q, got %q", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateServiceAnnotationsUDP(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test",
+			Annotations: map[string]string{annLinodeDefaultProtocol: "tcp"},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "dns", Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30053}},
+		},
+	}
+	if err := validateServiceAnnotations(svc); err != nil {
+		t.Errorf("expected udp port to default to the udp protocol, got %s", err)
+	}
+
+	svc.Annotations[annLinodePortConfigPrefix+"53"] = `{"protocol": "tcp"}`
+	if err := validateServiceAnnotations(svc); err == nil || !strings.Contains(err.Error(), "port 53 of the service is UDP but uses protocol tcp") {
+		t.Errorf("expected an error for a tcp config on a udp port, got %v", err)
+	}
+
+	delete(svc.Annotations, annLinodePortConfigPrefix+"53")
+	svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Name: "dns-tcp", Protocol: v1.ProtocolTCP, Port: 53, NodePort: 30054})
+	if err := validateServiceAnnotations(svc); err == nil || !strings.Contains(err.Error(), "port 53 is requested for several protocols") {
+		t.Errorf("expected an error for udp and tcp on the same port, got %v", err)
+	}
+}
+
+func TestEnsureLoadBalancerInvalidAnnotations(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected %s %s for a service with invalid annotations", r.Method, r.URL.Path)
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol: "https",
+				annLinodeProxyProtocol:   "v1",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30000}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil); err == nil {
+		t.Fatal("expected EnsureLoadBalancer to fail for invalid annotations")
+	}
+	event := <-recorder.Events
+	if !strings.Contains(event, "InvalidAnnotations") || !strings.Contains(event, "no TLS secret") || !strings.Contains(event, "proxy protocol v1") {
+		t.Errorf("expected a single InvalidAnnotations event with every error, got %q", event)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no other event, got %q", <-recorder.Events)
+	}
+}
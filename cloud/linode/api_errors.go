@@ -0,0 +1,52 @@
+package linode
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/linode/linodego"
+)
+
+// apiErrorKind classifies the errors returned by the Linode API, so that callers can react to
+// them without matching status codes and reasons themselves.
+type apiErrorKind int
+
+const (
+	apiErrorUnknown apiErrorKind = iota
+	apiErrorNotFound
+	apiErrorRetryable
+	apiErrorQuotaExceeded
+	apiErrorUnauthorized
+)
+
+// quotaExceededReasons are fragments of the reasons given by the Linode API when a limit of the
+// account prevents a resource from being created.
+var quotaExceededReasons = []string{"limit reached", "limit exceeded", "quota"}
+
+// classifyAPIError returns the kind of err, which is apiErrorUnknown for errors that don't come
+// from the Linode API.
+func classifyAPIError(err error) apiErrorKind {
+	apiErr, ok := err.(*linodego.Error)
+	if !ok {
+		return apiErrorUnknown
+	}
+
+	switch {
+	case apiErr.Code == http.StatusNotFound:
+		return apiErrorNotFound
+	case apiErr.Code == http.StatusUnauthorized:
+		return apiErrorUnauthorized
+	case apiErr.Code >= http.StatusInternalServerError || apiErr.Code == http.StatusTooManyRequests:
+		return apiErrorRetryable
+	case strings.Contains(apiErr.Message, retriesExhaustedMessage), strings.Contains(apiErr.Message, notRetriedMessage):
+		return apiErrorRetryable
+	case apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusForbidden:
+		reason := strings.ToLower(apiErr.Message)
+		for _, fragment := range quotaExceededReasons {
+			if strings.Contains(reason, fragment) {
+				return apiErrorQuotaExceeded
+			}
+		}
+	}
+	return apiErrorUnknown
+}
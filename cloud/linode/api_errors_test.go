@@ -0,0 +1,86 @@
+package linode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestClassifyAPIError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected apiErrorKind
+	}{
+		{"not an API error", errors.New("boom"), apiErrorUnknown},
+		{"nil", nil, apiErrorUnknown},
+		{"not found", &linodego.Error{Code: http.StatusNotFound, Message: "Not found"}, apiErrorNotFound},
+		{"invalid token", &linodego.Error{Code: http.StatusUnauthorized, Message: "Invalid Token"}, apiErrorUnauthorized},
+		{"server error", &linodego.Error{Code: http.StatusBadGateway, Message: "Bad Gateway"}, apiErrorRetryable},
+		{"rate limited", &linodego.Error{Code: http.StatusTooManyRequests, Message: "Too many requests"}, apiErrorRetryable},
+		{"retries exhausted", &linodego.Error{Code: linodego.ErrorFromError, Message: "GET /nodebalancers: " + retriesExhaustedMessage + " (5): 503"}, apiErrorRetryable},
+		{"limit reached", &linodego.Error{Code: http.StatusBadRequest, Message: "NodeBalancer limit reached. Please open a support ticket."}, apiErrorQuotaExceeded},
+		{"account limit exceeded", &linodego.Error{Code: http.StatusForbidden, Message: "Account Limit Exceeded"}, apiErrorQuotaExceeded},
+		{"other bad request", &linodego.Error{Code: http.StatusBadRequest, Message: "[region] region is not valid"}, apiErrorUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if kind := classifyAPIError(tc.err); kind != tc.expected {
+				t.Errorf("expected kind %d, got %d", tc.expected, kind)
+			}
+		})
+	}
+}
+
+func TestEnsureLoadBalancerQuotaExceeded(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/nodebalancers" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "NodeBalancer limit reached. Please open a support ticket."}]}`))
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	Options.LoadBalancerMaxBackoff = time.Minute
+	defer func() { Options.LoadBalancerMaxBackoff = 0 }()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil); classifyAPIError(err) != apiErrorQuotaExceeded {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodeBalancerQuotaExceeded") || !strings.Contains(event, "support ticket") {
+		t.Errorf("expected NodeBalancerQuotaExceeded event, got %q", event)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "ReconcileBackoff") || !strings.Contains(event, "1m0s") {
+		t.Errorf("expected ReconcileBackoff event for the maximum delay, got %q", event)
+	}
+}
@@ -0,0 +1,279 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	servicecontroller "k8s.io/kubernetes/pkg/controller/service"
+)
+
+// ErrOrphanedNodeBalancers is returned by Audit when NodeBalancers of the cluster are no longer
+// owned by any LoadBalancer Service.
+var ErrOrphanedNodeBalancers = errors.New("found orphaned NodeBalancers")
+
+// auditReport is the result of an audit of the NodeBalancers created for the cluster. Each of
+// them is in exactly one of the lists.
+type auditReport struct {
+	// Matched are the NodeBalancers matching the Services owning their ports.
+	Matched []auditNodeBalancer `json:"matched"`
+	// Drifted are the NodeBalancers whose Services would change them when reconciled.
+	Drifted []auditNodeBalancer `json:"drifted"`
+	// Orphaned are the NodeBalancers none of whose ports are owned by a LoadBalancer Service.
+	Orphaned []auditNodeBalancer `json:"orphaned"`
+}
+
+type auditNodeBalancer struct {
+	ID       int            `json:"id"`
+	Label    string         `json:"label"`
+	Region   string         `json:"region"`
+	Services []string       `json:"services,omitempty"`
+	Changes  []dryRunChange `json:"changes,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// Audit reports the NodeBalancers created for the cluster that match their LoadBalancer Services,
+// that have drifted from them, or that are orphaned, in every Linode account of the cloud config.
+// It only reads from the Linode and Kubernetes APIs: drift is found by reconciling the Services
+// with dry-run NodeBalancer changes, which are collected instead of logged. The report is written
+// to out as a table, or as JSON if jsonOutput is set. ErrOrphanedNodeBalancers is returned once
+// the report is written if it lists orphaned NodeBalancers.
+func Audit(ctx context.Context, cloudConfig io.Reader, out io.Writer, jsonOutput bool) error {
+	clusterTag := getClusterTag()
+	if clusterTag == "" {
+		return fmt.Errorf("--cluster-name is required to find the NodeBalancers of the cluster")
+	}
+
+	cloud, err := newCloud(cloudConfig)
+	if err != nil {
+		return err
+	}
+	lb := cloud.(*linodeCloud).loadbalancers.(*loadbalancers)
+	if err = lb.retrieveKubeClient(); err != nil {
+		return err
+	}
+
+	report, err := audit(ctx, lb, clusterTag)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.print(out)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(report.Orphaned) > 0 {
+		return ErrOrphanedNodeBalancers
+	}
+	return nil
+}
+
+func audit(ctx context.Context, lb *loadbalancers, clusterTag string) (*auditReport, error) {
+	services, err := listLoadBalancerServices(lb.kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	servicesByUID := make(map[string]*v1.Service, len(services))
+	serviceUIDs := make(map[string]bool, len(services))
+	for _, service := range services {
+		servicesByUID[string(service.UID)] = service
+		serviceUIDs[string(service.UID)] = true
+	}
+
+	nodes, err := listLoadBalancerNodes(lb.kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &auditReport{Matched: []auditNodeBalancer{}, Drifted: []auditNodeBalancer{}, Orphaned: []auditNodeBalancer{}}
+	gc := &nodeBalancerGC{clusterTag: clusterTag}
+	for _, account := range append([]*loadbalancers{lb}, lb.accountLoadBalancers()...) {
+		account.kubeClient = lb.kubeClient
+		nbs, err := account.client.ListNodeBalancers(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range nbs {
+			nb := &nbs[i]
+			if !containsString(nb.Tags, clusterTag) {
+				continue
+			}
+
+			entry := auditNodeBalancer{ID: nb.ID, Region: nb.Region}
+			if nb.Label != nil {
+				entry.Label = *nb.Label
+			}
+			// Retained NodeBalancers are orphaned, but never garbage-collected.
+			if gc.isOrphaned(nb, serviceUIDs) || containsString(nb.Tags, retainedTag) {
+				report.Orphaned = append(report.Orphaned, entry)
+				continue
+			}
+
+			owners := getPortOwners(nb)
+			for _, uid := range sortedOwners(owners) {
+				service, ok := servicesByUID[uid]
+				if !ok {
+					continue
+				}
+				entry.Services = append(entry.Services, getServiceNn(service))
+
+				changes, err := account.diffNodeBalancer(ctx, service, nodes, nb)
+				if err != nil {
+					entry.Error = fmt.Sprintf("service (%s): %v", getServiceNn(service), err)
+				}
+				entry.Changes = append(entry.Changes, changes...)
+			}
+
+			if len(entry.Changes) > 0 || entry.Error != "" {
+				report.Drifted = append(report.Drifted, entry)
+			} else {
+				report.Matched = append(report.Matched, entry)
+			}
+		}
+	}
+	return report, nil
+}
+
+// diffNodeBalancer returns the changes reconciling service would make to nb.
+func (l *loadbalancers) diffNodeBalancer(ctx context.Context, service *v1.Service, nodes []*v1.Node, nb *linodego.NodeBalancer) ([]dryRunChange, error) {
+	var changes []dryRunChange
+	dryRun := &loadbalancers{
+		client:     l.client,
+		zone:       l.zone,
+		kubeClient: l.kubeClient,
+		dryRun:     true,
+		defaults:   l.defaults,
+		onDryRun:   func(change dryRunChange) { changes = append(changes, change) },
+	}
+
+	// The NodeBalancer is copied as dry-run updates return modified copies of it.
+	current := *nb
+	err := dryRun.updateNodeBalancer(ctx, service, nodes, &current)
+	return changes, err
+}
+
+// sortedOwners returns the UIDs of the owners of the ports of a NodeBalancer, once each.
+func sortedOwners(owners map[int]string) []string {
+	seen := make(map[string]bool, len(owners))
+	uids := make([]string, 0, len(owners))
+	for _, uid := range owners {
+		if !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+	sort.Strings(uids)
+	return uids
+}
+
+func listLoadBalancerServices(kubeClient kubernetes.Interface) ([]*v1.Service, error) {
+	list, err := kubeClient.CoreV1().Services("").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var services []*v1.Service
+	for i := range list.Items {
+		if list.Items[i].Spec.Type == v1.ServiceTypeLoadBalancer {
+			services = append(services, &list.Items[i])
+		}
+	}
+	return services, nil
+}
+
+// listLoadBalancerNodes returns the nodes the service controller passes to the CCM as the
+// backends of LoadBalancer Services.
+func listLoadBalancerNodes(kubeClient kubernetes.Interface) ([]*v1.Node, error) {
+	list, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*v1.Node
+	for i := range list.Items {
+		if isLoadBalancerNode(&list.Items[i]) {
+			nodes = append(nodes, &list.Items[i])
+		}
+	}
+	return nodes, nil
+}
+
+// isLoadBalancerNode reports whether node is schedulable, ready and not excluded from load
+// balancers, like the node predicate of the service controller.
+func isLoadBalancerNode(node *v1.Node) bool {
+	if !isLoadBalancerCandidate(node) {
+		return false
+	}
+
+	ready := false
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			ready = condition.Status == v1.ConditionTrue
+		}
+	}
+	return ready
+}
+
+// isLoadBalancerCandidate reports whether node is schedulable and not excluded from load
+// balancers, i.e. whether the service controller passes it to the CCM whenever it is ready.
+func isLoadBalancerCandidate(node *v1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	if _, ok := node.Labels[servicecontroller.LabelNodeRoleMaster]; ok {
+		return false
+	}
+	_, excluded := node.Labels[servicecontroller.LabelNodeRoleExcludeBalancer]
+	return !excluded
+}
+
+func (r *auditReport) print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tNODEBALANCER\tLABEL\tREGION\tSERVICES\tDRIFT")
+	for _, section := range []struct {
+		status string
+		nbs    []auditNodeBalancer
+	}{
+		{"matched", r.Matched},
+		{"drifted", r.Drifted},
+		{"orphaned", r.Orphaned},
+	} {
+		for _, nb := range section.nbs {
+			drift := make([]string, 0, len(nb.Changes)+1)
+			for _, change := range nb.Changes {
+				drift = append(drift, change.Action)
+			}
+			if nb.Error != "" {
+				drift = append(drift, "error: "+nb.Error)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", section.status, nb.ID, nb.Label, nb.Region,
+				orNone(strings.Join(nb.Services, ",")), orNone(strings.Join(drift, ", ")))
+		}
+	}
+	fmt.Fprintf(w, "\n%d matched, %d drifted, %d orphaned\n", len(r.Matched), len(r.Drifted), len(r.Orphaned))
+	return w.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package linode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAudit(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "test", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+	clusterTag := getClusterTag()
+
+	kubeClient := fake.NewSimpleClientset()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: v1.NodeStatus{
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+	if _, err := kubeClient.CoreV1().Nodes().Create(node); err != nil {
+		t.Fatal(err)
+	}
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "web-uid"},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: kubeClient}
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "test", service, []*v1.Node{node})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	// The Service is changed after its NodeBalancer was reconciled.
+	service.Status.LoadBalancer = *lbStatus
+	service.Annotations = map[string]string{annLinodeThrottle: "5"}
+	if _, err = kubeClient.CoreV1().Services("default").Create(service); err != nil {
+		t.Fatal(err)
+	}
+
+	orphaned, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Region: "us-west",
+		Tags:   []string{clusterTag, "ccm:80:deleted-uid"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+	if _, err = client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Region: "us-west",
+		Tags:   []string{clusterTagPrefix + "other", "ccm:80:deleted-uid"},
+	}); err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+
+	fakeAPI.mu.Lock()
+	fakeAPI.requests = make(map[fakeRequest]struct{})
+	fakeAPI.mu.Unlock()
+
+	report, err := audit(context.TODO(), lb, clusterTag)
+	if err != nil {
+		t.Fatalf("audit returned an error: %s", err)
+	}
+
+	for request := range fakeAPI.requests {
+		if request.Method != http.MethodGet {
+			t.Errorf("expected the audit to be read-only, got %s %s", request.Method, request.Path)
+		}
+	}
+
+	if len(report.Matched) != 0 {
+		t.Errorf("expected no matched NodeBalancer, got %+v", report.Matched)
+	}
+	if len(report.Orphaned) != 1 || report.Orphaned[0].ID != orphaned.ID {
+		t.Errorf("expected NodeBalancer (%d) to be orphaned, got %+v", orphaned.ID, report.Orphaned)
+	}
+	if len(report.Drifted) != 1 {
+		t.Fatalf("expected a drifted NodeBalancer, got %+v", report.Drifted)
+	}
+	drifted := report.Drifted[0]
+	if len(drifted.Services) != 1 || drifted.Services[0] != "default/web" {
+		t.Errorf("expected the drifted NodeBalancer to be owned by default/web, got %v", drifted.Services)
+	}
+	if len(drifted.Changes) != 1 || drifted.Changes[0].Action != "update-nodebalancer" {
+		t.Errorf("expected the throttle to be updated, got %+v", drifted.Changes)
+	}
+
+	var out bytes.Buffer
+	if err = report.print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "0 matched, 1 drifted, 1 orphaned") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+
+	raw, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string][]map[string]interface{}
+	if err = json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded["matched"]) != 0 || len(decoded["drifted"]) != 1 || len(decoded["orphaned"]) != 1 {
+		t.Errorf("unexpected JSON report %s", raw)
+	}
+
+	// Once the Service is reconciled, its NodeBalancer matches it.
+	service, _ = kubeClient.CoreV1().Services("default").Get("web", metav1.GetOptions{})
+	if err = lb.UpdateLoadBalancer(context.TODO(), "test", service, []*v1.Node{node}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if report, err = audit(context.TODO(), lb, clusterTag); err != nil {
+		t.Fatalf("audit returned an error: %s", err)
+	}
+	if len(report.Matched) != 1 || len(report.Drifted) != 0 {
+		t.Errorf("expected the NodeBalancer to match its Service, got %+v", report)
+	}
+}
@@ -0,0 +1,74 @@
+package linode
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reconcileBackoffBaseDelay is how long EnsureLoadBalancer is held off after the first failure
+// for a Service; the delay doubles with every consecutive failure.
+const reconcileBackoffBaseDelay = 5 * time.Second
+
+type reconcileFailure struct {
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// reconcileBackoff records the consecutive EnsureLoadBalancer failures of each Service so that a
+// Service failing persistently, e.g. because of an exhausted quota, is retried with exponential
+// backoff instead of consuming the API budget of the whole cluster.
+type reconcileBackoff struct {
+	mu       sync.Mutex
+	failures map[types.UID]reconcileFailure
+}
+
+// remaining returns how long reconciling the Service uid is still held off for, along with the
+// error that caused the backoff.
+func (b *reconcileBackoff) remaining(uid types.UID, now time.Time) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failure, ok := b.failures[uid]
+	if !ok || !now.Before(failure.retryAt) {
+		return 0, nil
+	}
+	return failure.retryAt.Sub(now), failure.lastErr
+}
+
+// failed records that reconciling the Service uid failed with err and returns how long the next
+// attempt is held off for, which is between minDelay and maxDelay.
+func (b *reconcileBackoff) failed(uid types.UID, err error, now time.Time, minDelay, maxDelay time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures == nil {
+		b.failures = make(map[types.UID]reconcileFailure)
+	}
+
+	failure := b.failures[uid]
+	delay := reconcileBackoffBaseDelay << uint(failure.failures)
+	if delay < minDelay {
+		delay = minDelay
+	}
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+
+	b.failures[uid] = reconcileFailure{
+		failures: failure.failures + 1,
+		retryAt:  now.Add(delay),
+		lastErr:  err,
+	}
+	return delay
+}
+
+// reset forgets the failures of the Service uid.
+func (b *reconcileBackoff) reset(uid types.UID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, uid)
+}
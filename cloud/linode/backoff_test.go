@@ -0,0 +1,107 @@
+package linode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReconcileBackoff(t *testing.T) {
+	var backoff reconcileBackoff
+	now := time.Unix(1000, 0)
+	quotaErr := errors.New("quota exceeded")
+
+	if wait, _ := backoff.remaining("uid", now); wait != 0 {
+		t.Errorf("expected no backoff before any failure, got %s", wait)
+	}
+
+	for _, expected := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if delay := backoff.failed("uid", quotaErr, now, 0, 30*time.Second); delay != expected {
+			t.Errorf("expected delay %s, got %s", expected, delay)
+		}
+	}
+
+	wait, err := backoff.remaining("uid", now.Add(10*time.Second))
+	if wait != 20*time.Second || err != quotaErr {
+		t.Errorf("expected 20s of backoff after %v, got %s after %v", quotaErr, wait, err)
+	}
+	if wait, _ := backoff.remaining("other-uid", now); wait != 0 {
+		t.Errorf("expected other services not to be backed off, got %s", wait)
+	}
+	if wait, _ := backoff.remaining("uid", now.Add(30*time.Second)); wait != 0 {
+		t.Errorf("expected backoff to have expired, got %s", wait)
+	}
+
+	backoff.reset("uid")
+	if delay := backoff.failed("uid", quotaErr, now, 0, 30*time.Second); delay != 5*time.Second {
+		t.Errorf("expected backoff to restart after a reset, got %s", delay)
+	}
+}
+
+func TestEnsureLoadBalancerBackoff(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	Options.LoadBalancerMaxBackoff = time.Minute
+	defer func() { Options.LoadBalancerMaxBackoff = 0 }()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeRegion: "mars-north"},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil); err == nil {
+		t.Fatal("expected EnsureLoadBalancer to fail for an unknown region")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidRegion") {
+		t.Errorf("expected InvalidRegion event, got %q", event)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "ReconcileBackoff") {
+		t.Errorf("expected ReconcileBackoff event, got %q", event)
+	}
+
+	_, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err == nil || !strings.Contains(err.Error(), "backing off") {
+		t.Errorf("expected EnsureLoadBalancer to back off, got %v", err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event while backing off, got %q", <-recorder.Events)
+	}
+
+	lb.backoff.reset(svc.UID)
+	delete(svc.Annotations, annLinodeRegion)
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	if wait, _ := lb.backoff.remaining(svc.UID, time.Now()); wait != 0 {
+		t.Errorf("expected no backoff after a success, got %s", wait)
+	}
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+}
@@ -3,11 +3,19 @@ package linode
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/linode/linodego"
 	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
 	"k8s.io/kubernetes/pkg/cloudprovider"
 	"k8s.io/kubernetes/pkg/controller"
 )
@@ -23,30 +31,177 @@ const (
 // We expect it to be initialized with flags external to this package, likely in
 // main.go
 var Options struct {
-	KubeconfigFlag *pflag.Flag
-	LinodeGoDebug  bool
+	KubeconfigFlag      *pflag.Flag
+	ClusterNameFlag     *pflag.Flag
+	LinodeGoDebug       bool
+	LinodeAPIMaxRetries int
+	LinodeAPITimeout    time.Duration
+	BackendIPv4Range    string
+	DryRun              bool
+	InstanceCacheTTL    time.Duration
+
+	// RetainOnNamespaceDelete keeps the NodeBalancers of the Services deleted along with their
+	// namespace, tagged for manual review, instead of deleting them.
+	RetainOnNamespaceDelete bool
+
+	// UseMetadataService reads the ID, region and type of the Linode the CCM runs on from the
+	// Linode metadata service instead of the API, falling back to the API when it is unreachable.
+	UseMetadataService bool
+
+	// ExcludeNodeLabel is a label selector of the nodes never used as NodeBalancer backends,
+	// e.g. the nodes of GPU or spot pools. Services may override it with their
+	// exclude-node-label annotation.
+	ExcludeNodeLabel string
+
+	// ReconcileStatus records the outcome of the last reconcile of each LoadBalancer Service in
+	// its reconcile-status annotation.
+	ReconcileStatus bool
+
+	// ForceDeletePaused deletes the NodeBalancers of paused Services when they are deleted
+	// instead of failing the deletion until they are resumed.
+	ForceDeletePaused bool
+
+	// DisableNodeBalancerCreation restricts Services to the existing NodeBalancers they reference
+	// by ID instead of creating NodeBalancers for them.
+	DisableNodeBalancerCreation bool
+
+	// NodeBalancerNodeConcurrency is the number of NodeBalancer node requests made at once when
+	// syncing the backends of a NodeBalancer config.
+	NodeBalancerNodeConcurrency int
+
+	// NodeBalancerNodeFailureThreshold is the percentage of the nodes of a NodeBalancer config
+	// failing to sync from which the reconcile of the Service fails. Fewer failures are reported
+	// as events; 0 fails the reconcile on any failure.
+	NodeBalancerNodeFailureThreshold int
+
+	// LoadBalancerMaxBackoff caps the exponential backoff applied to EnsureLoadBalancer for a
+	// Service failing repeatedly; 0 disables the backoff.
+	LoadBalancerMaxBackoff time.Duration
+
+	// NodePortRange is the range of ports the NodeBalancer nodes of a Service port may be made to
+	// target instead of its NodePort. It defaults to 30000-32767.
+	NodePortRange utilnet.PortRange
+
+	// NodeBalancerIPTimeout is how long EnsureLoadBalancer waits for a NodeBalancer to be
+	// assigned an IPv4 address; 0 disables the wait.
+	NodeBalancerIPTimeout time.Duration
+
+	// WaitForBackendsStrict fails the reconcile of the Services whose NodeBalancer backends aren't
+	// UP within the timeout of their wait-for-backends annotation, instead of only recording an
+	// event.
+	WaitForBackendsStrict bool
+
+	// ConfigDrainGracePeriod is how long the nodes of the NodeBalancer config of a port removed
+	// from a Service are drained before the config is deleted; 0 deletes it immediately.
+	ConfigDrainGracePeriod time.Duration
+
+	// NodeBalancerGCInterval is how often orphaned NodeBalancers are garbage-collected; 0
+	// disables the garbage collection.
+	NodeBalancerGCInterval time.Duration
+
+	// NodeBalancerResyncPeriod is how often the NodeBalancers of all LoadBalancer Services are
+	// reconciled, correcting changes made to them outside of the CCM; 0 disables the resync.
+	NodeBalancerResyncPeriod time.Duration
+
+	// NodeBalancerResyncMaxPerMinute is how many Services are reconciled per minute at most by a
+	// resync, capping the load it puts on the Linode API.
+	NodeBalancerResyncMaxPerMinute int
+
+	// NodeBalancerStatsInterval is how often the transfer of the NodeBalancers of this cluster is
+	// exported as metrics; 0 disables the metrics.
+	NodeBalancerStatsInterval time.Duration
+
+	// MaintenanceGracePeriod is how long after Linode starts maintenance on an instance, e.g. a
+	// host reboot or migration, the instance being offline isn't reported as a shutdown; 0
+	// disables the grace period.
+	MaintenanceGracePeriod time.Duration
+
+	// TokenFile is the path of a file holding the Linode API token, e.g. a key of a mounted
+	// Secret, used instead of the LINODE_API_TOKEN environment variable. The file is reloaded
+	// when it changes.
+	TokenFile string
+
+	// TLSExpiryWarningDays is how many days before the certificate of an https NodeBalancer
+	// config expires a warning event is recorded on its Service; 0 disables the check.
+	TLSExpiryWarningDays int
+
+	// ManageDNSRecords creates, updates and deletes the Linode DNS records requested by the
+	// dns-record annotation of Services. Otherwise the records are only compared with the
+	// addresses of the NodeBalancers.
+	ManageDNSRecords bool
+
+	// LogFormat is the format of the logs of the reconcile paths, text (the klog format) or json.
+	LogFormat string
+
+	// TokenSecretNamespaces are the namespaces whose Services may have their NodeBalancers managed
+	// with the token of a Secret of their namespace referenced by their token-secret annotation,
+	// or "*" for all namespaces.
+	TokenSecretNamespaces []string
+
+	// SkipStartupValidation skips checking on startup that the cloud config has no unknown keys
+	// and that the Linode API accepts the tokens and regions, e.g. for offline testing.
+	SkipStartupValidation bool
+
+	// EmptyBackendPolicy is what the reconcile of a Service with no nodes eligible as backends
+	// does to its NodeBalancer: keep-last keeps the current backends, remove-all removes them and
+	// fail fails the reconcile. It defaults to keep-last.
+	EmptyBackendPolicy string
 }
 
 type linodeCloud struct {
 	client        *linodego.Client
+	tokenFile     *tokenFile
+	accounts      []*account
 	instances     cloudprovider.Instances
 	zones         cloudprovider.Zones
 	loadbalancers cloudprovider.LoadBalancer
 }
 
+// account is one of the other Linode accounts of the cloud config.
+type account struct {
+	name      string
+	client    *linodego.Client
+	tokenFile *tokenFile
+
+	// loadbalancers manages the NodeBalancers of the regions of the account, and is nil if it
+	// has none.
+	loadbalancers *loadbalancers
+}
+
 func init() {
 	cloudprovider.RegisterCloudProvider(
 		ProviderName,
-		func(io.Reader) (cloudprovider.Interface, error) {
-			return newCloud()
+		func(config io.Reader) (cloudprovider.Interface, error) {
+			return newCloud(config)
 		})
 }
 
-func newCloud() (cloudprovider.Interface, error) {
+func newCloud(configReader io.Reader) (cloudprovider.Interface, error) {
+	if err := validateLogFormat(Options.LogFormat); err != nil {
+		return nil, err
+	}
+	if threshold := Options.NodeBalancerNodeFailureThreshold; threshold < 0 || threshold > 100 {
+		return nil, fmt.Errorf("invalid --nodebalancer-node-failure-threshold %d: must be a percentage between 0 and 100", threshold)
+	}
+	if err := validateEmptyBackendPolicy(Options.EmptyBackendPolicy); err != nil {
+		return nil, err
+	}
+
+	// Fail before anything is reconciled if the defaults of the cloud config are malformed
+	config, err := readCloudConfig(configReader)
+	if err != nil {
+		return nil, err
+	}
+
 	// Read environment variables (from secrets)
+	var token *tokenFile
 	apiToken := os.Getenv(accessTokenEnv)
-	if apiToken == "" {
-		return nil, fmt.Errorf("%s must be set in the environment (use a k8s secret)", accessTokenEnv)
+	if Options.TokenFile != "" {
+		if token, err = newTokenFile(Options.TokenFile); err != nil {
+			return nil, err
+		}
+	} else if apiToken == "" {
+		return nil, fmt.Errorf("%s must be set in the environment (use a k8s secret) or --linode-token-file given", accessTokenEnv)
 	}
 
 	region := os.Getenv(regionEnv)
@@ -54,33 +209,169 @@ func newCloud() (cloudprovider.Interface, error) {
 		return nil, fmt.Errorf("%s must be set in the environment (use a k8s secret)", regionEnv)
 	}
 
-	linodeClient := linodego.NewClient(nil)
-	linodeClient.SetToken(apiToken)
-	if Options.LinodeGoDebug {
-		linodeClient.SetDebug(true)
+	linodeClient := newLinodeClient(token, apiToken)
+	lb := newLoadbalancers(linodeClient, region, config.LoadBalancer).(*loadbalancers)
+	lb.tokenSecrets = newTokenSecretAccounts()
+
+	// The default NodeBalancer is in the account of LINODE_API_TOKEN.
+	accountDefaults := config.LoadBalancer
+	accountDefaults.DefaultNodeBalancerID = 0
+
+	accounts := make([]*account, 0, len(config.Accounts))
+	accountClients := make([]*linodego.Client, 0, len(config.Accounts))
+	for _, accountConfig := range config.Accounts {
+		accountToken, err := newTokenFile(accountConfig.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", accountConfig.Name, err)
+		}
+		account := &account{name: accountConfig.Name, client: newLinodeClient(accountToken, ""), tokenFile: accountToken}
+
+		for _, accountRegion := range accountConfig.Regions {
+			if accountRegion == region {
+				return nil, fmt.Errorf("account %s: region %s is the region of %s, whose NodeBalancers are managed with %s", account.name, region, regionEnv, accessTokenEnv)
+			}
+			if account.loadbalancers == nil {
+				account.loadbalancers = newLoadbalancers(account.client, accountRegion, accountDefaults).(*loadbalancers)
+			}
+			if lb.accounts == nil {
+				lb.accounts = make(map[string]*loadbalancers)
+			}
+			lb.accounts[accountRegion] = account.loadbalancers
+		}
+
+		accounts = append(accounts, account)
+		accountClients = append(accountClients, account.client)
+	}
+
+	if !Options.SkipStartupValidation {
+		checks := []startupCheck{{name: accessTokenEnv, client: linodeClient, regions: []string{region}, regionsFrom: regionEnv}}
+		if token != nil {
+			checks[0].name = "--linode-token-file"
+			apiToken = ""
+		}
+		for i, account := range accounts {
+			name := "account " + account.name
+			checks = append(checks, startupCheck{name: name, client: account.client, regions: config.Accounts[i].Regions, regionsFrom: name})
+		}
+		if err = validateStartup(apiToken, checks); err != nil {
+			return nil, err
+		}
 	}
-	linodeClient.SetUserAgent(fmt.Sprintf("linode-cloud-controller-manager %s", linodego.DefaultUserAgent))
 
 	// Return struct that satisfies cloudprovider.Interface
 	return &linodeCloud{
-		client:        &linodeClient,
-		instances:     newInstances(&linodeClient),
-		zones:         newZones(&linodeClient, region),
-		loadbalancers: newLoadbalancers(&linodeClient, region),
+		client:        linodeClient,
+		tokenFile:     token,
+		accounts:      accounts,
+		instances:     newInstances(linodeClient, accountClients...),
+		zones:         newZones(linodeClient, region, accountClients...),
+		loadbalancers: lb,
 	}, nil
 }
 
+// newLinodeClient returns a Linode API client authenticated with the token of tokenFile, or with
+// apiToken if tokenFile is nil.
+func newLinodeClient(tokenFile *tokenFile, apiToken string) *linodego.Client {
+	var token func() string
+	if tokenFile != nil {
+		token = tokenFile.Token
+	}
+	return newLinodeClientWithToken(token, apiToken)
+}
+
+// newLinodeClientWithToken returns a Linode API client authenticated with the token returned by
+// token for each request, or with apiToken if token is nil.
+func newLinodeClientWithToken(token func() string, apiToken string) *linodego.Client {
+	transport := http.DefaultTransport
+	if token != nil {
+		// The token is set on every request, including retries, so that it can be rotated
+		transport = tokenTransport{next: transport, token: token}
+	}
+	linodeClient := linodego.NewClient(&http.Client{
+		Transport: newRetryTransport(metricsTransport{next: transport}, Options.LinodeAPIMaxRetries, Options.LinodeAPITimeout),
+	})
+	if token == nil {
+		linodeClient.SetToken(apiToken)
+	}
+	if Options.LinodeGoDebug {
+		linodeClient.SetDebug(true)
+	}
+	linodeClient.SetUserAgent(fmt.Sprintf("linode-cloud-controller-manager %s", linodego.DefaultUserAgent))
+	return &linodeClient
+}
+
 func (c *linodeCloud) Initialize(clientBuilder controller.ControllerClientBuilder) {
 	kubeclient := clientBuilder.ClientOrDie("linode-shared-informers")
 	sharedInformer := informers.NewSharedInformerFactory(kubeclient, 0)
 	serviceInformer := sharedInformer.Core().V1().Services()
+	nodeInformer := sharedInformer.Core().V1().Nodes()
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: kubeclient.CoreV1().Events("")})
+
+	lb := c.loadbalancers.(*loadbalancers)
+	lb.recorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "linode-cloud-controller-manager"})
 
-	serviceController := newServiceController(c.loadbalancers.(*loadbalancers), serviceInformer)
+	lb.nodes = nodeInformer.Lister()
+
+	for _, account := range lb.accountLoadBalancers() {
+		account.recorder = lb.recorder
+		account.nodes = lb.nodes
+	}
+
+	serviceController := newServiceController(lb, serviceInformer)
 
 	// in future version of the cloudprovider package, we should use the stopCh provided to
 	// (cloudprovider.Interface).Initialize instead
 	forever := make(chan struct{})
 	go serviceController.Run(forever)
+	go nodeInformer.Informer().Run(forever)
+
+	if c.tokenFile != nil {
+		go c.tokenFile.Run(tokenFilePollInterval, forever)
+	}
+	for _, account := range c.accounts {
+		go account.tokenFile.Run(tokenFilePollInterval, forever)
+	}
+
+	if canWatchSecrets(kubeclient) {
+		secretInformer := sharedInformer.Core().V1().Secrets()
+		tlsSecretController := newTLSSecretController(lb, serviceInformer.Informer(), secretInformer.Informer())
+		go tlsSecretController.Run(forever)
+	}
+
+	if lb.defaults.TagsConfigMap != "" {
+		defaultTagsController := newDefaultTagsController(lb, serviceInformer.Informer(), kubeclient, lb.defaults.TagsConfigMap)
+		go defaultTagsController.Run(forever)
+	}
+
+	if Options.NodeBalancerGCInterval > 0 {
+		if clusterTag, err := getGCClusterTag(); err != nil {
+			klog.Errorf("NodeBalancer GC disabled: %s", err)
+		} else {
+			// The NodeBalancers of each account are garbage-collected on their own
+			for _, accountLB := range append([]*loadbalancers{lb}, lb.accountLoadBalancers()...) {
+				gc := newNodeBalancerGC(accountLB, serviceInformer.Informer(), clusterTag)
+				go gc.Run(Options.NodeBalancerGCInterval, forever)
+			}
+		}
+	}
+
+	if Options.NodeBalancerResyncPeriod > 0 && Options.NodeBalancerResyncMaxPerMinute > 0 {
+		resyncer := newNodeBalancerResyncer(lb, kubeclient, serviceInformer.Informer(), Options.NodeBalancerResyncMaxPerMinute)
+		go resyncer.Run(Options.NodeBalancerResyncPeriod, forever)
+	}
+
+	if clusterTag := getClusterTag(); Options.NodeBalancerStatsInterval > 0 && clusterTag != "" {
+		poller := newNodeBalancerStatsPoller(lb, serviceInformer.Informer(), clusterTag)
+		go poller.Run(Options.NodeBalancerStatsInterval, forever)
+	}
+
+	if clusterTag := getClusterTag(); Options.TLSExpiryWarningDays > 0 && clusterTag != "" {
+		window := time.Duration(Options.TLSExpiryWarningDays) * 24 * time.Hour
+		checker := newTLSExpiryChecker(lb, serviceInformer.Informer(), clusterTag, window)
+		go checker.Run(tlsExpiryCheckInterval, forever)
+	}
 }
 
 func (c *linodeCloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
@@ -99,6 +390,9 @@ func (c *linodeCloud) Clusters() (cloudprovider.Clusters, bool) {
 	return nil, false
 }
 
+// Routes isn't supported: the Linode API client the CCM is built with has no VPC endpoints to
+// program pod CIDR routes with, so --configure-cloud-routes must stay disabled and pod traffic
+// needs the CNI's own routing or encapsulation.
 func (c *linodeCloud) Routes() (cloudprovider.Routes, bool) {
 	return nil, false
 }
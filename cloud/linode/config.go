@@ -0,0 +1,213 @@
+package linode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/linode/linodego"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// cloudConfig is the YAML or JSON configuration of the file passed to --cloud-config, e.g.
+//
+//	loadbalancer:
+//	  check-type: http
+//	  check-path: /healthz
+//	accounts:
+//	- name: secondary
+//	  token-file: /etc/linode/secondary/apiToken
+//	  regions: [eu-west]
+type cloudConfig struct {
+	LoadBalancer loadBalancerConfig `json:"loadbalancer"`
+	Accounts     []accountConfig    `json:"accounts"`
+}
+
+// accountConfig is a Linode account besides the one of LINODE_API_TOKEN that nodes of the
+// cluster run in. Nodes are looked up in every account, while the NodeBalancers of Services in
+// one of its regions are created in the account.
+type accountConfig struct {
+	Name      string   `json:"name"`
+	TokenFile string   `json:"token-file"`
+	Regions   []string `json:"regions"`
+}
+
+// loadBalancerConfig holds the cluster-wide defaults of the NodeBalancer settings, which the
+// annotations of each Service take precedence over. Unset fields keep the built-in defaults.
+type loadBalancerConfig struct {
+	CheckType     linodego.ConfigCheck `json:"check-type"`
+	CheckPath     string               `json:"check-path"`
+	CheckInterval int                  `json:"check-interval"`
+	CheckTimeout  int                  `json:"check-timeout"`
+	CheckAttempts int                  `json:"check-attempts"`
+
+	// BackendIPType is the kind of node address NodeBalancer backends use. Unset, the InternalIP
+	// of each node is used, or its address in the backend IPv4 range if one is set.
+	BackendIPType nodeBackendIPType `json:"backend-ip-type"`
+
+	// TagsConfigMap is the namespace/name of a ConfigMap whose entries are tagged on every
+	// NodeBalancer, as key:value or as key alone if the value is empty.
+	TagsConfigMap string `json:"tags-configmap"`
+
+	// DefaultNodeBalancerID is the ID of an existing NodeBalancer shared by the Services without a
+	// NodeBalancer of their own, as if they referenced it with annLinodeNodeBalancerID.
+	DefaultNodeBalancerID int `json:"default-nodebalancer-id"`
+
+	// NodeBalancerLabelTemplate is a text/template generating the labels of the NodeBalancers
+	// of the Services without a label annotation, executed with nodeBalancerLabelData.
+	NodeBalancerLabelTemplate string `json:"nodebalancer-label-template"`
+}
+
+// nodeBackendIPType is a kind of node address NodeBalancer backends can use.
+type nodeBackendIPType string
+
+const (
+	// backendIPTypePrivate uses the Linode private IP of each node.
+	backendIPTypePrivate nodeBackendIPType = "private"
+	// backendIPTypePublic uses the public IPv4 address of each node, its ExternalIP.
+	backendIPTypePublic nodeBackendIPType = "public"
+	// backendIPTypeVPC uses the InternalIP of each node within the backend IPv4 range, without
+	// falling back to its private IP.
+	backendIPTypeVPC nodeBackendIPType = "vpc"
+)
+
+// readCloudConfig parses and validates the cloud config read from r, which is nil when no
+// --cloud-config is given. Unknown keys, e.g. misspelled ones, are rejected unless
+// Options.SkipStartupValidation is set.
+func readCloudConfig(r io.Reader) (cloudConfig, error) {
+	var config cloudConfig
+	if r == nil {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return config, fmt.Errorf("failed to read the cloud config: %v", err)
+	}
+	if data, err = yaml.ToJSON(data); err != nil {
+		return config, fmt.Errorf("failed to parse the cloud config: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if !Options.SkipStartupValidation {
+		decoder.DisallowUnknownFields()
+	}
+	if err = decoder.Decode(&config); err != nil && err != io.EOF {
+		return config, fmt.Errorf("failed to parse the cloud config: %v", err)
+	}
+	if err := config.LoadBalancer.validate(); err != nil {
+		return config, fmt.Errorf("invalid loadbalancer section of the cloud config: %v", err)
+	}
+	if err := validateAccounts(config.Accounts); err != nil {
+		return config, fmt.Errorf("invalid accounts section of the cloud config: %v", err)
+	}
+	return config, nil
+}
+
+func validateAccounts(accounts []accountConfig) error {
+	names := make(map[string]bool, len(accounts))
+	regions := make(map[string]string)
+	for _, account := range accounts {
+		if account.Name == "" {
+			return fmt.Errorf("accounts must have a name")
+		}
+		if names[account.Name] {
+			return fmt.Errorf("duplicate account %s", account.Name)
+		}
+		names[account.Name] = true
+
+		if account.TokenFile == "" {
+			return fmt.Errorf("account %s has no token-file", account.Name)
+		}
+		for _, region := range account.Regions {
+			if other, ok := regions[region]; ok {
+				return fmt.Errorf("region %s is assigned to both accounts %s and %s", region, other, account.Name)
+			}
+			regions[region] = account.Name
+		}
+	}
+	return nil
+}
+
+func (c loadBalancerConfig) validate() error {
+	switch c.CheckType {
+	case "", linodego.CheckNone, linodego.CheckConnection, linodego.CheckHTTP:
+	case linodego.CheckHTTPBody:
+		return fmt.Errorf("check-type %s requires the body regex of each Service's %q annotation and can't be a default", c.CheckType, annLinodeCheckBody)
+	default:
+		return fmt.Errorf("invalid check-type %q: must be one of none, connection or http", c.CheckType)
+	}
+
+	if c.CheckTimeout < 0 || c.CheckTimeout > 30 {
+		return fmt.Errorf("invalid check-timeout %d: must be between 1 and 30 seconds", c.CheckTimeout)
+	}
+	if c.CheckInterval < 0 || c.CheckInterval > 3600 {
+		return fmt.Errorf("invalid check-interval %d: must be at most 3600 seconds", c.CheckInterval)
+	}
+	if c.healthCheckInterval() <= c.healthCheckTimeout() {
+		return fmt.Errorf("invalid check-interval %d: must be greater than the timeout (%d seconds)", c.healthCheckInterval(), c.healthCheckTimeout())
+	}
+	if c.CheckAttempts < 0 || c.CheckAttempts > 30 {
+		return fmt.Errorf("invalid check-attempts %d: must be between 1 and 30", c.CheckAttempts)
+	}
+
+	switch c.BackendIPType {
+	case "", backendIPTypePrivate, backendIPTypePublic, backendIPTypeVPC:
+	default:
+		return fmt.Errorf("invalid backend-ip-type %q: must be one of private, public or vpc", c.BackendIPType)
+	}
+
+	if c.DefaultNodeBalancerID < 0 {
+		return fmt.Errorf("invalid default-nodebalancer-id %d: must be the ID of a NodeBalancer", c.DefaultNodeBalancerID)
+	}
+
+	if c.NodeBalancerLabelTemplate != "" {
+		if _, err := parseNodeBalancerLabelTemplate(c.NodeBalancerLabelTemplate); err != nil {
+			return fmt.Errorf("invalid nodebalancer-label-template %q: %v", c.NodeBalancerLabelTemplate, err)
+		}
+	}
+
+	if c.TagsConfigMap != "" {
+		if parts := strings.Split(c.TagsConfigMap, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid tags-configmap %q: must be namespace/name", c.TagsConfigMap)
+		}
+	}
+	return nil
+}
+
+func (c loadBalancerConfig) healthCheckType() linodego.ConfigCheck {
+	if c.CheckType == "" {
+		return linodego.CheckConnection
+	}
+	return c.CheckType
+}
+
+func (c loadBalancerConfig) healthCheckPath() string {
+	if c.CheckPath == "" {
+		return "/"
+	}
+	return c.CheckPath
+}
+
+func (c loadBalancerConfig) healthCheckInterval() int {
+	if c.CheckInterval == 0 {
+		return 5
+	}
+	return c.CheckInterval
+}
+
+func (c loadBalancerConfig) healthCheckTimeout() int {
+	if c.CheckTimeout == 0 {
+		return 3
+	}
+	return c.CheckTimeout
+}
+
+func (c loadBalancerConfig) healthCheckAttempts() int {
+	if c.CheckAttempts == 0 {
+		return 2
+	}
+	return c.CheckAttempts
+}
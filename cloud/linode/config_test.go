@@ -0,0 +1,199 @@
+package linode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadCloudConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   string
+		expected loadBalancerConfig
+		err      string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "yaml",
+			config:   "loadbalancer:\n  check-type: http\n  check-path: /healthz\n  check-interval: 10\n  check-timeout: 5\n  check-attempts: 3\n",
+			expected: loadBalancerConfig{CheckType: linodego.CheckHTTP, CheckPath: "/healthz", CheckInterval: 10, CheckTimeout: 5, CheckAttempts: 3},
+		},
+		{
+			name:     "json",
+			config:   `{"loadbalancer": {"check-type": "none"}}`,
+			expected: loadBalancerConfig{CheckType: linodego.CheckNone},
+		},
+		{
+			name:     "backend ip type",
+			config:   "loadbalancer:\n  backend-ip-type: public\n",
+			expected: loadBalancerConfig{BackendIPType: backendIPTypePublic},
+		},
+		{
+			name:   "invalid backend ip type",
+			config: "loadbalancer:\n  backend-ip-type: external\n",
+			err:    `invalid backend-ip-type "external"`,
+		},
+		{
+			name:     "tags configmap",
+			config:   "loadbalancer:\n  tags-configmap: kube-system/nodebalancer-tags\n",
+			expected: loadBalancerConfig{TagsConfigMap: "kube-system/nodebalancer-tags"},
+		},
+		{
+			name:   "tags configmap without namespace",
+			config: "loadbalancer:\n  tags-configmap: nodebalancer-tags\n",
+			err:    `invalid tags-configmap "nodebalancer-tags"`,
+		},
+		{
+			name:     "default nodebalancer",
+			config:   "loadbalancer:\n  default-nodebalancer-id: 12345\n",
+			expected: loadBalancerConfig{DefaultNodeBalancerID: 12345},
+		},
+		{
+			name:   "invalid default nodebalancer",
+			config: "loadbalancer:\n  default-nodebalancer-id: -1\n",
+			err:    "invalid default-nodebalancer-id -1",
+		},
+		{
+			name:     "nodebalancer label template",
+			config:   "loadbalancer:\n  nodebalancer-label-template: \"{{ .Labels.env }}-{{ .Cluster }}-{{ .Name }}\"\n",
+			expected: loadBalancerConfig{NodeBalancerLabelTemplate: "{{ .Labels.env }}-{{ .Cluster }}-{{ .Name }}"},
+		},
+		{
+			name:   "invalid nodebalancer label template",
+			config: "loadbalancer:\n  nodebalancer-label-template: \"{{ .Name \"\n",
+			err:    "invalid nodebalancer-label-template",
+		},
+		{
+			name:   "unknown key",
+			config: "loadbalancer:\n  check-typ: http\n",
+			err:    `unknown field "check-typ"`,
+		},
+		{
+			name:   "unknown section",
+			config: "loadbalancers:\n  check-type: http\n",
+			err:    `unknown field "loadbalancers"`,
+		},
+		{
+			name:   "malformed",
+			config: "loadbalancer: [",
+			err:    "failed to parse the cloud config",
+		},
+		{
+			name:   "invalid check type",
+			config: "loadbalancer:\n  check-type: tcp\n",
+			err:    `invalid check-type "tcp"`,
+		},
+		{
+			name:   "http_body check type",
+			config: "loadbalancer:\n  check-type: http_body\n",
+			err:    "can't be a default",
+		},
+		{
+			name:   "timeout longer than the default interval",
+			config: "loadbalancer:\n  check-timeout: 10\n",
+			err:    "invalid check-interval 5: must be greater than the timeout (10 seconds)",
+		},
+		{
+			name:   "too many attempts",
+			config: "loadbalancer:\n  check-attempts: 31\n",
+			err:    "invalid check-attempts 31",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := readCloudConfig(strings.NewReader(tc.config))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if config.LoadBalancer != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, config.LoadBalancer)
+			}
+		})
+	}
+
+	config, err := readCloudConfig(strings.NewReader("accounts:\n- name: secondary\n  token-file: /etc/linode/secondary/apiToken\n  regions: [eu-west, ap-south]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedAccounts := []accountConfig{{Name: "secondary", TokenFile: "/etc/linode/secondary/apiToken", Regions: []string{"eu-west", "ap-south"}}}
+	if !reflect.DeepEqual(config.Accounts, expectedAccounts) {
+		t.Errorf("expected accounts %+v, got %+v", expectedAccounts, config.Accounts)
+	}
+
+	for config, expected := range map[string]string{
+		"accounts:\n- token-file: /token\n":                                     "accounts must have a name",
+		"accounts:\n- name: a\n":                                                "account a has no token-file",
+		"accounts:\n- name: a\n  token-file: /a\n- name: a\n  token-file: /b\n": "duplicate account a",
+		"accounts:\n- name: a\n  token-file: /a\n  regions: [eu-west]\n- name: b\n  token-file: /b\n  regions: [eu-west]\n": "region eu-west is assigned to both accounts a and b",
+	} {
+		if _, err := readCloudConfig(strings.NewReader(config)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got %v", expected, err)
+		}
+	}
+
+	// Unknown keys are ignored when the startup validation is skipped.
+	Options.SkipStartupValidation = true
+	config, err = readCloudConfig(strings.NewReader("loadbalancer:\n  check-typ: http\n  check-path: /healthz\n"))
+	Options.SkipStartupValidation = false
+	if err != nil || config.LoadBalancer.CheckPath != "/healthz" {
+		t.Errorf("expected the unknown key to be ignored, got %+v, %v", config.LoadBalancer, err)
+	}
+
+	if _, err := readCloudConfig(nil); err != nil {
+		t.Errorf("expected no error without a cloud config, got %s", err)
+	}
+}
+
+func TestBuildNodeBalancerConfigDefaults(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			Annotations: map[string]string{
+				annLinodeHealthCheckAttempts: "5",
+			},
+		},
+	}
+
+	lb := &loadbalancers{defaults: loadBalancerConfig{
+		CheckType:     linodego.CheckHTTP,
+		CheckPath:     "/healthz",
+		CheckInterval: 20,
+		CheckAttempts: 3,
+	}}
+
+	config, err := lb.buildNodeBalancerConfig(svc, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Check != linodego.CheckHTTP || config.CheckPath != "/healthz" || config.CheckInterval != 20 {
+		t.Errorf("expected the health check defaults of the cloud config, got %+v", config)
+	}
+	if config.CheckTimeout != 3 {
+		t.Errorf("expected the built-in timeout for an unset default, got %d", config.CheckTimeout)
+	}
+	if config.CheckAttempts != 5 {
+		t.Errorf("expected the attempts annotation to take precedence, got %d", config.CheckAttempts)
+	}
+
+	svc.Annotations[annLinodeHealthCheckType] = "connection"
+	if config, err = lb.buildNodeBalancerConfig(svc, 80); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Check != linodego.CheckConnection || config.CheckPath != "" {
+		t.Errorf("expected the check-type annotation to take precedence, got %+v", config)
+	}
+}
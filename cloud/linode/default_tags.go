@@ -0,0 +1,231 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appscode/go/wait"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+// defaultTags are the tags of every NodeBalancer managed by the CCM, read from the ConfigMap of
+// the tags-configmap option of the cloud config.
+var defaultTags defaultTagStore
+
+// defaultTagStore holds the default NodeBalancer tags by key. Each key is tagged as key:value, or
+// as key alone if its value is empty.
+type defaultTagStore struct {
+	mu   sync.RWMutex
+	tags map[string]string
+}
+
+// set replaces the default tags with the data of a ConfigMap, and reports whether they changed.
+// Keys that would be tagged as one of the tags the CCM manages are ignored.
+func (s *defaultTagStore) set(data map[string]string) bool {
+	tags := make(map[string]string, len(data))
+	for key, value := range data {
+		if tag := defaultTag(key, value); tag == "" || isManagedTag(tag) {
+			klog.Warningf("ignoring default NodeBalancer tag %q, which is reserved for the CCM", tag)
+			continue
+		}
+		tags[key] = value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reflect.DeepEqual(tags, s.tags) || (len(tags) == 0 && len(s.tags) == 0) {
+		return false
+	}
+	s.tags = tags
+	return true
+}
+
+// get returns the default tags of the keys that aren't tagged by overrides, the tags of a
+// Service, sorted.
+func (s *defaultTagStore) get(overrides []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	overridden := make(map[string]bool, len(overrides))
+	for _, tag := range overrides {
+		overridden[tagKey(tag)] = true
+	}
+
+	tags := make([]string, 0, len(s.tags))
+	for key, value := range s.tags {
+		if !overridden[key] {
+			tags = append(tags, defaultTag(key, value))
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// isStale reports whether tag was set for a key of the default tags, but isn't one of desired,
+// e.g. because the value of the key changed or a Service's tags override it.
+func (s *defaultTagStore) isStale(tag string, desired []string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.tags[tagKey(tag)]
+	return ok && !isManagedTag(tag) && !containsString(desired, tag)
+}
+
+func defaultTag(key, value string) string {
+	if value == "" {
+		return strings.TrimSpace(key)
+	}
+	return strings.TrimSpace(key) + ":" + strings.TrimSpace(value)
+}
+
+// tagKey returns the key of a key:value tag, which is the whole tag if it has no value.
+func tagKey(tag string) string {
+	return strings.SplitN(tag, ":", 2)[0]
+}
+
+// defaultTagsController keeps defaultTags in sync with their ConfigMap, and updates the tags of
+// the NodeBalancers of every LoadBalancer Service when it changes.
+type defaultTagsController struct {
+	loadbalancers  *loadbalancers
+	services       v1listers.ServiceLister
+	servicesSynced cache.InformerSynced
+	informer       cache.SharedIndexInformer
+
+	queue workqueue.DelayingInterface
+}
+
+// defaultTagsSyncKey is the only key of the queue of the defaultTagsController: the tags of every
+// NodeBalancer are synced at once.
+const defaultTagsSyncKey = "sync"
+
+// newDefaultTagsController returns a defaultTagsController watching configMap, the validated
+// namespace/name of the tags-configmap of the cloud config.
+func newDefaultTagsController(loadbalancers *loadbalancers, serviceInformer cache.SharedIndexInformer, kubeClient kubernetes.Interface, configMap string) *defaultTagsController {
+	parts := strings.SplitN(configMap, "/", 2)
+	listWatch := cache.NewListWatchFromClient(kubeClient.CoreV1().RESTClient(), "configmaps", parts[0], fields.OneTermEqualSelector("metadata.name", parts[1]))
+	return &defaultTagsController{
+		loadbalancers:  loadbalancers,
+		services:       v1listers.NewServiceLister(serviceInformer.GetIndexer()),
+		servicesSynced: serviceInformer.HasSynced,
+		informer:       cache.NewSharedIndexInformer(listWatch, &v1.ConfigMap{}, 0, cache.Indexers{}),
+		queue:          workqueue.NewDelayingQueue(),
+	}
+}
+
+func (c *defaultTagsController) Run(stopCh <-chan struct{}) {
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if configMap, ok := obj.(*v1.ConfigMap); ok {
+				c.setDefaultTags(configMap.Data)
+			}
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			if configMap, ok := newObj.(*v1.ConfigMap); ok {
+				c.setDefaultTags(configMap.Data)
+			}
+		},
+		DeleteFunc: func(interface{}) {
+			c.setDefaultTags(nil)
+		},
+	})
+	go c.informer.Run(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, c.servicesSynced, c.informer.HasSynced) {
+		klog.Errorf("default NodeBalancer tags controller failed to sync its caches")
+		return
+	}
+
+	wait.Until(c.worker, time.Second, stopCh)
+}
+
+// setDefaultTags replaces the default tags, and queues a sync of the tags of every NodeBalancer
+// if they changed. Periodic resyncs deliver updates without changes.
+func (c *defaultTagsController) setDefaultTags(data map[string]string) {
+	if defaultTags.set(data) {
+		klog.Infof("default NodeBalancer tags changed to %v", defaultTags.get(nil))
+		c.queue.Add(defaultTagsSyncKey)
+	}
+}
+
+func (c *defaultTagsController) worker() {
+	for c.processNextSync() {
+	}
+}
+
+func (c *defaultTagsController) processNextSync() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.sync(context.Background()); err != nil {
+		klog.Errorf("failed to sync the default tags of NodeBalancers; retrying in 1 minute: %s", err)
+		c.queue.AddAfter(key, retryInterval)
+	}
+	return true
+}
+
+// sync updates the tags of the NodeBalancers of every LoadBalancer Service. Services whose
+// NodeBalancer doesn't exist yet get the default tags when it is created.
+func (c *defaultTagsController) sync(ctx context.Context) error {
+	services, err := c.services.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		if err := c.loadbalancers.syncDefaultTags(ctx, service); err != nil {
+			klog.Errorf("failed to sync the default tags of the NodeBalancer of service (%s): %s", getServiceNn(service), err)
+			failed = append(failed, getServiceNn(service))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to sync the NodeBalancers of services %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// syncDefaultTags updates the tags of the NodeBalancer of service to the current default tags.
+func (l *loadbalancers) syncDefaultTags(ctx context.Context, service *v1.Service) error {
+	account, err := l.forService(service)
+	if err != nil {
+		return err
+	}
+	if account != l {
+		return account.syncDefaultTags(ctx, service)
+	}
+
+	defer l.serviceLocks.lock(service)()
+	if isPaused(service) {
+		l.recordPaused(service, "sync-default-tags")
+		return nil
+	}
+
+	nb, err := l.getNodeBalancerForService(ctx, service)
+	switch err.(type) {
+	case nil:
+		_, err = l.reconcileNodeBalancerIdentity(ctx, service, nb)
+		return err
+	case lbNotFoundError:
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,141 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func Test_buildNodeBalancerTagsDefaults(t *testing.T) {
+	defer defaultTags.set(nil)
+	defaultTags.set(map[string]string{"team": "payments", "env": "prod", "billable": "", "ccm:80:uid": "x"})
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			UID:         "uid",
+			Annotations: map[string]string{annLinodeTags: "env:staging,owner:alice"},
+		},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Port: 80}}},
+	}
+
+	tags := buildNodeBalancerTags(&linodego.NodeBalancer{Tags: []string{"team:search", "env:prod", "manual"}}, svc)
+	expected := []string{"billable", "ccm-service-uid:uid", "ccm:80:uid", "env:staging", "manual", "owner:alice", "team:payments"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, tags)
+	}
+
+	// A NodeBalancer shared with another Service keeps the default tags it overrides.
+	tags = buildNodeBalancerTags(&linodego.NodeBalancer{Tags: []string{"ccm:443:other-uid", "team:search"}}, svc)
+	if !containsString(tags, "team:search") || !containsString(tags, "team:payments") {
+		t.Errorf("expected the tags of the other Service to be kept, got %v", tags)
+	}
+}
+
+func TestDefaultTagsController(t *testing.T) {
+	defer defaultTags.set(nil)
+
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	kubeClient := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: kubeClient}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "web",
+			UID:         "web-uid",
+			Annotations: map[string]string{annLinodeTags: "team:search"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}}
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "test", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *status
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err = indexer.Add(svc); err != nil {
+		t.Fatal(err)
+	}
+	controller := &defaultTagsController{
+		loadbalancers: lb,
+		services:      v1listers.NewServiceLister(indexer),
+		queue:         workqueue.NewDelayingQueue(),
+	}
+
+	nbTags := func() []string {
+		nb, err := lb.getNodeBalancerForService(context.TODO(), svc)
+		if err != nil {
+			t.Fatalf("failed to get the NodeBalancer: %s", err)
+		}
+		return nb.Tags
+	}
+
+	for _, step := range []struct {
+		name     string
+		data     map[string]string
+		expected []string
+	}{
+		{
+			name:     "created",
+			data:     map[string]string{"env": "prod", "team": "payments"},
+			expected: []string{"ccm-service-uid:web-uid", "ccm:80:web-uid", "env:prod", "team:search"},
+		},
+		{
+			name:     "updated",
+			data:     map[string]string{"env": "staging", "cost-center": "42"},
+			expected: []string{"ccm-service-uid:web-uid", "ccm:80:web-uid", "cost-center:42", "env:staging", "team:search"},
+		},
+		{
+			name:     "removed keys are kept and managed tags ignored",
+			data:     map[string]string{"env": "staging", "ccm-service-uid:other": "", "ccm:80:other": "x"},
+			expected: []string{"ccm-service-uid:web-uid", "ccm:80:web-uid", "cost-center:42", "env:staging", "team:search"},
+		},
+	} {
+		t.Run(step.name, func(t *testing.T) {
+			controller.setDefaultTags(step.data)
+			if controller.queue.Len() != 1 {
+				t.Fatalf("expected a sync to be queued, got %d", controller.queue.Len())
+			}
+			key, _ := controller.queue.Get()
+			controller.queue.Done(key)
+
+			if err := controller.sync(context.TODO()); err != nil {
+				t.Fatalf("sync returned an error: %s", err)
+			}
+			if tags := nbTags(); !reflect.DeepEqual(tags, step.expected) {
+				t.Errorf("expected tags %v, got %v", step.expected, tags)
+			}
+		})
+	}
+
+	// Unchanged ConfigMaps, e.g. periodic resyncs, don't sync the NodeBalancers.
+	controller.setDefaultTags(map[string]string{"env": "staging"})
+	if controller.queue.Len() != 0 {
+		t.Errorf("expected no sync to be queued for an unchanged ConfigMap, got %d", controller.queue.Len())
+	}
+}
@@ -0,0 +1,173 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+)
+
+// dnsRecordAnnotation is the value of the annLinodeDNSRecord annotation.
+type dnsRecordAnnotation struct {
+	// DomainID is the ID of the Linode DNS domain the records are in.
+	DomainID int `json:"domain-id"`
+	// Name is the name of the records in the domain, e.g. "www", or "" for the domain itself.
+	Name string `json:"name"`
+	// TTLSec is the TTL of the records, which defaults to the TTL of the domain.
+	TTLSec int `json:"ttl-sec,omitempty"`
+}
+
+// getDNSRecordAnnotation returns the DNS records requested by service, or nil if it has none.
+func getDNSRecordAnnotation(service *v1.Service) (*dnsRecordAnnotation, error) {
+	raw, ok := getServiceAnnotation(service, annLinodeDNSRecord)
+	if !ok {
+		return nil, nil
+	}
+
+	annotation := &dnsRecordAnnotation{}
+	if err := json.Unmarshal([]byte(raw), annotation); err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %v", annLinodeDNSRecord, err)
+	}
+	if annotation.DomainID <= 0 {
+		return nil, fmt.Errorf("invalid value for %s: domain-id must be the ID of a Linode DNS domain", annLinodeDNSRecord)
+	}
+	if annotation.TTLSec < 0 {
+		return nil, fmt.Errorf("invalid value for %s: ttl-sec must be a number of seconds", annLinodeDNSRecord)
+	}
+	return annotation, nil
+}
+
+// getDNSRecordTargets returns the addresses of nb the DNS records of a Service point to, by
+// record type.
+func getDNSRecordTargets(nb *linodego.NodeBalancer) map[linodego.DomainRecordType]string {
+	targets := make(map[linodego.DomainRecordType]string, 2)
+	if nb.IPv4 != nil && *nb.IPv4 != "" {
+		targets[linodego.RecordTypeA] = *nb.IPv4
+	}
+	if nb.IPv6 != nil && *nb.IPv6 != "" {
+		targets[linodego.RecordTypeAAAA] = *nb.IPv6
+	}
+	return targets
+}
+
+// findDNSRecord returns the first record of records of type recordType named name, if any.
+func findDNSRecord(records []linodego.DomainRecord, recordType linodego.DomainRecordType, name string) *linodego.DomainRecord {
+	for i := range records {
+		if records[i].Type == recordType && records[i].Name == name {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// reconcileDNSRecords points the A and AAAA records requested by the annLinodeDNSRecord
+// annotation of service to the addresses of nb, creating them if they don't exist. Unless
+// Options.ManageDNSRecords is set, the records are only compared with the addresses of nb and
+// differences are reported as events.
+func (l *loadbalancers) reconcileDNSRecords(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	annotation, err := getDNSRecordAnnotation(service)
+	if err != nil || annotation == nil {
+		return err
+	}
+
+	records, err := l.client.ListDomainRecords(ctx, annotation.DomainID, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to list the records of domain (%d): %v", annotation.DomainID, err)
+		l.recordEvent(service, v1.EventTypeWarning, "DNSRecordSyncFailed", "%s", err)
+		return err
+	}
+
+	for _, recordType := range []linodego.DomainRecordType{linodego.RecordTypeA, linodego.RecordTypeAAAA} {
+		target, ok := getDNSRecordTargets(nb)[recordType]
+		if !ok {
+			continue
+		}
+		current := findDNSRecord(records, recordType, annotation.Name)
+		if current != nil && current.Target == target && (annotation.TTLSec == 0 || current.TTLSec == annotation.TTLSec) {
+			continue
+		}
+
+		if !Options.ManageDNSRecords {
+			currentTarget := "no record"
+			if current != nil {
+				currentTarget = current.Target
+			}
+			l.recordEvent(service, v1.EventTypeWarning, "DNSRecordOutOfSync",
+				"%s record %q of domain (%d) should point to %s but points to %s; run the CCM with --manage-dns-records to update it",
+				recordType, annotation.Name, annotation.DomainID, target, currentTarget)
+			continue
+		}
+
+		if err = l.upsertDNSRecord(ctx, service, nb, annotation, current, recordType, target); err != nil {
+			err = fmt.Errorf("failed to point %s record %q of domain (%d) to %s: %v", recordType, annotation.Name, annotation.DomainID, target, err)
+			l.recordEvent(service, v1.EventTypeWarning, "DNSRecordSyncFailed", "%s", err)
+			return err
+		}
+		serviceLog("sync-dns-record", service, nb.ID).infof("pointed %s record %q of domain (%d) to %s for service (%s)", recordType, annotation.Name, annotation.DomainID, target, getServiceNn(service))
+		l.recordEvent(service, v1.EventTypeNormal, "DNSRecordSynced", "%s record %q of domain (%d) points to %s", recordType, annotation.Name, annotation.DomainID, target)
+	}
+	return nil
+}
+
+// upsertDNSRecord creates the record of the given type and target for annotation, or updates
+// current if it exists, or only logs the change in dry-run mode.
+func (l *loadbalancers) upsertDNSRecord(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer, annotation *dnsRecordAnnotation, current *linodego.DomainRecord, recordType linodego.DomainRecordType, target string) error {
+	if current == nil {
+		create := linodego.DomainRecordCreateOptions{Type: recordType, Name: annotation.Name, Target: target, TTLSec: annotation.TTLSec}
+		if l.dryRun {
+			l.logDryRun(service, dryRunChange{Action: "create-dns-record", NodeBalancerID: nb.ID, Desired: create})
+			return nil
+		}
+		_, err := l.client.CreateDomainRecord(ctx, annotation.DomainID, create)
+		return err
+	}
+
+	update := linodego.DomainRecordUpdateOptions{Target: target, TTLSec: annotation.TTLSec}
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "update-dns-record", NodeBalancerID: nb.ID, Current: current.GetUpdateOptions(), Desired: update})
+		return nil
+	}
+	_, err := l.client.UpdateDomainRecord(ctx, annotation.DomainID, current.ID, update)
+	return err
+}
+
+// deleteDNSRecords deletes the A and AAAA records requested by the annLinodeDNSRecord annotation
+// of service if Options.ManageDNSRecords is set. Only the records still pointing to nb are
+// deleted, so records pointed elsewhere since are left alone.
+func (l *loadbalancers) deleteDNSRecords(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	if !Options.ManageDNSRecords {
+		return nil
+	}
+	// The annotation of a Service can't be fixed once it is deleted.
+	annotation, err := getDNSRecordAnnotation(service)
+	if err != nil || annotation == nil {
+		return nil
+	}
+
+	records, err := l.client.ListDomainRecords(ctx, annotation.DomainID, nil)
+	if classifyAPIError(err) == apiErrorNotFound {
+		// The records were deleted along with their domain.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list the records of domain (%d): %v", annotation.DomainID, err)
+	}
+
+	targets := getDNSRecordTargets(nb)
+	for _, record := range records {
+		if record.Name != annotation.Name || targets[record.Type] == "" || targets[record.Type] != record.Target {
+			continue
+		}
+		if l.dryRun {
+			l.logDryRun(service, dryRunChange{Action: "delete-dns-record", NodeBalancerID: nb.ID, Current: record.GetUpdateOptions()})
+			continue
+		}
+		if err = l.client.DeleteDomainRecord(ctx, annotation.DomainID, record.ID); err != nil {
+			return fmt.Errorf("failed to delete %s record %q of domain (%d): %v", record.Type, record.Name, annotation.DomainID, err)
+		}
+		serviceLog("delete-dns-record", service, nb.ID).infof("deleted %s record %q of domain (%d) for service (%s)", record.Type, record.Name, annotation.DomainID, getServiceNn(service))
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newDNSRecordTestService() *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			Namespace:   "default",
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeDNSRecord: `{"domain-id": 1, "name": "www", "ttl-sec": 300}`},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+}
+
+// getDNSRecordTargetsByType returns the targets of the records of domain named name by type.
+func getDNSRecordTargetsByType(fakeAPI *fakeAPI, domainID int, name string) map[linodego.DomainRecordType]string {
+	targets := make(map[linodego.DomainRecordType]string)
+	for _, record := range fakeAPI.dr[domainID] {
+		if record.Name == name {
+			targets[record.Type] = record.Target
+		}
+	}
+	return targets
+}
+
+func TestDNSRecords(t *testing.T) {
+	Options.ManageDNSRecords = true
+	defer func() { Options.ManageDNSRecords = false }()
+
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	fakeAPI.dr[1] = map[int]*linodego.DomainRecord{
+		1: {ID: 1, Type: linodego.RecordTypeA, Name: "mail", Target: "192.0.2.1"},
+	}
+
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset}
+
+	svc := newDNSRecordTestService()
+	if _, err := fakeClientset.CoreV1().Services("default").Create(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	// The record is created by EnsureLoadBalancer.
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *status
+	if _, err = fakeClientset.CoreV1().Services("default").UpdateStatus(svc); err != nil {
+		t.Fatal(err)
+	}
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[linodego.DomainRecordType]string{linodego.RecordTypeA: *nb.IPv4}
+	if actual := getDNSRecordTargetsByType(fakeAPI, 1, "www"); len(actual) != 1 || actual[linodego.RecordTypeA] != *nb.IPv4 {
+		t.Errorf("expected records %v, got %v", expected, actual)
+	}
+	for _, record := range fakeAPI.dr[1] {
+		if record.Name == "www" && record.TTLSec != 300 {
+			t.Errorf("expected the record to have a TTL of 300s, got %d", record.TTLSec)
+		}
+	}
+
+	// The records follow the addresses of the NodeBalancer.
+	ipv4, ipv6 := "192.0.2.10", "2001:db8::10"
+	fakeAPI.nb[strconv.Itoa(nb.ID)].IPv4 = &ipv4
+	fakeAPI.nb[strconv.Itoa(nb.ID)].IPv6 = &ipv6
+	if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expected = map[linodego.DomainRecordType]string{linodego.RecordTypeA: ipv4, linodego.RecordTypeAAAA: ipv6}
+	if actual := getDNSRecordTargetsByType(fakeAPI, 1, "www"); len(actual) != 2 || actual[linodego.RecordTypeA] != ipv4 || actual[linodego.RecordTypeAAAA] != ipv6 {
+		t.Errorf("expected records %v, got %v", expected, actual)
+	}
+	if len(fakeAPI.dr[1]) != 3 {
+		t.Errorf("expected the records to be updated in place, got %d records", len(fakeAPI.dr[1]))
+	}
+
+	// The records of the Service are deleted along with it, and other records are left alone.
+	svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: ipv4}}
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "linodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if actual := getDNSRecordTargetsByType(fakeAPI, 1, "www"); len(actual) != 0 {
+		t.Errorf("expected the records of the service to be deleted, got %v", actual)
+	}
+	if _, ok := fakeAPI.dr[1][1]; !ok || len(fakeAPI.dr[1]) != 1 {
+		t.Errorf("expected the other records to be kept, got %v", fakeAPI.dr[1])
+	}
+}
+
+func TestDNSRecordsReadOnly(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	fakeAPI.dr[1] = map[int]*linodego.DomainRecord{
+		1: {ID: 1, Type: linodego.RecordTypeA, Name: "www", Target: "192.0.2.1"},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+
+	svc := newDNSRecordTestService()
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if record := fakeAPI.dr[1][1]; len(fakeAPI.dr[1]) != 1 || record.Target != "192.0.2.1" {
+		t.Errorf("expected the records to be left alone, got %v", fakeAPI.dr[1])
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "DNSRecordOutOfSync") || !strings.Contains(event, status.Ingress[0].IP) {
+		t.Errorf("expected a DNSRecordOutOfSync event mentioning %s, got %q", status.Ingress[0].IP, event)
+	}
+
+	svc.Status.LoadBalancer = *status
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "linodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if len(fakeAPI.dr[1]) != 1 {
+		t.Errorf("expected the records to be left alone, got %v", fakeAPI.dr[1])
+	}
+}
+
+func TestDNSRecordsDomainNotFound(t *testing.T) {
+	Options.ManageDNSRecords = true
+	defer func() { Options.ManageDNSRecords = false }()
+
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	lb := &loadbalancers{client: &client, zone: "us-west"}
+	svc := newDNSRecordTestService()
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil); err == nil {
+		t.Fatal("expected EnsureLoadBalancer to fail for a missing domain")
+	}
+
+	// A Service whose domain was deleted is still deleted.
+	nb, err := lb.getNodeBalancerByOwner(context.TODO(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Status.LoadBalancer = *makeLoadBalancerStatus(svc, nb)
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "linodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if len(fakeAPI.nb) != 0 {
+		t.Errorf("expected the NodeBalancer to be deleted, got %v", fakeAPI.nb)
+	}
+}
+
+func Test_getDNSRecordAnnotation(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		value    string
+		expected *dnsRecordAnnotation
+		err      string
+	}{
+		{name: "valid", value: `{"domain-id": 1, "name": "www"}`, expected: &dnsRecordAnnotation{DomainID: 1, Name: "www"}},
+		{name: "domain apex", value: `{"domain-id": 1}`, expected: &dnsRecordAnnotation{DomainID: 1}},
+		{name: "invalid json", value: `{"domain-id": 1`, err: "invalid value"},
+		{name: "missing domain", value: `{"name": "www"}`, err: "domain-id"},
+		{name: "negative ttl", value: `{"domain-id": 1, "ttl-sec": -1}`, err: "ttl-sec"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annLinodeDNSRecord: test.value}}}
+			annotation, err := getDNSRecordAnnotation(svc)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *annotation != *test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, annotation)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package linode
+
+import (
+	"sync"
+	"time"
+)
+
+type drainKey struct {
+	nodeBalancerID int
+	configID       int
+	// address is empty for the drain of a whole config.
+	address string
+}
+
+// drainTracker records when NodeBalancer nodes were put into drain mode so that repeated
+// syncs of a Service don't reset the grace period of a node being drained.
+type drainTracker struct {
+	mu       sync.Mutex
+	draining map[drainKey]time.Time
+}
+
+// drainStart returns when the node at address started draining from the given config,
+// starting the drain now if it was not yet being drained.
+func (d *drainTracker) drainStart(nodeBalancerID, configID int, address string, now time.Time) time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining == nil {
+		d.draining = make(map[drainKey]time.Time)
+	}
+
+	key := drainKey{nodeBalancerID: nodeBalancerID, configID: configID, address: address}
+	start, ok := d.draining[key]
+	if !ok {
+		start = now
+		d.draining[key] = start
+	}
+	return start
+}
+
+// configDrainStart returns when the nodes of the given config started draining as its port was
+// removed, starting the drain now if it was not yet being drained.
+func (d *drainTracker) configDrainStart(nodeBalancerID, configID int, now time.Time) time.Time {
+	return d.drainStart(nodeBalancerID, configID, "", now)
+}
+
+// forgetConfigDrain stops tracking the drain of the given config started by configDrainStart.
+func (d *drainTracker) forgetConfigDrain(nodeBalancerID, configID int) {
+	d.forget(nodeBalancerID, configID, "")
+}
+
+// forget stops tracking the node at address in the given config.
+func (d *drainTracker) forget(nodeBalancerID, configID int, address string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.draining, drainKey{nodeBalancerID: nodeBalancerID, configID: configID, address: address})
+}
+
+// forgetConfig stops tracking every node draining from the given config. A configID of 0
+// matches every config of the NodeBalancer.
+func (d *drainTracker) forgetConfig(nodeBalancerID, configID int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key := range d.draining {
+		if key.nodeBalancerID == nodeBalancerID && (configID == 0 || key.configID == configID) {
+			delete(d.draining, key)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const redacted = "<REDACTED>"
+
+// dryRunChange describes a NodeBalancer change skipped because of Options.DryRun.
+type dryRunChange struct {
+	Action         string      `json:"action"`
+	Service        string      `json:"service,omitempty"`
+	NodeBalancerID int         `json:"nodebalancer_id,omitempty"`
+	ConfigID       int         `json:"config_id,omitempty"`
+	Current        interface{} `json:"current,omitempty"`
+	Desired        interface{} `json:"desired,omitempty"`
+}
+
+// logDryRun logs the change that would have been made to a NodeBalancer for service, which is
+// nil for changes not made on behalf of a Service.
+func (l *loadbalancers) logDryRun(service *v1.Service, change dryRunChange) {
+	if service != nil {
+		change.Service = getServiceNn(service)
+	}
+	if l.onDryRun != nil {
+		l.onDryRun(change)
+		return
+	}
+
+	diff, err := json.Marshal(change)
+	if err != nil {
+		klog.Errorf("dry-run: failed to marshal %s change for service (%s): %s", change.Action, change.Service, err)
+		return
+	}
+	klog.Infof("dry-run: %s", diff)
+}
+
+// updateNodeBalancerOptions updates the settings of nb, or only logs the update in dry-run mode.
+func (l *loadbalancers) updateNodeBalancerOptions(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer, update linodego.NodeBalancerUpdateOptions) (*linodego.NodeBalancer, error) {
+	if !l.dryRun {
+		return l.client.UpdateNodeBalancer(ctx, nb.ID, update)
+	}
+
+	l.logDryRun(service, dryRunChange{
+		Action:         "update-nodebalancer",
+		NodeBalancerID: nb.ID,
+		Current:        nb.GetUpdateOptions(),
+		Desired:        update,
+	})
+
+	updated := *nb
+	if update.Label != nil {
+		updated.Label = update.Label
+	}
+	if update.ClientConnThrottle != nil {
+		updated.ClientConnThrottle = *update.ClientConnThrottle
+	}
+	if update.Tags != nil {
+		updated.Tags = *update.Tags
+	}
+	return &updated, nil
+}
+
+// createNodeBalancerConfig creates cfg on the NodeBalancer nodeBalancerID, or only logs the
+// creation in dry-run mode.
+func (l *loadbalancers) createNodeBalancerConfig(ctx context.Context, service *v1.Service, nodeBalancerID int, cfg linodego.NodeBalancerConfig) (*linodego.NodeBalancerConfig, error) {
+	if !l.dryRun {
+		return l.client.CreateNodeBalancerConfig(ctx, nodeBalancerID, cfg.GetCreateOptions())
+	}
+
+	l.logDryRun(service, dryRunChange{
+		Action:         "create-config",
+		NodeBalancerID: nodeBalancerID,
+		Desired:        redactConfigCreateOptions(cfg.GetCreateOptions()),
+	})
+
+	cfg.NodeBalancerID = nodeBalancerID
+	return &cfg, nil
+}
+
+// updateNodeBalancerConfig updates the settings of current, or only logs the update in dry-run
+// mode.
+func (l *loadbalancers) updateNodeBalancerConfig(ctx context.Context, service *v1.Service, current *linodego.NodeBalancerConfig, update linodego.NodeBalancerConfigUpdateOptions) error {
+	if !l.dryRun {
+		_, err := l.client.UpdateNodeBalancerConfig(ctx, current.NodeBalancerID, current.ID, update)
+		return err
+	}
+
+	l.logDryRun(service, dryRunChange{
+		Action:         "update-config",
+		NodeBalancerID: current.NodeBalancerID,
+		ConfigID:       current.ID,
+		Current:        redactConfigCreateOptions(linodego.NodeBalancerConfigCreateOptions(current.GetUpdateOptions())),
+		Desired:        redactConfigCreateOptions(linodego.NodeBalancerConfigCreateOptions(update)),
+	})
+	return nil
+}
+
+// deleteNodeBalancerConfig deletes a config of the NodeBalancer nodeBalancerID, or only logs the
+// deletion in dry-run mode.
+func (l *loadbalancers) deleteNodeBalancerConfig(ctx context.Context, service *v1.Service, nodeBalancerID, configID int) error {
+	if !l.dryRun {
+		return l.client.DeleteNodeBalancerConfig(ctx, nodeBalancerID, configID)
+	}
+
+	l.logDryRun(service, dryRunChange{
+		Action:         "delete-config",
+		NodeBalancerID: nodeBalancerID,
+		ConfigID:       configID,
+	})
+	return nil
+}
+
+// createNodeBalancerNode creates a backend node on config, or only logs the creation in dry-run
+// mode.
+func (l *loadbalancers) createNodeBalancerNode(ctx context.Context, service *v1.Service, config *linodego.NodeBalancerConfig, node linodego.NodeBalancerNodeCreateOptions) error {
+	if !l.dryRun {
+		_, err := l.client.CreateNodeBalancerNode(ctx, config.NodeBalancerID, config.ID, node)
+		if err == nil {
+			observeNodeBalancerNodeChange(service, config.NodeBalancerID, "add")
+		}
+		return err
+	}
+
+	l.logDryRun(service, dryRunChange{
+		Action:         "create-node",
+		NodeBalancerID: config.NodeBalancerID,
+		ConfigID:       config.ID,
+		Desired:        node,
+	})
+	return nil
+}
+
+// updateNodeBalancerNode updates a backend node of config, or only logs the update in dry-run
+// mode.
+func (l *loadbalancers) updateNodeBalancerNode(ctx context.Context, service *v1.Service, config *linodego.NodeBalancerConfig, current linodego.NodeBalancerNode, update linodego.NodeBalancerNodeUpdateOptions) error {
+	if !l.dryRun {
+		_, err := l.client.UpdateNodeBalancerNode(ctx, config.NodeBalancerID, config.ID, current.ID, update)
+		if err == nil && update.Mode != "" && update.Mode != current.Mode {
+			observeNodeBalancerNodeChange(service, config.NodeBalancerID, "mode")
+		}
+		return err
+	}
+
+	l.logDryRun(service, dryRunChange{
+		Action:         "update-node",
+		NodeBalancerID: config.NodeBalancerID,
+		ConfigID:       config.ID,
+		Current:        current.GetUpdateOptions(),
+		Desired:        update,
+	})
+	return nil
+}
+
+// deleteNodeBalancerNode deletes a backend node of config, or only logs the deletion in dry-run
+// mode.
+func (l *loadbalancers) deleteNodeBalancerNode(ctx context.Context, service *v1.Service, config *linodego.NodeBalancerConfig, node linodego.NodeBalancerNode) error {
+	if !l.dryRun {
+		err := l.client.DeleteNodeBalancerNode(ctx, config.NodeBalancerID, config.ID, node.ID)
+		if err == nil {
+			observeNodeBalancerNodeChange(service, config.NodeBalancerID, "remove")
+		}
+		return err
+	}
+
+	l.logDryRun(service, dryRunChange{
+		Action:         "delete-node",
+		NodeBalancerID: config.NodeBalancerID,
+		ConfigID:       config.ID,
+		Current:        node.GetCreateOptions(),
+	})
+	return nil
+}
+
+func redactConfigCreateOptions(opts linodego.NodeBalancerConfigCreateOptions) linodego.NodeBalancerConfigCreateOptions {
+	if opts.SSLCert != "" {
+		opts.SSLCert = redacted
+	}
+	if opts.SSLKey != "" {
+		opts.SSLKey = redacted
+	}
+	return opts
+}
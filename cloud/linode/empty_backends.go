@@ -0,0 +1,73 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+)
+
+// The policies of Options.EmptyBackendPolicy for the NodeBalancers of Services left with no
+// eligible backend nodes, e.g. during a rolling replacement of all the nodes of the cluster.
+const (
+	// emptyBackendPolicyKeepLast keeps the current backends, avoiding an outage if the nodes
+	// come back under the same addresses, at the risk of sending traffic to nodes that are gone.
+	emptyBackendPolicyKeepLast = "keep-last"
+
+	// emptyBackendPolicyRemoveAll removes all the backends, like for any other change of nodes.
+	emptyBackendPolicyRemoveAll = "remove-all"
+
+	// emptyBackendPolicyFail fails the reconcile, leaving the backends as they are until the
+	// service controller retries with nodes.
+	emptyBackendPolicyFail = "fail"
+)
+
+func validateEmptyBackendPolicy(policy string) error {
+	switch policy {
+	case "", emptyBackendPolicyKeepLast, emptyBackendPolicyRemoveAll, emptyBackendPolicyFail:
+		return nil
+	default:
+		return fmt.Errorf("invalid --empty-backend-policy %q: must be %s, %s or %s", policy, emptyBackendPolicyKeepLast, emptyBackendPolicyRemoveAll, emptyBackendPolicyFail)
+	}
+}
+
+func getEmptyBackendPolicy() string {
+	if Options.EmptyBackendPolicy == "" {
+		return emptyBackendPolicyKeepLast
+	}
+	return Options.EmptyBackendPolicy
+}
+
+// keepBackendsWithoutNodes reports whether the current backends of config are kept rather than
+// synced, as none of the nodes are eligible as backends of service and Options.EmptyBackendPolicy
+// is keep-last. An error is returned instead with the fail policy, so that the reconcile is
+// retried. Configs without backends are synced as usual, as there is nothing to keep.
+func (l *loadbalancers) keepBackendsWithoutNodes(ctx context.Context, service *v1.Service, config *linodego.NodeBalancerConfig, eligible []*v1.Node) (bool, error) {
+	if len(eligible) > 0 {
+		return false, nil
+	}
+	current, err := l.client.ListNodeBalancerNodes(ctx, config.NodeBalancerID, config.ID, nil)
+	if err != nil || len(current) == 0 {
+		return false, err
+	}
+
+	policy := getEmptyBackendPolicy()
+	switch policy {
+	case emptyBackendPolicyRemoveAll:
+		l.recordEvent(service, v1.EventTypeWarning, "NoBackendNodes",
+			"no nodes are eligible as backends of service (%s), removing the %d backends of port %d of NodeBalancer (%d) as --empty-backend-policy is %s",
+			getServiceNn(service), len(current), config.Port, config.NodeBalancerID, policy)
+		return false, nil
+	case emptyBackendPolicyFail:
+		err = fmt.Errorf("no nodes are eligible as backends of service (%s), not removing the %d backends of port %d of NodeBalancer (%d) as --empty-backend-policy is %s",
+			getServiceNn(service), len(current), config.Port, config.NodeBalancerID, policy)
+		l.recordEvent(service, v1.EventTypeWarning, "NoBackendNodes", "%s", err)
+		return false, err
+	default:
+		l.recordEvent(service, v1.EventTypeWarning, "NoBackendNodes",
+			"no nodes are eligible as backends of service (%s), keeping the %d backends of port %d of NodeBalancer (%d) as --empty-backend-policy is %s",
+			getServiceNn(service), len(current), config.Port, config.NodeBalancerID, policy)
+		return true, nil
+	}
+}
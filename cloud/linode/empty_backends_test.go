@@ -0,0 +1,104 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEmptyBackendPolicy(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		policy   string
+		backends int
+		event    string
+		err      bool
+	}{
+		{name: "default", policy: "", backends: 1, event: "keeping the 1 backends of port 80"},
+		{name: "keep-last", policy: emptyBackendPolicyKeepLast, backends: 1, event: "keeping the 1 backends of port 80"},
+		{name: "remove-all", policy: emptyBackendPolicyRemoveAll, backends: 0, event: "removing the 1 backends of port 80"},
+		{name: "fail", policy: emptyBackendPolicyFail, backends: 1, event: "not removing the 1 backends of port 80", err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			Options.EmptyBackendPolicy = test.policy
+			defer func() { Options.EmptyBackendPolicy = "" }()
+
+			fakeAPI := newFake(t)
+			ts := httptest.NewServer(fakeAPI)
+			defer ts.Close()
+
+			client := linodego.NewClient(http.DefaultClient)
+			client.SetBaseURL(ts.URL)
+
+			recorder := record.NewFakeRecorder(10)
+			fakeClientset := fake.NewSimpleClientset()
+			lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: randString(10), Namespace: "default", UID: "foobar123"},
+				Spec: v1.ServiceSpec{
+					Type:  v1.ServiceTypeLoadBalancer,
+					Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+				},
+			}
+			if _, err := fakeClientset.CoreV1().Services("default").Create(svc); err != nil {
+				t.Fatal(err)
+			}
+			nodes := []*v1.Node{{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+				Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}}},
+			}}
+
+			status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nodes)
+			if err != nil {
+				t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+			}
+			svc.Status.LoadBalancer = *status
+			if _, err = fakeClientset.CoreV1().Services("default").UpdateStatus(svc); err != nil {
+				t.Fatal(err)
+			}
+
+			// All the nodes of the cluster are gone, e.g. during a rolling replacement.
+			err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nil)
+			if test.err != (err != nil) {
+				t.Errorf("expected an error %t, got %v", test.err, err)
+			}
+			if len(fakeAPI.nbn) != test.backends {
+				t.Errorf("expected %d backends, got %d", test.backends, len(fakeAPI.nbn))
+			}
+			if event := <-recorder.Events; !strings.Contains(event, "NoBackendNodes") || !strings.Contains(event, test.event) {
+				t.Errorf("expected a NoBackendNodes event containing %q, got %q", test.event, event)
+			}
+
+			// Configs without backends have nothing to keep.
+			for id := range fakeAPI.nbn {
+				delete(fakeAPI.nbn, id)
+			}
+			if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nil); err != nil {
+				t.Errorf("UpdateLoadBalancer returned an error: %s", err)
+			}
+			if len(recorder.Events) != 0 {
+				t.Errorf("expected no events, got %q", <-recorder.Events)
+			}
+		})
+	}
+}
+
+func Test_validateEmptyBackendPolicy(t *testing.T) {
+	for _, policy := range []string{"", emptyBackendPolicyKeepLast, emptyBackendPolicyRemoveAll, emptyBackendPolicyFail} {
+		if err := validateEmptyBackendPolicy(policy); err != nil {
+			t.Errorf("expected policy %q to be valid, got %s", policy, err)
+		}
+	}
+	if err := validateEmptyBackendPolicy("keep"); err == nil {
+		t.Error("expected policy keep to be invalid")
+	}
+}
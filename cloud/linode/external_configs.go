@@ -0,0 +1,72 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+)
+
+// getPortConfigID returns the ID of the externally-managed config the annLinodePortConfigIDPrefix
+// annotation of port points to, if any.
+func getPortConfigID(service *v1.Service, port int) (int, bool, error) {
+	name := annLinodePortConfigIDPrefix + strconv.Itoa(port)
+	raw, ok := getServiceAnnotation(service, name)
+	if !ok {
+		return 0, false, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 1 {
+		return 0, false, fmt.Errorf("invalid value %q for %q: must be the ID of a NodeBalancer config", raw, name)
+	}
+	return id, true, nil
+}
+
+// getExternalConfig returns the config of nb, among its configs nbCfgs, that port is annotated to
+// use with annLinodePortConfigIDPrefix, or nil if port has no such annotation. The config must
+// belong to nb and listen on port, otherwise an event is recorded and an error returned.
+func (l *loadbalancers) getExternalConfig(service *v1.Service, nb *linodego.NodeBalancer, nbCfgs []linodego.NodeBalancerConfig, port v1.ServicePort) (*linodego.NodeBalancerConfig, error) {
+	id, ok, err := getPortConfigID(service, int(port.Port))
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	for i := range nbCfgs {
+		if nbCfgs[i].ID != id {
+			continue
+		}
+		if nbCfgs[i].Port != int(port.Port) {
+			err = fmt.Errorf("config (%d) referenced by %s%d listens on port %d of NodeBalancer (%d), not on port %d",
+				id, annLinodePortConfigIDPrefix, port.Port, nbCfgs[i].Port, nb.ID, port.Port)
+			l.recordEvent(service, v1.EventTypeWarning, "ConfigPortMismatch", "%s", err)
+			return nil, err
+		}
+		return &nbCfgs[i], nil
+	}
+
+	err = fmt.Errorf("config (%d) referenced by %s%d is not a config of NodeBalancer (%d)", id, annLinodePortConfigIDPrefix, port.Port, nb.ID)
+	l.recordEvent(service, v1.EventTypeWarning, "ConfigNotFound", "%s", err)
+	return nil, err
+}
+
+// syncExternalConfigNodes syncs the backend nodes of the externally-managed config of port with
+// nodes, leaving its protocol, health check, TLS and other settings as they are. The nodes are
+// weighted for the algorithm of the config rather than the one of the annotations.
+func (l *loadbalancers) syncExternalConfigNodes(ctx context.Context, service *v1.Service, nodes []*v1.Node, port v1.ServicePort, config *linodego.NodeBalancerConfig) error {
+	nodePort, err := l.getNodePort(service, port)
+	if err != nil {
+		return err
+	}
+
+	desired, err := l.buildNodeBalancerNodes(service, nodes, nodePort, config.Algorithm)
+	if err != nil {
+		return fmt.Errorf("error building NodeBalancer nodes: %v", err)
+	}
+	draining, err := l.getDrainingNodes(ctx, service, config.NodeBalancerID, config.ID, desired)
+	if err != nil {
+		return fmt.Errorf("error draining NodeBalancer nodes: %v", err)
+	}
+	return l.syncNodeBalancerNodes(ctx, service, config, append(desired, draining...))
+}
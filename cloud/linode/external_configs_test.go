@@ -0,0 +1,200 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestExternalConfig(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	nb, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPassive := false
+	external, err := client.CreateNodeBalancerConfig(context.TODO(), nb.ID, linodego.NodeBalancerConfigCreateOptions{
+		Port:         443,
+		Protocol:     linodego.ProtocolTCP,
+		Algorithm:    linodego.AlgorithmLeastConn,
+		Check:        linodego.CheckConnection,
+		CheckPassive: &checkPassive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      randString(10),
+			Namespace: "default",
+			UID:       "foobar123",
+			Annotations: map[string]string{
+				annLinodeNodeBalancerID:              strconv.Itoa(nb.ID),
+				annLinodePortConfigIDPrefix + "443":  strconv.Itoa(external.ID),
+				annLinodeHealthCheckType:             "http",
+				annLinodeCheckPath:                   "/healthz",
+				annLinodePortAlgorithmPrefix + "443": "source",
+				annLinodeHealthCheckPassive:          "true",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{
+				{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30443},
+				{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30080},
+			},
+		},
+	}
+	if _, err = fakeClientset.CoreV1().Services("default").Create(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	newNode := func(name, address string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: address}}},
+		}
+	}
+	nodes := []*v1.Node{newNode("node-1", "127.0.0.1"), newNode("node-2", "127.0.0.2")}
+
+	expectConfigs := func(stage string, addresses ...string) {
+		configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(configs) != 2 {
+			t.Fatalf("%s: expected 2 NodeBalancer configs, got %d", stage, len(configs))
+		}
+		for _, config := range configs {
+			if config.Port == 443 && (config.ID != external.ID || config.Algorithm != linodego.AlgorithmLeastConn ||
+				config.Check != linodego.CheckConnection || config.CheckPassive) {
+				t.Errorf("%s: expected the externally-managed config to be left as is, got %+v", stage, config)
+			}
+			if config.Port == 80 && config.Check != linodego.CheckHTTP {
+				t.Errorf("%s: expected the config of port 80 to be managed, got check %s", stage, config.Check)
+			}
+
+			nbNodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, config.ID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, node := range nbNodes {
+				actual = append(actual, node.Address)
+			}
+			sort.Strings(actual)
+			var expected []string
+			for _, address := range addresses {
+				expected = append(expected, address+":"+strconv.Itoa(30000+config.Port))
+			}
+			if strings.Join(actual, ",") != strings.Join(expected, ",") {
+				t.Errorf("%s: expected port %d to have nodes %v, got %v", stage, config.Port, expected, actual)
+			}
+		}
+	}
+
+	// The backends of the externally-managed config are synced, but not its settings.
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	expectConfigs("ensured", "127.0.0.1", "127.0.0.2")
+
+	// So are node removals.
+	svc.Status.LoadBalancer = *status
+	if _, err = fakeClientset.CoreV1().Services("default").UpdateStatus(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nodes[:1]); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectConfigs("node removed", "127.0.0.1")
+
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no events, got %q", <-recorder.Events)
+	}
+}
+
+func TestExternalConfigErrors(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	nb, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPassive := false
+	newConfig := func(nodeBalancerID, port int) *linodego.NodeBalancerConfig {
+		config, err := client.CreateNodeBalancerConfig(context.TODO(), nodeBalancerID, linodego.NodeBalancerConfigCreateOptions{
+			Port:         port,
+			Protocol:     linodego.ProtocolTCP,
+			CheckPassive: &checkPassive,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+	otherPort := newConfig(nb.ID, 8443)
+	otherNodeBalancer := newConfig(other.ID, 443)
+
+	for _, test := range []struct {
+		name     string
+		configID int
+		event    string
+	}{
+		{name: "other port", configID: otherPort.ID, event: "ConfigPortMismatch"},
+		{name: "other NodeBalancer", configID: otherNodeBalancer.ID, event: "ConfigNotFound"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "svc",
+					Namespace:   "default",
+					UID:         "foobar123",
+					Annotations: map[string]string{annLinodePortConfigIDPrefix + "443": strconv.Itoa(test.configID)},
+				},
+			}
+			configs := []linodego.NodeBalancerConfig{*otherPort}
+
+			config, err := lb.getExternalConfig(svc, nb, configs, v1.ServicePort{Port: 443})
+			if err == nil {
+				t.Fatalf("expected an error, got config %+v", config)
+			}
+			if event := <-recorder.Events; !strings.Contains(event, test.event) {
+				t.Errorf("expected a %s event, got %q", test.event, event)
+			}
+		})
+	}
+}
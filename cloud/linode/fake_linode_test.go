@@ -12,18 +12,28 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/linode/linodego"
 )
 
+// fakeRevokedToken is a token the fake API rejects.
+const fakeRevokedToken = "revoked-token"
+
 type fakeAPI struct {
-	t        *testing.T
+	t        testing.TB
+	mu       sync.Mutex
 	instance *linodego.Instance
 	ips      []*linodego.InstanceIP
 	nb       map[string]*linodego.NodeBalancer
 	nbc      map[string]*linodego.NodeBalancerConfig
 	nbn      map[string]*linodego.NodeBalancerNode
+	fw       map[int]*linodego.Firewall
+	fwd      map[int][]linodego.FirewallDevice
+	// dr are the records of the domains by domain ID; domains missing from it don't exist.
+	dr     map[int]map[int]*linodego.DomainRecord
+	events []linodego.Event
 
 	requests map[fakeRequest]struct{}
 }
@@ -39,7 +49,7 @@ type filterStruct struct {
 	NbID  string `json:"nodebalancer_id,omitempty"`
 }
 
-func newFake(t *testing.T) *fakeAPI {
+func newFake(t testing.TB) *fakeAPI {
 	publicIP := net.ParseIP("45.79.101.25")
 	privateIP := net.ParseIP("192.168.133.65")
 	instanceName := "test-instance"
@@ -79,6 +89,9 @@ func newFake(t *testing.T) *fakeAPI {
 		nb:       make(map[string]*linodego.NodeBalancer),
 		nbc:      make(map[string]*linodego.NodeBalancerConfig),
 		nbn:      make(map[string]*linodego.NodeBalancerNode),
+		fw:       make(map[int]*linodego.Firewall),
+		fwd:      make(map[int][]linodego.FirewallDevice),
+		dr:       make(map[int]map[int]*linodego.DomainRecord),
 		requests: make(map[fakeRequest]struct{}),
 	}
 }
@@ -95,6 +108,9 @@ func (f *fakeAPI) recordRequest(r *http.Request) {
 }
 
 func (f *fakeAPI) didRequestOccur(method, path, body string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	_, ok := f.requests[fakeRequest{
 		Path:   path,
 		Method: method,
@@ -104,14 +120,66 @@ func (f *fakeAPI) didRequestOccur(method, path, body string) bool {
 }
 
 func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	f.recordRequest(r)
 
 	w.Header().Set("Content-Type", "application/json")
 	urlPath := r.URL.Path
+	if strings.HasPrefix(urlPath, "/networking/firewalls") {
+		f.serveFirewalls(w, r)
+		return
+	}
+	if strings.HasPrefix(urlPath, "/domains") {
+		f.serveDomainRecords(w, r)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		whichAPI := strings.Split(urlPath[1:], "/")
 		switch whichAPI[0] {
+		case "regions":
+			if len(whichAPI) == 2 {
+				switch whichAPI[1] {
+				case "us-east", "us-west", "eu-west":
+					rr, _ := json.Marshal(linodego.Region{ID: whichAPI[1], Country: "us"})
+					_, _ = w.Write(rr)
+					return
+				}
+			}
+			w.WriteHeader(404)
+			rr, _ := json.Marshal(linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: "Not found"}}})
+			_, _ = w.Write(rr)
+			return
+		case "profile":
+			if r.Header.Get("Authorization") == "Bearer "+fakeRevokedToken {
+				w.WriteHeader(401)
+				rr, _ := json.Marshal(linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: "Invalid Token"}}})
+				_, _ = w.Write(rr)
+				return
+			}
+			rr, _ := json.Marshal(linodego.Profile{Username: "ccm"})
+			_, _ = w.Write(rr)
+			return
+		case "account":
+			if len(whichAPI) == 2 && whichAPI[1] == "events" {
+				// Event.Created isn't marshaled by linodego, so events are written field by field.
+				data := make([]map[string]interface{}, 0, len(f.events))
+				for _, event := range f.events {
+					data = append(data, map[string]interface{}{
+						"id":      event.ID,
+						"action":  event.Action,
+						"status":  event.Status,
+						"entity":  event.Entity,
+						"created": event.Created.UTC().Format("2006-01-02T15:04:05"),
+					})
+				}
+				rr, _ := json.Marshal(map[string]interface{}{"page": 1, "pages": 1, "results": len(data), "data": data})
+				_, _ = w.Write(rr)
+				return
+			}
 		case "linode":
 			switch whichAPI[1] {
 			case "instances":
@@ -134,7 +202,11 @@ func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 					if id == strconv.Itoa(f.instance.ID) {
 						rr, _ := json.Marshal(&f.instance)
 						_, _ = w.Write(rr)
+						return
 					}
+					w.WriteHeader(404)
+					rr, _ := json.Marshal(linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: "Not found"}}})
+					_, _ = w.Write(rr)
 					return
 				}
 
@@ -343,6 +415,7 @@ func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				Region:   nbco.Region,
 				IPv4:     &ip,
 				Hostname: &hostname,
+				Tags:     nbco.Tags,
 			}
 
 			if nbco.ClientConnThrottle != nil {
@@ -387,6 +460,7 @@ func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 						ID:             rand.Intn(99999),
 						Address:        nbnco.Address,
 						Label:          nbnco.Label,
+						Status:         "UP",
 						Weight:         nbnco.Weight,
 						Mode:           nbnco.Mode,
 						NodeBalancerID: nb.ID,
@@ -577,7 +651,30 @@ func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	case "PUT":
 		if strings.Contains(r.URL.Path, "nodes") {
-			f.t.Fatal("PUT ...nodes is not supported by the mock API")
+			nbnuo := new(linodego.NodeBalancerNodeUpdateOptions)
+			if err := json.NewDecoder(r.Body).Decode(nbnuo); err != nil {
+				f.t.Fatal(err)
+			}
+
+			nbn, found := f.nbn[filepath.Base(r.URL.Path)]
+			if !found {
+				w.WriteHeader(404)
+				rr, _ := json.Marshal(linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: "Not Found"}}})
+				_, _ = w.Write(rr)
+				return
+			}
+			if nbnuo.Label != "" {
+				nbn.Label = nbnuo.Label
+			}
+			if nbnuo.Weight != 0 {
+				nbn.Weight = nbnuo.Weight
+			}
+			if nbnuo.Mode != "" {
+				nbn.Mode = nbnuo.Mode
+			}
+			rr, _ := json.Marshal(nbn)
+			_, _ = w.Write(rr)
+			return
 		} else if strings.Contains(r.URL.Path, "configs") {
 			parts := strings.Split(r.URL.Path[1:], "/")
 			nbcco := new(linodego.NodeBalancerConfigUpdateOptions)
@@ -653,6 +750,9 @@ func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				if nbuo.Label != nil {
 					nb.Label = nbuo.Label
 				}
+				if nbuo.Tags != nil {
+					nb.Tags = *nbuo.Tags
+				}
 
 				f.nb[strconv.Itoa(nb.ID)] = nb
 				resp, err := json.Marshal(nb)
@@ -676,6 +776,193 @@ func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (f *fakeAPI) serveFirewalls(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/networking/firewalls"), "/")[1:]
+
+	writeJSON := func(v interface{}) {
+		rr, err := json.Marshal(v)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		_, _ = w.Write(rr)
+	}
+
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			data := []linodego.Firewall{}
+			for _, fw := range f.fw {
+				data = append(data, *fw)
+			}
+			writeJSON(linodego.FirewallsPagedResponse{
+				PageOptions: &linodego.PageOptions{Page: 1, Pages: 1, Results: len(data)},
+				Data:        data,
+			})
+		case "POST":
+			fwco := linodego.FirewallCreateOptions{}
+			if err := json.NewDecoder(r.Body).Decode(&fwco); err != nil {
+				f.t.Fatal(err)
+			}
+			fw := &linodego.Firewall{
+				ID:     rand.Intn(9999),
+				Label:  fwco.Label,
+				Status: linodego.FirewallEnabled,
+				Tags:   fwco.Tags,
+				Rules:  fwco.Rules,
+			}
+			f.fw[fw.ID] = fw
+			for _, nbID := range fwco.Devices.NodeBalancers {
+				f.fwd[fw.ID] = append(f.fwd[fw.ID], linodego.FirewallDevice{
+					ID:     rand.Intn(9999),
+					Entity: linodego.FirewallDeviceEntity{ID: nbID, Type: linodego.FirewallDeviceNodeBalancer},
+				})
+			}
+			writeJSON(fw)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	fw, found := f.fw[id]
+	if !found {
+		w.WriteHeader(404)
+		writeJSON(linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: "Not Found"}}})
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		writeJSON(fw)
+	case len(parts) == 1 && r.Method == "PUT":
+		fwuo := linodego.FirewallUpdateOptions{}
+		if err := json.NewDecoder(r.Body).Decode(&fwuo); err != nil {
+			f.t.Fatal(err)
+		}
+		if fwuo.Tags != nil {
+			fw.Tags = *fwuo.Tags
+		}
+		writeJSON(fw)
+	case len(parts) == 1 && r.Method == "DELETE":
+		delete(f.fw, id)
+		delete(f.fwd, id)
+	case len(parts) == 2 && parts[1] == "rules" && r.Method == "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&fw.Rules); err != nil {
+			f.t.Fatal(err)
+		}
+		writeJSON(fw.Rules)
+	case len(parts) == 2 && parts[1] == "devices" && r.Method == "GET":
+		data := append([]linodego.FirewallDevice{}, f.fwd[id]...)
+		writeJSON(linodego.FirewallDevicesPagedResponse{
+			PageOptions: &linodego.PageOptions{Page: 1, Pages: 1, Results: len(data)},
+			Data:        data,
+		})
+	case len(parts) == 2 && parts[1] == "devices" && r.Method == "POST":
+		fwdco := linodego.FirewallDeviceCreateOptions{}
+		if err := json.NewDecoder(r.Body).Decode(&fwdco); err != nil {
+			f.t.Fatal(err)
+		}
+		device := linodego.FirewallDevice{
+			ID:     rand.Intn(9999),
+			Entity: linodego.FirewallDeviceEntity{ID: fwdco.ID, Type: fwdco.Type},
+		}
+		f.fwd[id] = append(f.fwd[id], device)
+		writeJSON(device)
+	case len(parts) == 3 && parts[1] == "devices" && r.Method == "DELETE":
+		devices := f.fwd[id][:0]
+		for _, device := range f.fwd[id] {
+			if strconv.Itoa(device.ID) != parts[2] {
+				devices = append(devices, device)
+			}
+		}
+		f.fwd[id] = devices
+	default:
+		f.t.Fatalf("%s %s is not supported by the mock API", r.Method, r.URL.Path)
+	}
+}
+
+func (f *fakeAPI) serveDomainRecords(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/domains"), "/")[1:]
+
+	writeJSON := func(v interface{}) {
+		rr, err := json.Marshal(v)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		_, _ = w.Write(rr)
+	}
+
+	if len(parts) < 2 || parts[1] != "records" {
+		f.t.Fatalf("%s %s is not supported by the mock API", r.Method, r.URL.Path)
+	}
+	domainID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	records, found := f.dr[domainID]
+	if !found {
+		w.WriteHeader(404)
+		writeJSON(linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: "Not Found"}}})
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && r.Method == "GET":
+		data := []linodego.DomainRecord{}
+		for _, record := range records {
+			data = append(data, *record)
+		}
+		writeJSON(linodego.DomainRecordsPagedResponse{
+			PageOptions: &linodego.PageOptions{Page: 1, Pages: 1, Results: len(data)},
+			Data:        data,
+		})
+	case len(parts) == 2 && r.Method == "POST":
+		drco := linodego.DomainRecordCreateOptions{}
+		if err := json.NewDecoder(r.Body).Decode(&drco); err != nil {
+			f.t.Fatal(err)
+		}
+		record := &linodego.DomainRecord{
+			ID:     rand.Intn(9999),
+			Type:   drco.Type,
+			Name:   drco.Name,
+			Target: drco.Target,
+			TTLSec: drco.TTLSec,
+		}
+		records[record.ID] = record
+		writeJSON(record)
+	case len(parts) == 3 && (r.Method == "PUT" || r.Method == "DELETE"):
+		id, err := strconv.Atoi(parts[2])
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		record, found := records[id]
+		if !found {
+			w.WriteHeader(404)
+			writeJSON(linodego.APIError{Errors: []linodego.APIErrorReason{{Reason: "Not Found"}}})
+			return
+		}
+		if r.Method == "DELETE" {
+			delete(records, id)
+			return
+		}
+		druo := linodego.DomainRecordUpdateOptions{}
+		if err := json.NewDecoder(r.Body).Decode(&druo); err != nil {
+			f.t.Fatal(err)
+		}
+		if druo.Target != "" {
+			record.Target = druo.Target
+		}
+		if druo.TTLSec != 0 {
+			record.TTLSec = druo.TTLSec
+		}
+		writeJSON(record)
+	default:
+		f.t.Fatalf("%s %s is not supported by the mock API", r.Method, r.URL.Path)
+	}
+}
+
 func randString(n int) string {
 	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	b := make([]byte, n)
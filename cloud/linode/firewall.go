@@ -0,0 +1,573 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// annLinodeFirewallID is the annotation specifying the ID of an existing Cloud Firewall to
+	// attach to the NodeBalancer. The CCM never deletes this firewall.
+	annLinodeFirewallID = "service.beta.kubernetes.io/linode-loadbalancer-firewall-id"
+
+	// annLinodeFirewallACL is the annotation specifying, in JSON, the rules of a Cloud Firewall
+	// the CCM creates, attaches to the NodeBalancer and deletes along with the Service.
+	annLinodeFirewallACL = "service.beta.kubernetes.io/linode-loadbalancer-firewall-acl"
+
+	// firewallOwnerTagPrefix prefixes the tag recording which Service a CCM-created firewall
+	// belongs to, e.g. "ccm-firewall:<service uid>".
+	firewallOwnerTagPrefix = "ccm-firewall:"
+
+	// firewallAttachedTagPrefix prefixes the tag recording which Services attached their
+	// NodeBalancer to a firewall they reference by ID or name, e.g.
+	// "ccm-firewall-attached:<service uid>", so that it is detached when the reference changes,
+	// even after a restart.
+	firewallAttachedTagPrefix = "ccm-firewall-attached:"
+)
+
+// firewallACL is the value of annLinodeFirewallACL.
+type firewallACL struct {
+	AllowList *firewallACLAddresses `json:"allowList"`
+	DenyList  *firewallACLAddresses `json:"denyList"`
+
+	// Ports restricts the rules to the given ports, defaulting to the Service's ports.
+	Ports []int `json:"ports"`
+}
+
+type firewallACLAddresses struct {
+	IPv4 []string `json:"ipv4"`
+	IPv6 []string `json:"ipv6"`
+}
+
+// getFirewallRules returns the firewall rules described by service's firewall ACL annotation.
+func getFirewallRules(service *v1.Service, rawACL string) (linodego.FirewallRuleSet, error) {
+	var acl firewallACL
+	if err := json.Unmarshal([]byte(rawACL), &acl); err != nil {
+		return linodego.FirewallRuleSet{}, fmt.Errorf("invalid value for %s: %s", annLinodeFirewallACL, err)
+	}
+
+	// Cloud Firewalls drop all traffic that isn't explicitly allowed, so there is no way to only
+	// deny some addresses.
+	if acl.DenyList != nil {
+		return linodego.FirewallRuleSet{}, fmt.Errorf("invalid value for %s: denyList is not supported, Cloud Firewalls only allow the addresses in allowList", annLinodeFirewallACL)
+	}
+	if acl.AllowList == nil {
+		return linodego.FirewallRuleSet{}, fmt.Errorf("invalid value for %s: allowList must be specified", annLinodeFirewallACL)
+	}
+	return getACLFirewallRules(service, acl)
+}
+
+// getSourceRangesFirewallRules returns the firewall rules only allowing service's
+// loadBalancerSourceRanges to reach its ports.
+func getSourceRangesFirewallRules(service *v1.Service) (linodego.FirewallRuleSet, error) {
+	allowList := &firewallACLAddresses{}
+	for _, sourceRange := range service.Spec.LoadBalancerSourceRanges {
+		ip, _, err := net.ParseCIDR(strings.TrimSpace(sourceRange))
+		if err != nil {
+			return linodego.FirewallRuleSet{}, fmt.Errorf("invalid loadBalancerSourceRanges: %q is not a CIDR", sourceRange)
+		}
+		if ip.To4() != nil {
+			allowList.IPv4 = append(allowList.IPv4, strings.TrimSpace(sourceRange))
+		} else {
+			allowList.IPv6 = append(allowList.IPv6, strings.TrimSpace(sourceRange))
+		}
+	}
+	return getACLFirewallRules(service, firewallACL{AllowList: allowList})
+}
+
+// getACLFirewallRules returns the firewall rules allowing the addresses of acl's allowList to
+// reach its ports.
+func getACLFirewallRules(service *v1.Service, acl firewallACL) (linodego.FirewallRuleSet, error) {
+	addresses := linodego.NetworkAddresses{IPv4: []string{}, IPv6: []string{}}
+	for _, address := range acl.AllowList.IPv4 {
+		cidr, err := normalizeFirewallAddress(address, false)
+		if err != nil {
+			return linodego.FirewallRuleSet{}, err
+		}
+		addresses.IPv4 = append(addresses.IPv4, cidr)
+	}
+	for _, address := range acl.AllowList.IPv6 {
+		cidr, err := normalizeFirewallAddress(address, true)
+		if err != nil {
+			return linodego.FirewallRuleSet{}, err
+		}
+		addresses.IPv6 = append(addresses.IPv6, cidr)
+	}
+
+	ports := acl.Ports
+	if len(ports) == 0 {
+		ports = getServicePorts(service)
+	}
+	var tcpPorts, udpPorts []string
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return linodego.FirewallRuleSet{}, fmt.Errorf("invalid value for %s: invalid port %d", annLinodeFirewallACL, port)
+		}
+		if getServicePortProtocol(service, port) == v1.ProtocolUDP {
+			udpPorts = append(udpPorts, strconv.Itoa(port))
+		} else {
+			tcpPorts = append(tcpPorts, strconv.Itoa(port))
+		}
+	}
+
+	var rules linodego.FirewallRuleSet
+	if len(tcpPorts) > 0 || len(udpPorts) == 0 {
+		rules.Inbound = append(rules.Inbound, linodego.FirewallRule{
+			Ports:     strings.Join(tcpPorts, ","),
+			Protocol:  linodego.TCP,
+			Addresses: addresses,
+		})
+	}
+	if len(udpPorts) > 0 {
+		rules.Inbound = append(rules.Inbound, linodego.FirewallRule{
+			Ports:     strings.Join(udpPorts, ","),
+			Protocol:  linodego.UDP,
+			Addresses: addresses,
+		})
+	}
+	return rules, nil
+}
+
+// normalizeFirewallAddress returns address as a CIDR, the form returned by the API.
+func normalizeFirewallAddress(address string, ipv6 bool) (string, error) {
+	ip, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		if ip = net.ParseIP(address); ip == nil {
+			return "", fmt.Errorf("invalid value for %s: invalid address %q", annLinodeFirewallACL, address)
+		}
+		bits := 32
+		if ipv6 {
+			bits = 128
+		}
+		ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+
+	if (ip.To4() == nil) != ipv6 {
+		return "", fmt.Errorf("invalid value for %s: address %q is not of the right IP version", annLinodeFirewallACL, address)
+	}
+	return ipNet.String(), nil
+}
+
+func firewallOwnerTag(service *v1.Service) string {
+	return firewallOwnerTagPrefix + string(service.UID)
+}
+
+func firewallAttachedTag(service *v1.Service) string {
+	return firewallAttachedTagPrefix + string(service.UID)
+}
+
+// firewallLabel returns the label of the firewall created for service, which is the label of the
+// Service's NodeBalancer.
+func firewallLabel(service *v1.Service) string {
+	return nodeBalancerLabel(service)
+}
+
+// reconcileFirewall makes sure the firewall requested by service's annotations is attached to nb.
+func (l *loadbalancers) reconcileFirewall(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	rawID, hasID := getServiceAnnotation(service, annLinodeFirewallID)
+	name, hasName := getServiceAnnotation(service, annLinodeFirewallName)
+	rawACL, hasACL := getServiceAnnotation(service, annLinodeFirewallACL)
+
+	hasSourceRanges := len(service.Spec.LoadBalancerSourceRanges) > 0
+
+	// The firewall referenced by ID takes precedence over the one referenced by name.
+	referencedBy, referenced := annLinodeFirewallID, rawID
+	if !hasID && hasName {
+		referencedBy, referenced = annLinodeFirewallName, name
+	}
+
+	if hasID && hasName {
+		l.recordEvent(service, v1.EventTypeWarning, "FirewallNameIgnored",
+			"both %s and %s are set, using firewall %s and ignoring the name %q", annLinodeFirewallID, annLinodeFirewallName, rawID, name)
+	}
+	if (hasID || hasName) && hasACL {
+		l.recordEvent(service, v1.EventTypeWarning, "FirewallACLIgnored",
+			"both %s and %s are set, using firewall %s and ignoring the ACL", referencedBy, annLinodeFirewallACL, referenced)
+	}
+	// Firewalls specified through annotations are managed by the user, so the source ranges
+	// mustn't fight over their rules.
+	if hasSourceRanges && (hasID || hasName || hasACL) {
+		annotation := annLinodeFirewallACL
+		if hasID || hasName {
+			annotation = referencedBy
+		}
+		l.recordEvent(service, v1.EventTypeWarning, "SourceRangesIgnored",
+			"loadBalancerSourceRanges is ignored because the firewall is configured with %s", annotation)
+	}
+
+	owned, err := l.getServiceFirewall(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	if hasID || hasName {
+		var id int
+		if hasID {
+			if id, err = strconv.Atoi(rawID); err != nil {
+				return fmt.Errorf("invalid value %q for %s: must be a firewall ID", rawID, annLinodeFirewallID)
+			}
+		} else if id, err = l.resolveFirewallName(ctx, service, name); err != nil {
+			return err
+		}
+		if owned != nil && owned.ID != id {
+			if err := l.deleteFirewall(ctx, service, owned); err != nil {
+				return err
+			}
+		}
+		if err = l.detachPreviousFirewall(ctx, service, id, nb); err != nil {
+			return err
+		}
+		if err = l.attachFirewall(ctx, service, id, nb); err != nil {
+			if !hasID && classifyAPIError(err) == apiErrorNotFound {
+				// The firewall the name was cached as was deleted, so the next reconcile
+				// resolves the name again.
+				l.firewallNames.forgetName(name)
+			}
+			return err
+		}
+		if previous, ok := l.firewallNames.attachedTo(service.UID); !ok || previous != id {
+			if err = l.setFirewallAttachedTag(ctx, service, id, true); err != nil {
+				return err
+			}
+		}
+		l.firewallNames.setAttached(service.UID, id)
+		return nil
+	}
+	if err = l.detachPreviousFirewall(ctx, service, 0, nb); err != nil {
+		return err
+	}
+
+	if !hasACL && !hasSourceRanges {
+		if owned != nil {
+			return l.deleteFirewall(ctx, service, owned)
+		}
+		return nil
+	}
+
+	var rules linodego.FirewallRuleSet
+	if hasACL {
+		if rules, err = getFirewallRules(service, rawACL); err != nil {
+			l.recordEvent(service, v1.EventTypeWarning, "InvalidFirewallACL", "%s", err)
+			return err
+		}
+	} else if rules, err = getSourceRangesFirewallRules(service); err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidSourceRanges", "%s", err)
+		return err
+	}
+
+	if owned == nil {
+		return l.createFirewall(ctx, service, nb, rules)
+	}
+
+	if !reflect.DeepEqual(owned.Rules.Inbound, rules.Inbound) {
+		if l.dryRun {
+			l.logDryRun(service, dryRunChange{Action: "update-firewall-rules", Current: owned.Rules, Desired: rules})
+		} else if _, err := l.client.UpdateFirewallRules(ctx, owned.ID, rules); err != nil {
+			return err
+		}
+	}
+	return l.attachFirewall(ctx, service, owned.ID, nb)
+}
+
+// getServiceFirewall returns the firewall the CCM created for service, if any.
+func (l *loadbalancers) getServiceFirewall(ctx context.Context, service *v1.Service) (*linodego.Firewall, error) {
+	firewalls, err := l.client.ListFirewalls(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := firewallOwnerTag(service)
+	for i := range firewalls {
+		for _, t := range firewalls[i].Tags {
+			if t == tag {
+				return &firewalls[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (l *loadbalancers) createFirewall(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer, rules linodego.FirewallRuleSet) error {
+	createOpts := linodego.FirewallCreateOptions{
+		Label:   firewallLabel(service),
+		Rules:   rules,
+		Tags:    []string{firewallOwnerTag(service)},
+		Devices: linodego.DevicesCreationOptions{NodeBalancers: []int{nb.ID}},
+	}
+
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "create-firewall", NodeBalancerID: nb.ID, Desired: createOpts})
+		return nil
+	}
+
+	firewall, err := l.client.CreateFirewall(ctx, createOpts)
+	if err != nil {
+		return err
+	}
+	klog.Infof("created firewall (%d) for NodeBalancer (%d) of service (%s)", firewall.ID, nb.ID, getServiceNn(service))
+	return nil
+}
+
+// attachFirewall attaches the firewall firewallID to nb if it isn't already.
+func (l *loadbalancers) attachFirewall(ctx context.Context, service *v1.Service, firewallID int, nb *linodego.NodeBalancer) error {
+	devices, err := l.client.ListFirewallDevices(ctx, firewallID, nil)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		if device.Entity.Type == linodego.FirewallDeviceNodeBalancer && device.Entity.ID == nb.ID {
+			return nil
+		}
+	}
+
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "attach-firewall", NodeBalancerID: nb.ID, Desired: firewallID})
+		return nil
+	}
+
+	_, err = l.client.CreateFirewallDevice(ctx, firewallID, linodego.FirewallDeviceCreateOptions{
+		ID:   nb.ID,
+		Type: linodego.FirewallDeviceNodeBalancer,
+	})
+	return err
+}
+
+// detachPreviousFirewall detaches nb from the firewall service was last attached to by its
+// firewall-id or firewall-name annotation if it isn't firewallID, e.g. as the annotation was
+// changed or removed.
+func (l *loadbalancers) detachPreviousFirewall(ctx context.Context, service *v1.Service, firewallID int, nb *linodego.NodeBalancer) error {
+	previous, ok, err := l.getAttachedFirewallID(ctx, service)
+	if err != nil || !ok || previous == firewallID {
+		return err
+	}
+	if err := l.detachFirewall(ctx, service, previous, nb); err != nil {
+		return fmt.Errorf("failed to detach NodeBalancer (%d) from previously referenced firewall (%d): %v", nb.ID, previous, err)
+	}
+	l.firewallNames.forgetAttached(service.UID)
+	return nil
+}
+
+func (l *loadbalancers) deleteFirewall(ctx context.Context, service *v1.Service, firewall *linodego.Firewall) error {
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "delete-firewall", Current: firewall})
+		return nil
+	}
+
+	if err := l.client.DeleteFirewall(ctx, firewall.ID); err != nil {
+		return err
+	}
+	klog.Infof("deleted firewall (%d) of service (%s)", firewall.ID, getServiceNn(service))
+	return nil
+}
+
+// deleteOwnedFirewalls deletes the firewalls the CCM created for the Services with the given
+// UIDs, e.g. once their orphaned NodeBalancer was deleted.
+func (l *loadbalancers) deleteOwnedFirewalls(ctx context.Context, uids []string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	firewalls, err := l.client.ListFirewalls(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	tags := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		tags[firewallOwnerTagPrefix+uid] = true
+	}
+	for i := range firewalls {
+		firewall := &firewalls[i]
+		owned := false
+		for _, tag := range firewall.Tags {
+			owned = owned || tags[tag]
+		}
+		if !owned {
+			continue
+		}
+
+		if l.dryRun {
+			l.logDryRun(nil, dryRunChange{Action: "delete-firewall", Current: firewall})
+			continue
+		}
+		if err := l.client.DeleteFirewall(ctx, firewall.ID); err != nil && classifyAPIError(err) != apiErrorNotFound {
+			return err
+		}
+		klog.Infof("deleted firewall (%d) with tags %v", firewall.ID, firewall.Tags)
+	}
+	return nil
+}
+
+// getAttachedFirewallID returns the firewall service attached its NodeBalancer to by ID or name,
+// if any. It is looked up by its firewallAttachedTag when the firewallNames cache doesn't know
+// it, e.g. after a restart.
+func (l *loadbalancers) getAttachedFirewallID(ctx context.Context, service *v1.Service) (int, bool, error) {
+	if id, ok := l.firewallNames.attachedTo(service.UID); ok {
+		return id, true, nil
+	}
+
+	firewalls, err := l.client.ListFirewalls(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	tag := firewallAttachedTag(service)
+	for _, firewall := range firewalls {
+		if containsString(firewall.Tags, tag) {
+			l.firewallNames.setAttached(service.UID, firewall.ID)
+			return firewall.ID, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// setFirewallAttachedTag adds the firewallAttachedTag of service to the firewall firewallID, or
+// removes it if attached is false. Firewalls that no longer exist are ignored.
+func (l *loadbalancers) setFirewallAttachedTag(ctx context.Context, service *v1.Service, firewallID int, attached bool) error {
+	firewall, err := l.client.GetFirewall(ctx, firewallID)
+	if classifyAPIError(err) == apiErrorNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tag := firewallAttachedTag(service)
+	if containsString(firewall.Tags, tag) == attached {
+		return nil
+	}
+	tags := make([]string, 0, len(firewall.Tags)+1)
+	for _, t := range firewall.Tags {
+		if t != tag {
+			tags = append(tags, t)
+		}
+	}
+	if attached {
+		tags = append(tags, tag)
+	}
+
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "update-firewall-tags", Current: firewall.Tags, Desired: tags})
+		return nil
+	}
+	_, err = l.client.UpdateFirewall(ctx, firewallID, linodego.FirewallUpdateOptions{Tags: &tags})
+	return err
+}
+
+// detachFirewall detaches nb from the firewall firewallID referenced by service, leaving the
+// firewall's rules and other devices untouched. Firewalls referenced by several Services sharing
+// nb stay attached until the last of them is deleted.
+func (l *loadbalancers) detachFirewall(ctx context.Context, service *v1.Service, firewallID int, nb *linodego.NodeBalancer) error {
+	if err := l.setFirewallAttachedTag(ctx, service, firewallID, false); err != nil {
+		return err
+	}
+	if referenced, err := l.isFirewallReferencedByOtherServices(ctx, service, firewallID, nb); err != nil || referenced {
+		return err
+	}
+
+	devices, err := l.client.ListFirewallDevices(ctx, firewallID, nil)
+	if classifyAPIError(err) == apiErrorNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		if device.Entity.Type != linodego.FirewallDeviceNodeBalancer || device.Entity.ID != nb.ID {
+			continue
+		}
+
+		if l.dryRun {
+			l.logDryRun(service, dryRunChange{Action: "detach-firewall", NodeBalancerID: nb.ID, Current: firewallID})
+			return nil
+		}
+		if err = l.client.DeleteFirewallDevice(ctx, firewallID, device.ID); err != nil && classifyAPIError(err) != apiErrorNotFound {
+			return err
+		}
+		klog.Infof("detached NodeBalancer (%d) of service (%s) from firewall (%d)", nb.ID, getServiceNn(service), firewallID)
+	}
+	return nil
+}
+
+// isFirewallReferencedByOtherServices reports whether another Service sharing nb references the
+// firewall firewallID, or attached nb to it.
+func (l *loadbalancers) isFirewallReferencedByOtherServices(ctx context.Context, service *v1.Service, firewallID int, nb *linodego.NodeBalancer) (bool, error) {
+	if !isSharedWithOtherServices(nb, service) {
+		return false, nil
+	}
+	if err := l.retrieveKubeClient(); err != nil {
+		return false, err
+	}
+
+	var tags []string
+	if firewall, err := l.client.GetFirewall(ctx, firewallID); err == nil {
+		tags = firewall.Tags
+	} else if classifyAPIError(err) != apiErrorNotFound {
+		return false, err
+	}
+
+	owners := make(map[string]bool)
+	for _, uid := range getPortOwners(nb) {
+		owners[uid] = true
+	}
+
+	services, err := l.kubeClient.CoreV1().Services("").List(metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, other := range services.Items {
+		if other.UID == service.UID || !owners[string(other.UID)] {
+			continue
+		}
+		if rawID, ok := getServiceAnnotation(&other, annLinodeFirewallID); ok && rawID == strconv.Itoa(firewallID) {
+			return true, nil
+		}
+		if id, ok := l.firewallNames.attachedTo(other.UID); ok && id == firewallID {
+			return true, nil
+		}
+		if containsString(tags, firewallAttachedTag(&other)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getReferencedFirewallID returns the ID of the firewall referenced by the firewall-id or
+// firewall-name annotation of service, if any. A name that no longer resolves to a single firewall
+// references none, unless service's NodeBalancer is attached to a firewall by name. Without
+// either annotation, the firewall service last attached its NodeBalancer to is returned.
+func (l *loadbalancers) getReferencedFirewallID(ctx context.Context, service *v1.Service) (int, bool, error) {
+	if rawID, ok := getServiceAnnotation(service, annLinodeFirewallID); ok {
+		id, err := strconv.Atoi(rawID)
+		return id, err == nil, nil
+	}
+	name, hasName := getServiceAnnotation(service, annLinodeFirewallName)
+	if id, ok, err := l.getAttachedFirewallID(ctx, service); err != nil || ok {
+		return id, ok, err
+	}
+	if !hasName {
+		return 0, false, nil
+	}
+	ids, err := l.findFirewallsByName(ctx, name)
+	if err != nil || len(ids) != 1 {
+		return 0, false, err
+	}
+	return ids[0], true, nil
+}
+
+// deleteServiceFirewall deletes the firewall the CCM created for service, if any. Firewalls
+// referenced by annLinodeFirewallID or annLinodeFirewallName aren't owned by the Service and are left untouched.
+func (l *loadbalancers) deleteServiceFirewall(ctx context.Context, service *v1.Service) error {
+	owned, err := l.getServiceFirewall(ctx, service)
+	if err != nil || owned == nil {
+		return err
+	}
+	return l.deleteFirewall(ctx, service, owned)
+}
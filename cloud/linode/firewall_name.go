@@ -0,0 +1,144 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// annLinodeFirewallName is the annotation specifying the label of an existing Cloud Firewall to
+// attach to the NodeBalancer, like annLinodeFirewallID. The CCM never deletes this firewall.
+const annLinodeFirewallName = "service.beta.kubernetes.io/linode-loadbalancer-firewall-name"
+
+// firewallNameCacheTTL is how long the ID a firewall label resolved to is used without listing
+// the firewalls again, so that a label moved to another firewall is eventually followed.
+var firewallNameCacheTTL = 10 * time.Minute
+
+type resolvedFirewallName struct {
+	id         int
+	resolvedAt time.Time
+}
+
+// firewallNameCache caches the IDs the labels of the firewall-name annotations resolved to, and
+// which firewall each Service was attached to by ID or name, to detach it when the annotation
+// changes or is removed.
+type firewallNameCache struct {
+	mu       sync.Mutex
+	ids      map[string]resolvedFirewallName
+	attached map[types.UID]int
+}
+
+// get returns the ID name resolved to, if it was resolved within firewallNameCacheTTL of now.
+func (c *firewallNameCache) get(name string, now time.Time) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resolved, ok := c.ids[name]
+	if !ok || now.Sub(resolved.resolvedAt) >= firewallNameCacheTTL {
+		return 0, false
+	}
+	return resolved.id, true
+}
+
+func (c *firewallNameCache) set(name string, id int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ids == nil {
+		c.ids = make(map[string]resolvedFirewallName)
+	}
+	c.ids[name] = resolvedFirewallName{id: id, resolvedAt: now}
+}
+
+// forgetName forgets the ID name resolved to, e.g. once the firewall was found to be deleted.
+func (c *firewallNameCache) forgetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.ids, name)
+}
+
+// attachedTo returns the firewall the Service uid was last attached to by ID or name, if any.
+func (c *firewallNameCache) attachedTo(uid types.UID) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, ok := c.attached[uid]
+	return id, ok
+}
+
+func (c *firewallNameCache) setAttached(uid types.UID, id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.attached == nil {
+		c.attached = make(map[types.UID]int)
+	}
+	c.attached[uid] = id
+}
+
+func (c *firewallNameCache) forgetAttached(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.attached, uid)
+}
+
+// findFirewallsByName returns the sorted IDs of the firewalls labeled name. A name resolved to a
+// single firewall is cached for firewallNameCacheTTL.
+func (l *loadbalancers) findFirewallsByName(ctx context.Context, name string) ([]int, error) {
+	now := time.Now()
+	if id, ok := l.firewallNames.get(name, now); ok {
+		return []int{id}, nil
+	}
+
+	firewalls, err := l.client.ListFirewalls(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, firewall := range firewalls {
+		if firewall.Label == name {
+			ids = append(ids, firewall.ID)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) == 1 {
+		l.firewallNames.set(name, ids[0], now)
+	}
+	return ids, nil
+}
+
+// resolveFirewallName returns the ID of the firewall labeled name requested by the firewall-name
+// annotation of service, recording an event if no firewall or several firewalls are labeled name.
+func (l *loadbalancers) resolveFirewallName(ctx context.Context, service *v1.Service, name string) (int, error) {
+	ids, err := l.findFirewallsByName(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list firewalls to resolve %s %q: %v", annLinodeFirewallName, name, err)
+	}
+
+	switch len(ids) {
+	case 0:
+		err = fmt.Errorf("no firewall is labeled %q as requested by %s", name, annLinodeFirewallName)
+		l.recordEvent(service, v1.EventTypeWarning, "FirewallNotFound", "%s", err)
+		return 0, err
+	case 1:
+		return ids[0], nil
+	default:
+		idList := make([]string, len(ids))
+		for i, id := range ids {
+			idList[i] = strconv.Itoa(id)
+		}
+		err = fmt.Errorf("%d firewalls are labeled %q as requested by %s: %s; use %s to pick one",
+			len(ids), name, annLinodeFirewallName, strings.Join(idList, ", "), annLinodeFirewallID)
+		l.recordEvent(service, v1.EventTypeWarning, "FirewallAmbiguous", "%s", err)
+		return 0, err
+	}
+}
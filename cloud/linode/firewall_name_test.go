@@ -0,0 +1,167 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestFirewallName(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	newFirewall := func(label string) *linodego.Firewall {
+		firewall, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{Label: label})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return firewall
+	}
+	web := newFirewall("web")
+	admin := newFirewall("admin")
+
+	recorder := record.NewFakeRecorder(10)
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			Namespace:   "default",
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeFirewallName: "web"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	if _, err := fakeClientset.CoreV1().Services("default").Create(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAttached := func(stage string, firewall *linodego.Firewall, nbID int) {
+		devices := fakeAPI.fwd[firewall.ID]
+		if nbID == 0 && len(devices) != 0 {
+			t.Errorf("%s: expected firewall %q to be detached, got %v", stage, firewall.Label, devices)
+		}
+		if nbID != 0 && (len(devices) != 1 || devices[0].Entity.ID != nbID) {
+			t.Errorf("%s: expected firewall %q to be attached to NodeBalancer (%d), got %v", stage, firewall.Label, nbID, devices)
+		}
+	}
+
+	// The name is resolved to the firewall labeled with it.
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *status
+	if _, err = fakeClientset.CoreV1().Services("default").UpdateStatus(svc); err != nil {
+		t.Fatal(err)
+	}
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAttached("resolved", web, nb.ID)
+	expectAttached("resolved", admin, 0)
+
+	// Changing the name moves the NodeBalancer to the other firewall.
+	svc.Annotations[annLinodeFirewallName] = "admin"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectAttached("renamed", web, 0)
+	expectAttached("renamed", admin, nb.ID)
+
+	// The firewall is only detached along with the Service.
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "linodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if _, found := fakeAPI.fw[admin.ID]; !found {
+		t.Error("expected the firewall referenced by name not to be deleted")
+	}
+	expectAttached("deleted", admin, 0)
+
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no events, got %q", <-recorder.Events)
+	}
+}
+
+func TestFirewallNameResolutionErrors(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	for _, label := range []string{"web", "web", "admin"} {
+		if _, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{Label: label}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name  string
+		label string
+		event string
+	}{
+		{name: "not found", label: "db", event: `FirewallNotFound no firewall is labeled "db"`},
+		{name: "ambiguous", label: "web", event: `FirewallAmbiguous 2 firewalls are labeled "web"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", UID: "foobar123"}}
+
+			if _, err := lb.resolveFirewallName(context.TODO(), svc, test.label); err == nil {
+				t.Fatal("expected an error")
+			}
+			if event := <-recorder.Events; !strings.Contains(event, test.event) {
+				t.Errorf("expected an event containing %q, got %q", test.event, event)
+			}
+			if _, ok := lb.firewallNames.get(test.label, time.Now()); ok {
+				t.Error("expected the name not to be cached")
+			}
+		})
+	}
+}
+
+func TestFirewallNameCache(t *testing.T) {
+	var cache firewallNameCache
+	now := time.Now()
+
+	cache.set("web", 1, now)
+	for _, test := range []struct {
+		name     string
+		at       time.Time
+		expected bool
+	}{
+		{name: "just resolved", at: now, expected: true},
+		{name: "within the TTL", at: now.Add(firewallNameCacheTTL - time.Second), expected: true},
+		{name: "after the TTL", at: now.Add(firewallNameCacheTTL), expected: false},
+	} {
+		if id, ok := cache.get("web", test.at); ok != test.expected || (ok && id != 1) {
+			t.Errorf("%s: expected cached %t, got %d, %t", test.name, test.expected, id, ok)
+		}
+	}
+
+	cache.forgetName("web")
+	if _, ok := cache.get("web", now); ok {
+		t.Error("expected the name to be forgotten")
+	}
+}
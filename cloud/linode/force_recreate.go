@@ -0,0 +1,95 @@
+package linode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+)
+
+// forceRecreateTagPrefix is the prefix of the tag recording the value of the force-recreate
+// annotation a NodeBalancer was created for, so that each value recreates the NodeBalancer once,
+// even if the reconcile recreating it fails after creating it.
+const forceRecreateTagPrefix = "ccm-force-recreate:"
+
+// forceRecreateTag returns the tag of NodeBalancers created for the current value of the
+// force-recreate annotation of service, holding a hash of the value as tags are short.
+func forceRecreateTag(service *v1.Service) (string, bool) {
+	value, ok := getServiceAnnotation(service, annLinodeForceRecreate)
+	if !ok || value == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(value))
+	return forceRecreateTagPrefix + hex.EncodeToString(sum[:6]), true
+}
+
+// withForceRecreateTag returns tags, the tags of a NodeBalancer created for service, with the tag
+// of its force-recreate annotation.
+func withForceRecreateTag(tags []string, service *v1.Service) []string {
+	if tag, ok := forceRecreateTag(service); ok && !containsString(tags, tag) {
+		tags = append(tags, tag)
+		sort.Strings(tags)
+	}
+	return tags
+}
+
+// forceRecreatePending reports whether the force-recreate annotation of service was set to a
+// value nb wasn't created for.
+func forceRecreatePending(service *v1.Service, nb *linodego.NodeBalancer) bool {
+	tag, ok := forceRecreateTag(service)
+	return ok && !containsString(nb.Tags, tag)
+}
+
+// forceRecreateNodeBalancer deletes nb and creates a new NodeBalancer for service, pointing its
+// nodebalancer-id annotation to the new one if it has one, as requested by its force-recreate
+// annotation. A NodeBalancer shared with other Services or the default NodeBalancer of the cloud
+// config isn't recreated and is updated instead, like when NodeBalancer creation is disabled.
+func (l *loadbalancers) forceRecreateNodeBalancer(ctx context.Context, service *v1.Service, nodes []*v1.Node, nb *linodego.NodeBalancer) (*linodego.NodeBalancer, error) {
+	value := service.Annotations[annLinodeForceRecreate]
+	switch {
+	case isSharedWithOtherServices(nb, service):
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerRecreateRefused",
+			"not recreating NodeBalancer (%d) as requested by %s=%s, as it is shared with other services", nb.ID, annLinodeForceRecreate, value)
+		return nb, l.updateNodeBalancer(ctx, service, nodes, nb)
+	case l.isDefaultNodeBalancer(nb):
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerRecreateRefused",
+			"not recreating NodeBalancer (%d) as requested by %s=%s, as it is the default NodeBalancer of the cloud config", nb.ID, annLinodeForceRecreate, value)
+		return nb, l.updateNodeBalancer(ctx, service, nodes, nb)
+	case l.disableCreation:
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerRecreateRefused",
+			"not recreating NodeBalancer (%d) as requested by %s=%s, as NodeBalancer creation is disabled", nb.ID, annLinodeForceRecreate, value)
+		return nb, l.updateNodeBalancer(ctx, service, nodes, nb)
+	}
+
+	serviceLog("recreate-nodebalancer", service, nb.ID).infof("recreating NodeBalancer (%d) of service (%s) as requested by %s=%s", nb.ID, getServiceNn(service), annLinodeForceRecreate, value)
+	l.recordEvent(service, v1.EventTypeNormal, "NodeBalancerRecreating", "deleting NodeBalancer (%d) to recreate it as requested by %s=%s", nb.ID, annLinodeForceRecreate, value)
+	if err := l.deleteNodeBalancer(ctx, service, nb); err != nil {
+		err = fmt.Errorf("failed to delete NodeBalancer (%d) to recreate it: %v", nb.ID, err)
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerRecreateFailed", "%s", err)
+		return nil, err
+	}
+
+	// Once the NodeBalancer is deleted, a failure is retried like for a Service without one.
+	recreated, err := l.buildLoadBalancerRequest(ctx, service, nodes)
+	if err != nil {
+		err = fmt.Errorf("deleted NodeBalancer (%d) but failed to create its replacement: %v", nb.ID, err)
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerRecreateFailed", "%s", err)
+		return nil, err
+	}
+	if err = l.reconcileFirewall(ctx, service, recreated); err != nil {
+		return nil, fmt.Errorf("error reconciling firewall of NodeBalancer (%d): %v", recreated.ID, err)
+	}
+
+	if _, ok := getServiceAnnotation(service, annLinodeNodeBalancerID); ok {
+		if err = l.setNodeBalancerIDAnnotation(service, recreated.ID); err != nil {
+			return nil, fmt.Errorf("failed to point %s of service (%s) to NodeBalancer (%d): %v", annLinodeNodeBalancerID, getServiceNn(service), recreated.ID, err)
+		}
+	}
+
+	l.recordEvent(service, v1.EventTypeNormal, "NodeBalancerRecreated", "NodeBalancer (%d) has been replaced by NodeBalancer (%d)", nb.ID, recreated.ID)
+	return recreated, nil
+}
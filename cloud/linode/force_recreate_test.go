@@ -0,0 +1,151 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestForceRecreateNodeBalancer(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	recorder := record.NewFakeRecorder(10)
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			Namespace:   "default",
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeForceRecreate: "2020-06-01T00:00:00Z"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	ensure := func() *linodego.NodeBalancer {
+		t.Helper()
+		status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+		if err != nil {
+			t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+		}
+		svc.Status.LoadBalancer = *status
+		nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nb
+	}
+
+	// A NodeBalancer created with the annotation already set isn't recreated for its value.
+	created := ensure()
+	if nb := ensure(); nb.ID != created.ID {
+		t.Fatalf("expected NodeBalancer (%d) to be kept, got NodeBalancer (%d)", created.ID, nb.ID)
+	}
+
+	// A new value recreates it, and the nodebalancer-id annotation, e.g. of an adopted
+	// NodeBalancer, is pointed to the new one.
+	svc.Annotations[annLinodeForceRecreate] = "2020-06-02T00:00:00Z"
+	svc.Annotations[annLinodeNodeBalancerID] = strconv.Itoa(created.ID)
+	if _, err := fakeClientset.CoreV1().Services("default").Create(svc); err != nil {
+		t.Fatal(err)
+	}
+	recreated := ensure()
+	if recreated.ID == created.ID {
+		t.Fatalf("expected NodeBalancer (%d) to be recreated", created.ID)
+	}
+	if _, ok := fakeAPI.nb[strconv.Itoa(created.ID)]; ok {
+		t.Errorf("expected NodeBalancer (%d) to be deleted", created.ID)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Errorf("expected 1 NodeBalancer, got %d", len(fakeAPI.nb))
+	}
+
+	current, err := fakeClientset.CoreV1().Services("default").Get(svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := current.Annotations[annLinodeNodeBalancerID]; id != strconv.Itoa(recreated.ID) {
+		t.Errorf("expected %s to point to NodeBalancer (%d), got %q", annLinodeNodeBalancerID, recreated.ID, id)
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	for _, reason := range []string{"NodeBalancerRecreating", "NodeBalancerRecreated"} {
+		if !strings.Contains(strings.Join(events, "\n"), reason) {
+			t.Errorf("expected a %s event, got %v", reason, events)
+		}
+	}
+
+	// Further reconciles with the same value keep the replacement.
+	svc.Annotations = current.Annotations
+	if nb := ensure(); nb.ID != recreated.ID {
+		t.Errorf("expected NodeBalancer (%d) to be kept, got NodeBalancer (%d)", recreated.ID, nb.ID)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Errorf("expected 1 NodeBalancer, got %d", len(fakeAPI.nb))
+	}
+}
+
+func TestForceRecreateNodeBalancerRefused(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: randString(10), Namespace: "default", UID: "foobar123"},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *status
+	created, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lb.disableCreation = true
+	svc.Annotations = map[string]string{annLinodeForceRecreate: "1"}
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil); err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if _, ok := fakeAPI.nb[strconv.Itoa(created.ID)]; !ok || len(fakeAPI.nb) != 1 {
+		t.Errorf("expected NodeBalancer (%d) to be kept, got %v", created.ID, fakeAPI.nb)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodeBalancerRecreateRefused") {
+		t.Errorf("expected a NodeBalancerRecreateRefused event, got %q", event)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/linode/linode-cloud-controller-manager/cloud"
 	"github.com/linode/linode-cloud-controller-manager/sentry"
@@ -18,23 +21,174 @@ import (
 
 type instances struct {
 	client *linodego.Client
+	cache  *instanceCache
+
+	// accounts are the clients of the other Linode accounts nodes may run in, which are looked
+	// up after the one of client.
+	accounts []*linodego.Client
+
+	// metadata, if set, answers the lookups of the ID and type of the Linode the CCM runs on.
+	metadata *metadataClient
+
+	maintenanceGracePeriod time.Duration
+}
+
+func newInstances(client *linodego.Client, accounts ...*linodego.Client) cloudprovider.Instances {
+	return &instances{
+		client:                 client,
+		cache:                  newInstanceCache(Options.InstanceCacheTTL),
+		accounts:               accounts,
+		metadata:               getMetadataClient(),
+		maintenanceGracePeriod: Options.MaintenanceGracePeriod,
+	}
+}
+
+// instanceCache memoizes Linode instances by ID and by label for a short time, as the node
+// controllers look instances up much more often than they change. A ttl of 0 disables caching.
+type instanceCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	byID    map[int]cachedInstance
+	byLabel map[string]cachedInstance
+}
+
+type cachedInstance struct {
+	instance *linodego.Instance
+	client   *linodego.Client
+	expiry   time.Time
+}
+
+func newInstanceCache(ttl time.Duration) *instanceCache {
+	return &instanceCache{
+		ttl:     ttl,
+		now:     time.Now,
+		byID:    make(map[int]cachedInstance),
+		byLabel: make(map[string]cachedInstance),
+	}
+}
+
+func (c *instanceCache) getByID(id int) (*linodego.Instance, *linodego.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.byID[id]
+	if !ok {
+		return nil, nil
+	}
+	if !c.now().Before(entry.expiry) {
+		delete(c.byID, id)
+		return nil, nil
+	}
+	return entry.instance, entry.client
+}
+
+func (c *instanceCache) getByLabel(label string) (*linodego.Instance, *linodego.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.byLabel[label]
+	if !ok {
+		return nil, nil
+	}
+	if !c.now().Before(entry.expiry) {
+		delete(c.byLabel, label)
+		return nil, nil
+	}
+	return entry.instance, entry.client
+}
+
+// add caches instance along with the client of the account it's in. The instance is also cached
+// under names, e.g. the node name it was found by when the node isn't named after its label.
+func (c *instanceCache) add(instance *linodego.Instance, client *linodego.Client, names ...string) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cachedInstance{instance: instance, client: client, expiry: c.now().Add(c.ttl)}
+	c.byID[instance.ID] = entry
+	c.byLabel[instance.Label] = entry
+	for _, name := range names {
+		c.byLabel[name] = entry
+	}
+}
+
+// invalidate drops the instances with the given ID or label, so that an instance which couldn't
+// be found is not served from the cache under its other key.
+func (c *instanceCache) invalidate(id int, label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.byID {
+		if key == id || entry.instance.Label == label {
+			delete(c.byID, key)
+		}
+	}
+	for key, entry := range c.byLabel {
+		if key == label || entry.instance.ID == id {
+			delete(c.byLabel, key)
+		}
+	}
+}
+
+// clients returns the clients of the accounts nodes are looked up in, in lookup order.
+func (i *instances) clients() []*linodego.Client {
+	return append([]*linodego.Client{i.client}, i.accounts...)
+}
+
+// linodeByID returns the Linode with the given ID along with the client of the account it's in,
+// from the cache if possible.
+func (i *instances) linodeByID(ctx context.Context, id string) (*linodego.Instance, *linodego.Client, error) {
+	linodeID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if instance, client := i.cache.getByID(linodeID); instance != nil {
+		return instance, client, nil
+	}
+
+	instance, client, err := findLinodeByID(ctx, i.clients(), id)
+	if err != nil {
+		i.cache.invalidate(linodeID, "")
+		return nil, nil, err
+	}
+	i.cache.add(instance, client)
+	return instance, client, nil
 }
 
-func newInstances(client *linodego.Client) cloudprovider.Instances {
-	return &instances{client}
+// linodeByName returns the Linode labeled nodeName along with the client of the account it's in,
+// from the cache if possible.
+func (i *instances) linodeByName(ctx context.Context, nodeName types.NodeName) (*linodego.Instance, *linodego.Client, error) {
+	if instance, client := i.cache.getByLabel(string(nodeName)); instance != nil {
+		return instance, client, nil
+	}
+
+	instance, client, err := findLinodeByName(ctx, i.clients(), nodeName)
+	if err != nil {
+		i.cache.invalidate(0, string(nodeName))
+		return nil, nil, err
+	}
+	// Nodes named by one of their IPs are found by listing all Linodes, so they're cached under
+	// their node name too.
+	i.cache.add(instance, client, string(nodeName))
+	return instance, client, nil
 }
 
 func (i *instances) NodeAddresses(ctx context.Context, name types.NodeName) ([]v1.NodeAddress, error) {
 	ctx = sentry.SetHubOnContext(ctx)
 	sentry.SetTag(ctx, "node_name", string(name))
 
-	linode, err := linodeByName(ctx, i.client, name)
+	linode, client, err := i.linodeByName(ctx, name)
 	if err != nil {
 		sentry.CaptureError(ctx, err)
 		return nil, err
 	}
 
-	addresses, err := i.nodeAddresses(ctx, linode)
+	addresses, err := nodeAddresses(ctx, client, linode)
 	if err != nil {
 		sentry.CaptureError(ctx, err)
 		return nil, err
@@ -53,13 +207,13 @@ func (i *instances) NodeAddressesByProviderID(ctx context.Context, providerID st
 		return nil, err
 	}
 
-	linode, err := linodeByID(ctx, i.client, id)
+	linode, client, err := i.linodeByID(ctx, id)
 	if err != nil {
 		sentry.CaptureError(ctx, err)
 		return nil, err
 	}
 
-	addresses, err := i.nodeAddresses(ctx, linode)
+	addresses, err := nodeAddresses(ctx, client, linode)
 	if err != nil {
 		sentry.CaptureError(ctx, err)
 		return nil, err
@@ -68,11 +222,12 @@ func (i *instances) NodeAddressesByProviderID(ctx context.Context, providerID st
 	return addresses, nil
 }
 
-func (i *instances) nodeAddresses(ctx context.Context, linode *linodego.Instance) ([]v1.NodeAddress, error) {
+// nodeAddresses returns the addresses of linode, which is in the account of client.
+func nodeAddresses(ctx context.Context, client *linodego.Client, linode *linodego.Instance) ([]v1.NodeAddress, error) {
 	var addresses []v1.NodeAddress
 	addresses = append(addresses, v1.NodeAddress{Type: v1.NodeHostName, Address: linode.Label})
 
-	ips, err := i.client.GetInstanceIPAddresses(ctx, linode.ID)
+	ips, err := client.GetInstanceIPAddresses(ctx, linode.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +253,11 @@ func (i *instances) InstanceID(ctx context.Context, nodeName types.NodeName) (st
 	ctx = sentry.SetHubOnContext(ctx)
 	sentry.SetTag(ctx, "node_name", string(nodeName))
 
-	linode, err := linodeByName(ctx, i.client, nodeName)
+	if local := i.metadata.getLocalInstance(ctx, nodeName); local != nil {
+		return strconv.Itoa(local.ID), nil
+	}
+
+	linode, _, err := i.linodeByName(ctx, nodeName)
 	if err != nil {
 		sentry.CaptureError(ctx, err)
 		return "", err
@@ -106,11 +265,18 @@ func (i *instances) InstanceID(ctx context.Context, nodeName types.NodeName) (st
 	return strconv.Itoa(linode.ID), nil
 }
 
+// InstanceType returns the plan of the Linode, e.g. g6-standard-4, which the node controller sets
+// as the node's instance-type label. Linodes whose plan isn't known are reported with an empty
+// type, leaving the label unset.
 func (i *instances) InstanceType(ctx context.Context, nodeName types.NodeName) (string, error) {
 	ctx = sentry.SetHubOnContext(ctx)
 	sentry.SetTag(ctx, "node_name", string(nodeName))
 
-	linode, err := linodeByName(ctx, i.client, nodeName)
+	if local := i.metadata.getLocalInstance(ctx, nodeName); local != nil {
+		return local.Type, nil
+	}
+
+	linode, _, err := i.linodeByName(ctx, nodeName)
 	if err != nil {
 		sentry.CaptureError(ctx, err)
 		return "", err
@@ -130,7 +296,7 @@ func (i *instances) InstanceTypeByProviderID(ctx context.Context, providerID str
 
 	sentry.SetTag(ctx, "linode_id", id)
 
-	linode, err := linodeByID(ctx, i.client, id)
+	linode, _, err := i.linodeByID(ctx, id)
 	if err != nil {
 		sentry.CaptureError(ctx, err)
 		return "", err
@@ -158,18 +324,147 @@ func (i *instances) InstanceExistsByProviderID(ctx context.Context, providerID s
 
 	sentry.SetTag(ctx, "linode_id", id)
 
-	_, err = linodeByID(ctx, i.client, id)
+	// Only the Linode with this exact ID backs the node: a Linode recreated under the same label
+	// gets a new ID, and the node must be removed rather than matched to it by name. The cache is
+	// bypassed so that a deleted Linode isn't reported to exist until its entry expires.
+	linodeID, err := strconv.Atoi(id)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return false, err
+	}
+	linode, client, err := findLinodeByID(ctx, i.clients(), id)
 	if err == nil {
+		i.cache.add(linode, client)
 		return true, nil
 	}
+	i.cache.invalidate(linodeID, "")
+	if classifyAPIError(err) == apiErrorNotFound {
+		return false, nil
+	}
 
+	// Failing to look the Linode up doesn't mean it was deleted, and reporting it as such would
+	// have the node controller delete a healthy node.
 	sentry.CaptureError(ctx, err)
+	return false, err
+}
+
+func (i *instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
+	ctx = sentry.SetHubOnContext(ctx)
+	sentry.SetTag(ctx, "provider_id", providerID)
+
+	id, err := linodeIDFromProviderID(providerID)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return false, err
+	}
+
+	sentry.SetTag(ctx, "linode_id", id)
+
+	linode, client, err := i.linodeByID(ctx, id)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return false, err
+	}
+	if !isInstanceShutdown(linode.Status) {
+		return false, nil
+	}
 
+	inMaintenance, err := i.inMaintenance(ctx, client, linode)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return false, err
+	}
+	return !inMaintenance, nil
+}
+
+// maintenanceActions are the actions of the events recorded when Linode reboots or migrates an
+// instance for host maintenance.
+var maintenanceActions = map[linodego.EventAction]bool{
+	linodego.ActionHostReboot:    true,
+	linodego.ActionLassieReboot:  true,
+	linodego.ActionLinodeMigrate: true,
+}
+
+// inMaintenance reports whether linode, which is in the account of client, went through
+// Linode-initiated maintenance during the grace period, in which case it being offline is
+// transient and its Node must not be evicted.
+func (i *instances) inMaintenance(ctx context.Context, client *linodego.Client, linode *linodego.Instance) (bool, error) {
+	if i.maintenanceGracePeriod == 0 {
+		return false, nil
+	}
+
+	filter, err := json.Marshal(map[string]interface{}{
+		"entity.type": linodego.EntityLinode,
+		"entity.id":   linode.ID,
+		"+order_by":   "created",
+		"+order":      "desc",
+	})
+	if err != nil {
+		return false, err
+	}
+	// The most recent page of events is enough to cover a short grace period.
+	events, err := client.ListEvents(ctx, &linodego.ListOptions{PageOptions: &linodego.PageOptions{Page: 1}, Filter: string(filter)})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to list events of Linode %d", linode.ID)
+	}
+
+	for _, event := range events {
+		if !maintenanceActions[event.Action] || event.Status == linodego.EventFailed || event.Created == nil {
+			continue
+		}
+		if time.Since(*event.Created) < i.maintenanceGracePeriod {
+			logEntry{Operation: "instance-shutdown", LinodeID: linode.ID}.infof("Linode %d is %s after %s event %d, not reporting it as shut down", linode.ID, linode.Status, event.Action, event.ID)
+			return true, nil
+		}
+	}
 	return false, nil
 }
 
-func (i *instances) InstanceShutdownByProviderID(ctx context.Context, providerID string) (bool, error) {
-	return false, cloudprovider.NotImplemented
+// isInstanceShutdown reports whether a Linode with the given status is powered off. The transient
+// states a Linode goes through while it's rebooted or managed aren't considered shut down, so
+// that Nodes aren't tainted and evicted during a reboot.
+func isInstanceShutdown(status linodego.InstanceStatus) bool {
+	switch status {
+	case linodego.InstanceOffline:
+		return true
+	case linodego.InstanceBooting, linodego.InstanceShuttingDown, linodego.InstanceRebooting:
+		// The Linode is about to be running again, or offline once it's done shutting down.
+		return false
+	default:
+		return false
+	}
+}
+
+// findLinodeByID returns the Linode with the given ID from the first of the accounts of clients
+// it's in, along with the client of that account.
+func findLinodeByID(ctx context.Context, clients []*linodego.Client, id string) (*linodego.Instance, *linodego.Client, error) {
+	var err error
+	for _, client := range clients {
+		var instance *linodego.Instance
+		if instance, err = linodeByID(ctx, client, id); err == nil {
+			return instance, client, nil
+		}
+		if classifyAPIError(err) != apiErrorNotFound {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, err
+}
+
+// findLinodeByName returns the Linode labeled nodeName from the first of the accounts of clients
+// it's in, along with the client of that account.
+func findLinodeByName(ctx context.Context, clients []*linodego.Client, nodeName types.NodeName) (*linodego.Instance, *linodego.Client, error) {
+	var err error
+	for _, client := range clients {
+		var instance *linodego.Instance
+		if instance, err = linodeByName(ctx, client, nodeName); err == nil {
+			return instance, client, nil
+		}
+		if err != cloudprovider.InstanceNotFound {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, err
 }
 
 func linodeByID(ctx context.Context, client *linodego.Client, id string) (*linodego.Instance, error) {
@@ -182,7 +477,7 @@ func linodeByID(ctx context.Context, client *linodego.Client, id string) (*linod
 	if err != nil {
 		return nil, err
 	}
-	if instance == nil {
+	if instance == nil || instance.ID != linodeID {
 		return nil, fmt.Errorf("linode not found with id %v", linodeID)
 	}
 	return instance, nil
@@ -200,6 +495,11 @@ func linodeByName(ctx context.Context, client *linodego.Client, nodeName types.N
 	}
 
 	if len(linodes) == 0 {
+		// Nodes registering with one of their addresses as their name, e.g. their private IP,
+		// are looked up by the addresses of the Linodes.
+		if ip := net.ParseIP(string(nodeName)); ip != nil {
+			return linodeByIP(ctx, client, ip)
+		}
 		return nil, cloudprovider.InstanceNotFound
 	} else if len(linodes) > 1 {
 		return nil, errors.New(fmt.Sprintf("Multiple instances found with name %v", nodeName))
@@ -208,6 +508,23 @@ func linodeByName(ctx context.Context, client *linodego.Client, nodeName types.N
 	return &linodes[0], nil
 }
 
+// linodeByIP returns the Linode with the public or private IPv4 address ip.
+func linodeByIP(ctx context.Context, client *linodego.Client, ip net.IP) (*linodego.Instance, error) {
+	linodes, err := client.ListInstances(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range linodes {
+		for _, address := range linodes[i].IPv4 {
+			if address != nil && address.Equal(ip) {
+				return &linodes[i], nil
+			}
+		}
+	}
+	return nil, cloudprovider.InstanceNotFound
+}
+
 // serverIDFromProviderID returns a Linode ID from a providerID.
 //
 // The providerID can be seen on the Kubernetes Node object. The expected
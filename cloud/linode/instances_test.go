@@ -6,9 +6,12 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/linode/linodego"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/cloudprovider"
 )
 
 func TestCCMInstances(t *testing.T) {
@@ -80,6 +83,10 @@ func testNodeAddresses(t *testing.T, client *linodego.Client) {
 			name: "Node Addresses Not Found",
 			f:    testNodeAddressesNotFound,
 		},
+		{
+			name: "Node Addresses Found by IP",
+			f:    testNodeAddressesFoundByIP,
+		},
 		// TODO: Add test for the failure mode of multiple Linodes returned for the
 		// same label. The API should prevent this but we must handle it gracefully on
 		// the Kubernetes side.
@@ -120,6 +127,25 @@ func testNodeAddressesFound(t *testing.T, client *linodego.Client) {
 	}
 }
 
+func testNodeAddressesFoundByIP(t *testing.T, client *linodego.Client) {
+	instances := newInstances(client)
+
+	for _, name := range []types.NodeName{"192.168.133.65", "45.79.101.25"} {
+		addresses, err := instances.NodeAddresses(context.TODO(), name)
+		if err != nil {
+			t.Errorf("expected node %s to resolve to its Linode, got: %v", name, err)
+			continue
+		}
+		if len(addresses) == 0 || addresses[0] != (v1.NodeAddress{Type: v1.NodeHostName, Address: "test-instance"}) {
+			t.Errorf("unexpected node addresses for node %s: %v", name, addresses)
+		}
+	}
+
+	if _, err := instances.NodeAddresses(context.TODO(), "10.0.0.1"); err != cloudprovider.InstanceNotFound {
+		t.Errorf("expected InstanceNotFound for an unknown IP, got: %v", err)
+	}
+}
+
 func testNodeAddressesNotFound(t *testing.T, client *linodego.Client) {
 	instances := newInstances(client)
 
@@ -291,3 +317,302 @@ func testInstanceExistsByProviderID(t *testing.T, client *linodego.Client) {
 	}
 
 }
+
+func TestInstanceTypeUnresolved(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	linodeClient := linodego.NewClient(http.DefaultClient)
+	linodeClient.SetBaseURL(ts.URL)
+
+	fake.instance.Type = ""
+	instances := newInstances(&linodeClient)
+
+	insType, err := instances.InstanceTypeByProviderID(context.TODO(), "linode://123")
+	if err != nil || insType != "" {
+		t.Errorf("expected empty type without error, got %q (%v)", insType, err)
+	}
+	insType, err = instances.InstanceType(context.TODO(), "test-instance")
+	if err != nil || insType != "" {
+		t.Errorf("expected empty type without error, got %q (%v)", insType, err)
+	}
+}
+
+func TestInstanceShutdownByProviderID(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	linodeClient := linodego.NewClient(http.DefaultClient)
+	linodeClient.SetBaseURL(ts.URL)
+
+	testCases := []struct {
+		status   linodego.InstanceStatus
+		shutdown bool
+	}{
+		{linodego.InstanceRunning, false},
+		{linodego.InstanceOffline, true},
+		{linodego.InstanceBooting, false},
+		{linodego.InstanceShuttingDown, false},
+		{linodego.InstanceRebooting, false},
+		{linodego.InstanceProvisioning, false},
+		{linodego.InstanceDeleting, false},
+		{linodego.InstanceMigrating, false},
+		{linodego.InstanceRebuilding, false},
+		{linodego.InstanceCloning, false},
+		{linodego.InstanceRestoring, false},
+		{linodego.InstanceResizing, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.status), func(t *testing.T) {
+			fake.instance.Status = tc.status
+			instances := &instances{client: &linodeClient, cache: newInstanceCache(0)}
+
+			shutdown, err := instances.InstanceShutdownByProviderID(context.TODO(), "linode://123")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if shutdown != tc.shutdown {
+				t.Errorf("expected shutdown %v for status %s, got %v", tc.shutdown, tc.status, shutdown)
+			}
+		})
+	}
+
+	if _, err := newInstances(&linodeClient).InstanceShutdownByProviderID(context.TODO(), "linode://12345"); err == nil {
+		t.Error("expected an error for a Linode that doesn't exist")
+	}
+}
+
+func TestInstanceShutdownByProviderIDDuringMaintenance(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	linodeClient := linodego.NewClient(http.DefaultClient)
+	linodeClient.SetBaseURL(ts.URL)
+
+	fake.instance.Status = linodego.InstanceOffline
+	instances := &instances{client: &linodeClient, cache: newInstanceCache(0), maintenanceGracePeriod: 15 * time.Minute}
+
+	shutdown, err := instances.InstanceShutdownByProviderID(context.TODO(), "linode://123")
+	if err != nil || !shutdown {
+		t.Errorf("expected offline instance without events to be shut down, got %v (%v)", shutdown, err)
+	}
+
+	recent := time.Now().Add(-5 * time.Minute)
+	old := time.Now().Add(-time.Hour)
+	entity := &linodego.EventEntity{ID: 123, Type: linodego.EntityLinode}
+	fake.events = []linodego.Event{
+		{ID: 2, Action: linodego.ActionLinodeShutdown, Status: linodego.EventFinished, Entity: entity, Created: &recent},
+		{ID: 1, Action: linodego.ActionHostReboot, Status: linodego.EventFinished, Entity: entity, Created: &old},
+	}
+	shutdown, err = instances.InstanceShutdownByProviderID(context.TODO(), "linode://123")
+	if err != nil || !shutdown {
+		t.Errorf("expected instance to be shut down outside of the grace period, got %v (%v)", shutdown, err)
+	}
+
+	fake.events = append(fake.events, linodego.Event{ID: 3, Action: linodego.ActionHostReboot, Status: linodego.EventStarted, Entity: entity, Created: &recent})
+	shutdown, err = instances.InstanceShutdownByProviderID(context.TODO(), "linode://123")
+	if err != nil || shutdown {
+		t.Errorf("expected instance in maintenance not to be shut down, got %v (%v)", shutdown, err)
+	}
+
+	instances.maintenanceGracePeriod = 0
+	shutdown, err = instances.InstanceShutdownByProviderID(context.TODO(), "linode://123")
+	if err != nil || !shutdown {
+		t.Errorf("expected instance to be shut down without a grace period, got %v (%v)", shutdown, err)
+	}
+}
+
+func TestInstanceCache(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	linodeClient := linodego.NewClient(http.DefaultClient)
+	linodeClient.SetBaseURL(ts.URL)
+
+	now := time.Now()
+	cache := newInstanceCache(15 * time.Second)
+	cache.now = func() time.Time { return now }
+	instances := &instances{client: &linodeClient, cache: cache}
+
+	found, err := instances.InstanceExistsByProviderID(context.TODO(), "linode://123")
+	if err != nil || !found {
+		t.Fatalf("expected instance to exist, got %v (%v)", found, err)
+	}
+
+	// The instance is shut down and then deleted, which the cache hides until it expires.
+	fake.instance.Status = linodego.InstanceOffline
+	shutdown, err := instances.InstanceShutdownByProviderID(context.TODO(), "linode://123")
+	if err != nil || shutdown {
+		t.Errorf("expected cached running instance, got shutdown %v (%v)", shutdown, err)
+	}
+
+	now = now.Add(16 * time.Second)
+	shutdown, err = instances.InstanceShutdownByProviderID(context.TODO(), "linode://123")
+	if err != nil || !shutdown {
+		t.Errorf("expected instance to be shut down once the cache expired, got %v (%v)", shutdown, err)
+	}
+
+	if _, err = instances.InstanceID(context.TODO(), "test-instance"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The existence check isn't served from the cache, so that deleted nodes are removed.
+	fake.instance.ID = 456
+	fake.instance.Label = "other-instance"
+	found, err = instances.InstanceExistsByProviderID(context.TODO(), "linode://123")
+	if err != nil || found {
+		t.Errorf("expected deleted instance not to exist, got %v (%v)", found, err)
+	}
+
+	if _, err = instances.InstanceID(context.TODO(), "test-instance"); err == nil {
+		t.Error("expected deleted instance not to be found by name")
+	}
+	if len(cache.byID) != 0 || len(cache.byLabel) != 0 {
+		t.Errorf("expected cache to be invalidated, got %v, %v", cache.byID, cache.byLabel)
+	}
+}
+
+func TestInstanceCacheByIP(t *testing.T) {
+	fake := newFake(t)
+	var lists int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/linode/instances" {
+			lists++
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	linodeClient := linodego.NewClient(http.DefaultClient)
+	linodeClient.SetBaseURL(ts.URL)
+
+	instances := &instances{client: &linodeClient, cache: newInstanceCache(15 * time.Second)}
+
+	// The node named by its private IP is looked up by label and then among all the Linodes.
+	if _, err := instances.InstanceID(context.TODO(), "192.168.133.65"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lists != 2 {
+		t.Fatalf("expected 2 instance lists, got %d", lists)
+	}
+
+	if _, err := instances.InstanceID(context.TODO(), "192.168.133.65"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if lists != 2 {
+		t.Errorf("expected the node named by its IP to be served from the cache, got %d instance lists", lists)
+	}
+}
+
+func TestInstanceExistsByProviderIDRecreated(t *testing.T) {
+	fake := newFake(t)
+	var failLookups bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failLookups {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Internal server error"}]}`))
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	linodeClient := linodego.NewClient(http.DefaultClient)
+	linodeClient.SetBaseURL(ts.URL)
+
+	instances := &instances{client: &linodeClient, cache: newInstanceCache(15 * time.Second)}
+
+	found, err := instances.InstanceExistsByProviderID(context.TODO(), "linode://123")
+	if err != nil || !found {
+		t.Fatalf("expected instance to exist, got %v (%v)", found, err)
+	}
+
+	// The Linode is deleted and recreated with the same label, which gives it another ID.
+	fake.instance.ID = 456
+	found, err = instances.InstanceExistsByProviderID(context.TODO(), "linode://123")
+	if err != nil || found {
+		t.Errorf("expected the deleted instance not to exist, got %v (%v)", found, err)
+	}
+
+	id, err := instances.InstanceID(context.TODO(), "test-instance")
+	if err != nil || id != "456" {
+		t.Errorf("expected the recreated instance to be found by name, got %q (%v)", id, err)
+	}
+	found, err = instances.InstanceExistsByProviderID(context.TODO(), "linode://456")
+	if err != nil || !found {
+		t.Errorf("expected the recreated instance to exist, got %v (%v)", found, err)
+	}
+
+	failLookups = true
+	if found, err = instances.InstanceExistsByProviderID(context.TODO(), "linode://456"); err == nil {
+		t.Errorf("expected an error when the instance can't be looked up, got found %v", found)
+	}
+}
+
+func TestInstancesMultipleAccounts(t *testing.T) {
+	primary := newFake(t)
+	primaryServer := httptest.NewServer(primary)
+	defer primaryServer.Close()
+
+	secondary := newFake(t)
+	secondary.instance.ID = 456
+	secondary.instance.Label = "secondary-instance"
+	secondary.instance.Type = "g6-standard-4"
+	secondary.ips[0].Address = "45.79.101.26"
+	secondary.ips[1].Address = "192.168.133.66"
+	secondaryServer := httptest.NewServer(secondary)
+	defer secondaryServer.Close()
+
+	primaryClient := linodego.NewClient(http.DefaultClient)
+	primaryClient.SetBaseURL(primaryServer.URL)
+	secondaryClient := linodego.NewClient(http.DefaultClient)
+	secondaryClient.SetBaseURL(secondaryServer.URL)
+
+	instances := newInstances(&primaryClient, &secondaryClient)
+
+	addresses, err := instances.NodeAddressesByProviderID(context.TODO(), "linode://456")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []v1.NodeAddress{
+		{Type: v1.NodeHostName, Address: "secondary-instance"},
+		{Type: v1.NodeExternalIP, Address: "45.79.101.26"},
+		{Type: v1.NodeInternalIP, Address: "192.168.133.66"},
+	}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("expected the addresses of the secondary account's Linode %v, got %v", expected, addresses)
+	}
+
+	id, err := instances.InstanceID(context.TODO(), "secondary-instance")
+	if err != nil || id != "456" {
+		t.Errorf("expected the secondary account's Linode to be found by name, got %q (%v)", id, err)
+	}
+	insType, err := instances.InstanceTypeByProviderID(context.TODO(), "linode://456")
+	if err != nil || insType != "g6-standard-4" {
+		t.Errorf("expected the type of the secondary account's Linode, got %q (%v)", insType, err)
+	}
+
+	// Linodes of the primary account are still found first.
+	id, err = instances.InstanceID(context.TODO(), "test-instance")
+	if err != nil || id != "123" {
+		t.Errorf("expected the primary account's Linode, got %q (%v)", id, err)
+	}
+
+	found, err := instances.InstanceExistsByProviderID(context.TODO(), "linode://456")
+	if err != nil || !found {
+		t.Errorf("expected the secondary account's Linode to exist, got %v (%v)", found, err)
+	}
+	found, err = instances.InstanceExistsByProviderID(context.TODO(), "linode://789")
+	if err != nil || found {
+		t.Errorf("expected a Linode of neither account not to exist, got %v (%v)", found, err)
+	}
+	if _, err = instances.InstanceID(context.TODO(), "missing-instance"); err != cloudprovider.InstanceNotFound {
+		t.Errorf("expected InstanceNotFound for a node of neither account, got %v", err)
+	}
+}
@@ -4,19 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
+	v1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog"
 	"k8s.io/kubernetes/pkg/cloudprovider"
+	kubeletapis "k8s.io/kubernetes/pkg/kubelet/apis"
 
+	"github.com/appscode/go/wait"
 	"github.com/linode/linode-cloud-controller-manager/sentry"
 	"github.com/linode/linodego"
 )
@@ -28,10 +41,83 @@ const (
 	annLinodePortConfigPrefix = "service.beta.kubernetes.io/linode-loadbalancer-port-"
 	annLinodeProxyProtocol    = "service.beta.kubernetes.io/linode-loadbalancer-proxy-protocol"
 
+	// annLinodePortTLSSecretPrefix is the prefix of the annotation specifying the kubernetes.io/tls
+	// Secret holding the certificate of a port, e.g.
+	// service.beta.kubernetes.io/linode-loadbalancer-tls-secret-443. The port defaults to https.
+	annLinodePortTLSSecretPrefix = "service.beta.kubernetes.io/linode-loadbalancer-tls-secret-"
+
+	// annLinodePortTLSObjectURLPrefix is the prefix of the annotation specifying the signed Object
+	// Storage URL of a PEM bundle holding the certificate chain and private key of a port, e.g.
+	// service.beta.kubernetes.io/linode-loadbalancer-tls-object-url-443. The port defaults to
+	// https.
+	annLinodePortTLSObjectURLPrefix = "service.beta.kubernetes.io/linode-loadbalancer-tls-object-url-"
+
+	// annLinodePortProxyProtocolPrefix is the prefix of the annotation overriding
+	// annLinodeProxyProtocol for a single port, e.g.
+	// service.beta.kubernetes.io/linode-loadbalancer-proxy-protocol-443.
+	annLinodePortProxyProtocolPrefix = "service.beta.kubernetes.io/linode-loadbalancer-proxy-protocol-"
+
+	// annLinodeAlgorithm is the annotation specifying the balancing algorithm of the
+	// NodeBalancer's ports. Options are roundrobin, leastconn and source. Defaults to roundrobin.
+	annLinodeAlgorithm = "service.beta.kubernetes.io/linode-loadbalancer-algorithm"
+
+	// annLinodePortAlgorithmPrefix is the prefix of the annotation overriding annLinodeAlgorithm
+	// for a single port, e.g. service.beta.kubernetes.io/linode-loadbalancer-algorithm-443.
+	annLinodePortAlgorithmPrefix = "service.beta.kubernetes.io/linode-loadbalancer-algorithm-"
+
+	// annLinodePortStickinessPrefix is the prefix of the annotation specifying the session
+	// stickiness of a port, e.g. service.beta.kubernetes.io/linode-loadbalancer-stickiness-443.
+	// Options are none, table and http_cookie, which is only supported by http and https ports.
+	annLinodePortStickinessPrefix = "service.beta.kubernetes.io/linode-loadbalancer-stickiness-"
+
+	// annLinodePortSSLCipherPrefix is the prefix of the annotation specifying the cipher suite of
+	// an https port, e.g. service.beta.kubernetes.io/linode-loadbalancer-ssl-cipher-443. Options
+	// are recommended, which disables legacy TLS versions, and legacy. Defaults to recommended,
+	// the default of the Linode API.
+	annLinodePortSSLCipherPrefix = "service.beta.kubernetes.io/linode-loadbalancer-ssl-cipher-"
+
+	// annLinodePortSkipPrefix is the prefix of the annotation specifying whether a port is left
+	// out of the NodeBalancer, e.g. service.beta.kubernetes.io/linode-loadbalancer-skip-port-8080
+	// for a port handled by another load balancer. Defaults to false.
+	annLinodePortSkipPrefix = "service.beta.kubernetes.io/linode-loadbalancer-skip-port-"
+
+	// annLinodePortNodePortPrefix is the prefix of the annotation overriding the port the
+	// NodeBalancer nodes of a Service port target, which defaults to its NodePort, e.g.
+	// service.beta.kubernetes.io/linode-loadbalancer-node-port-443 for a proxy running on each node.
+	annLinodePortNodePortPrefix = "service.beta.kubernetes.io/linode-loadbalancer-node-port-"
+
+	// annLinodePortCheckPortPrefix is the prefix of the annotation requesting the health checks of
+	// a port to probe another port, e.g. service.beta.kubernetes.io/linode-loadbalancer-check-port-8080.
+	// NodeBalancers only check the port of their backends receiving traffic, so Services with this
+	// annotation are refused rather than checked on the traffic port unknowingly.
+	annLinodePortCheckPortPrefix = "service.beta.kubernetes.io/linode-loadbalancer-check-port-"
+
+	// annLinodePortTimeoutPrefix is the prefix of the annotation requesting a connection timeout
+	// in seconds for a port, e.g. service.beta.kubernetes.io/linode-loadbalancer-timeout-443.
+	// NodeBalancer configs have no configurable connection timeout, so the annotation is only
+	// validated and reported as unsupported with an event.
+	annLinodePortTimeoutPrefix = "service.beta.kubernetes.io/linode-loadbalancer-timeout-"
+
+	// annLinodePortCheckTypePrefix is the prefix of the annotation specifying the health check
+	// type of a single port, overriding annLinodeHealthCheckType, e.g.
+	// service.beta.kubernetes.io/linode-loadbalancer-check-type-53: none.
+	annLinodePortCheckTypePrefix = "service.beta.kubernetes.io/linode-loadbalancer-check-type-"
+
+	// annLinodePortConfigIDPrefix is the prefix of the annotation pointing a port to an existing
+	// config of the NodeBalancer referenced by annLinodeNodeBalancerID, e.g.
+	// service.beta.kubernetes.io/linode-loadbalancer-config-id-443: "12345". The config is managed
+	// outside of the CCM, which only syncs its backend nodes.
+	annLinodePortConfigIDPrefix = "service.beta.kubernetes.io/linode-loadbalancer-config-id-"
+
 	annLinodeCheckPath       = "service.beta.kubernetes.io/linode-loadbalancer-check-path"
 	annLinodeCheckBody       = "service.beta.kubernetes.io/linode-loadbalancer-check-body"
 	annLinodeHealthCheckType = "service.beta.kubernetes.io/linode-loadbalancer-check-type"
 
+	// annLinodeCheckBodyMatch is the annotation specifying how annLinodeCheckBody is matched
+	// against the response body of http_body checks: as a regex, which is how NodeBalancers match
+	// it, or as a substring, which is escaped so that it is matched literally. Defaults to regex.
+	annLinodeCheckBodyMatch = "service.beta.kubernetes.io/linode-loadbalancer-check-body-match"
+
 	annLinodeHealthCheckInterval = "service.beta.kubernetes.io/linode-loadbalancer-check-interval"
 	annLinodeHealthCheckTimeout  = "service.beta.kubernetes.io/linode-loadbalancer-check-timeout"
 	annLinodeHealthCheckAttempts = "service.beta.kubernetes.io/linode-loadbalancer-check-attempts"
@@ -42,27 +128,195 @@ const (
 	// same client IP. Options are a number between 1-20, or 0 to disable. Defaults to 20.
 	annLinodeThrottle = "service.beta.kubernetes.io/linode-loadbalancer-throttle"
 
+	// annLinodePortThrottlePrefix is the prefix of the annotation overriding annLinodeThrottle
+	// for a single port, e.g. service.beta.kubernetes.io/linode-loadbalancer-throttle-443.
+	annLinodePortThrottlePrefix = "service.beta.kubernetes.io/linode-loadbalancer-throttle-"
+
+	// annLinodeDrainSeconds is the annotation specifying, in seconds, how long a node removed
+	// from the Service is kept in the NodeBalancer in drain mode before it is removed.
+	// Defaults to 0, which removes nodes immediately.
+	annLinodeDrainSeconds = "service.beta.kubernetes.io/linode-loadbalancer-drain-seconds"
+
+	// annLinodeBackendIPv4Range is the annotation specifying the CIDR of the VPC subnet the
+	// nodes are attached to. When set, NodeBalancer backends use the node address within the
+	// range, falling back to the node's Linode private IP. Overrides Options.BackendIPv4Range.
+	annLinodeBackendIPv4Range = "service.beta.kubernetes.io/linode-loadbalancer-backend-ipv4-range"
+
+	// annLinodeBackupNodeLabel is the annotation specifying a label selector of the nodes added
+	// to the NodeBalancer in backup mode, which only receive traffic when all other nodes are
+	// down, e.g. "pool=backup".
+	annLinodeBackupNodeLabel = "service.beta.kubernetes.io/linode-loadbalancer-backup-node-label"
+
+	// annLinodeExcludeNodeLabel is the annotation specifying a label selector of the nodes not
+	// used as NodeBalancer backends, e.g. "pool in (gpu,spot)". Overrides Options.ExcludeNodeLabel;
+	// an empty value excludes no nodes but the ones labelled labelNodeExcludeFromLoadBalancers.
+	annLinodeExcludeNodeLabel = "service.beta.kubernetes.io/linode-loadbalancer-exclude-node-label"
+
+	// annLinodeIncludeControlPlane is the annotation specifying whether the control-plane nodes,
+	// which are excluded by default as they don't run workload pods, are NodeBalancer backends.
+	annLinodeIncludeControlPlane = "service.beta.kubernetes.io/linode-loadbalancer-include-control-plane"
+
+	// annLinodeNodeWeightLabel is the annotation naming a node label whose integer value is the
+	// weight of the node in the NodeBalancer, e.g. for larger node pools to receive more traffic.
+	// Nodes without the label get the default weight. Weights only apply to roundrobin ports.
+	annLinodeNodeWeightLabel = "service.beta.kubernetes.io/linode-loadbalancer-node-weight-label"
+
+	// annLinodeRegion is the annotation specifying the region of the NodeBalancer, defaulting to
+	// the region of the cluster. Only nodes in this region are used as backends.
+	annLinodeRegion = "service.beta.kubernetes.io/linode-loadbalancer-region"
+
+	// annLinodeTags is the annotation specifying a comma-separated list of tags added to the
+	// NodeBalancer alongside the ones managed by the CCM.
+	annLinodeTags = "service.beta.kubernetes.io/linode-loadbalancer-tags"
+
+	// annLinodeLabel is the annotation specifying the label of the NodeBalancer instead of the one
+	// generated by the CCM. Ownership is tracked with tags, so changing it doesn't orphan the
+	// NodeBalancer.
+	annLinodeLabel = "service.beta.kubernetes.io/linode-loadbalancer-label"
+
+	// annLinodeEnableIPv6Ingress is the annotation specifying whether the NodeBalancer's IPv6
+	// address is added to the Service's ingress alongside its IPv4 address. Defaults to false.
+	annLinodeEnableIPv6Ingress = "service.beta.kubernetes.io/linode-loadbalancer-enable-ipv6-ingress"
+
+	// annLinodeHostname is the annotation specifying the hostname published in the Service's
+	// ingress instead of the NodeBalancer's, e.g. one managed by a geo-DNS provider.
+	annLinodeHostname = "service.beta.kubernetes.io/linode-loadbalancer-hostname"
+
+	// annLinodeHostnameOnlyIngress is the annotation specifying whether the IP addresses of the
+	// NodeBalancer are left out of the Service's ingress, leaving only its hostname. Defaults to
+	// false.
+	annLinodeHostnameOnlyIngress = "service.beta.kubernetes.io/linode-loadbalancer-hostname-only-ingress"
+
+	// annLinodeHTTPSRedirect is the annotation specifying whether the NodeBalancer gets an http
+	// config on port 80 for redirecting clients to https. NodeBalancers can't issue redirects
+	// themselves, so the config targets the backends of port 443, which are expected to redirect
+	// requests whose X-Forwarded-Proto header is http. Defaults to false.
+	annLinodeHTTPSRedirect = "service.beta.kubernetes.io/linode-loadbalancer-https-redirect"
+
+	// annLinodeReservedIPv4 is the annotation specifying a reserved IPv4 address for the
+	// NodeBalancer. NodeBalancers can't be created with a reserved address yet, so Services
+	// requesting one are refused a new NodeBalancer rather than given another address.
+	annLinodeReservedIPv4 = "service.beta.kubernetes.io/linode-loadbalancer-reserved-ipv4"
+
+	// annLinodeWaitForBackends is the annotation specifying how long EnsureLoadBalancer waits, e.g.
+	// "2m", for at least one backend of each config of the NodeBalancer to be reported UP by its
+	// health checks, so that the Service isn't reported ready with an address that only returns
+	// errors. Backends that aren't UP in time fail the reconcile if Options.WaitForBackendsStrict
+	// is set, and are only reported as an event otherwise.
+	annLinodeWaitForBackends = "service.beta.kubernetes.io/linode-loadbalancer-wait-for-backends"
+
+	// annLinodePaused is the annotation specifying whether the CCM leaves the NodeBalancer of the
+	// Service alone, e.g. while it is edited by hand during an incident. The status of the
+	// NodeBalancer is still reported, and removing the annotation re-converges it. Deleting the
+	// NodeBalancer fails while the Service is paused, unless Options.ForceDeletePaused is set.
+	// Defaults to false.
+	annLinodePaused = "service.beta.kubernetes.io/linode-loadbalancer-paused"
+
+	// annLinodeReconcileStatus is the annotation the CCM records the outcome of the last
+	// reconcile of the Service in as a JSON reconcileStatus, if Options.ReconcileStatus is set.
+	annLinodeReconcileStatus = "service.beta.kubernetes.io/linode-loadbalancer-reconcile-status"
+
+	// annLinodeForceRecreate is the annotation requesting the NodeBalancer of the Service to be
+	// deleted and created again, e.g. to get new addresses or recover from a broken NodeBalancer.
+	// Each new value, e.g. a timestamp, recreates it once.
+	annLinodeForceRecreate = "service.beta.kubernetes.io/linode-loadbalancer-force-recreate"
+
+	// annLinodeDNSRecord is the annotation specifying the Linode DNS records pointed to the
+	// addresses of the NodeBalancer, as a JSON dnsRecordAnnotation. They are only changed if
+	// Options.ManageDNSRecords is set.
+	annLinodeDNSRecord = "service.beta.kubernetes.io/linode-loadbalancer-dns-record"
+
 	annLinodeLoadBalancerPreserve = "service.beta.kubernetes.io/linode-loadbalancer-preserve"
 	annLinodeNodeBalancerID       = "service.beta.kubernetes.io/linode-loadbalancer-nodebalancer-id"
 )
 
+// labelNodeExcludeFromLoadBalancers is the well-known label of the nodes excluded from external
+// load balancers, which the service controller of this Kubernetes version doesn't filter yet.
+const labelNodeExcludeFromLoadBalancers = "node.kubernetes.io/exclude-from-external-load-balancers"
+
+// controlPlaneNodeLabels are the labels of the control-plane nodes, including the legacy master
+// label.
+var controlPlaneNodeLabels = []string{"node-role.kubernetes.io/control-plane", "node-role.kubernetes.io/master"}
+
+// linodePrivateIPv4Range is the range Linode private IPv4 addresses are allocated from.
+var linodePrivateIPv4Range = &net.IPNet{IP: net.IPv4(192, 168, 128, 0).To4(), Mask: net.CIDRMask(17, 32)}
+
 type lbNotFoundError struct {
 	serviceNn      string
 	nodeBalancerID int
+	// isDefault is set if nodeBalancerID is the default NodeBalancer of the cloud config.
+	isDefault bool
 }
 
 func (e lbNotFoundError) Error() string {
+	if e.isDefault {
+		return fmt.Sprintf("default NodeBalancer (%d) of the cloud config not found for service (%s)", e.nodeBalancerID, e.serviceNn)
+	}
 	if e.nodeBalancerID != 0 {
 		return fmt.Sprintf("LoadBalancer (%d) not found for service (%s)", e.nodeBalancerID, e.serviceNn)
 	}
 	return fmt.Sprintf("LoadBalancer not found for service (%s)", e.serviceNn)
 }
 
+// nodeBalancerIPPollInterval is how often a NodeBalancer is polled while waiting for its IPv4
+// address to be assigned.
+var nodeBalancerIPPollInterval = 2 * time.Second
+
+// backendStatusPollInterval is how often the backends of a NodeBalancer are polled while waiting
+// for them to be UP.
+var backendStatusPollInterval = 5 * time.Second
+
+// defaultNodePortRange is the default --service-node-port-range of the API server.
+var defaultNodePortRange = utilnet.PortRange{Base: 30000, Size: 2768}
+
 type loadbalancers struct {
 	client *linodego.Client
 	zone   string
 
-	kubeClient kubernetes.Interface
+	kubeClient   kubernetes.Interface
+	kubeClientMu sync.Mutex
+	recorder     record.EventRecorder
+
+	// nodes lists the nodes of the cluster from the shared informer, e.g. to find the nodes that
+	// aren't ready. The nodes are listed from the API without it.
+	nodes v1listers.NodeLister
+
+	drains        drainTracker
+	backoff       reconcileBackoff
+	tlsObjects    tlsObjectCache
+	serviceLocks  serviceLocks
+	skippedNodes  skippedNodesEvents
+	firewallNames firewallNameCache
+
+	// dryRun makes the mutating NodeBalancer API calls log the intended change instead.
+	dryRun bool
+
+	// onDryRun, if set, receives the dry-run changes instead of the log, e.g. for audits.
+	onDryRun func(change dryRunChange)
+
+	// retainOnNamespaceDelete keeps the NodeBalancers of the Services deleted along with their
+	// namespace instead of deleting them.
+	retainOnNamespaceDelete bool
+
+	// disableCreation restricts Services to the existing NodeBalancers they reference with
+	// annLinodeNodeBalancerID, refusing to create new ones.
+	disableCreation bool
+
+	// forceDeletePaused deletes the NodeBalancers of Services paused with annLinodePaused when
+	// they are deleted, instead of failing the deletion until the annotation is removed.
+	forceDeletePaused bool
+
+	// defaults are the NodeBalancer settings of the cloud config used when a Service has no
+	// annotation for them.
+	defaults loadBalancerConfig
+
+	// accounts are the loadbalancers of the other Linode accounts of the cloud config, by the
+	// regions whose NodeBalancers they manage.
+	accounts map[string]*loadbalancers
+
+	// tokenSecrets are the loadbalancers of the Linode accounts of the token Secrets referenced
+	// by Services. It is only set on the loadbalancers of LINODE_API_TOKEN.
+	tokenSecrets *tokenSecretAccounts
 }
 
 type portConfigAnnotation struct {
@@ -70,15 +324,62 @@ type portConfigAnnotation struct {
 	Protocol      string `json:"protocol"`
 }
 
+// protocolUDP is the protocol of NodeBalancer configs balancing UDP traffic, which linodego
+// doesn't define yet.
+const protocolUDP linodego.ConfigProtocol = "udp"
+
 type portConfig struct {
 	TLSSecretName string
+	TLSObjectURL  string
 	Protocol      linodego.ConfigProtocol
 	Port          int
 }
 
 // newLoadbalancers returns a cloudprovider.LoadBalancer whose concrete type is a *loadbalancer.
-func newLoadbalancers(client *linodego.Client, zone string) cloudprovider.LoadBalancer {
-	return &loadbalancers{client: client, zone: zone}
+func newLoadbalancers(client *linodego.Client, zone string, defaults loadBalancerConfig) cloudprovider.LoadBalancer {
+	return &loadbalancers{
+		client:                  client,
+		zone:                    zone,
+		dryRun:                  Options.DryRun,
+		retainOnNamespaceDelete: Options.RetainOnNamespaceDelete,
+		disableCreation:         Options.DisableNodeBalancerCreation,
+		forceDeletePaused:       Options.ForceDeletePaused,
+		defaults:                defaults,
+	}
+}
+
+// forService returns the loadbalancers of the Linode account owning the NodeBalancer of service,
+// which is the account of the token Secret referenced by annLinodeTokenSecret if it has one, or
+// else the account of the region requested with annLinodeRegion, if it has its own.
+func (l *loadbalancers) forService(service *v1.Service) (*loadbalancers, error) {
+	if secretName, ok := getServiceAnnotation(service, annLinodeTokenSecret); ok && l.tokenSecrets != nil {
+		return l.forTokenSecret(service, secretName)
+	}
+	if region, ok := getServiceAnnotation(service, annLinodeRegion); ok {
+		if account, ok := l.accounts[region]; ok {
+			return account, nil
+		}
+	}
+	return l, nil
+}
+
+// accountLoadBalancers returns the loadbalancers of the other Linode accounts, once each.
+func (l *loadbalancers) accountLoadBalancers() []*loadbalancers {
+	regions := make([]string, 0, len(l.accounts))
+	for region := range l.accounts {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	var accounts []*loadbalancers
+	seen := make(map[*loadbalancers]bool, len(l.accounts))
+	for _, region := range regions {
+		if account := l.accounts[region]; !seen[account] {
+			seen[account] = true
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
 }
 
 func (l *loadbalancers) getNodeBalancerForService(ctx context.Context, service *v1.Service) (*linodego.NodeBalancer, error) {
@@ -91,16 +392,136 @@ func (l *loadbalancers) getNodeBalancerForService(ctx context.Context, service *
 		nb, err := l.getNodeBalancerByID(ctx, service, id)
 		switch err.(type) {
 		case nil:
+			if belongsToOtherCluster(nb) {
+				err = fmt.Errorf("%s annotation points to NodeBalancer (%d) used by another cluster", annLinodeNodeBalancerID, id)
+				l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerInUse", "%s", err)
+				return nil, err
+			}
 			return nb, nil
 
 		case lbNotFoundError:
+			// The NodeBalancer was deleted out-of-band if the status doesn't point to an existing
+			// NodeBalancer either, and is recreated by EnsureLoadBalancer. Otherwise, the annotation
+			// was most likely set to a wrong ID.
+			if len(service.Status.LoadBalancer.Ingress) > 0 {
+				_, statusErr := l.getNodeBalancerByStatus(ctx, service)
+				if _, deleted := statusErr.(lbNotFoundError); deleted {
+					return nil, err
+				}
+			}
 			return nil, fmt.Errorf("%s annotation points to a NodeBalancer that does not exist: %s", annLinodeNodeBalancerID, err)
 
 		default:
 			return nil, err
 		}
 	}
-	return l.getNodeBalancerByStatus(ctx, service)
+
+	// The NodeBalancers are listed once and matched against every criterion, as each list of a
+	// large account takes several requests.
+	nbs, err := l.client.ListNodeBalancers(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if nb := findNodeBalancerByUIDTag(service, nbs); nb != nil {
+		return nb, nil
+	}
+
+	// NodeBalancers created before UID tags were introduced are found by the status or the
+	// generated label of service, and get their UID tag once reconciled.
+	if nb := findNodeBalancerByStatus(service, nbs); nb != nil {
+		return nb, nil
+	}
+	if legacy := findNodeBalancerByLabel(service, nbs, nodeBalancerLabel(service)); legacy != nil {
+		return legacy, nil
+	}
+	// Services that aren't of type LoadBalancer don't own their preserved NodeBalancer.
+	if service.Spec.Type == v1.ServiceTypeLoadBalancer {
+		if preserved := findPreservedNodeBalancer(service, nbs); preserved != nil {
+			return preserved, nil
+		}
+	}
+	if l.usesDefaultNodeBalancer(service) {
+		return l.getDefaultNodeBalancer(ctx, service)
+	}
+	return nil, lbNotFoundError{serviceNn: getServiceNn(service)}
+}
+
+// usesDefaultNodeBalancer reports whether service shares the default NodeBalancer of the cloud
+// config when it has no NodeBalancer of its own. Services with a region annotation don't, as the
+// default NodeBalancer is in the region of the cluster.
+func (l *loadbalancers) usesDefaultNodeBalancer(service *v1.Service) bool {
+	if _, ok := getServiceAnnotation(service, annLinodeRegion); ok {
+		return false
+	}
+	return l.defaults.DefaultNodeBalancerID != 0
+}
+
+// isDefaultNodeBalancer reports whether nb is the default NodeBalancer of the cloud config, which
+// is never deleted or recreated, even once the last Service sharing it is deleted.
+func (l *loadbalancers) isDefaultNodeBalancer(nb *linodego.NodeBalancer) bool {
+	return l.defaults.DefaultNodeBalancerID != 0 && nb.ID == l.defaults.DefaultNodeBalancerID
+}
+
+// getDefaultNodeBalancer returns the default NodeBalancer of the cloud config for service. A
+// default NodeBalancer that doesn't exist isn't replaced by a NodeBalancer of service.
+func (l *loadbalancers) getDefaultNodeBalancer(ctx context.Context, service *v1.Service) (*linodego.NodeBalancer, error) {
+	id := l.defaults.DefaultNodeBalancerID
+	nb, err := l.getNodeBalancerByID(ctx, service, id)
+	if notFound, ok := err.(lbNotFoundError); ok {
+		notFound.isDefault = true
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if belongsToOtherCluster(nb) {
+		err = fmt.Errorf("default NodeBalancer (%d) of the cloud config is used by another cluster", id)
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerInUse", "%s", err)
+		return nil, err
+	}
+	return nb, nil
+}
+
+// findNodeBalancerByUIDTag returns the NodeBalancer of nbs tagged with the UID of service, if any.
+func findNodeBalancerByUIDTag(service *v1.Service, nbs []linodego.NodeBalancer) *linodego.NodeBalancer {
+	tag := serviceUIDTag(service)
+	for i := range nbs {
+		if containsString(nbs[i].Tags, tag) && !belongsToOtherCluster(&nbs[i]) {
+			if klog.V(2) {
+				serviceLog("find-nodebalancer", service, nbs[i].ID).infof("found NodeBalancer (%d) for service (%s) via its UID tag", nbs[i].ID, getServiceNn(service))
+			}
+			return &nbs[i]
+		}
+	}
+	return nil
+}
+
+// findNodeBalancerByLabel returns the NodeBalancer of nbs labeled label that has no UID tag yet,
+// if any. Preserved NodeBalancers are left to findPreservedNodeBalancer.
+func findNodeBalancerByLabel(service *v1.Service, nbs []linodego.NodeBalancer, label string) *linodego.NodeBalancer {
+	for i := range nbs {
+		nb := &nbs[i]
+		if nb.Label == nil || *nb.Label != label || belongsToOtherCluster(nb) || len(getServiceUIDs(nb)) > 0 || containsString(nb.Tags, preservedTag(service)) {
+			continue
+		}
+		serviceLog("adopt-nodebalancer", service, nb.ID).infof("found NodeBalancer (%d) for service (%s) via its legacy label %q", nb.ID, getServiceNn(service), label)
+		return nb
+	}
+	return nil
+}
+
+// findPreservedNodeBalancer returns the NodeBalancer of nbs preserved when service stopped being
+// of type LoadBalancer, if any.
+func findPreservedNodeBalancer(service *v1.Service, nbs []linodego.NodeBalancer) *linodego.NodeBalancer {
+	tag := preservedTag(service)
+	for i := range nbs {
+		if containsString(nbs[i].Tags, tag) && !belongsToOtherCluster(&nbs[i]) {
+			serviceLog("adopt-nodebalancer", service, nbs[i].ID).infof("re-adopting NodeBalancer (%d) preserved for service (%s)", nbs[i].ID, getServiceNn(service))
+			return &nbs[i]
+		}
+	}
+	return nil
 }
 
 func (l *loadbalancers) getLatestServiceLoadBalancerStatus(ctx context.Context, service *v1.Service) (v1.LoadBalancerStatus, error) {
@@ -117,17 +538,68 @@ func (l *loadbalancers) getLatestServiceLoadBalancerStatus(ctx context.Context,
 }
 
 // getNodeBalancerByStatus attempts to get the NodeBalancer from the IPv4 specified in the
-// most recent LoadBalancer status.
+// most recent LoadBalancer status. Statuses written with annLinodeHostnameOnlyIngress have no IP,
+// so the NodeBalancer is looked up by the port ownership tags of service instead.
 func (l *loadbalancers) getNodeBalancerByStatus(ctx context.Context, service *v1.Service) (*linodego.NodeBalancer, error) {
+	if len(service.Status.LoadBalancer.Ingress) == 0 {
+		return nil, lbNotFoundError{serviceNn: getServiceNn(service)}
+	}
+	nbs, err := l.client.ListNodeBalancers(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if nb := findNodeBalancerByStatus(service, nbs); nb != nil {
+		return nb, nil
+	}
+	return nil, lbNotFoundError{serviceNn: getServiceNn(service)}
+}
+
+// findNodeBalancerByStatus returns the NodeBalancer of nbs with the IPv4 of the LoadBalancer
+// status of service, or with ports owned by service if the status has no IP, if any.
+func findNodeBalancerByStatus(service *v1.Service, nbs []linodego.NodeBalancer) *linodego.NodeBalancer {
+	hasIP := false
 	for _, ingress := range service.Status.LoadBalancer.Ingress {
-		ipv4 := ingress.IP
-		if nb, err := l.getNodeBalancerByIPv4(ctx, service, ipv4); err == nil {
-			return nb, err
+		if ingress.IP == "" {
+			continue
+		}
+		hasIP = true
+		if nb := findNodeBalancerByIPv4(service, nbs, ingress.IP); nb != nil {
+			return nb
 		}
 	}
+	if !hasIP && len(service.Status.LoadBalancer.Ingress) > 0 {
+		return findNodeBalancerByOwner(service, nbs)
+	}
+	return nil
+}
+
+// getNodeBalancerByOwner returns the NodeBalancer with ports owned by service.
+func (l *loadbalancers) getNodeBalancerByOwner(ctx context.Context, service *v1.Service) (*linodego.NodeBalancer, error) {
+	nbs, err := l.client.ListNodeBalancers(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if nb := findNodeBalancerByOwner(service, nbs); nb != nil {
+		return nb, nil
+	}
 	return nil, lbNotFoundError{serviceNn: getServiceNn(service)}
 }
 
+// findNodeBalancerByOwner returns the NodeBalancer of nbs with ports owned by service, if any.
+func findNodeBalancerByOwner(service *v1.Service, nbs []linodego.NodeBalancer) *linodego.NodeBalancer {
+	for i := range nbs {
+		if belongsToOtherCluster(&nbs[i]) {
+			continue
+		}
+		for _, uid := range getPortOwners(&nbs[i]) {
+			if uid == string(service.UID) {
+				return &nbs[i]
+			}
+		}
+	}
+	return nil
+}
+
 // cleanupOldNodeBalancer removes the service's disowned NodeBalancer if there is one.
 //
 // The current NodeBalancer from getNodeBalancerForService is compared to the most recent
@@ -154,11 +626,11 @@ func (l *loadbalancers) cleanupOldNodeBalancer(ctx context.Context, service *v1.
 		return nil
 	}
 
-	if err := l.client.DeleteNodeBalancer(ctx, previousNB.ID); err != nil {
+	if err := l.deleteNodeBalancer(ctx, service, previousNB); err != nil {
 		return err
 	}
 
-	klog.Infof("successfully deleted old NodeBalancer (%d) for service (%s)", previousNB.ID, getServiceNn(service))
+	serviceLog("delete-nodebalancer", service, previousNB.ID).infof("successfully removed old NodeBalancer (%d) for service (%s)", previousNB.ID, getServiceNn(service))
 	return nil
 }
 
@@ -166,6 +638,14 @@ func (l *loadbalancers) cleanupOldNodeBalancer(ctx context.Context, service *v1.
 //
 // GetLoadBalancer will not modify service.
 func (l *loadbalancers) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	account, err := l.forService(service)
+	if err != nil {
+		return nil, false, err
+	}
+	if account != l {
+		return account.GetLoadBalancer(ctx, clusterName, service)
+	}
+
 	ctx = sentry.SetHubOnContext(ctx)
 	sentry.SetTag(ctx, "cluster_name", clusterName)
 	sentry.SetTag(ctx, "service", service.Name)
@@ -183,14 +663,30 @@ func (l *loadbalancers) GetLoadBalancer(ctx context.Context, clusterName string,
 		return nil, false, err
 	}
 
-	return makeLoadBalancerStatus(nb), true, nil
+	return makeLoadBalancerStatus(service, nb), true, nil
 }
 
 // EnsureLoadBalancer ensures that the cluster is running a load balancer for
 // service.
 //
 // EnsureLoadBalancer will not modify service or nodes.
-func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (lbStatus *v1.LoadBalancerStatus, err error) {
+func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	account, err := l.forService(service)
+	if err != nil {
+		return nil, err
+	}
+	if account != l {
+		return account.EnsureLoadBalancer(ctx, clusterName, service, nodes)
+	}
+
+	defer l.serviceLocks.lock(service)()
+	return l.ensureLoadBalancer(ctx, clusterName, service, nodes)
+}
+
+// ensureLoadBalancer is EnsureLoadBalancer for a Service whose lock is held.
+func (l *loadbalancers) ensureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (lbStatus *v1.LoadBalancerStatus, err error) {
+	defer observeLoadBalancerOperation("ensure", time.Now(), &err)
+
 	ctx = sentry.SetHubOnContext(ctx)
 	sentry.SetTag(ctx, "cluster_name", clusterName)
 	sentry.SetTag(ctx, "service", service.Name)
@@ -198,17 +694,72 @@ func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 	var nb *linodego.NodeBalancer
 	serviceNn := getServiceNn(service)
 
+	if isPaused(service) {
+		return l.getPausedLoadBalancerStatus(ctx, service)
+	}
+
+	if wait, lastErr := l.backoff.remaining(service.UID, time.Now()); wait > 0 {
+		return nil, fmt.Errorf("backing off reconciling service (%s) for %s after error: %v", serviceNn, wait.Round(time.Second), lastErr)
+	}
+	defer func() { l.recordReconcileResult(service, err) }()
+	defer func() { l.setReconcileStatus(service, nb, err, time.Now()) }()
+
+	if _, err = getIngressHostname(service); err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidHostname", "%s", err)
+		sentry.CaptureError(ctx, err)
+		return nil, err
+	}
+
+	if err = validateServiceAnnotations(service); err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidAnnotations", "%s", err)
+		sentry.CaptureError(ctx, err)
+		return nil, fmt.Errorf("invalid annotations for service (%s): %v", serviceNn, err)
+	}
+
 	nb, err = l.getNodeBalancerForService(ctx, service)
+	deletedID := 0
+	if notFound, ok := err.(lbNotFoundError); ok && notFound.isDefault {
+		l.recordEvent(service, v1.EventTypeWarning, "DefaultNodeBalancerNotFound", "%s", err)
+		return nil, err
+	}
+	if notFound, ok := err.(lbNotFoundError); ok && notFound.nodeBalancerID != 0 {
+		// The NodeBalancer referenced by annLinodeNodeBalancerID was deleted out-of-band. The
+		// replacement created by a previous attempt that failed to update the annotation is reused
+		// rather than creating another one.
+		deletedID = notFound.nodeBalancerID
+		nb, err = l.getNodeBalancerByOwner(ctx, service)
+	}
+
 	switch err.(type) {
 	case lbNotFoundError:
+		if l.disableCreation {
+			if deletedID != 0 {
+				err = fmt.Errorf("NodeBalancer (%d) referenced by %s doesn't exist and NodeBalancer creation is disabled", deletedID, annLinodeNodeBalancerID)
+			} else {
+				err = fmt.Errorf("NodeBalancer creation is disabled, set %s to the ID of an existing NodeBalancer", annLinodeNodeBalancerID)
+			}
+			l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerCreationDisabled", "%s", err)
+			return nil, err
+		}
+
 		if nb, err = l.buildLoadBalancerRequest(ctx, service, nodes); err != nil {
 			sentry.CaptureError(ctx, err)
 			return nil, err
 		}
-		klog.Infof("created new NodeBalancer (%d) for service (%s)", nb.ID, serviceNn)
+		serviceLog("create-nodebalancer", service, nb.ID).infof("created new NodeBalancer (%d) for service (%s)", nb.ID, serviceNn)
+
+		if err = l.reconcileFirewall(ctx, service, nb); err != nil {
+			sentry.CaptureError(ctx, err)
+			return nil, fmt.Errorf("error reconciling firewall of NodeBalancer (%d): %v", nb.ID, err)
+		}
 
 	case nil:
-		if err = l.updateNodeBalancer(ctx, service, nodes, nb); err != nil {
+		if forceRecreatePending(service, nb) {
+			nb, err = l.forceRecreateNodeBalancer(ctx, service, nodes, nb)
+		} else {
+			err = l.updateNodeBalancer(ctx, service, nodes, nb)
+		}
+		if err != nil {
 			sentry.CaptureError(ctx, err)
 			return nil, err
 		}
@@ -218,8 +769,32 @@ func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 		return nil, err
 	}
 
-	klog.Infof("NodeBalancer (%d) has been ensured for service (%s)", nb.ID, serviceNn)
-	lbStatus = makeLoadBalancerStatus(nb)
+	if deletedID != 0 {
+		if err = l.setNodeBalancerIDAnnotation(service, nb.ID); err != nil {
+			sentry.CaptureError(ctx, err)
+			return nil, fmt.Errorf("failed to point %s of service (%s) to NodeBalancer (%d): %v", annLinodeNodeBalancerID, serviceNn, nb.ID, err)
+		}
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerRecreated",
+			"NodeBalancer (%d) was deleted outside of the CCM and has been replaced by NodeBalancer (%d)", deletedID, nb.ID)
+	}
+
+	if nb, err = l.waitForNodeBalancerIP(ctx, service, nb); err != nil {
+		sentry.CaptureError(ctx, err)
+		return nil, err
+	}
+
+	if err = l.reconcileDNSRecords(ctx, service, nb); err != nil {
+		sentry.CaptureError(ctx, err)
+		return nil, err
+	}
+
+	if err = l.waitForBackends(ctx, service, nb); err != nil {
+		sentry.CaptureError(ctx, err)
+		return nil, err
+	}
+
+	serviceLog("ensure-loadbalancer", service, nb.ID).infof("NodeBalancer (%d) has been ensured for service (%s)", nb.ID, serviceNn)
+	lbStatus = makeLoadBalancerStatus(service, nb)
 
 	if !l.shouldPreserveNodeBalancer(service) {
 		if err := l.cleanupOldNodeBalancer(ctx, service); err != nil {
@@ -231,152 +806,725 @@ func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 	return lbStatus, nil
 }
 
-//nolint:funlen
-func (l *loadbalancers) updateNodeBalancer(ctx context.Context, service *v1.Service, nodes []*v1.Node, nb *linodego.NodeBalancer) (err error) {
-	connThrottle := getConnectionThrottle(service)
-	if connThrottle != nb.ClientConnThrottle {
-		update := nb.GetUpdateOptions()
-		update.ClientConnThrottle = &connThrottle
+// isPaused reports whether reconciling the NodeBalancer of service is paused with annLinodePaused.
+func isPaused(service *v1.Service) bool {
+	return getServiceBoolAnnotation(service, annLinodePaused)
+}
+
+func (l *loadbalancers) recordPaused(service *v1.Service, op string) {
+	serviceLog(op, service, 0).infof("skipping reconciliation of service (%s) as it is paused with %s", getServiceNn(service), annLinodePaused)
+	l.recordEvent(service, v1.EventTypeNormal, "ReconcilePaused", "not changing the NodeBalancer while %s is set", annLinodePaused)
+}
+
+// getPausedLoadBalancerStatus returns the status of the current NodeBalancer of the paused
+// service, without changing anything.
+func (l *loadbalancers) getPausedLoadBalancerStatus(ctx context.Context, service *v1.Service) (*v1.LoadBalancerStatus, error) {
+	l.recordPaused(service, "ensure-loadbalancer")
+
+	nb, err := l.getNodeBalancerForService(ctx, service)
+	if _, ok := err.(lbNotFoundError); ok {
+		return nil, fmt.Errorf("service (%s) is paused with %s and has no NodeBalancer to report", getServiceNn(service), annLinodePaused)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return makeLoadBalancerStatus(service, nb), nil
+}
+
+// waitForNodeBalancerIP returns nb once it has been assigned an IPv4 address, polling it for up to
+// Options.NodeBalancerIPTimeout so that the Service doesn't look ready with an empty ingress. The
+// wait is skipped if the timeout is 0 and in dry-run mode.
+func (l *loadbalancers) waitForNodeBalancerIP(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) (*linodego.NodeBalancer, error) {
+	if hasIPv4(nb) || l.dryRun || Options.NodeBalancerIPTimeout <= 0 {
+		return nb, nil
+	}
 
-		nb, err = l.client.UpdateNodeBalancer(ctx, nb.ID, update)
+	err := wait.Poll(nodeBalancerIPPollInterval, Options.NodeBalancerIPTimeout, func() (bool, error) {
+		current, err := l.client.GetNodeBalancer(ctx, nb.ID)
 		if err != nil {
-			sentry.CaptureError(ctx, err)
-			return err
+			return false, err
 		}
+		nb = current
+		return hasIPv4(nb), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("NodeBalancer (%d) of service (%s) wasn't assigned an IPv4 address within %s", nb.ID, getServiceNn(service), Options.NodeBalancerIPTimeout)
 	}
+	return nb, err
+}
 
-	// Get all of the NodeBalancer's configs
-	nbCfgs, err := l.client.ListNodeBalancerConfigs(ctx, nb.ID, nil)
-	if err != nil {
-		sentry.CaptureError(ctx, err)
+// getWaitForBackendsTimeout returns how long to wait for the backends of service to be UP based
+// on its wait-for-backends annotation, or 0 if they aren't waited for.
+func getWaitForBackendsTimeout(service *v1.Service) (time.Duration, error) {
+	raw, ok := getServiceAnnotation(service, annLinodeWaitForBackends)
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid value %q for %s: must be a positive duration, e.g. 2m", raw, annLinodeWaitForBackends)
+	}
+	return timeout, nil
+}
+
+// waitForBackends polls the backends of the configs of nb owned by service until at least one
+// backend of each of them is UP, for as long as requested by service's wait-for-backends
+// annotation. Configs without backends aren't waited for. The wait is skipped in dry-run mode.
+//
+// Backends that aren't UP in time are reported as a warning event, and only fail the reconcile if
+// Options.WaitForBackendsStrict is set.
+func (l *loadbalancers) waitForBackends(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	timeout, err := getWaitForBackendsTimeout(service)
+	if err != nil || timeout == 0 || l.dryRun {
+		// Invalid annotations are reported by validateServiceAnnotations.
+		return nil
+	}
+
+	var pending []int
+	err = wait.Poll(backendStatusPollInterval, timeout, func() (bool, error) {
+		pending, err = l.getPortsWithoutUpBackends(ctx, service, nb)
+		return err == nil && len(pending) == 0, err
+	})
+	if err != wait.ErrWaitTimeout {
 		return err
 	}
 
-	// Delete any configs for ports that have been removed from the Service
-	if err = l.deleteUnusedConfigs(ctx, nbCfgs, service.Spec.Ports); err != nil {
-		sentry.CaptureError(ctx, err)
+	err = fmt.Errorf("no backend of port(s) %s of NodeBalancer (%d) is UP after %s", joinPorts(pending), nb.ID, timeout)
+	l.recordEvent(service, v1.EventTypeWarning, "BackendsNotUp", "%s", err)
+	if Options.WaitForBackendsStrict {
 		return err
 	}
+	serviceLog("wait-for-backends", service, nb.ID).infof("reporting service (%s) as ready in a degraded state: %s", getServiceNn(service), err)
+	return nil
+}
 
-	// Add or overwrite configs for each of the Service's ports
-	for _, port := range service.Spec.Ports {
-		if port.Protocol == v1.ProtocolUDP {
-			err := fmt.Errorf("error updating NodeBalancer Config: ports with the UDP protocol are not supported")
-			sentry.CaptureError(ctx, err)
-			return err
-		}
+// getPortsWithoutUpBackends returns the ports of the configs of nb owned by service that have
+// backends, none of which is UP.
+func (l *loadbalancers) getPortsWithoutUpBackends(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) ([]int, error) {
+	ports := make(map[int]bool)
+	for _, port := range getNodeBalancerPorts(service) {
+		ports[int(port.Port)] = true
+	}
 
-		// Construct a new config for this port
-		newNBCfg, err := l.buildNodeBalancerConfig(service, int(port.Port))
+	nbCfgs, err := l.client.ListNodeBalancerConfigs(ctx, nb.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []int
+	for _, nbc := range nbCfgs {
+		if !ports[nbc.Port] {
+			continue
+		}
+		nodes, err := l.client.ListNodeBalancerNodes(ctx, nb.ID, nbc.ID, nil)
 		if err != nil {
-			sentry.CaptureError(ctx, err)
-			return err
+			return nil, err
 		}
 
-		// Add all of the Nodes to the config
-		var newNBNodes []linodego.NodeBalancerNodeCreateOptions
+		up := len(nodes) == 0
 		for _, node := range nodes {
-			newNBNodes = append(newNBNodes, l.buildNodeBalancerNodeCreateOptions(node, port.NodePort))
-		}
-
-		// Look for an existing config for this port
-		var currentNBCfg *linodego.NodeBalancerConfig
-		for i := range nbCfgs {
-			nbc := nbCfgs[i]
-			if nbc.Port == int(port.Port) {
-				currentNBCfg = &nbc
+			if node.Status == "UP" {
+				up = true
 				break
 			}
 		}
-
-		// If there's no existing config, create it
-		var rebuildOpts linodego.NodeBalancerConfigRebuildOptions
-		if currentNBCfg == nil {
-			createOpts := newNBCfg.GetCreateOptions()
-
-			currentNBCfg, err = l.client.CreateNodeBalancerConfig(ctx, nb.ID, createOpts)
-			if err != nil {
-				sentry.CaptureError(ctx, err)
-				return fmt.Errorf("[port %d] error creating NodeBalancer config: %v", int(port.Port), err)
-			}
-			rebuildOpts = currentNBCfg.GetRebuildOptions()
-
-			// SSLCert and SSLKey return <REDACTED> from the API, so copy the
-			// value that we sent in create for the rebuild
-			rebuildOpts.SSLCert = newNBCfg.SSLCert
-			rebuildOpts.SSLKey = newNBCfg.SSLKey
-		} else {
-			rebuildOpts = newNBCfg.GetRebuildOptions()
+		if !up {
+			pending = append(pending, nbc.Port)
 		}
+	}
+	sort.Ints(pending)
+	return pending, nil
+}
 
-		rebuildOpts.Nodes = newNBNodes
-
-		if _, err = l.client.RebuildNodeBalancerConfig(ctx, nb.ID, currentNBCfg.ID, rebuildOpts); err != nil {
-			sentry.CaptureError(ctx, err)
-			return fmt.Errorf("[port %d] error rebuilding NodeBalancer config: %v", int(port.Port), err)
-		}
+func joinPorts(ports []int) string {
+	strs := make([]string, 0, len(ports))
+	for _, port := range ports {
+		strs = append(strs, strconv.Itoa(port))
 	}
-	return nil
+	return strings.Join(strs, ", ")
 }
 
-// UpdateLoadBalancer updates the NodeBalancer to have configs that match the Service's ports
-func (l *loadbalancers) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (err error) {
-	ctx = sentry.SetHubOnContext(ctx)
-	sentry.SetTag(ctx, "cluster_name", clusterName)
-	sentry.SetTag(ctx, "service", service.Name)
+func hasIPv4(nb *linodego.NodeBalancer) bool {
+	return nb.IPv4 != nil && *nb.IPv4 != ""
+}
 
-	// UpdateLoadBalancer is invoked with a nil LoadBalancerStatus; we must fetch the latest
-	// status for NodeBalancer discovery.
-	serviceWithStatus := service.DeepCopy()
-	serviceWithStatus.Status.LoadBalancer, err = l.getLatestServiceLoadBalancerStatus(ctx, service)
-	if err != nil {
-		return fmt.Errorf("failed to get latest LoadBalancer status for service (%s): %s", getServiceNn(service), err)
+// setNodeBalancerIDAnnotation points the annLinodeNodeBalancerID annotation of service to the
+// NodeBalancer id, or only logs the change in dry-run mode. Updates are retried on conflicts with
+// other writers of the Service, such as the service controller writing its status.
+func (l *loadbalancers) setNodeBalancerIDAnnotation(service *v1.Service, id int) error {
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "update-nodebalancer-id-annotation", NodeBalancerID: id})
+		return nil
 	}
 
-	nb, err := l.getNodeBalancerForService(ctx, serviceWithStatus)
-	if err != nil {
-		sentry.CaptureError(ctx, err)
+	if err := l.retrieveKubeClient(); err != nil {
 		return err
 	}
-
-	if !l.shouldPreserveNodeBalancer(service) {
-		if err := l.cleanupOldNodeBalancer(ctx, service); err != nil {
-			sentry.CaptureError(ctx, err)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := l.kubeClient.CoreV1().Services(service.Namespace).Get(service.Name, metav1.GetOptions{})
+		if err != nil {
 			return err
 		}
-	}
-
-	return l.updateNodeBalancer(ctx, serviceWithStatus, nodes, nb)
-}
+		if current.Annotations == nil {
+			current.Annotations = make(map[string]string)
+		}
+		current.Annotations[annLinodeNodeBalancerID] = strconv.Itoa(id)
+		_, err = l.kubeClient.CoreV1().Services(service.Namespace).Update(current)
+		return err
+	})
+}
+
+// recordReconcileResult resets the reconcile backoff of service if err is nil, and otherwise
+// extends it and reports err in an event. The backoff is disabled if Options.LoadBalancerMaxBackoff
+// isn't positive.
+func (l *loadbalancers) recordReconcileResult(service *v1.Service, err error) {
+	maxDelay := Options.LoadBalancerMaxBackoff
+	if err == nil || maxDelay <= 0 {
+		l.backoff.reset(service.UID)
+		return
+	}
+
+	// Quota errors only go away once the account's limit is raised, so retrying them early would
+	// only waste API requests.
+	var minDelay time.Duration
+	if classifyAPIError(err) == apiErrorQuotaExceeded {
+		minDelay = maxDelay
+	}
+
+	delay := l.backoff.failed(service.UID, err, time.Now(), minDelay, maxDelay)
+	l.recordEvent(service, v1.EventTypeWarning, "ReconcileBackoff", "retrying in %s after error: %s", delay, err)
+}
+
+//nolint:funlen
+func (l *loadbalancers) updateNodeBalancer(ctx context.Context, service *v1.Service, nodes []*v1.Node, nb *linodego.NodeBalancer) (err error) {
+	if region, ok := getServiceAnnotation(service, annLinodeRegion); ok && region != nb.Region {
+		err = fmt.Errorf("NodeBalancer (%d) is in region %s, but service (%s) requests region %s: NodeBalancers can't be moved between regions", nb.ID, nb.Region, getServiceNn(service), region)
+		l.recordEvent(service, v1.EventTypeWarning, "RegionMismatch", "%s", err)
+		return err
+	}
+	l.checkHTTPSRedirect(service)
+
+	eligible, err := l.getEligibleNodes(ctx, service, nodes)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+	nodes, err = l.filterNodesByTrafficPolicy(service, eligible)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+
+	connThrottle, collapsed := l.getNodeBalancerThrottle(service)
+	if connThrottle != nb.ClientConnThrottle {
+		// The collapse is reported when it changes the throttle rather than on every sync.
+		if collapsed {
+			l.recordThrottleCollapsed(service, connThrottle)
+		}
+		update := nb.GetUpdateOptions()
+		update.ClientConnThrottle = &connThrottle
+
+		nb, err = l.updateNodeBalancerOptions(ctx, service, nb, update)
+		if err != nil {
+			sentry.CaptureError(ctx, err)
+			return err
+		}
+	}
+
+	// Make sure none of the Service's ports are used by another Service sharing the NodeBalancer
+	if err = l.checkPortConflicts(service, nb); err != nil {
+		return err
+	}
+
+	// Get all of the NodeBalancer's configs
+	nbCfgs, err := l.client.ListNodeBalancerConfigs(ctx, nb.ID, nil)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+
+	// Delete any configs for ports that have been removed from the Service
+	if err = l.deleteUnusedConfigs(ctx, service, nb, nbCfgs); err != nil {
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+
+	// Add or overwrite configs for each of the Service's ports
+	for _, port := range getNodeBalancerPorts(service) {
+		// Externally-managed configs only get their backend nodes synced
+		externalCfg, err := l.getExternalConfig(service, nb, nbCfgs, port)
+		if err != nil {
+			sentry.CaptureError(ctx, err)
+			return err
+		}
+		if externalCfg != nil {
+			keep, err := l.keepBackendsWithoutNodes(ctx, service, externalCfg, eligible)
+			if err != nil {
+				return err
+			}
+			if keep {
+				continue
+			}
+			if err = l.syncExternalConfigNodes(ctx, service, nodes, port, externalCfg); err != nil {
+				sentry.CaptureError(ctx, err)
+				return fmt.Errorf("[port %d] error syncing nodes of externally-managed NodeBalancer config (%d): %v", int(port.Port), externalCfg.ID, err)
+			}
+			continue
+		}
+
+		// Construct a new config for this port
+		newNBCfg, err := l.buildNodeBalancerConfig(service, int(port.Port))
+		if err != nil {
+			sentry.CaptureError(ctx, err)
+			return err
+		}
+
+		nodePort, err := l.getNodePort(service, port)
+		if err != nil {
+			sentry.CaptureError(ctx, err)
+			return err
+		}
+
+		// Add all of the Nodes to the config
+		newNBNodes, err := l.buildNodeBalancerNodes(service, nodes, nodePort, newNBCfg.Algorithm)
+		if err != nil {
+			sentry.CaptureError(ctx, err)
+			return fmt.Errorf("[port %d] error building NodeBalancer nodes: %v", int(port.Port), err)
+		}
 
-// Delete any NodeBalancer configs for ports that no longer exist on the Service
+		// Look for the existing configs for this port, of which there should only be one
+		var portNBCfgs []linodego.NodeBalancerConfig
+		for _, nbc := range nbCfgs {
+			if nbc.Port == int(port.Port) {
+				portNBCfgs = append(portNBCfgs, nbc)
+			}
+		}
+		currentNBCfg, err := l.deleteDuplicateConfigs(ctx, service, nb.ID, portNBCfgs, newNBCfg)
+		if err != nil {
+			sentry.CaptureError(ctx, err)
+			return fmt.Errorf("[port %d] error deleting duplicate NodeBalancer configs: %v", int(port.Port), err)
+		}
+
+		// A config that can't be updated to the desired settings is recreated from scratch
+		if currentNBCfg != nil && configNeedsRecreate(*currentNBCfg, newNBCfg) {
+			serviceLog("recreate-config", service, nb.ID).infof("recreating config of port %d of NodeBalancer (%d) to change its protocol from %s to %s",
+				currentNBCfg.Port, nb.ID, currentNBCfg.Protocol, newNBCfg.Protocol)
+			if err = l.deleteNodeBalancerConfig(ctx, service, nb.ID, currentNBCfg.ID); err != nil {
+				sentry.CaptureError(ctx, err)
+				return fmt.Errorf("[port %d] error deleting NodeBalancer config: %v", int(port.Port), err)
+			}
+			l.drains.forgetConfig(nb.ID, currentNBCfg.ID)
+			currentNBCfg = nil
+		}
+
+		// If there's no existing config, create it; otherwise update its settings
+		if currentNBCfg == nil {
+			if err = checkConfigHasTLSCert(newNBCfg); err != nil {
+				sentry.CaptureError(ctx, err)
+				return err
+			}
+			currentNBCfg, err = l.createNodeBalancerConfig(ctx, service, nb.ID, newNBCfg)
+			if err != nil {
+				sentry.CaptureError(ctx, err)
+				return fmt.Errorf("[port %d] error creating NodeBalancer config: %v", int(port.Port), err)
+			}
+			l.recordUploadedTLSObjectCert(service, int(port.Port), currentNBCfg.ID, newNBCfg)
+		} else {
+			l.omitUploadedTLSObjectCert(service, int(port.Port), currentNBCfg, &newNBCfg)
+			if configNeedsUpdate(*currentNBCfg, newNBCfg) {
+				if err = l.updateNodeBalancerConfig(ctx, service, currentNBCfg, newNBCfg.GetUpdateOptions()); err != nil {
+					sentry.CaptureError(ctx, err)
+					return fmt.Errorf("[port %d] error updating NodeBalancer config: %v", int(port.Port), err)
+				}
+				l.recordUploadedTLSObjectCert(service, int(port.Port), currentNBCfg.ID, newNBCfg)
+			}
+			keep, err := l.keepBackendsWithoutNodes(ctx, service, currentNBCfg, eligible)
+			if err != nil {
+				return err
+			}
+			if keep {
+				continue
+			}
+
+			drainingNodes, err := l.getDrainingNodes(ctx, service, nb.ID, currentNBCfg.ID, newNBNodes)
+			if err != nil {
+				sentry.CaptureError(ctx, err)
+				return fmt.Errorf("[port %d] error draining NodeBalancer nodes: %v", int(port.Port), err)
+			}
+			newNBNodes = append(newNBNodes, drainingNodes...)
+		}
+
+		if err = l.syncNodeBalancerNodes(ctx, service, currentNBCfg, newNBNodes); err != nil {
+			sentry.CaptureError(ctx, err)
+			return fmt.Errorf("[port %d] error syncing NodeBalancer nodes: %v", int(port.Port), err)
+		}
+	}
+
+	updated, err := l.reconcileNodeBalancerIdentity(ctx, service, nb)
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return fmt.Errorf("error reconciling label and tags of NodeBalancer (%d): %v", nb.ID, err)
+	}
+	nb = updated
+
+	if err = l.reconcileFirewall(ctx, service, nb); err != nil {
+		sentry.CaptureError(ctx, err)
+		return fmt.Errorf("error reconciling firewall of NodeBalancer (%d): %v", nb.ID, err)
+	}
+	return nil
+}
+
+// UpdateLoadBalancer updates the NodeBalancer to have configs that match the Service's ports
+func (l *loadbalancers) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (err error) {
+	account, err := l.forService(service)
+	if err != nil {
+		return err
+	}
+	if account != l {
+		return account.UpdateLoadBalancer(ctx, clusterName, service, nodes)
+	}
+
+	defer l.serviceLocks.lock(service)()
+
+	defer observeLoadBalancerOperation("update", time.Now(), &err)
+
+	if isPaused(service) {
+		l.recordPaused(service, "update-loadbalancer")
+		return nil
+	}
+
+	ctx = sentry.SetHubOnContext(ctx)
+	sentry.SetTag(ctx, "cluster_name", clusterName)
+	sentry.SetTag(ctx, "service", service.Name)
+
+	var nb *linodego.NodeBalancer
+	defer func() { l.setReconcileStatus(service, nb, err, time.Now()) }()
+
+	// UpdateLoadBalancer is invoked with a nil LoadBalancerStatus; we must fetch the latest
+	// status for NodeBalancer discovery.
+	serviceWithStatus := service.DeepCopy()
+	serviceWithStatus.Status.LoadBalancer, err = l.getLatestServiceLoadBalancerStatus(ctx, service)
+	if err != nil {
+		return fmt.Errorf("failed to get latest LoadBalancer status for service (%s): %s", getServiceNn(service), err)
+	}
+
+	nb, err = l.getNodeBalancerForService(ctx, serviceWithStatus)
+	if notFound, ok := err.(lbNotFoundError); ok && notFound.nodeBalancerID != 0 {
+		serviceLog("recreate-nodebalancer", service, notFound.nodeBalancerID).infof("NodeBalancer (%d) of service (%s) was deleted, recreating it", notFound.nodeBalancerID, getServiceNn(service))
+		_, err = l.ensureLoadBalancer(ctx, clusterName, serviceWithStatus, nodes)
+		return err
+	}
+	if err != nil {
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+	if forceRecreatePending(serviceWithStatus, nb) {
+		// The new NodeBalancer has new addresses that only EnsureLoadBalancer reports.
+		_, err = l.ensureLoadBalancer(ctx, clusterName, serviceWithStatus, nodes)
+		return err
+	}
+
+	if !l.shouldPreserveNodeBalancer(service) {
+		if err := l.cleanupOldNodeBalancer(ctx, service); err != nil {
+			sentry.CaptureError(ctx, err)
+			return err
+		}
+	}
+
+	if err = l.updateNodeBalancer(ctx, serviceWithStatus, nodes, nb); err != nil {
+		return err
+	}
+	return l.reconcileDNSRecords(ctx, serviceWithStatus, nb)
+}
+
+// configNeedsRecreate reports whether current can't be updated in place to desired. The
+// certificate of an https config can't be removed through an update, and configs can't be
+// switched between UDP and the other protocols, so such configs are recreated when their
+// protocol changes.
+func configNeedsRecreate(current, desired linodego.NodeBalancerConfig) bool {
+	if (current.Protocol == protocolUDP) != (desired.Protocol == protocolUDP) {
+		return true
+	}
+	return current.Protocol == linodego.ProtocolHTTPS && desired.Protocol != linodego.ProtocolHTTPS
+}
+
+// configNeedsUpdate reports whether the settings of current, such as its protocol or health
+// check, differ from desired. The API redacts the certificate of https configs, so they are
+// always updated when desired has a certificate to upload.
+func configNeedsUpdate(current, desired linodego.NodeBalancerConfig) bool {
+	if desired.Protocol == linodego.ProtocolHTTPS && desired.SSLCert != "" {
+		return true
+	}
+
+	currentOpts, desiredOpts := current.GetUpdateOptions(), desired.GetUpdateOptions()
+	currentOpts.SSLCert, currentOpts.SSLKey = "", ""
+	desiredOpts.SSLCert, desiredOpts.SSLKey = "", ""
+	return !reflect.DeepEqual(currentOpts, desiredOpts)
+}
+
+// Delete any NodeBalancer configs for ports that no longer exist on the Service or are skipped.
+// Configs owned by other Services sharing the NodeBalancer are left untouched. The nodes of the
+// configs are drained for Options.ConfigDrainGracePeriod, over as many syncs as it takes, before
+// they are deleted, unless the Service is being deleted.
 // Note: Don't build a map or other lookup structure here, it is not worth the overhead
-func (l *loadbalancers) deleteUnusedConfigs(ctx context.Context, nbConfigs []linodego.NodeBalancerConfig, servicePorts []v1.ServicePort) error {
+func (l *loadbalancers) deleteUnusedConfigs(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer, nbConfigs []linodego.NodeBalancerConfig) error {
+	owners := getPortOwners(nb)
+	var unused []linodego.NodeBalancerConfig
 	for _, nbc := range nbConfigs {
+		if owner, ok := owners[nbc.Port]; ok && owner != string(service.UID) {
+			continue
+		}
+
 		found := false
-		for _, sp := range servicePorts {
+		for _, sp := range getNodeBalancerPorts(service) {
 			if nbc.Port == int(sp.Port) {
 				found = true
 			}
 		}
 		if !found {
-			if err := l.client.DeleteNodeBalancerConfig(ctx, nbc.NodeBalancerID, nbc.ID); err != nil {
-				return err
-			}
+			unused = append(unused, nbc)
+		} else {
+			// The port was added back, so a later removal drains the config again.
+			l.drains.forgetConfigDrain(nb.ID, nbc.ID)
+		}
+	}
+
+	drained, err := l.drainUnusedConfigs(ctx, service, nb, unused)
+	if err != nil {
+		return err
+	}
+
+	for _, nbc := range drained {
+		if err := l.deleteNodeBalancerConfig(ctx, service, nbc.NodeBalancerID, nbc.ID); err != nil {
+			return err
 		}
+		l.drains.forgetConfig(nbc.NodeBalancerID, nbc.ID)
 	}
 	return nil
 }
 
+// drainUnusedConfigs puts the nodes of the configs of removed ports into drain mode and returns
+// the configs to delete: those without nodes, and those drained for Options.ConfigDrainGracePeriod
+// so that the connections in flight could complete. The others are deleted on the first sync after
+// their grace period. All of them are deleted if the Service is being deleted or in dry-run mode.
+func (l *loadbalancers) drainUnusedConfigs(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer, configs []linodego.NodeBalancerConfig) ([]linodego.NodeBalancerConfig, error) {
+	grace := Options.ConfigDrainGracePeriod
+	if grace <= 0 || len(configs) == 0 || service.DeletionTimestamp != nil || l.dryRun {
+		return configs, nil
+	}
+
+	now := time.Now()
+	var drained []linodego.NodeBalancerConfig
+	for i := range configs {
+		nbc := &configs[i]
+		start := l.drains.configDrainStart(nb.ID, nbc.ID, now)
+		if now.Sub(start) >= grace {
+			drained = append(drained, *nbc)
+			continue
+		}
+
+		current, err := l.client.ListNodeBalancerNodes(ctx, nb.ID, nbc.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		draining := make([]linodego.NodeBalancerNodeCreateOptions, 0, len(current))
+		for _, node := range current {
+			draining = append(draining, linodego.NodeBalancerNodeCreateOptions{
+				Address: node.Address,
+				Label:   node.Label,
+				Weight:  node.Weight,
+				Mode:    linodego.ModeDrain,
+			})
+		}
+		if len(draining) == 0 {
+			drained = append(drained, *nbc)
+			continue
+		}
+		if err = l.syncNodeBalancerNodes(ctx, service, nbc, draining); err != nil {
+			return nil, fmt.Errorf("[port %d] error draining NodeBalancer nodes: %v", nbc.Port, err)
+		}
+		if start.Equal(now) {
+			serviceLog("drain-config", service, nb.ID).infof("draining the config of port %d removed from service (%s) for %s before deleting it", nbc.Port, getServiceNn(service), grace)
+		}
+	}
+	return drained, nil
+}
+
+// deleteDuplicateConfigs deletes all but one of configs, the configs of a NodeBalancer on the same
+// port, and returns the remaining one. Several configs on a port, e.g. left by an interrupted
+// reconcile, route its traffic nondeterministically, so the one already matching desired is kept
+// if any.
+func (l *loadbalancers) deleteDuplicateConfigs(ctx context.Context, service *v1.Service, nodeBalancerID int, configs []linodego.NodeBalancerConfig, desired linodego.NodeBalancerConfig) (*linodego.NodeBalancerConfig, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	retained := 0
+	for i := range configs {
+		if !configNeedsUpdate(configs[i], desired) {
+			retained = i
+			break
+		}
+	}
+
+	for i, nbc := range configs {
+		if i == retained {
+			continue
+		}
+		serviceLog("delete-config", service, nodeBalancerID).infof("deleting config (%d) of NodeBalancer (%d) duplicating port %d, retaining config (%d)",
+			nbc.ID, nodeBalancerID, nbc.Port, configs[retained].ID)
+		if err := l.deleteNodeBalancerConfig(ctx, service, nodeBalancerID, nbc.ID); err != nil {
+			return nil, err
+		}
+		l.drains.forgetConfig(nodeBalancerID, nbc.ID)
+	}
+	return &configs[retained], nil
+}
+
+// getDrainingNodes returns the nodes of the given NodeBalancer config which are no longer desired
+// but are still within the service's drain grace period. These nodes are kept in the config in
+// drain mode rather than being removed, so that in-flight connections can complete.
+func (l *loadbalancers) getDrainingNodes(ctx context.Context, service *v1.Service, nodeBalancerID, configID int, desired []linodego.NodeBalancerNodeCreateOptions) ([]linodego.NodeBalancerNodeCreateOptions, error) {
+	grace, err := getDrainGracePeriod(service)
+	if err != nil {
+		return nil, err
+	}
+	if grace == 0 {
+		l.drains.forgetConfig(nodeBalancerID, configID)
+		return nil, nil
+	}
+
+	currentNodes, err := l.client.ListNodeBalancerNodes(ctx, nodeBalancerID, configID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	desiredAddresses := make(map[string]bool, len(desired))
+	for _, node := range desired {
+		desiredAddresses[node.Address] = true
+	}
+
+	now := time.Now()
+	var draining []linodego.NodeBalancerNodeCreateOptions
+	for _, node := range currentNodes {
+		if desiredAddresses[node.Address] {
+			l.drains.forget(nodeBalancerID, configID, node.Address)
+			continue
+		}
+
+		if now.Sub(l.drains.drainStart(nodeBalancerID, configID, node.Address, now)) >= grace {
+			serviceLog("delete-node", service, nodeBalancerID).infof("removing drained node (%s) from NodeBalancer (%d) config (%d) for service (%s)", node.Address, nodeBalancerID, configID, getServiceNn(service))
+			l.drains.forget(nodeBalancerID, configID, node.Address)
+			continue
+		}
+
+		draining = append(draining, linodego.NodeBalancerNodeCreateOptions{
+			Address: node.Address,
+			Label:   node.Label,
+			Weight:  node.Weight,
+			Mode:    linodego.ModeDrain,
+		})
+	}
+	return draining, nil
+}
+
+// getDrainGracePeriod returns how long removed nodes should be drained for based on the
+// service's drain annotation.
+func getDrainGracePeriod(service *v1.Service) (time.Duration, error) {
+	raw, ok := getServiceAnnotation(service, annLinodeDrainSeconds)
+	if !ok {
+		return 0, nil
+	}
+
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s: must be a non-negative number of seconds", raw, annLinodeDrainSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
 // shouldPreserveNodeBalancer determines whether a NodeBalancer should be deleted based on the
 // service's preserve annotation.
 func (l *loadbalancers) shouldPreserveNodeBalancer(service *v1.Service) bool {
-	preserveRaw, ok := getServiceAnnotation(service, annLinodeLoadBalancerPreserve)
-	if !ok {
-		return false
+	return getServiceBoolAnnotation(service, annLinodeLoadBalancerPreserve)
+}
+
+// preserveNodeBalancer detaches the backends of service from nb, keeping its configs and IP
+// addresses, and marks nb as preserved so that the Service re-adopts it if it becomes of type
+// LoadBalancer again. The Service's ports are released so that nb isn't garbage-collected as
+// orphaned.
+func (l *loadbalancers) preserveNodeBalancer(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	if err := l.detachServiceBackends(ctx, service, nb); err != nil {
+		return err
 	}
-	preserve, err := strconv.ParseBool(preserveRaw)
-	return err == nil && preserve
+
+	tags := buildPortOwnerTags(nb, service, nil)
+	if !containsString(tags, preservedTag(service)) {
+		tags = append(tags, preservedTag(service))
+		sort.Strings(tags)
+	}
+	_, err := l.updateNodeBalancerOptions(ctx, service, nb, linodego.NodeBalancerUpdateOptions{Tags: &tags})
+	return err
+}
+
+// retainNodeBalancer detaches the backends of service from nb and tags it as retained, keeping
+// the port owner tags of service so that nb is reported as orphaned for manual review. The
+// backends are detached as the NodePorts they target are released along with the Service.
+func (l *loadbalancers) retainNodeBalancer(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	if err := l.detachServiceBackends(ctx, service, nb); err != nil {
+		return err
+	}
+	if containsString(nb.Tags, retainedTag) {
+		return nil
+	}
+
+	tags := append(append([]string(nil), nb.Tags...), retainedTag)
+	sort.Strings(tags)
+	_, err := l.updateNodeBalancerOptions(ctx, service, nb, linodego.NodeBalancerUpdateOptions{Tags: &tags})
+	return err
+}
+
+// detachServiceBackends removes the backends of the configs of nb whose ports are owned by
+// service, or by no Service. Any node failing to be removed fails the detach, as the NodePorts
+// left as backends are released along with the Service.
+func (l *loadbalancers) detachServiceBackends(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	owners := getPortOwners(nb)
+
+	nbCfgs, err := l.client.ListNodeBalancerConfigs(ctx, nb.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, nbc := range nbCfgs {
+		if owner, ok := owners[nbc.Port]; ok && owner != string(service.UID) {
+			continue
+		}
+
+		nbc := nbc
+		if err := l.syncNodeBalancerNodesWithThreshold(ctx, service, &nbc, nil, 0); err != nil {
+			return err
+		}
+		l.drains.forgetConfig(nb.ID, nbc.ID)
+	}
+	return nil
+}
+
+// isNamespaceTerminating reports whether the namespace of service is being deleted, or is gone.
+func (l *loadbalancers) isNamespaceTerminating(service *v1.Service) (bool, error) {
+	if err := l.retrieveKubeClient(); err != nil {
+		return false, err
+	}
+
+	namespace, err := l.kubeClient.CoreV1().Namespaces().Get(service.Namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return namespace.DeletionTimestamp != nil || namespace.Status.Phase == v1.NamespaceTerminating, nil
 }
 
 // EnsureLoadBalancerDeleted deletes the specified loadbalancer if it exists.
@@ -384,45 +1532,120 @@ func (l *loadbalancers) shouldPreserveNodeBalancer(service *v1.Service) bool {
 // successfully deleted.
 //
 // EnsureLoadBalancerDeleted will not modify service.
-func (l *loadbalancers) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+func (l *loadbalancers) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) (err error) {
+	account, err := l.forService(service)
+	if err != nil {
+		return err
+	}
+	if account != l {
+		return account.EnsureLoadBalancerDeleted(ctx, clusterName, service)
+	}
+
+	defer l.serviceLocks.lock(service)()
+
+	defer observeLoadBalancerOperation("delete", time.Now(), &err)
+
 	ctx = sentry.SetHubOnContext(ctx)
 	sentry.SetTag(ctx, "cluster_name", clusterName)
 	sentry.SetTag(ctx, "service", service.Name)
 
 	serviceNn := getServiceNn(service)
+	l.backoff.reset(service.UID)
+	l.skippedNodes.forget(service.UID)
 
 	if len(service.Status.LoadBalancer.Ingress) == 0 {
-		klog.Infof("short-circuting deletion of NodeBalancer for service(%s) as LoadBalancer ingress is not present", serviceNn)
+		serviceLog("delete-loadbalancer", service, 0).infof("short-circuting deletion of NodeBalancer for service(%s) as LoadBalancer ingress is not present", serviceNn)
 		return nil
 	}
 
+	// The deletion is retried until the Service is resumed.
+	if isPaused(service) && !l.forceDeletePaused {
+		l.recordPaused(service, "delete-loadbalancer")
+		return fmt.Errorf("not deleting the NodeBalancer of service (%s) as it is paused with %s", serviceNn, annLinodePaused)
+	}
+
 	nb, err := l.getNodeBalancerForService(ctx, service)
 	switch getErr := err.(type) {
 	case nil:
 		break
 
 	case lbNotFoundError:
-		klog.Infof("short-circuting deletion for NodeBalancer for service (%s) as one does not exist: %s", serviceNn, err)
+		// The firewall of the Service may be left over from a deletion that failed after the
+		// NodeBalancer was deleted.
+		if err = l.deleteServiceFirewall(ctx, service); err != nil {
+			serviceLog("delete-firewall", service, 0).withError(err).errorf("failed to delete firewall for service (%s)", serviceNn)
+			sentry.CaptureError(ctx, err)
+			return err
+		}
+		serviceLog("delete-loadbalancer", service, 0).withError(getErr).infof("short-circuting deletion for NodeBalancer for service (%s) as one does not exist", serviceNn)
 		return nil
 
 	default:
-		klog.Errorf("failed to get NodeBalancer for service (%s): %s", serviceNn, err)
+		serviceLog("delete-loadbalancer", service, 0).withError(err).errorf("failed to get NodeBalancer for service (%s)", serviceNn)
 		sentry.CaptureError(ctx, getErr)
 		return err
 	}
 
+	// Firewalls referenced by ID or name may protect other devices, so only nb is detached from
+	// them.
+	firewallID, referenced, err := l.getReferencedFirewallID(ctx, service)
+	if err == nil && referenced {
+		err = l.detachFirewall(ctx, service, firewallID, nb)
+	}
+	if err != nil {
+		serviceLog("detach-firewall", service, nb.ID).withError(err).errorf("failed to detach NodeBalancer (%d) from firewall (%d) for service (%s)", nb.ID, firewallID, serviceNn)
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+	l.firewallNames.forgetAttached(service.UID)
+
+	if err = l.deleteDNSRecords(ctx, service, nb); err != nil {
+		serviceLog("delete-dns-record", service, nb.ID).withError(err).errorf("failed to delete the DNS records of service (%s)", serviceNn)
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+
+	if l.retainOnNamespaceDelete {
+		terminating, err := l.isNamespaceTerminating(service)
+		if err != nil {
+			// Deleting the NodeBalancer can't be undone, so it waits until the namespace is known.
+			serviceLog("retain-nodebalancer", service, nb.ID).withError(err).errorf("failed to get namespace of service (%s)", serviceNn)
+			return err
+		}
+		if terminating {
+			if err = l.retainNodeBalancer(ctx, service, nb); err != nil {
+				serviceLog("retain-nodebalancer", service, nb.ID).withError(err).errorf("failed to retain NodeBalancer (%d) for service (%s)", nb.ID, serviceNn)
+				sentry.CaptureError(ctx, err)
+				return err
+			}
+			serviceLog("retain-nodebalancer", service, nb.ID).infof("short-circuting deletion of NodeBalancer (%d) for service (%s) as its namespace is being deleted", nb.ID, serviceNn)
+			return nil
+		}
+	}
+
 	if l.shouldPreserveNodeBalancer(service) {
-		klog.Infof("short-circuting deletion of NodeBalancer (%d) for service (%s) as annotated with %s", nb.ID, serviceNn, annLinodeLoadBalancerPreserve)
+		if err = l.preserveNodeBalancer(ctx, service, nb); err != nil {
+			serviceLog("preserve-nodebalancer", service, nb.ID).withError(err).errorf("failed to preserve NodeBalancer (%d) for service (%s)", nb.ID, serviceNn)
+			sentry.CaptureError(ctx, err)
+			return err
+		}
+		serviceLog("preserve-nodebalancer", service, nb.ID).infof("short-circuting deletion of NodeBalancer (%d) for service (%s) as annotated with %s", nb.ID, serviceNn, annLinodeLoadBalancerPreserve)
 		return nil
 	}
 
-	if err = l.client.DeleteNodeBalancer(ctx, nb.ID); err != nil {
-		klog.Errorf("failed to delete NodeBalancer (%d) for service (%s): %s", nb.ID, serviceNn, err)
+	if err = l.deleteNodeBalancer(ctx, service, nb); err != nil {
+		serviceLog("delete-nodebalancer", service, nb.ID).withError(err).errorf("failed to delete NodeBalancer (%d) for service (%s)", nb.ID, serviceNn)
 		sentry.CaptureError(ctx, err)
 		return err
 	}
 
-	klog.Infof("successfully deleted NodeBalancer (%d) for service (%s)", nb.ID, serviceNn)
+	if err = l.deleteServiceFirewall(ctx, service); err != nil {
+		serviceLog("delete-firewall", service, nb.ID).withError(err).errorf("failed to delete firewall for service (%s)", serviceNn)
+		sentry.CaptureError(ctx, err)
+		return err
+	}
+
+	serviceLog("delete-loadbalancer", service, nb.ID).infof("successfully deleted NodeBalancer (%d) for service (%s)", nb.ID, serviceNn)
 	return nil
 }
 
@@ -431,19 +1654,29 @@ func (l *loadbalancers) getNodeBalancerByIPv4(ctx context.Context, service *v1.S
 	if err != nil {
 		return nil, err
 	}
-	for _, lb := range lbs {
-		if *lb.IPv4 == ipv4 {
-			klog.V(2).Infof("found NodeBalancer (%d) for service (%s) via IPv4 (%s)", lb.ID, getServiceNn(service), ipv4)
-			return &lb, nil
-		}
+	if nb := findNodeBalancerByIPv4(service, lbs, ipv4); nb != nil {
+		return nb, nil
 	}
 	return nil, lbNotFoundError{serviceNn: getServiceNn(service)}
 }
 
+// findNodeBalancerByIPv4 returns the NodeBalancer of nbs with the IPv4 address ipv4, if any.
+func findNodeBalancerByIPv4(service *v1.Service, nbs []linodego.NodeBalancer, ipv4 string) *linodego.NodeBalancer {
+	for i := range nbs {
+		if nbs[i].IPv4 != nil && *nbs[i].IPv4 == ipv4 && !belongsToOtherCluster(&nbs[i]) {
+			if klog.V(2) {
+				serviceLog("find-nodebalancer", service, nbs[i].ID).infof("found NodeBalancer (%d) for service (%s) via IPv4 (%s)", nbs[i].ID, getServiceNn(service), ipv4)
+			}
+			return &nbs[i]
+		}
+	}
+	return nil
+}
+
 func (l *loadbalancers) getNodeBalancerByID(ctx context.Context, service *v1.Service, id int) (*linodego.NodeBalancer, error) {
 	nb, err := l.client.GetNodeBalancer(ctx, id)
 	if err != nil {
-		if apiErr, ok := err.(*linodego.Error); ok && apiErr.Code == http.StatusNotFound {
+		if classifyAPIError(err) == apiErrorNotFound {
 			return nil, lbNotFoundError{serviceNn: getServiceNn(service), nodeBalancerID: id}
 		}
 		return nil, err
@@ -451,18 +1684,44 @@ func (l *loadbalancers) getNodeBalancerByID(ctx context.Context, service *v1.Ser
 	return nb, nil
 }
 
+// createNodeBalancer creates the NodeBalancer of service along with its configs and their nodes in
+// a single request, tagged with the UID of service. If the request fails once the NodeBalancer was
+// created, the next reconcile finds it by that tag and syncs its configs instead of creating
+// another NodeBalancer.
 func (l *loadbalancers) createNodeBalancer(ctx context.Context, service *v1.Service, configs []*linodego.NodeBalancerConfigCreateOptions) (lb *linodego.NodeBalancer, err error) {
-	connThrottle := getConnectionThrottle(service)
+	connThrottle, collapsed := l.getNodeBalancerThrottle(service)
+	if collapsed {
+		l.recordThrottleCollapsed(service, connThrottle)
+	}
 
-	unixNano := strconv.FormatInt(time.Now().UnixNano(), 16)
-	label := fmt.Sprintf("ccm-%s", unixNano[len(unixNano)-12:])
+	label := l.getNodeBalancerLabel(service)
 	createOpts := linodego.NodeBalancerCreateOptions{
 		Label:              &label,
-		Region:             l.zone,
+		Region:             l.getNodeBalancerRegion(service),
 		ClientConnThrottle: &connThrottle,
 		Configs:            configs,
+		Tags:               withForceRecreateTag(buildNodeBalancerTags(&linodego.NodeBalancer{}, service), service),
+	}
+
+	if l.dryRun {
+		desired := createOpts
+		desired.Configs = make([]*linodego.NodeBalancerConfigCreateOptions, 0, len(configs))
+		for _, config := range configs {
+			redactedConfig := redactConfigCreateOptions(*config)
+			desired.Configs = append(desired.Configs, &redactedConfig)
+		}
+		l.logDryRun(service, dryRunChange{Action: "create-nodebalancer", Desired: desired})
+
+		// The NodeBalancer doesn't exist, so it has no addresses to report in the Service's status.
+		return &linodego.NodeBalancer{Label: &label, Region: createOpts.Region, ClientConnThrottle: connThrottle, Tags: createOpts.Tags}, nil
+	}
+
+	lb, err = l.client.CreateNodeBalancer(ctx, createOpts)
+	if classifyAPIError(err) == apiErrorQuotaExceeded {
+		l.recordEvent(service, v1.EventTypeWarning, "NodeBalancerQuotaExceeded",
+			"the Linode account can't have more NodeBalancers, delete unused ones or open a support ticket to raise the limit: %s", err)
 	}
-	return l.client.CreateNodeBalancer(ctx, createOpts)
+	return lb, err
 }
 
 //nolint:funlen
@@ -472,9 +1731,15 @@ func (l *loadbalancers) buildNodeBalancerConfig(service *v1.Service, port int) (
 		return linodego.NodeBalancerConfig{}, err
 	}
 
-	health, err := getHealthCheckType(service)
+	health, err := l.getPortHealthCheckType(service, port)
 	if err != nil {
-		return linodego.NodeBalancerConfig{}, nil
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidHealthCheck", "%s", err)
+		return linodego.NodeBalancerConfig{}, err
+	}
+
+	// UDP configs can't run HTTP checks, which need a TCP connection to the backend.
+	if portConfig.Protocol == protocolUDP && (health == linodego.CheckHTTP || health == linodego.CheckHTTPBody) {
+		health = linodego.CheckConnection
 	}
 
 	config := linodego.NodeBalancerConfig{
@@ -486,63 +1751,133 @@ func (l *loadbalancers) buildNodeBalancerConfig(service *v1.Service, port int) (
 	if health == linodego.CheckHTTP || health == linodego.CheckHTTPBody {
 		path := service.Annotations[annLinodeCheckPath]
 		if path == "" {
-			path = "/"
+			path = l.defaults.healthCheckPath()
 		}
 		config.CheckPath = path
 	}
 
+	body := service.Annotations[annLinodeCheckBody]
+	if health == linodego.CheckHTTP && body != "" {
+		l.recordEvent(service, v1.EventTypeWarning, "CheckBodyIgnored",
+			"ignoring %s on port %d: %s health checks only check the status code of %s, set %s to %s to match the response body",
+			annLinodeCheckBody, port, linodego.CheckHTTP, config.CheckPath, annLinodeHealthCheckType, linodego.CheckHTTPBody)
+	}
 	if health == linodego.CheckHTTPBody {
-		body := service.Annotations[annLinodeCheckBody]
 		if body == "" {
-			return config, fmt.Errorf("for health check type http_body need body regex annotation %v", annLinodeCheckBody)
+			err = fmt.Errorf("%s health check on port %d requires the regex matching the response body of %s in annotation %s", linodego.CheckHTTPBody, port, config.CheckPath, annLinodeCheckBody)
+			l.recordEvent(service, v1.EventTypeWarning, "InvalidHealthCheck", "%s", err)
+			return config, err
+		}
+		if config.CheckBody, err = getCheckBodyRegex(service, body); err != nil {
+			l.recordEvent(service, v1.EventTypeWarning, "InvalidCheckBody", "%s", err)
+			return config, err
 		}
-		config.CheckBody = body
 	}
-	checkInterval := 5
-	if ci, ok := service.Annotations[annLinodeHealthCheckInterval]; ok {
+	// Without active checks, the settings of the active checks are ignored and kept at their
+	// defaults, so that they are valid and take effect again once checks are turned back on.
+	if health == linodego.CheckNone {
+		l.recordIgnoredHealthCheckAnnotations(service, port)
+	}
+
+	checkInterval := l.defaults.healthCheckInterval()
+	if ci, ok := service.Annotations[annLinodeHealthCheckInterval]; ok && health != linodego.CheckNone {
 		if checkInterval, err = strconv.Atoi(ci); err != nil {
 			return config, err
 		}
 	}
 	config.CheckInterval = checkInterval
 
-	checkTimeout := 3
-	if ct, ok := service.Annotations[annLinodeHealthCheckTimeout]; ok {
+	checkTimeout := l.defaults.healthCheckTimeout()
+	if ct, ok := service.Annotations[annLinodeHealthCheckTimeout]; ok && health != linodego.CheckNone {
 		if checkTimeout, err = strconv.Atoi(ct); err != nil {
 			return config, err
 		}
 	}
 	config.CheckTimeout = checkTimeout
 
-	checkAttempts := 2
-	if ca, ok := service.Annotations[annLinodeHealthCheckAttempts]; ok {
+	checkAttempts := l.defaults.healthCheckAttempts()
+	if ca, ok := service.Annotations[annLinodeHealthCheckAttempts]; ok && health != linodego.CheckNone {
 		if checkAttempts, err = strconv.Atoi(ca); err != nil {
 			return config, err
 		}
 	}
 	config.CheckAttempts = checkAttempts
 
-	checkPassive := true
-	if cp, ok := service.Annotations[annLinodeHealthCheckPassive]; ok {
-		if checkPassive, err = strconv.ParseBool(cp); err != nil {
-			return config, err
+	config.CheckPassive, err = getCheckPassive(service, portConfig.Protocol, health)
+	if err != nil {
+		return config, err
+	}
+
+	if err = validateHealthCheck(config); err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidHealthCheck", "%s", err)
+		return config, err
+	}
+
+	proxyProtocol, err := getPortProxyProtocol(service, port)
+	if err != nil {
+		return config, err
+	}
+	if proxyProtocol != linodego.ProxyProtocolNone && portConfig.Protocol != linodego.ProtocolTCP {
+		err = fmt.Errorf("proxy protocol %s can't be used on port %d with protocol %s: NodeBalancers only support proxy protocol for tcp", proxyProtocol, port, portConfig.Protocol)
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidProxyProtocol", "%s", err)
+		return config, err
+	}
+	config.ProxyProtocol = proxyProtocol
+
+	algorithm, err := getPortAlgorithm(service, port)
+	if err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidAlgorithm", "%s", err)
+		return config, err
+	}
+	if service.Spec.SessionAffinity == v1.ServiceAffinityClientIP {
+		// ClientIP affinity selects the source algorithm unless an algorithm is explicitly annotated.
+		if !hasPortAlgorithmAnnotation(service, port) {
+			algorithm = linodego.AlgorithmSource
+		}
+		if algorithm != linodego.AlgorithmSource {
+			l.recordEvent(service, v1.EventTypeWarning, "SessionAffinityIgnored",
+				"session affinity ClientIP requires the %s algorithm, but port %d uses %s", linodego.AlgorithmSource, port, algorithm)
+		} else {
+			config.Stickiness = linodego.StickinessTable
+			if timeout := getSessionAffinityTimeout(service); timeout != nil {
+				l.recordEvent(service, v1.EventTypeNormal, "SessionAffinityTimeoutIgnored",
+					"NodeBalancers don't expire session affinity: port %d keeps each client on the same Node while the Nodes are unchanged, instead of for %d seconds", port, *timeout)
+			}
 		}
 	}
-	config.CheckPassive = checkPassive
 
-	proxyProtocol := linodego.ProxyProtocolNone
-	if pp, ok := service.Annotations[annLinodeProxyProtocol]; ok {
-		switch linodego.ConfigProxyProtocol(pp) {
-		case linodego.ProxyProtocolNone, linodego.ProxyProtocolV1, linodego.ProxyProtocolV2:
-			proxyProtocol = linodego.ConfigProxyProtocol(pp)
-		default:
-			return config, fmt.Errorf("invalid NodeBalancer proxy protocol value '%s'", pp)
+	// An annotated stickiness takes precedence over the one of ClientIP affinity.
+	stickiness, ok, err := getPortStickiness(service, port)
+	if err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidStickiness", "%s", err)
+		return config, err
+	}
+	if ok {
+		if err = checkStickinessProtocol(stickiness, portConfig.Protocol); err != nil {
+			err = fmt.Errorf("port %d: %v", port, err)
+			l.recordEvent(service, v1.EventTypeWarning, "InvalidStickiness", "%s", err)
+			return config, err
 		}
+		config.Stickiness = stickiness
 	}
-	config.ProxyProtocol = proxyProtocol
+
+	if timeout, ok := getServiceAnnotation(service, annLinodePortTimeoutPrefix+strconv.Itoa(port)); ok {
+		l.recordEvent(service, v1.EventTypeWarning, "TimeoutUnsupported",
+			"NodeBalancer configs don't support connection timeouts: the timeout of %s seconds requested for port %d isn't applied", timeout, port)
+	}
+	config.Algorithm = algorithm
+
+	cipherSuite, err := getPortCipherSuite(service, port, portConfig.Protocol)
+	if err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidSSLCipher", "%s", err)
+		return config, err
+	}
+	config.CipherSuite = cipherSuite
 
 	if portConfig.Protocol == linodego.ProtocolHTTPS {
-		if err = l.addTLSCert(service, &config, portConfig); err != nil {
+		if portConfig.TLSObjectURL != "" {
+			l.addTLSObjectCert(service, &config, portConfig)
+		} else if err = l.addTLSCert(service, &config, portConfig); err != nil {
 			return config, err
 		}
 	}
@@ -550,6 +1885,15 @@ func (l *loadbalancers) buildNodeBalancerConfig(service *v1.Service, port int) (
 	return config, nil
 }
 
+// checkConfigHasTLSCert returns an error if config is an https config to be created without a
+// certificate, e.g. as its tls-object-url couldn't be fetched.
+func checkConfigHasTLSCert(config linodego.NodeBalancerConfig) error {
+	if config.Protocol == linodego.ProtocolHTTPS && config.SSLCert == "" {
+		return fmt.Errorf("[port %d] can't create an https NodeBalancer config without a certificate", config.Port)
+	}
+	return nil
+}
+
 func (l *loadbalancers) addTLSCert(service *v1.Service, nbConfig *linodego.NodeBalancerConfig, config portConfig) error {
 	err := l.retrieveKubeClient()
 	if err != nil {
@@ -558,6 +1902,7 @@ func (l *loadbalancers) addTLSCert(service *v1.Service, nbConfig *linodego.NodeB
 
 	nbConfig.SSLCert, nbConfig.SSLKey, err = getTLSCertInfo(l.kubeClient, service.Namespace, config)
 	if err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidTLSSecret", "%s", err)
 		return err
 	}
 	return nil
@@ -566,39 +1911,385 @@ func (l *loadbalancers) addTLSCert(service *v1.Service, nbConfig *linodego.NodeB
 // buildLoadBalancerRequest returns a linodego.NodeBalancer
 // requests for service across nodes.
 func (l *loadbalancers) buildLoadBalancerRequest(ctx context.Context, service *v1.Service, nodes []*v1.Node) (*linodego.NodeBalancer, error) {
-	ports := service.Spec.Ports
+	if reserved, ok := getServiceAnnotation(service, annLinodeReservedIPv4); ok {
+		err := fmt.Errorf("%s requests address %s, but NodeBalancers can't be created with a reserved IPv4 address: create the NodeBalancer manually and reference it with %s instead", annLinodeReservedIPv4, reserved, annLinodeNodeBalancerID)
+		l.recordEvent(service, v1.EventTypeWarning, "ReservedIPv4Unsupported", "%s", err)
+		return nil, err
+	}
+	l.checkHTTPSRedirect(service)
+
+	nodes, err := l.getBackendNodes(ctx, service, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := getNodeBalancerPorts(service)
 	configs := make([]*linodego.NodeBalancerConfigCreateOptions, 0, len(ports))
 
-	for _, port := range ports {
-		if port.Protocol == v1.ProtocolUDP {
-			return nil, fmt.Errorf("error creating NodeBalancer Config: ports with the UDP protocol are not supported")
-		}
+	for _, port := range ports {
+		config, err := l.buildNodeBalancerConfig(service, int(port.Port))
+		if err != nil {
+			return nil, err
+		}
+		if err = checkConfigHasTLSCert(config); err != nil {
+			return nil, err
+		}
+		createOpt := config.GetCreateOptions()
+
+		nodePort, err := l.getNodePort(service, port)
+		if err != nil {
+			return nil, err
+		}
+
+		createOpt.Nodes, err = l.buildNodeBalancerNodes(service, nodes, nodePort, config.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		configs = append(configs, &createOpt)
+	}
+	return l.createNodeBalancer(ctx, service, configs)
+}
+
+// getBackendNodes returns the nodes the NodeBalancer for service should send traffic to. The
+// nodes left out are reported with an event per reason.
+func (l *loadbalancers) getBackendNodes(ctx context.Context, service *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	nodes, err := l.getEligibleNodes(ctx, service, nodes)
+	if err != nil {
+		return nil, err
+	}
+	return l.filterNodesByTrafficPolicy(service, nodes)
+}
+
+// getEligibleNodes returns the nodes that may be backends of the NodeBalancer for service,
+// whether or not they run its endpoints.
+func (l *loadbalancers) getEligibleNodes(ctx context.Context, service *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	nodes = l.withNotReadyNodes(service, nodes)
+	nodes, err := l.filterExcludedNodes(service, nodes)
+	if err != nil {
+		return nil, err
+	}
+	return l.filterNodesByRegion(ctx, service, nodes)
+}
+
+// filterExcludedNodes returns the nodes neither labelled labelNodeExcludeFromLoadBalancers nor
+// matching the exclude-node-label selector of service, leaving out the control-plane nodes unless
+// service opts them in with annLinodeIncludeControlPlane. As the backends of existing configs are
+// synced with the returned nodes, nodes are removed from the NodeBalancer once excluded, and
+// added back once they no longer are.
+func (l *loadbalancers) filterExcludedNodes(service *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	selector, err := getExcludeNodeSelector(service)
+	if err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidExcludeNodeLabel", "%s", err)
+		return nil, err
+	}
+	includeControlPlane := getServiceBoolAnnotation(service, annLinodeIncludeControlPlane)
+
+	backendNodes := make([]*v1.Node, 0, len(nodes))
+	var excluded, controlPlane []string
+	for _, node := range nodes {
+		if _, ok := node.Labels[labelNodeExcludeFromLoadBalancers]; ok || (selector != nil && selector.Matches(labels.Set(node.Labels))) {
+			excluded = append(excluded, node.Name)
+		} else if !includeControlPlane && isControlPlaneNode(node) {
+			controlPlane = append(controlPlane, node.Name)
+		} else {
+			backendNodes = append(backendNodes, node)
+		}
+	}
+
+	l.recordSkippedNodes(service, v1.EventTypeNormal, "NodesExcluded", "excluded by label", excluded)
+	l.recordSkippedNodes(service, v1.EventTypeNormal, "ControlPlaneNodesExcluded",
+		"control-plane, set "+annLinodeIncludeControlPlane+" to include them", controlPlane)
+	return backendNodes, nil
+}
+
+// isControlPlaneNode reports whether node has one of controlPlaneNodeLabels.
+func isControlPlaneNode(node *v1.Node) bool {
+	for _, label := range controlPlaneNodeLabels {
+		if _, ok := node.Labels[label]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withNotReadyNodes returns nodes along with the nodes of the cluster that aren't ready, which the
+// service controller leaves out, so that their NodeBalancer backends are drained rather than
+// removed while they are NotReady, and accept connections again once they are Ready. Nodes
+// otherwise left out by the service controller, e.g. unschedulable ones, aren't added. nodes is
+// returned as is if the nodes of the cluster can't be listed.
+func (l *loadbalancers) withNotReadyNodes(service *v1.Service, nodes []*v1.Node) []*v1.Node {
+	all, err := l.listClusterNodes()
+	if err != nil {
+		serviceLog("list-nodes", service, 0).withError(err).errorf("failed to list the nodes that aren't ready for service (%s)", getServiceNn(service))
+		return nodes
+	}
+
+	names := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		names[node.Name] = true
+	}
+	// The nodes of the caller are left untouched.
+	nodes = nodes[:len(nodes):len(nodes)]
+	for _, node := range all {
+		if !names[node.Name] && isNodeNotReady(node) && isLoadBalancerCandidate(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// listClusterNodes returns the nodes of the cluster, from l.nodes if it is set.
+func (l *loadbalancers) listClusterNodes() ([]*v1.Node, error) {
+	if l.nodes != nil {
+		return l.nodes.List(labels.Everything())
+	}
+
+	if err := l.retrieveKubeClient(); err != nil {
+		return nil, err
+	}
+	list, err := l.kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*v1.Node, 0, len(list.Items))
+	for i := range list.Items {
+		nodes = append(nodes, &list.Items[i])
+	}
+	return nodes, nil
+}
+
+// isNodeNotReady reports whether node has a Ready condition that isn't true.
+func isNodeNotReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status != v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// getNodeBalancerRegion returns the region the NodeBalancer for service should be in.
+func (l *loadbalancers) getNodeBalancerRegion(service *v1.Service) string {
+	if region, ok := getServiceAnnotation(service, annLinodeRegion); ok {
+		return region
+	}
+	return l.zone
+}
+
+// filterNodesByRegion returns the nodes in the region requested by service's region annotation,
+// if any. NodeBalancers can only send traffic to nodes in their own region.
+func (l *loadbalancers) filterNodesByRegion(ctx context.Context, service *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	region, ok := getServiceAnnotation(service, annLinodeRegion)
+	if !ok {
+		return nodes, nil
+	}
+
+	if _, err := l.client.GetRegion(ctx, region); err != nil {
+		err = fmt.Errorf("invalid value %q for %s: %v", region, annLinodeRegion, err)
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidRegion", "%s", err)
+		return nil, err
+	}
+
+	regionNodes := make([]*v1.Node, 0, len(nodes))
+	var skipped []string
+	for _, node := range nodes {
+		if node.Labels[kubeletapis.LabelZoneRegion] == region {
+			regionNodes = append(regionNodes, node)
+		} else {
+			skipped = append(skipped, node.Name)
+		}
+	}
+
+	l.recordSkippedNodes(service, v1.EventTypeNormal, "NodesOutsideRegion", "outside of region "+region, skipped)
+	return regionNodes, nil
+}
+
+// filterNodesByTrafficPolicy returns the nodes running one of service's endpoints if it uses the
+// Local external traffic policy, which may be none of them.
+func (l *loadbalancers) filterNodesByTrafficPolicy(service *v1.Service, nodes []*v1.Node) ([]*v1.Node, error) {
+	if service.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeLocal {
+		return nodes, nil
+	}
+
+	if err := l.retrieveKubeClient(); err != nil {
+		return nil, err
+	}
+
+	endpoints, err := l.kubeClient.CoreV1().Endpoints(service.Namespace).Get(service.Name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get endpoints for service (%s): %s", getServiceNn(service), err)
+	}
+
+	endpointNodes := make(map[string]bool)
+	if endpoints != nil {
+		for _, subset := range endpoints.Subsets {
+			for _, address := range subset.Addresses {
+				if address.NodeName != nil {
+					endpointNodes[*address.NodeName] = true
+				}
+			}
+		}
+	}
+
+	backendNodes := make([]*v1.Node, 0, len(endpointNodes))
+	for _, node := range nodes {
+		if endpointNodes[node.Name] {
+			backendNodes = append(backendNodes, node)
+		}
+	}
+
+	if len(backendNodes) == 0 {
+		serviceLog("filter-nodes", service, 0).warningf("no nodes run endpoints of service (%s) with the Local external traffic policy", getServiceNn(service))
+	}
+	return backendNodes, nil
+}
+
+// buildNodeBalancerNodes returns the NodeBalancer nodes of a config targeting nodePort of nodes
+// and balancing them with algorithm.
+func (l *loadbalancers) buildNodeBalancerNodes(service *v1.Service, nodes []*v1.Node, nodePort int32, algorithm linodego.ConfigAlgorithm) ([]linodego.NodeBalancerNodeCreateOptions, error) {
+	backendRange, err := getBackendIPv4Range(service)
+	if err != nil {
+		return nil, err
+	}
+	ipType := l.defaults.BackendIPType
+	if ipType == backendIPTypeVPC && backendRange == nil {
+		return nil, fmt.Errorf("backend-ip-type %s requires a backend IPv4 range, set with --nodebalancer-backend-ipv4-range or %s", backendIPTypeVPC, annLinodeBackendIPv4Range)
+	}
+
+	weightLabel, hasWeightLabel := getServiceAnnotation(service, annLinodeNodeWeightLabel)
+	if hasWeightLabel && algorithm != linodego.AlgorithmRoundRobin {
+		l.recordEvent(service, v1.EventTypeWarning, "NodeWeightIgnored",
+			"the node weights of label %s only apply to the %s algorithm, not %s", weightLabel, linodego.AlgorithmRoundRobin, algorithm)
+		hasWeightLabel = false
+	}
+
+	backupSelector, err := getBackupNodeSelector(service)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeLabels, err := l.getNodeBalancerNodeLabels(service, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	nbNodes := make([]linodego.NodeBalancerNodeCreateOptions, 0, len(nodes))
+	var ipv6Only, notReady []string
+	for _, node := range nodes {
+		if isIPv6OnlyNode(node) {
+			ipv6Only = append(ipv6Only, node.Name)
+			continue
+		}
+		address, inRange, err := getNodeBackendIP(node, ipType, backendRange)
+		if err != nil {
+			return nil, err
+		}
+		if ipType == "" && backendRange != nil && !inRange {
+			l.recordEvent(service, v1.EventTypeWarning, "BackendOutsideVPC",
+				"node %s has no address in backend range %s, using its private IP %s", node.Name, backendRange, address)
+		}
+		mode := linodego.ModeAccept
+		if isNodeNotReady(node) {
+			mode = linodego.ModeDrain
+			notReady = append(notReady, node.Name)
+		} else if backupSelector != nil && backupSelector.Matches(labels.Set(node.Labels)) {
+			mode = linodego.ModeBackup
+		}
+		weight := defaultNodeWeight
+		if hasWeightLabel {
+			weight = l.getNodeWeight(service, node, weightLabel)
+		}
+		nbNodes = append(nbNodes, l.buildNodeBalancerNodeCreateOptions(nodeLabels[node.Name], address, nodePort, mode, weight))
+	}
+
+	// Nodes are only reported once for all the configs, as the event is recorded again only if
+	// the skipped nodes change.
+	l.recordSkippedNodes(service, v1.EventTypeWarning, "NodeWithoutIPv4",
+		"only IPv6 InternalIPs, but NodeBalancers only reach their backends over IPv4", ipv6Only)
+	l.recordDrainingNodes(service, notReady)
+	return nbNodes, nil
+}
+
+func (l *loadbalancers) buildNodeBalancerNodeCreateOptions(label, address string, nodePort int32, mode linodego.NodeMode, weight int) linodego.NodeBalancerNodeCreateOptions {
+	return linodego.NodeBalancerNodeCreateOptions{
+		Address: fmt.Sprintf("%v:%v", address, nodePort),
+		Label:   label,
+		Mode:    mode,
+		Weight:  weight,
+	}
+}
+
+const (
+	defaultNodeWeight = 100
+	minNodeWeight     = 1
+	maxNodeWeight     = 255
+)
 
-		config, err := l.buildNodeBalancerConfig(service, int(port.Port))
-		if err != nil {
-			return nil, err
-		}
-		createOpt := config.GetCreateOptions()
+// getNodeWeight returns the NodeBalancer weight of node from its label, which defaults to
+// defaultNodeWeight. Weights outside of the range accepted by NodeBalancers are clamped.
+func (l *loadbalancers) getNodeWeight(service *v1.Service, node *v1.Node, label string) int {
+	raw, ok := node.Labels[label]
+	if !ok {
+		return defaultNodeWeight
+	}
 
-		for _, n := range nodes {
-			createOpt.Nodes = append(createOpt.Nodes, l.buildNodeBalancerNodeCreateOptions(n, port.NodePort))
-		}
+	weight, err := strconv.Atoi(raw)
+	if err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidNodeWeight",
+			"label %s of node %s is %q, which isn't a weight: using the default weight of %d", label, node.Name, raw, defaultNodeWeight)
+		return defaultNodeWeight
+	}
 
-		configs = append(configs, &createOpt)
+	clamped := weight
+	if clamped < minNodeWeight {
+		clamped = minNodeWeight
+	} else if clamped > maxNodeWeight {
+		clamped = maxNodeWeight
 	}
-	return l.createNodeBalancer(ctx, service, configs)
+	if clamped != weight {
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidNodeWeight",
+			"label %s of node %s is %d, outside of the weights %d-%d of NodeBalancers: using %d", label, node.Name, weight, minNodeWeight, maxNodeWeight, clamped)
+	}
+	return clamped
 }
 
-func (l *loadbalancers) buildNodeBalancerNodeCreateOptions(node *v1.Node, nodePort int32) linodego.NodeBalancerNodeCreateOptions {
-	return linodego.NodeBalancerNodeCreateOptions{
-		Address: fmt.Sprintf("%v:%v", getNodeInternalIP(node), nodePort),
-		Label:   node.Name,
-		Mode:    "accept",
-		Weight:  100,
+// getBackupNodeSelector returns the selector of service's backup-node-label annotation, or nil
+// when all nodes accept traffic.
+func getBackupNodeSelector(service *v1.Service) (labels.Selector, error) {
+	raw, ok := getServiceAnnotation(service, annLinodeBackupNodeLabel)
+	if !ok {
+		return nil, nil
+	}
+	selector, err := labels.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for %s: %v", raw, annLinodeBackupNodeLabel, err)
+	}
+	return selector, nil
+}
+
+// getExcludeNodeSelector returns the selector of the nodes excluded from the NodeBalancer of
+// service, from its exclude-node-label annotation or Options.ExcludeNodeLabel, or nil when no
+// nodes are excluded by label selector.
+func getExcludeNodeSelector(service *v1.Service) (labels.Selector, error) {
+	raw, ok := getServiceAnnotation(service, annLinodeExcludeNodeLabel)
+	if !ok {
+		raw = Options.ExcludeNodeLabel
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	selector, err := labels.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude node label selector %q: %v", raw, err)
 	}
+	return selector, nil
 }
 
 func (l *loadbalancers) retrieveKubeClient() error {
+	// Services are reconciled concurrently, so the client is only created once.
+	l.kubeClientMu.Lock()
+	defer l.kubeClientMu.Unlock()
 	if l.kubeClient != nil {
 		return nil
 	}
@@ -629,34 +2320,250 @@ func (l *loadbalancers) retrieveKubeClient() error {
 	return nil
 }
 
+// recordEvent records an event for service if an event recorder has been configured.
+func (l *loadbalancers) recordEvent(service *v1.Service, eventType, reason, messageFmt string, args ...interface{}) {
+	if l.recorder == nil {
+		return
+	}
+	l.recorder.Eventf(service, eventType, reason, messageFmt, args...)
+}
+
+// getPortProtocol returns the protocol of port, from the most specific setting down:
+//  1. the protocol of its port config annotation, or https for a port with a TLS secret or
+//     certificate URL, or udp for a UDP port,
+//  2. the annLinodeProtocolDeprecated annotation of the Service,
+//  3. the annLinodeDefaultProtocol annotation of the Service,
+//  4. tcp.
+//
+// The certificate of a port resolved to https is looked up whichever layer its protocol comes
+// from.
+func getPortProtocol(service *v1.Service, port int, annotation portConfigAnnotation, hasTLSCert bool) string {
+	switch {
+	case annotation.Protocol != "":
+		return annotation.Protocol
+	case hasTLSCert:
+		return string(linodego.ProtocolHTTPS)
+	case getServicePortProtocol(service, port) == v1.ProtocolUDP:
+		return string(protocolUDP)
+	}
+	if protocol, ok := service.Annotations[annLinodeProtocolDeprecated]; ok {
+		return protocol
+	}
+	if protocol, ok := service.Annotations[annLinodeDefaultProtocol]; ok {
+		return protocol
+	}
+	return "tcp"
+}
+
 func getPortConfig(service *v1.Service, port int) (portConfig, error) {
 	portConfig := portConfig{}
+	if port == httpsRedirectPort {
+		if redirect, ok := getHTTPSRedirectPort(service); ok && int(redirect.Port) == port {
+			portConfig.Port = port
+			portConfig.Protocol = linodego.ProtocolHTTP
+			return portConfig, nil
+		}
+	}
 	portConfigAnnotation, err := getPortConfigAnnotation(service, port)
 	if err != nil {
 		return portConfig, err
 	}
-	protocol := portConfigAnnotation.Protocol
-	if protocol == "" {
-		var ok bool
-		protocol, ok = service.Annotations[annLinodeDefaultProtocol]
-		if !ok {
-			protocol = "tcp"
+	tlsSecretName, hasTLSSecret := getServiceAnnotation(service, annLinodePortTLSSecretPrefix+strconv.Itoa(port))
+	if !hasTLSSecret {
+		tlsSecretName = portConfigAnnotation.TLSSecretName
+	}
+	tlsObjectURL, hasTLSObjectURL, err := getTLSObjectURL(service, port)
+	if err != nil {
+		return portConfig, err
+	}
+
+	if tlsSecretName == "" && !hasTLSObjectURL {
+		// Ports with a port config annotation may still list their secret in the deprecated tls
+		// annotation.
+		deprecated, err := getTLSAnnotationDeprecated(service, port)
+		if err != nil {
+			return portConfig, err
+		}
+		if deprecated != nil {
+			tlsSecretName, hasTLSSecret = deprecated.TLSSecretName, true
 		}
 	}
 
+	protocol := getPortProtocol(service, port, portConfigAnnotation, hasTLSSecret || hasTLSObjectURL)
 	protocol = strings.ToLower(protocol)
 
-	if protocol != "tcp" && protocol != "http" && protocol != "https" {
+	if protocol != "tcp" && protocol != "http" && protocol != "https" && protocol != "udp" {
 		return portConfig, fmt.Errorf("invalid protocol: %q specified", protocol)
 	}
 
 	portConfig.Port = port
 	portConfig.Protocol = linodego.ConfigProtocol(protocol)
-	portConfig.TLSSecretName = portConfigAnnotation.TLSSecretName
+	portConfig.TLSSecretName = tlsSecretName
+	portConfig.TLSObjectURL = tlsObjectURL
 
 	return portConfig, nil
 }
 
+// getPortProxyProtocol returns the proxy protocol used for port, from the port's proxy protocol
+// annotation, falling back to the Service's and then to none.
+func getPortProxyProtocol(service *v1.Service, port int) (linodego.ConfigProxyProtocol, error) {
+	pp, ok := getServiceAnnotation(service, annLinodePortProxyProtocolPrefix+strconv.Itoa(port))
+	if !ok {
+		if pp, ok = getServiceAnnotation(service, annLinodeProxyProtocol); !ok {
+			return linodego.ProxyProtocolNone, nil
+		}
+	}
+
+	switch linodego.ConfigProxyProtocol(pp) {
+	case linodego.ProxyProtocolNone, linodego.ProxyProtocolV1, linodego.ProxyProtocolV2:
+		return linodego.ConfigProxyProtocol(pp), nil
+	default:
+		return "", fmt.Errorf("invalid NodeBalancer proxy protocol value '%s'", pp)
+	}
+}
+
+const (
+	checkBodyMatchRegex     = "regex"
+	checkBodyMatchSubstring = "substring"
+)
+
+// getCheckBodyRegex returns the regex NodeBalancers match the response body of http_body checks
+// against for body, following the match semantics of annLinodeCheckBodyMatch.
+func getCheckBodyRegex(service *v1.Service, body string) (string, error) {
+	match, ok := getServiceAnnotation(service, annLinodeCheckBodyMatch)
+	if !ok {
+		// The body is passed as is, like before the match could be annotated.
+		return body, nil
+	}
+
+	switch match {
+	case checkBodyMatchRegex:
+		// NodeBalancers use their own regex engine, so a regex Go rejects may still be valid
+		// there; explicitly requested regexes are checked to catch typos before they mark every
+		// backend as down.
+		if _, err := regexp.Compile(body); err != nil {
+			return "", fmt.Errorf("invalid regex %q for %s: %v", body, annLinodeCheckBody, err)
+		}
+		return body, nil
+	case checkBodyMatchSubstring:
+		return regexp.QuoteMeta(body), nil
+	default:
+		return "", fmt.Errorf("invalid value %q for %s: must be %s or %s", match, annLinodeCheckBodyMatch, checkBodyMatchRegex, checkBodyMatchSubstring)
+	}
+}
+
+// getPortStickiness returns the session stickiness annotated for port, if any.
+func getPortStickiness(service *v1.Service, port int) (linodego.ConfigStickiness, bool, error) {
+	stickiness, ok := getServiceAnnotation(service, annLinodePortStickinessPrefix+strconv.Itoa(port))
+	if !ok {
+		return "", false, nil
+	}
+
+	switch linodego.ConfigStickiness(stickiness) {
+	case linodego.StickinessNone, linodego.StickinessTable, linodego.StickinessHTTPCookie:
+		return linodego.ConfigStickiness(stickiness), true, nil
+	default:
+		return "", false, fmt.Errorf("invalid NodeBalancer stickiness value '%s' for port %d", stickiness, port)
+	}
+}
+
+// getPortCipherSuite returns the cipher suite of port from its ssl-cipher annotation, defaulting
+// to recommended for https ports. Other protocols have no cipher suite.
+func getPortCipherSuite(service *v1.Service, port int, protocol linodego.ConfigProtocol) (linodego.ConfigCipher, error) {
+	cipher, ok := getServiceAnnotation(service, annLinodePortSSLCipherPrefix+strconv.Itoa(port))
+	if !ok {
+		if protocol != linodego.ProtocolHTTPS {
+			return "", nil
+		}
+		return linodego.CipherRecommended, nil
+	}
+
+	switch linodego.ConfigCipher(cipher) {
+	case linodego.CipherRecommended, linodego.CipherLegacy:
+	default:
+		return "", fmt.Errorf("invalid NodeBalancer cipher suite value '%s' for port %d: must be %s or %s", cipher, port, linodego.CipherRecommended, linodego.CipherLegacy)
+	}
+	if protocol != linodego.ProtocolHTTPS {
+		return "", fmt.Errorf("port %d uses protocol %s, but cipher suites only apply to https", port, protocol)
+	}
+	return linodego.ConfigCipher(cipher), nil
+}
+
+// checkStickinessProtocol returns an error if stickiness can't be used with protocol: cookies
+// can only be set on the HTTP traffic the NodeBalancer terminates.
+func checkStickinessProtocol(stickiness linodego.ConfigStickiness, protocol linodego.ConfigProtocol) error {
+	if stickiness == linodego.StickinessHTTPCookie && protocol != linodego.ProtocolHTTP && protocol != linodego.ProtocolHTTPS {
+		return fmt.Errorf("stickiness %s requires protocol http or https, not %s", stickiness, protocol)
+	}
+	return nil
+}
+
+// getPortAlgorithm returns the balancing algorithm used for port, from the port's algorithm
+// annotation, falling back to the Service's and then to roundrobin.
+func getPortAlgorithm(service *v1.Service, port int) (linodego.ConfigAlgorithm, error) {
+	algorithm, ok := getServiceAnnotation(service, annLinodePortAlgorithmPrefix+strconv.Itoa(port))
+	if !ok {
+		if algorithm, ok = getServiceAnnotation(service, annLinodeAlgorithm); !ok {
+			return linodego.AlgorithmRoundRobin, nil
+		}
+	}
+
+	switch linodego.ConfigAlgorithm(algorithm) {
+	case linodego.AlgorithmRoundRobin, linodego.AlgorithmLeastConn, linodego.AlgorithmSource:
+		return linodego.ConfigAlgorithm(algorithm), nil
+	default:
+		return "", fmt.Errorf("invalid NodeBalancer algorithm value '%s' for port %d", algorithm, port)
+	}
+}
+
+func hasPortAlgorithmAnnotation(service *v1.Service, port int) bool {
+	if _, ok := getServiceAnnotation(service, annLinodePortAlgorithmPrefix+strconv.Itoa(port)); ok {
+		return true
+	}
+	_, ok := getServiceAnnotation(service, annLinodeAlgorithm)
+	return ok
+}
+
+// getSessionAffinityTimeout returns the timeout of the ClientIP session affinity of service, which
+// the API server defaults to 3 hours.
+func getSessionAffinityTimeout(service *v1.Service) *int32 {
+	if config := service.Spec.SessionAffinityConfig; config != nil && config.ClientIP != nil {
+		return config.ClientIP.TimeoutSeconds
+	}
+	return nil
+}
+
+// getPortHealthCheckType returns the health check type of port, from its check-type-* annotation,
+// the check-type annotation of service or the defaults of the cloud config in that order.
+func (l *loadbalancers) getPortHealthCheckType(service *v1.Service, port int) (linodego.ConfigCheck, error) {
+	annotation := annLinodePortCheckTypePrefix + strconv.Itoa(port)
+	if hType, ok := getServiceAnnotation(service, annotation); ok {
+		if hType != "none" && hType != "connection" && hType != "http" && hType != "http_body" {
+			return "", fmt.Errorf("invalid health check type: %q specified in annotation: %q", hType, annotation)
+		}
+		return linodego.ConfigCheck(hType), nil
+	}
+	if _, ok := service.Annotations[annLinodeHealthCheckType]; ok {
+		return getHealthCheckType(service)
+	}
+	return l.defaults.healthCheckType(), nil
+}
+
+// recordIgnoredHealthCheckAnnotations reports the health check annotations of service that don't
+// apply to port, as its health checks are disabled.
+func (l *loadbalancers) recordIgnoredHealthCheckAnnotations(service *v1.Service, port int) {
+	var ignored []string
+	for _, annotation := range []string{annLinodeCheckPath, annLinodeCheckBody, annLinodeCheckBodyMatch, annLinodeHealthCheckInterval, annLinodeHealthCheckTimeout, annLinodeHealthCheckAttempts} {
+		if _, ok := service.Annotations[annotation]; ok {
+			ignored = append(ignored, annotation)
+		}
+	}
+	if len(ignored) > 0 {
+		l.recordEvent(service, v1.EventTypeNormal, "HealthCheckAnnotationsIgnored",
+			"port %d has health checks disabled with check type %s, ignoring %s", port, linodego.CheckNone, strings.Join(ignored, ", "))
+	}
+}
+
 func getHealthCheckType(service *v1.Service) (linodego.ConfigCheck, error) {
 	hType, ok := service.Annotations[annLinodeHealthCheckType]
 	if !ok {
@@ -668,6 +2575,26 @@ func getHealthCheckType(service *v1.Service) (linodego.ConfigCheck, error) {
 	return linodego.ConfigCheck(hType), nil
 }
 
+// validateHealthCheck returns an error if the health check settings of config would be rejected
+// by the Linode API. Connection checks only use the interval, timeout and attempts, so the HTTP
+// settings aren't validated for them.
+func validateHealthCheck(config linodego.NodeBalancerConfig) error {
+	if config.Check == linodego.CheckNone {
+		return nil
+	}
+
+	if config.CheckTimeout < 1 || config.CheckTimeout > 30 {
+		return fmt.Errorf("invalid health check timeout %d specified in annotation %q: must be between 1 and 30 seconds", config.CheckTimeout, annLinodeHealthCheckTimeout)
+	}
+	if config.CheckInterval <= config.CheckTimeout || config.CheckInterval > 3600 {
+		return fmt.Errorf("invalid health check interval %d specified in annotation %q: must be greater than the timeout (%d seconds) and at most 3600 seconds", config.CheckInterval, annLinodeHealthCheckInterval, config.CheckTimeout)
+	}
+	if config.CheckAttempts < 1 || config.CheckAttempts > 30 {
+		return fmt.Errorf("invalid health check attempts %d specified in annotation %q: must be between 1 and 30", config.CheckAttempts, annLinodeHealthCheckAttempts)
+	}
+	return nil
+}
+
 func getPortConfigAnnotation(service *v1.Service, port int) (portConfigAnnotation, error) {
 	annotationKey := annLinodePortConfigPrefix + strconv.Itoa(port)
 	annotationJSON, ok := service.Annotations[annotationKey]
@@ -684,9 +2611,151 @@ func getPortConfigAnnotation(service *v1.Service, port int) (portConfigAnnotatio
 	return annotation, nil
 }
 
+// getNodeInternalIP returns the first IPv4 InternalIP of node. NodeBalancers only reach their
+// backends over IPv4, so the IPv6 InternalIPs of dual-stack nodes are skipped.
 func getNodeInternalIP(node *v1.Node) string {
 	for _, addr := range node.Status.Addresses {
-		if addr.Type == v1.NodeInternalIP {
+		if addr.Type != v1.NodeInternalIP {
+			continue
+		}
+		if ip := net.ParseIP(addr.Address); ip == nil || ip.To4() != nil {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+// isIPv6OnlyNode reports whether node has InternalIPs, all of which are IPv6.
+func isIPv6OnlyNode(node *v1.Node) bool {
+	hasIPv6 := false
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != v1.NodeInternalIP {
+			continue
+		}
+		ip := net.ParseIP(addr.Address)
+		if ip == nil || ip.To4() != nil {
+			return false
+		}
+		hasIPv6 = true
+	}
+	return hasIPv6
+}
+
+// getNodePort returns the port the NodeBalancer nodes of port target: its NodePort, unless
+// overridden with annLinodePortNodePortPrefix. Overrides must be within the range allowed by
+// Options.NodePortRange.
+func (l *loadbalancers) getNodePort(service *v1.Service, port v1.ServicePort) (int32, error) {
+	if port.Name == httpsRedirectPortName {
+		// The redirect config targets the backends of the port clients are redirected to.
+		if target, ok := getHTTPSRedirectTarget(service); ok {
+			port = target
+		}
+	}
+	name := annLinodePortNodePortPrefix + strconv.Itoa(int(port.Port))
+	raw, ok := getServiceAnnotation(service, name)
+	if !ok {
+		if port.NodePort == 0 {
+			// NodeBalancer backends must be nodes: pod IPs aren't reachable from NodeBalancers.
+			err := fmt.Errorf("port %d has no NodePort, e.g. because the service sets allocateLoadBalancerNodePorts to false, but NodeBalancers can only target nodes: allocate NodePorts or set %s to a port served on every node", port.Port, name)
+			l.recordEvent(service, v1.EventTypeWarning, "NodePortNotAllocated", "%s", err)
+			return 0, err
+		}
+		return port.NodePort, nil
+	}
+
+	allowed := getNodePortRange()
+	nodePort, err := strconv.Atoi(raw)
+	if err != nil || !allowed.Contains(nodePort) {
+		err = fmt.Errorf("invalid value %q for %s: must be a port in the range %s", raw, name, allowed.String())
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidNodePort", "%s", err)
+		return 0, err
+	}
+
+	for _, other := range service.Spec.Ports {
+		if other.Port != port.Port && other.NodePort == int32(nodePort) {
+			l.recordEvent(service, v1.EventTypeWarning, "NodePortConflict",
+				"%s targets port %d, which is the NodePort allocated to port %d of the service", name, nodePort, other.Port)
+		}
+	}
+	return int32(nodePort), nil
+}
+
+// getNodePortRange returns the range of ports NodeBalancer nodes may target, which defaults to the
+// default NodePort range of the API server.
+func getNodePortRange() utilnet.PortRange {
+	if Options.NodePortRange.Size == 0 {
+		return defaultNodePortRange
+	}
+	return Options.NodePortRange
+}
+
+// getBackendIPv4Range returns the VPC subnet NodeBalancer backends should be addressed in, or
+// nil if the cluster isn't VPC-backed.
+func getBackendIPv4Range(service *v1.Service) (*net.IPNet, error) {
+	cidr, ok := getServiceAnnotation(service, annLinodeBackendIPv4Range)
+	if !ok {
+		cidr = Options.BackendIPv4Range
+	}
+	if cidr == "" {
+		return nil, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ipNet.IP.To4() == nil {
+		return nil, fmt.Errorf("invalid backend IPv4 range %q: must be an IPv4 CIDR", cidr)
+	}
+	return ipNet, nil
+}
+
+// getNodeBackendIP returns the address NodeBalancer backends should use to reach node. ipType
+// selects the node's private IP, public IP or address within backendRange, and fails if the node
+// has none. Otherwise, if backendRange is set, the node's InternalIP within it is preferred,
+// falling back to the node's Linode private IP; inRange reports whether the returned address is
+// within backendRange. Otherwise, the node's InternalIP is used.
+func getNodeBackendIP(node *v1.Node, ipType nodeBackendIPType, backendRange *net.IPNet) (address string, inRange bool, err error) {
+	switch ipType {
+	case backendIPTypePrivate:
+		if private := findNodeAddress(node, v1.NodeInternalIP, linodePrivateIPv4Range.Contains); private != "" {
+			return private, false, nil
+		}
+		return "", false, fmt.Errorf("node %s has no private IP to use as a NodeBalancer backend with backend-ip-type %s", node.Name, ipType)
+
+	case backendIPTypePublic:
+		public := findNodeAddress(node, v1.NodeExternalIP, func(ip net.IP) bool {
+			return ip.To4() != nil && !linodePrivateIPv4Range.Contains(ip)
+		})
+		if public != "" {
+			return public, false, nil
+		}
+		return "", false, fmt.Errorf("node %s has no public IPv4 ExternalIP to use as a NodeBalancer backend with backend-ip-type %s", node.Name, ipType)
+
+	case backendIPTypeVPC:
+		if vpc := findNodeAddress(node, v1.NodeInternalIP, backendRange.Contains); vpc != "" {
+			return vpc, true, nil
+		}
+		return "", false, fmt.Errorf("node %s has no InternalIP address in backend range %s to use as a NodeBalancer backend with backend-ip-type %s", node.Name, backendRange, ipType)
+	}
+
+	if backendRange == nil {
+		return getNodeInternalIP(node), false, nil
+	}
+
+	if vpc := findNodeAddress(node, v1.NodeInternalIP, backendRange.Contains); vpc != "" {
+		return vpc, true, nil
+	}
+	if private := findNodeAddress(node, v1.NodeInternalIP, linodePrivateIPv4Range.Contains); private != "" {
+		return private, false, nil
+	}
+	return "", false, fmt.Errorf("node %s has neither an InternalIP address in backend range %s nor a private IP to use as a NodeBalancer backend", node.Name, backendRange)
+}
+
+// findNodeAddress returns the first address of node of type addrType that matches, if any.
+func findNodeAddress(node *v1.Node, addrType v1.NodeAddressType, matches func(net.IP) bool) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != addrType {
+			continue
+		}
+		if ip := net.ParseIP(addr.Address); ip != nil && matches(ip) {
 			return addr.Address
 		}
 	}
@@ -699,10 +2768,19 @@ func getTLSCertInfo(kubeClient kubernetes.Interface, namespace string, config po
 	}
 
 	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(config.TLSSecretName, metav1.GetOptions{})
+	if errors.IsForbidden(err) {
+		return "", "", fmt.Errorf("not allowed to read TLS secret %s/%s for port %d, the CCM needs RBAC permissions to get secrets: %v", namespace, config.TLSSecretName, config.Port, err)
+	}
 	if err != nil {
 		return "", "", err
 	}
 
+	for _, key := range []string{v1.TLSCertKey, v1.TLSPrivateKeyKey} {
+		if len(secret.Data[key]) == 0 {
+			return "", "", fmt.Errorf("TLS secret %s/%s for port %d has no %s", namespace, config.TLSSecretName, config.Port, key)
+		}
+	}
+
 	cert := string(secret.Data[v1.TLSCertKey])
 	cert = strings.TrimSpace(cert)
 
@@ -733,13 +2811,210 @@ func getConnectionThrottle(service *v1.Service) int {
 	return connThrottle
 }
 
-func makeLoadBalancerStatus(nb *linodego.NodeBalancer) *v1.LoadBalancerStatus {
-	return &v1.LoadBalancerStatus{
+// getPortConnectionThrottle returns the Client Connection Throttle requested for port. The
+// port-suffixed throttle annotation is read first, falling back to getConnectionThrottle.
+//
+// An error is returned alongside the fallback value if the port-suffixed value is invalid.
+func getPortConnectionThrottle(service *v1.Service, port int) (int, error) {
+	raw, ok := getServiceAnnotation(service, annLinodePortThrottlePrefix+strconv.Itoa(port))
+	if !ok {
+		return getConnectionThrottle(service), nil
+	}
+
+	connThrottle, err := strconv.Atoi(raw)
+	if err != nil || connThrottle < 0 || connThrottle > 20 {
+		return getConnectionThrottle(service), fmt.Errorf("invalid throttle %q for port %d: must be a number between 0 and 20", raw, port)
+	}
+	return connThrottle, nil
+}
+
+// getNodeBalancerThrottle returns the Client Connection Throttle for service's NodeBalancer.
+//
+// The Linode API only supports a single throttle per NodeBalancer, so differing per-port values
+// are collapsed into the most restrictive one (0 disables throttling, so it is the least
+// restrictive), which collapsed reports. Invalid values are reported as events on service.
+func (l *loadbalancers) getNodeBalancerThrottle(service *v1.Service) (connThrottle int, collapsed bool) {
+	if raw, ok := getServiceAnnotation(service, annLinodeThrottle); ok {
+		if parsed, err := strconv.Atoi(raw); err != nil || parsed < 0 || parsed > 20 {
+			l.recordEvent(service, v1.EventTypeWarning, "InvalidThrottle",
+				"invalid throttle %q: must be a number between 0 and 20, using %d", raw, getConnectionThrottle(service))
+		}
+	}
+
+	connThrottle = getConnectionThrottle(service)
+	for i, port := range getNodeBalancerPorts(service) {
+		portThrottle, err := getPortConnectionThrottle(service, int(port.Port))
+		if err != nil {
+			l.recordEvent(service, v1.EventTypeWarning, "InvalidThrottle", "%s", err)
+		}
+
+		switch {
+		case i == 0:
+			connThrottle = portThrottle
+		case portThrottle == connThrottle:
+			continue
+		case connThrottle == 0 || (portThrottle != 0 && portThrottle < connThrottle):
+			connThrottle = portThrottle
+			collapsed = true
+		default:
+			collapsed = true
+		}
+	}
+
+	return connThrottle, collapsed
+}
+
+// recordThrottleCollapsed reports that the differing port throttles of service were collapsed
+// into connThrottle.
+func (l *loadbalancers) recordThrottleCollapsed(service *v1.Service, connThrottle int) {
+	l.recordEvent(service, v1.EventTypeNormal, "ThrottleCollapsed",
+		"ports request different throttles; NodeBalancers support a single throttle so %d is applied to all ports", connThrottle)
+}
+
+func makeLoadBalancerStatus(service *v1.Service, nb *linodego.NodeBalancer) *v1.LoadBalancerStatus {
+	// NodeBalancers "created" in dry-run mode don't exist, so they have no addresses.
+	if nb.IPv4 == nil || nb.Hostname == nil {
+		return &v1.LoadBalancerStatus{}
+	}
+
+	// Invalid hostnames are reported by EnsureLoadBalancer; the NodeBalancer's is used meanwhile.
+	hostname := *nb.Hostname
+	if custom, err := getIngressHostname(service); err == nil && custom != "" {
+		hostname = custom
+	}
+
+	if getServiceBoolAnnotation(service, annLinodeHostnameOnlyIngress) {
+		return &v1.LoadBalancerStatus{
+			Ingress: []v1.LoadBalancerIngress{{Hostname: hostname}},
+		}
+	}
+
+	status := &v1.LoadBalancerStatus{
 		Ingress: []v1.LoadBalancerIngress{{
 			IP:       *nb.IPv4,
-			Hostname: *nb.Hostname,
+			Hostname: hostname,
 		}},
 	}
+
+	if nb.IPv6 != nil && *nb.IPv6 != "" && getServiceBoolAnnotation(service, annLinodeEnableIPv6Ingress) {
+		status.Ingress = append(status.Ingress, v1.LoadBalancerIngress{IP: *nb.IPv6})
+	}
+	return status
+}
+
+// getIngressHostname returns the hostname specified by annLinodeHostname, or an empty string if
+// it isn't set. An error is returned if the hostname isn't a valid DNS-1123 subdomain.
+func getIngressHostname(service *v1.Service) (string, error) {
+	hostname, ok := getServiceAnnotation(service, annLinodeHostname)
+	if !ok {
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) > 0 {
+		return "", fmt.Errorf("invalid value %q for %s: %s", hostname, annLinodeHostname, strings.Join(errs, ", "))
+	}
+	return hostname, nil
+}
+
+// getNodeBalancerPorts returns the ports of the service handled by its NodeBalancer, which are
+// all of them but the ones skipped with annLinodePortSkipPrefix, along with the redirect port
+// requested with annLinodeHTTPSRedirect.
+func getNodeBalancerPorts(service *v1.Service) []v1.ServicePort {
+	ports := make([]v1.ServicePort, 0, len(service.Spec.Ports)+1)
+	for _, port := range service.Spec.Ports {
+		if !isPortSkipped(service, port) {
+			ports = append(ports, port)
+		}
+	}
+	if redirect, ok := getHTTPSRedirectPort(service); ok {
+		ports = append(ports, redirect)
+	}
+	return ports
+}
+
+func isPortSkipped(service *v1.Service, port v1.ServicePort) bool {
+	return getServiceBoolAnnotation(service, annLinodePortSkipPrefix+strconv.Itoa(int(port.Port)))
+}
+
+const (
+	httpsRedirectPort     = 80
+	httpsRedirectPortName = "linode-https-redirect"
+)
+
+// getHTTPSRedirectPort returns the port of the redirect config requested with
+// annLinodeHTTPSRedirect, which is only added while the service has an https port 443 and no
+// port 80 of its own.
+func getHTTPSRedirectPort(service *v1.Service) (v1.ServicePort, bool) {
+	if !getServiceBoolAnnotation(service, annLinodeHTTPSRedirect) {
+		return v1.ServicePort{}, false
+	}
+	target, ok := getHTTPSRedirectTarget(service)
+	if !ok {
+		return v1.ServicePort{}, false
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Port == httpsRedirectPort {
+			return v1.ServicePort{}, false
+		}
+	}
+	return v1.ServicePort{
+		Name:     httpsRedirectPortName,
+		Protocol: v1.ProtocolTCP,
+		Port:     httpsRedirectPort,
+		NodePort: target.NodePort,
+	}, true
+}
+
+// getHTTPSRedirectTarget returns the port 443 of the service if the NodeBalancer terminates TLS
+// on it.
+func getHTTPSRedirectTarget(service *v1.Service) (v1.ServicePort, bool) {
+	for _, port := range service.Spec.Ports {
+		if port.Port != 443 || isPortSkipped(service, port) {
+			continue
+		}
+		portConfig, err := getPortConfig(service, int(port.Port))
+		if err != nil || portConfig.Protocol != linodego.ProtocolHTTPS || portConfig.TLSSecretName == "" {
+			return v1.ServicePort{}, false
+		}
+		return port, true
+	}
+	return v1.ServicePort{}, false
+}
+
+// checkHTTPSRedirect warns about an annLinodeHTTPSRedirect annotation the service can't honor.
+func (l *loadbalancers) checkHTTPSRedirect(service *v1.Service) {
+	if !getServiceBoolAnnotation(service, annLinodeHTTPSRedirect) {
+		return
+	}
+	if _, ok := getHTTPSRedirectPort(service); ok {
+		return
+	}
+	if _, ok := getHTTPSRedirectTarget(service); !ok {
+		l.recordEvent(service, v1.EventTypeWarning, "HTTPSRedirectIgnored",
+			"%s requires port 443 to use protocol https with a TLS secret", annLinodeHTTPSRedirect)
+		return
+	}
+	l.recordEvent(service, v1.EventTypeWarning, "HTTPSRedirectIgnored",
+		"%s is ignored because the service already has a port %d", annLinodeHTTPSRedirect, httpsRedirectPort)
+}
+
+// getServicePortProtocol returns the protocol of port of the service, defaulting to TCP.
+func getServicePortProtocol(service *v1.Service, port int) v1.Protocol {
+	for _, servicePort := range service.Spec.Ports {
+		if int(servicePort.Port) == port && servicePort.Protocol != "" {
+			return servicePort.Protocol
+		}
+	}
+	return v1.ProtocolTCP
+}
+
+// getServicePorts returns the port numbers of the service handled by its NodeBalancer.
+func getServicePorts(service *v1.Service) []int {
+	nbPorts := getNodeBalancerPorts(service)
+	ports := make([]int, 0, len(nbPorts))
+	for _, port := range nbPorts {
+		ports = append(ports, int(port.Port))
+	}
+	return ports
 }
 
 // getServiceNn returns the services namespaced name.
@@ -754,3 +3029,31 @@ func getServiceAnnotation(service *v1.Service, name string) (string, bool) {
 	val, ok := service.Annotations[name]
 	return val, ok
 }
+
+// getCheckPassive returns whether the config of a port using protocol and active checks of type
+// check marks backends down on connection errors and 5xx responses. The check-passive annotation
+// sets it regardless of the active checks, e.g. to keep backends that fail requests under load.
+// Passive checks aren't supported by UDP configs, and are disabled along with the active checks
+// unless they are enabled explicitly, leaving only passive checks.
+func getCheckPassive(service *v1.Service, protocol linodego.ConfigProtocol, check linodego.ConfigCheck) (bool, error) {
+	raw, ok := getServiceAnnotation(service, annLinodeHealthCheckPassive)
+	if !ok {
+		return protocol != protocolUDP && check != linodego.CheckNone, nil
+	}
+	checkPassive, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %q: must be a bool", raw, annLinodeHealthCheckPassive)
+	}
+	return checkPassive, nil
+}
+
+// getServiceBoolAnnotation returns the value of a bool annotation of service, treating missing
+// and invalid values as false.
+func getServiceBoolAnnotation(service *v1.Service, name string) bool {
+	raw, ok := getServiceAnnotation(service, name)
+	if !ok {
+		return false
+	}
+	value, err := strconv.ParseBool(raw)
+	return err == nil && value
+}
@@ -14,8 +14,15 @@ const (
 type tlsAnnotationDeprecated struct {
 	TLSSecretName string `json:"tls-secret-name"`
 	Port          int    `json:"port"`
+
+	// Hostname is the server name the certificate is for. NodeBalancer configs hold a single
+	// certificate and don't support SNI, so a port can only have one of these.
+	Hostname string `json:"hostname,omitempty"`
 }
 
+// tryDeprecatedTLSAnnotation returns the port config of port from the deprecated tls annotation,
+// which only configures ports listed in it. The deprecated protocol annotation applies to all the
+// ports and is resolved by getPortProtocol.
 func tryDeprecatedTLSAnnotation(service *v1.Service, port int) (portConfigAnnotation, error) {
 	annotation := portConfigAnnotation{}
 	tlsAnnotation, err := getTLSAnnotationDeprecated(service, port)
@@ -26,19 +33,12 @@ func tryDeprecatedTLSAnnotation(service *v1.Service, port int) (portConfigAnnota
 	if tlsAnnotation != nil {
 		annotation.Protocol = "https"
 		annotation.TLSSecretName = tlsAnnotation.TLSSecretName
-	} else if protocol, ok := service.Annotations[annLinodeProtocolDeprecated]; ok {
-		annotation.Protocol = protocol
 	}
 	return annotation, nil
 }
 
 func getTLSAnnotationDeprecated(service *v1.Service, port int) (*tlsAnnotationDeprecated, error) {
-	annotationJSON, ok := service.Annotations[annLinodeLoadBalancerTLSDeprecated]
-	if !ok {
-		return nil, nil
-	}
-	tlsAnnotations := make([]*tlsAnnotationDeprecated, 0)
-	err := json.Unmarshal([]byte(annotationJSON), &tlsAnnotations)
+	tlsAnnotations, err := getTLSAnnotationsDeprecated(service)
 	if err != nil {
 		return nil, err
 	}
@@ -49,3 +49,15 @@ func getTLSAnnotationDeprecated(service *v1.Service, port int) (*tlsAnnotationDe
 	}
 	return nil, nil
 }
+
+func getTLSAnnotationsDeprecated(service *v1.Service) ([]*tlsAnnotationDeprecated, error) {
+	annotationJSON, ok := service.Annotations[annLinodeLoadBalancerTLSDeprecated]
+	if !ok {
+		return nil, nil
+	}
+	tlsAnnotations := make([]*tlsAnnotationDeprecated, 0)
+	if err := json.Unmarshal([]byte(annotationJSON), &tlsAnnotations); err != nil {
+		return nil, err
+	}
+	return tlsAnnotations, nil
+}
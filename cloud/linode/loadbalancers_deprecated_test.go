@@ -89,11 +89,12 @@ func testBuildLoadBalancerRequestDeprecated(t *testing.T, client *linodego.Clien
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	nb, err := lb.buildLoadBalancerRequest(context.TODO(), svc, nodes)
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
 
 	if nb == nil {
 		t.Error("unexpected nodeID")
@@ -185,13 +186,13 @@ func testEnsureLoadBalancerDeletedDeprecated(t *testing.T, client *linodego.Clie
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	configs := []*linodego.NodeBalancerConfigCreateOptions{}
-	_, err := lb.createNodeBalancer(context.TODO(), svc, configs)
+	nb, err := lb.createNodeBalancer(context.TODO(), svc, configs)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
 
 	for _, test := range testcases {
 		t.Run(test.name, func(t *testing.T) {
@@ -232,7 +233,7 @@ func testEnsureLoadBalancerDeprecated(t *testing.T, client *linodego.Client) {
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 
 	configs := []*linodego.NodeBalancerConfigCreateOptions{}
 	nb, err := lb.createNodeBalancer(context.TODO(), svc, configs)
@@ -240,7 +241,7 @@ func testEnsureLoadBalancerDeprecated(t *testing.T, client *linodego.Client) {
 		t.Fatal(err)
 	}
 
-	svc.Status.LoadBalancer = *makeLoadBalancerStatus(nb)
+	svc.Status.LoadBalancer = *makeLoadBalancerStatus(svc, nb)
 	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
 	lbStatus, exists, err := lb.GetLoadBalancer(context.TODO(), "linodelb", svc)
 	if err != nil {
@@ -329,7 +330,7 @@ func testEnsureLoadBalancerDeprecated(t *testing.T, client *linodego.Client) {
 }
 
 func testGetLoadBalancerDeprecated(t *testing.T, client *linodego.Client) {
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "test",
@@ -356,7 +357,7 @@ func testGetLoadBalancerDeprecated(t *testing.T, client *linodego.Client) {
 		t.Fatal(err)
 	}
 
-	lbStatus := makeLoadBalancerStatus(nb)
+	lbStatus := makeLoadBalancerStatus(svc, nb)
 	svc.Status.LoadBalancer = *lbStatus
 	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
 	testcases := []struct {
@@ -504,9 +505,10 @@ func Test_tryDeprecatedTLSAnnotation(t *testing.T) {
 			expectedTLSSecretName: "prod-app-tls",
 		},
 		{
+			// The protocol annotation is resolved by getPortProtocol, below port configs.
 			name:                  "Test Linode Protocol set as default",
 			ann:                   map[string]string{annLinodeProtocolDeprecated: `https`},
-			expectedProtocol:      "https",
+			expectedProtocol:      "",
 			expectedTLSSecretName: "",
 		},
 		{
@@ -0,0 +1,504 @@
+package linode
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// portOwnerTagPrefix prefixes the NodeBalancer tags recording which Service owns each of the
+// NodeBalancer's ports, e.g. "ccm:443:<service uid>". These tags allow several Services to share
+// a NodeBalancer through the nodebalancer-id annotation without fighting over its configs.
+const portOwnerTagPrefix = "ccm:"
+
+// preservedTagPrefix prefixes the tag recording which Service a preserved NodeBalancer was
+// detached from, e.g. "ccm-preserved:<service uid>", so that the Service can re-adopt it.
+const preservedTagPrefix = "ccm-preserved:"
+
+// serviceUIDTagPrefix prefixes the tags recording which Services own a NodeBalancer, e.g.
+// "ccm-service-uid:<service uid>". Unlike the label or the status of the Service, these tags
+// don't depend on the name of the Service or on its ports, so they are the first thing the CCM
+// looks at to find the NodeBalancer of a Service.
+const serviceUIDTagPrefix = "ccm-service-uid:"
+
+// retainedTag marks the NodeBalancers kept for manual review when the namespace of their Service
+// was deleted with --retain-on-namespace-delete. They are never garbage-collected.
+const retainedTag = "ccm-retained"
+
+func preservedTag(service *v1.Service) string {
+	return preservedTagPrefix + string(service.UID)
+}
+
+func serviceUIDTag(service *v1.Service) string {
+	return serviceUIDTagPrefix + string(service.UID)
+}
+
+// getServiceUIDs returns the UIDs of the Services recorded as owners of nb by their UID tag.
+func getServiceUIDs(nb *linodego.NodeBalancer) []string {
+	var uids []string
+	for _, tag := range nb.Tags {
+		if strings.HasPrefix(tag, serviceUIDTagPrefix) && len(tag) > len(serviceUIDTagPrefix) {
+			uids = append(uids, strings.TrimPrefix(tag, serviceUIDTagPrefix))
+		}
+	}
+	return uids
+}
+
+func portOwnerTag(port int, service *v1.Service) string {
+	return fmt.Sprintf("%s%d:%s", portOwnerTagPrefix, port, service.UID)
+}
+
+func parsePortOwnerTag(tag string) (port int, uid string, ok bool) {
+	if !strings.HasPrefix(tag, portOwnerTagPrefix) {
+		return 0, "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(tag, portOwnerTagPrefix), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", false
+	}
+
+	port, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", false
+	}
+	return port, parts[1], true
+}
+
+// getPortOwners returns the UID of the Service owning each of nb's ports.
+func getPortOwners(nb *linodego.NodeBalancer) map[int]string {
+	owners := make(map[int]string)
+	for _, tag := range nb.Tags {
+		if port, uid, ok := parsePortOwnerTag(tag); ok {
+			owners[port] = uid
+		}
+	}
+	return owners
+}
+
+// isSharedWithOtherServices reports whether a Service other than service owns ports on nb, or
+// is recorded as one of its owners by its UID tag.
+func isSharedWithOtherServices(nb *linodego.NodeBalancer, service *v1.Service) bool {
+	for _, uid := range getPortOwners(nb) {
+		if uid != string(service.UID) {
+			return true
+		}
+	}
+	for _, uid := range getServiceUIDs(nb) {
+		if uid != string(service.UID) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPortConflicts returns an error if any of service's ports is owned by another Service
+// sharing nb.
+func (l *loadbalancers) checkPortConflicts(service *v1.Service, nb *linodego.NodeBalancer) error {
+	owners := getPortOwners(nb)
+	for _, port := range getNodeBalancerPorts(service) {
+		if owner, ok := owners[int(port.Port)]; ok && owner != string(service.UID) {
+			err := fmt.Errorf("port %d of NodeBalancer (%d) is already in use by service with UID %s", port.Port, nb.ID, owner)
+			l.recordEvent(service, v1.EventTypeWarning, "PortConflict", "%s", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// buildPortOwnerTags returns nb's tags with service recorded as the owner of ports, replacing
+// any ports service previously owned. The UID tag of service is removed along with its last port.
+func buildPortOwnerTags(nb *linodego.NodeBalancer, service *v1.Service, ports []int) []string {
+	tags := make([]string, 0, len(nb.Tags)+len(ports))
+	for _, tag := range nb.Tags {
+		if _, uid, ok := parsePortOwnerTag(tag); ok && uid == string(service.UID) {
+			continue
+		}
+		if len(ports) == 0 && tag == serviceUIDTag(service) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	for _, port := range ports {
+		tags = append(tags, portOwnerTag(port, service))
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// nodeBalancerLabel returns the label of the NodeBalancer created for service. Labels are unique
+// per Linode account, so when the cluster name is known a hash of it is appended to keep clusters
+// sharing an account apart. Labels are limited to 32 characters, so only part of the Service's UID
+// is used.
+func nodeBalancerLabel(service *v1.Service) string {
+	uid := strings.Replace(string(service.UID), "-", "", -1)
+
+	clusterName := getClusterName()
+	if clusterName == "" {
+		if len(uid) > 28 {
+			uid = uid[:28]
+		}
+		return "ccm-" + uid
+	}
+
+	if len(uid) > 19 {
+		uid = uid[:19]
+	}
+	clusterHash := sha256.Sum256([]byte(clusterName))
+	return fmt.Sprintf("ccm-%s-%x", uid, clusterHash[:4])
+}
+
+// nodeBalancerLabelPattern matches the labels accepted by the Linode API: 3 to 32 letters, digits,
+// hyphens, underscores and periods, starting and ending with a letter or digit.
+var nodeBalancerLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{1,30}[a-zA-Z0-9]$`)
+
+func validateNodeBalancerLabel(label string) error {
+	if !nodeBalancerLabelPattern.MatchString(label) {
+		return fmt.Errorf("label %q must be 3 to 32 letters, digits, hyphens, underscores or periods, starting and ending with a letter or digit", label)
+	}
+	for _, repeated := range []string{"--", "__", ".."} {
+		if strings.Contains(label, repeated) {
+			return fmt.Errorf("label %q must not contain %q", label, repeated)
+		}
+	}
+	return nil
+}
+
+// getNodeBalancerLabel returns the label requested by service's label annotation, or the label
+// of the label template of the cloud config, or the generated one when they're unset or invalid.
+func (l *loadbalancers) getNodeBalancerLabel(service *v1.Service) string {
+	label, ok := getServiceAnnotation(service, annLinodeLabel)
+	if !ok {
+		return l.getTemplatedNodeBalancerLabel(service)
+	}
+	if err := validateNodeBalancerLabel(label); err != nil {
+		generated := nodeBalancerLabel(service)
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidLabel", "%s, using %q instead", err, generated)
+		return generated
+	}
+	return label
+}
+
+// nodeBalancerLabelData is what the nodebalancer-label-template of the cloud config is executed
+// with, e.g. {{ .Labels.env }}-{{ .Cluster }}-{{ .Name }}.
+type nodeBalancerLabelData struct {
+	// Namespace and Name are the namespace and name of the Service.
+	Namespace string
+	Name      string
+	// UID is the UID of the Service without hyphens.
+	UID string
+	// Cluster is the name of the cluster, if known.
+	Cluster string
+	// Labels are the labels of the Service.
+	Labels map[string]string
+}
+
+// parseNodeBalancerLabelTemplate parses text, a nodebalancer-label-template. Missing keys are
+// errors, so that labels aren't generated with "<no value>" in them.
+func parseNodeBalancerLabelTemplate(text string) (*template.Template, error) {
+	return template.New("nodebalancer-label").Option("missingkey=error").Parse(text)
+}
+
+// getTemplatedNodeBalancerLabel returns the label of the nodebalancer-label-template of the cloud
+// config for service, truncated to the 32 characters of Linode labels, or the generated label if
+// there is no template or it doesn't produce a valid label. As NodeBalancers are found by their
+// tags, changing the template relabels them rather than orphaning them.
+func (l *loadbalancers) getTemplatedNodeBalancerLabel(service *v1.Service) string {
+	if l.defaults.NodeBalancerLabelTemplate == "" {
+		return nodeBalancerLabel(service)
+	}
+
+	label, err := executeNodeBalancerLabelTemplate(l.defaults.NodeBalancerLabelTemplate, service)
+	if err == nil {
+		err = validateNodeBalancerLabel(label)
+	}
+	if err != nil {
+		generated := nodeBalancerLabel(service)
+		l.recordEvent(service, v1.EventTypeWarning, "InvalidLabelTemplate", "nodebalancer-label-template of the cloud config: %s, using %q instead", err, generated)
+		return generated
+	}
+	return label
+}
+
+// executeNodeBalancerLabelTemplate returns the label text generates for service, truncated to 32
+// characters without the separators the truncation leaves at its end.
+func executeNodeBalancerLabelTemplate(text string, service *v1.Service) (string, error) {
+	tmpl, err := parseNodeBalancerLabelTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var label strings.Builder
+	err = tmpl.Execute(&label, nodeBalancerLabelData{
+		Namespace: service.Namespace,
+		Name:      service.Name,
+		UID:       strings.Replace(string(service.UID), "-", "", -1),
+		Cluster:   getClusterName(),
+		Labels:    service.Labels,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	result := label.String()
+	if len(result) > 32 {
+		result = strings.TrimRight(result[:32], "._-")
+	}
+	return result, nil
+}
+
+// tagTemplateToken matches the tokens expanded in the tags of the tags annotation.
+var tagTemplateToken = regexp.MustCompile(`\{(namespace|service|cluster)\}`)
+
+// getServiceTags returns the tags listed in service's tags annotation.
+func getServiceTags(service *v1.Service) []string {
+	raw, ok := getServiceAnnotation(service, annLinodeTags)
+	if !ok {
+		return nil
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// expandTagTemplate returns tag, a tag of service's tags annotation, with its {namespace},
+// {service} and {cluster} tokens expanded. ok is false if a token has no value, i.e. {cluster}
+// when the cluster name isn't known.
+//
+// The returned pattern matches the expansions of tag for any value of its tokens, so that stale
+// expansions can be replaced. It is nil for tags without tokens or only made of tokens, whose
+// pattern would match unrelated tags.
+func expandTagTemplate(tag string, service *v1.Service) (expanded string, pattern *regexp.Regexp, ok bool) {
+	values := map[string]string{
+		"{namespace}": service.Namespace,
+		"{service}":   service.Name,
+		"{cluster}":   getClusterName(),
+	}
+
+	var literal, expr strings.Builder
+	last := 0
+	for _, loc := range tagTemplateToken.FindAllStringIndex(tag, -1) {
+		if values[tag[loc[0]:loc[1]]] == "" {
+			return "", nil, false
+		}
+		literal.WriteString(tag[last:loc[0]])
+		expr.WriteString(regexp.QuoteMeta(tag[last:loc[0]]) + ".+")
+		last = loc[1]
+	}
+	literal.WriteString(tag[last:])
+	expr.WriteString(regexp.QuoteMeta(tag[last:]))
+
+	expanded = tagTemplateToken.ReplaceAllStringFunc(tag, func(token string) string {
+		return values[token]
+	})
+	if last > 0 && literal.Len() > 0 {
+		pattern = regexp.MustCompile("^" + expr.String() + "$")
+	}
+	return expanded, pattern, true
+}
+
+// isStaleTag reports whether tag is a stale expansion of a templated tag, i.e. matches one of
+// patterns without being one of the current expansions.
+func isStaleTag(tag string, expansions []string, patterns []*regexp.Regexp) bool {
+	if isManagedTag(tag) || containsString(expansions, tag) {
+		return false
+	}
+	for _, pattern := range patterns {
+		if pattern.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// isManagedTag reports whether tag is one of the tags the CCM relies on to recognize NodeBalancers.
+func isManagedTag(tag string) bool {
+	return strings.HasPrefix(tag, portOwnerTagPrefix) || strings.HasPrefix(tag, clusterTagPrefix) || strings.HasPrefix(tag, preservedTagPrefix) ||
+		strings.HasPrefix(tag, serviceUIDTagPrefix) || strings.HasPrefix(tag, forceRecreateTagPrefix) || tag == retainedTag
+}
+
+// buildNodeBalancerTags returns the tags nb should have once service owns its ports: nb's current
+// tags but service's preserved tag, the port owner tags and UID tag of service, the cluster tag
+// and the expanded tags of service's tags annotation. NodeBalancers created before UID tags were
+// introduced get theirs the first time they are reconciled.
+// The default tags of the tags-configmap of the cloud config are added for the keys the tags of
+// service don't override.
+// Tags are only ever added, so tags set outside of the CCM are left alone. The only exceptions are
+// the stale expansions of templated tags, which are replaced by their current expansion, and the
+// tags of default tag keys with another value, which are replaced by the current one.
+func buildNodeBalancerTags(nb *linodego.NodeBalancer, service *v1.Service) []string {
+	tags := buildPortOwnerTags(nb, service, getServicePorts(service))
+
+	// The Service has re-adopted its preserved NodeBalancer.
+	for i, tag := range tags {
+		if tag == preservedTag(service) {
+			tags = append(tags[:i], tags[i+1:]...)
+			break
+		}
+	}
+
+	var extra []string
+	var patterns []*regexp.Regexp
+	for _, template := range getServiceTags(service) {
+		tag, pattern, ok := expandTagTemplate(template, service)
+		if !ok {
+			continue
+		}
+		extra = append(extra, tag)
+		if pattern != nil {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	// The expansions and default tag overrides of the other Services sharing nb would look stale.
+	shared := isSharedWithOtherServices(nb, service)
+	if shared {
+		patterns = nil
+	}
+	extra = append(extra, defaultTags.get(extra)...)
+
+	current := tags
+	tags = make([]string, 0, len(current)+len(extra)+2)
+	for _, tag := range current {
+		if isStaleTag(tag, extra, patterns) || (!shared && defaultTags.isStale(tag, extra)) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	extra = append(extra, serviceUIDTag(service))
+	if clusterTag := getClusterTag(); clusterTag != "" {
+		extra = append(extra, clusterTag)
+	}
+
+	for _, tag := range extra {
+		if !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// reconcileNodeBalancerIdentity restores the label and tags the CCM relies on to recognize nb,
+// e.g. after they were changed from the Linode dashboard. The label of a NodeBalancer shared with
+// other Services, or of the default NodeBalancer, isn't changed, as it belongs to none of them in
+// particular.
+func (l *loadbalancers) reconcileNodeBalancerIdentity(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) (*linodego.NodeBalancer, error) {
+	var update linodego.NodeBalancerUpdateOptions
+
+	currentLabel := ""
+	if nb.Label != nil {
+		currentLabel = *nb.Label
+	}
+	if label := l.getNodeBalancerLabel(service); currentLabel != label && !isSharedWithOtherServices(nb, service) && !l.isDefaultNodeBalancer(nb) {
+		update.Label = &label
+	}
+
+	current := append([]string(nil), nb.Tags...)
+	sort.Strings(current)
+	if tags := buildNodeBalancerTags(nb, service); strings.Join(current, ",") != strings.Join(tags, ",") {
+		update.Tags = &tags
+	}
+
+	if update.Label == nil && update.Tags == nil {
+		return nb, nil
+	}
+
+	if update.Label != nil {
+		klog.Infof("relabeling NodeBalancer (%d) of service (%s) from %q to %q", nb.ID, getServiceNn(service), currentLabel, *update.Label)
+	}
+	if update.Tags != nil {
+		klog.Infof("updating tags of NodeBalancer (%d) of service (%s) from %v to %v", nb.ID, getServiceNn(service), current, *update.Tags)
+	}
+	updated, err := l.updateNodeBalancerOptions(ctx, service, nb, update)
+	if err == nil && update.Label != nil && currentLabel != "" && !l.dryRun {
+		// Relabeling is visible to anything finding the NodeBalancer by its label, e.g. when the
+		// generated label replaces the random label of a NodeBalancer created by an older CCM.
+		l.recordEvent(service, v1.EventTypeNormal, "NodeBalancerRelabeled", "relabeled NodeBalancer (%d) from %q to %q", nb.ID, currentLabel, *update.Label)
+	}
+	return updated, err
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePortOwnerTags records service as the owner of ports on nb.
+func (l *loadbalancers) updatePortOwnerTags(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer, ports []int) (*linodego.NodeBalancer, error) {
+	tags := buildPortOwnerTags(nb, service, ports)
+
+	current := append([]string(nil), nb.Tags...)
+	sort.Strings(current)
+	if strings.Join(current, ",") == strings.Join(tags, ",") {
+		return nb, nil
+	}
+
+	return l.updateNodeBalancerOptions(ctx, service, nb, linodego.NodeBalancerUpdateOptions{Tags: &tags})
+}
+
+// releaseSharedNodeBalancer removes the configs and port ownership tags of service from nb,
+// leaving the NodeBalancer in place for the other Services sharing it.
+func (l *loadbalancers) releaseSharedNodeBalancer(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	owners := getPortOwners(nb)
+
+	nbCfgs, err := l.client.ListNodeBalancerConfigs(ctx, nb.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, nbc := range nbCfgs {
+		if owners[nbc.Port] != string(service.UID) {
+			continue
+		}
+		if err := l.deleteNodeBalancerConfig(ctx, service, nb.ID, nbc.ID); err != nil {
+			return err
+		}
+		l.drains.forgetConfig(nb.ID, nbc.ID)
+	}
+
+	if _, err := l.updatePortOwnerTags(ctx, service, nb, nil); err != nil {
+		return err
+	}
+
+	klog.Infof("released NodeBalancer (%d) shared with other services for service (%s)", nb.ID, getServiceNn(service))
+	return nil
+}
+
+// deleteNodeBalancer deletes nb, unless it is shared with other Services or is the default
+// NodeBalancer of the cloud config, in which case only service's configs are released from it.
+func (l *loadbalancers) deleteNodeBalancer(ctx context.Context, service *v1.Service, nb *linodego.NodeBalancer) error {
+	if isSharedWithOtherServices(nb, service) || l.isDefaultNodeBalancer(nb) {
+		return l.releaseSharedNodeBalancer(ctx, service, nb)
+	}
+
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "delete-nodebalancer", NodeBalancerID: nb.ID, Current: nb})
+		return nil
+	}
+
+	if err := l.client.DeleteNodeBalancer(ctx, nb.ID); err != nil {
+		return err
+	}
+	l.drains.forgetConfig(nb.ID, 0)
+	return nil
+}
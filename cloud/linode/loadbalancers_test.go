@@ -2,21 +2,35 @@ package linode
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/linode/linodego"
+	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	kubeletapis "k8s.io/kubernetes/pkg/kubelet/apis"
 )
 
 const testCert string = `-----BEGIN CERTIFICATE-----
@@ -130,10 +144,74 @@ func TestCCMLoadBalancers(t *testing.T) {
 			name: "Update Load Balancer - Specify NodeBalancerID",
 			f:    testUpdateLoadBalancerAddNodeBalancerID,
 		},
+		{
+			name: "Update Load Balancer - Change Protocol",
+			f:    testUpdateLoadBalancerChangeProtocol,
+		},
 		{
 			name: "Update Load Balancer - Proxy Protocol",
 			f:    testUpdateLoadBalancerAddProxyProtocol,
 		},
+		{
+			name: "Update Load Balancer - Drain Removed Nodes",
+			f:    testUpdateLoadBalancerDrainNodes,
+		},
+		{
+			name: "Update Load Balancer - Local External Traffic Policy",
+			f:    testUpdateLoadBalancerLocalTrafficPolicy,
+		},
+		{
+			name: "Ensure Load Balancer - Shared NodeBalancer",
+			f:    testEnsureLoadBalancerSharedNodeBalancer,
+		},
+		{
+			name: "Ensure Load Balancer - Region Annotation",
+			f:    testEnsureLoadBalancerRegion,
+		},
+		{
+			name: "Ensure Load Balancer - Hostname Only Ingress",
+			f:    testEnsureLoadBalancerHostnameOnly,
+		},
+		{
+			name: "Ensure Load Balancer - Skip Port",
+			f:    testEnsureLoadBalancerSkipPort,
+		},
+		{
+			name: "Ensure Load Balancer - Reserved IPv4",
+			f:    testEnsureLoadBalancerReservedIPv4,
+		},
+		{
+			name: "Update Load Balancer - Reconcile Label and Tags",
+			f:    testUpdateLoadBalancerReconcileIdentity,
+		},
+		{
+			name: "Get Load Balancer - Other Cluster",
+			f:    testGetLoadBalancerOtherCluster,
+		},
+		{
+			name: "Get Load Balancer - Service UID Tag",
+			f:    testGetLoadBalancerServiceUIDTag,
+		},
+		{
+			name: "Ensure Load Balancer - Firewall",
+			f:    testEnsureLoadBalancerFirewall,
+		},
+		{
+			name: "Ensure Load Balancer - Firewall ID Change",
+			f:    testEnsureLoadBalancerFirewallIDChange,
+		},
+		{
+			name: "Ensure Load Balancer - Source Ranges",
+			f:    testEnsureLoadBalancerSourceRanges,
+		},
+		{
+			name: "Ensure Load Balancer - Creation Disabled",
+			f:    testEnsureLoadBalancerCreationDisabled,
+		},
+		{
+			name: "Ensure Load Balancer - Dry Run",
+			f:    testEnsureLoadBalancerDryRun,
+		},
 		{
 			name: "Build Load Balancer Request",
 			f:    testBuildLoadBalancerRequest,
@@ -146,6 +224,18 @@ func TestCCMLoadBalancers(t *testing.T) {
 			name: "Ensure Load Balancer Deleted - Preserve Annotation",
 			f:    testEnsureLoadBalancerPreserveAnnotation,
 		},
+		{
+			name: "Ensure Load Balancer Deleted - Namespace Terminating",
+			f:    testEnsureLoadBalancerDeletedNamespaceTerminating,
+		},
+		{
+			name: "Ensure Load Balancer - Paused",
+			f:    testEnsureLoadBalancerPaused,
+		},
+		{
+			name: "Ensure Load Balancer - Preserved Across Type Change",
+			f:    testEnsureLoadBalancerPreserveTypeChange,
+		},
 		{
 			name: "Ensure Existing Load Balancer",
 			f:    testEnsureExistingLoadBalancer,
@@ -162,6 +252,62 @@ func TestCCMLoadBalancers(t *testing.T) {
 			name: "getNodeBalancerForService - NodeBalancerID does not exist",
 			f:    testGetNodeBalancerForServiceIDDoesNotExist,
 		},
+		{
+			name: "Update Load Balancer - NodeBalancerID deleted out-of-band",
+			f:    testUpdateLoadBalancerDeletedNodeBalancerID,
+		},
+		{
+			name: "Ensure Load Balancer - Shared firewall",
+			f:    testEnsureLoadBalancerSharedFirewall,
+		},
+		{
+			name: "Update Load Balancer - Backup nodes",
+			f:    testUpdateLoadBalancerBackupNodes,
+		},
+		{
+			name: "Update Load Balancer - Excluded nodes",
+			f:    testUpdateLoadBalancerExcludedNodes,
+		},
+		{
+			name: "Update Load Balancer - Control-plane nodes",
+			f:    testUpdateLoadBalancerControlPlaneNodes,
+		},
+		{
+			name: "Update Load Balancer - NotReady nodes",
+			f:    testUpdateLoadBalancerNotReadyNodes,
+		},
+		{
+			name: "Update Load Balancer - Disable health checks",
+			f:    testUpdateLoadBalancerDisableHealthChecks,
+		},
+		{
+			name: "Update Load Balancer - Node weights",
+			f:    testUpdateLoadBalancerNodeWeights,
+		},
+		{
+			name: "Update Load Balancer - Duplicate configs",
+			f:    testUpdateLoadBalancerDuplicateConfigs,
+		},
+		{
+			name: "Update Load Balancer - HTTPS redirect",
+			f:    testUpdateLoadBalancerHTTPSRedirect,
+		},
+		{
+			name: "Ensure Load Balancer - Secondary account",
+			f:    testEnsureLoadBalancerSecondaryAccount,
+		},
+		{
+			name: "Ensure Load Balancer - Mixed protocols",
+			f:    testEnsureLoadBalancerMixedProtocols,
+		},
+		{
+			name: "Ensure Load Balancer - Default NodeBalancer",
+			f:    testEnsureLoadBalancerDefaultNodeBalancer,
+		},
+		{
+			name: "Ensure Load Balancer - Label template",
+			f:    testEnsureLoadBalancerLabelTemplate,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -209,7 +355,7 @@ func testCreateNodeBalancer(t *testing.T, client *linodego.Client, _ *fakeAPI) {
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	var nodes []*v1.Node
 	nb, err := lb.buildLoadBalancerRequest(context.TODO(), svc, nodes)
 	if err != nil {
@@ -288,7 +434,7 @@ func testUpdateLoadBalancerAddAnnotation(t *testing.T, client *linodego.Client,
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	fakeClientset := fake.NewSimpleClientset()
 	lb.kubeClient = fakeClientset
 
@@ -356,7 +502,7 @@ func testUpdateLoadBalancerAddPortAnnotation(t *testing.T, client *linodego.Clie
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	fakeClientset := fake.NewSimpleClientset()
 	lb.kubeClient = fakeClientset
 
@@ -443,7 +589,7 @@ func testUpdateLoadBalancerAddTLSPort(t *testing.T, client *linodego.Client, _ *
 		NodePort: int32(30001),
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 
 	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
 
@@ -502,6 +648,182 @@ func testUpdateLoadBalancerAddTLSPort(t *testing.T, client *linodego.Client, _ *
 	}
 }
 
+func testUpdateLoadBalancerChangeProtocol(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol: "tcp",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(443),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	nodes := []*v1.Node{
+		{
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+	addTLSSecret(t, lb.kubeClient)
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	getConfig := func() linodego.NodeBalancerConfig {
+		cfgs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+		if err != nil || len(cfgs) != 1 {
+			t.Fatalf("expected a single NodeBalancer config, got %v (%v)", cfgs, err)
+		}
+		nodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, cfgs[0].ID, nil)
+		if err != nil || len(nodes) != 1 {
+			t.Errorf("expected a single NodeBalancer node, got %v (%v)", nodes, err)
+		}
+		return cfgs[0]
+	}
+	update := func(annotations map[string]string) linodego.NodeBalancerConfig {
+		svc.SetAnnotations(annotations)
+		if err := lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+			t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+		}
+		return getConfig()
+	}
+
+	initial := getConfig()
+	if initial.Protocol != linodego.ProtocolTCP {
+		t.Fatalf("expected protocol tcp, got %s", initial.Protocol)
+	}
+
+	cfg := update(map[string]string{annLinodeDefaultProtocol: "http", annLinodeHealthCheckType: "connection"})
+	if cfg.Protocol != linodego.ProtocolHTTP || cfg.Check != linodego.CheckConnection {
+		t.Errorf("expected protocol http with a connection check, got %s with %s", cfg.Protocol, cfg.Check)
+	}
+	if cfg.ID != initial.ID {
+		t.Errorf("expected config %d to be updated in place, got config %d", initial.ID, cfg.ID)
+	}
+
+	cfg = update(map[string]string{annLinodePortTLSSecretPrefix + "443": "tls-secret"})
+	if cfg.Protocol != linodego.ProtocolHTTPS {
+		t.Errorf("expected protocol https, got %s", cfg.Protocol)
+	}
+	httpsID := cfg.ID
+
+	cfg = update(map[string]string{annLinodeDefaultProtocol: "tcp"})
+	if cfg.Protocol != linodego.ProtocolTCP {
+		t.Errorf("expected protocol tcp, got %s", cfg.Protocol)
+	}
+	if cfg.ID == httpsID {
+		t.Errorf("expected https config %d to be recreated", httpsID)
+	}
+}
+
+func Test_configNeedsUpdate(t *testing.T) {
+	current := linodego.NodeBalancerConfig{
+		ID:            1,
+		Port:          80,
+		Protocol:      linodego.ProtocolTCP,
+		Algorithm:     linodego.AlgorithmRoundRobin,
+		Check:         linodego.CheckConnection,
+		CheckInterval: 5,
+		SSLCert:       "<REDACTED>",
+		SSLKey:        "<REDACTED>",
+	}
+
+	desired := current
+	desired.ID = 0
+	desired.SSLCert, desired.SSLKey = "", ""
+	if configNeedsUpdate(current, desired) {
+		t.Error("expected matching config not to need an update")
+	}
+
+	desired.Protocol = linodego.ProtocolHTTP
+	if !configNeedsUpdate(current, desired) {
+		t.Error("expected protocol change to need an update")
+	}
+
+	desired = current
+	desired.CheckInterval = 10
+	if !configNeedsUpdate(current, desired) {
+		t.Error("expected health check change to need an update")
+	}
+
+	desired = current
+	desired.Protocol = linodego.ProtocolHTTPS
+	if !configNeedsUpdate(desired, desired) {
+		t.Error("expected https config to always be updated")
+	}
+	if configNeedsRecreate(current, desired) || !configNeedsRecreate(desired, current) {
+		t.Error("expected only https configs changing protocol to be recreated")
+	}
+
+	desired = current
+	desired.Protocol = protocolUDP
+	if !configNeedsRecreate(current, desired) || !configNeedsRecreate(desired, current) {
+		t.Error("expected configs switching to or from udp to be recreated")
+	}
+}
+
+func Test_buildNodeBalancerConfigUDP(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol: "http",
+				annLinodeHealthCheckType: "http",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Name: "dns", Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30053},
+				{Name: "http", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080},
+			},
+		},
+	}
+
+	lb := &loadbalancers{recorder: record.NewFakeRecorder(10)}
+
+	config, err := lb.buildNodeBalancerConfig(svc, 53)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Protocol != protocolUDP || config.Check != linodego.CheckConnection || config.CheckPath != "" || config.CheckPassive {
+		t.Errorf("expected a udp config with an active connection check, got %+v", config)
+	}
+
+	config, err = lb.buildNodeBalancerConfig(svc, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Protocol != linodego.ProtocolHTTP || config.Check != linodego.CheckHTTP || !config.CheckPassive {
+		t.Errorf("expected the tcp port to keep its http config, got %+v", config)
+	}
+}
+
 func testUpdateLoadBalancerAddProxyProtocol(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
 	nodes := []*v1.Node{
 		{
@@ -516,7 +838,7 @@ func testUpdateLoadBalancerAddProxyProtocol(t *testing.T, client *linodego.Clien
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	fakeClientset := fake.NewSimpleClientset()
 	lb.kubeClient = fakeClientset
 
@@ -571,7 +893,7 @@ func testUpdateLoadBalancerAddProxyProtocol(t *testing.T, client *linodego.Clien
 				t.Fatalf("failed to create NodeBalancer: %s", err)
 			}
 
-			svc.Status.LoadBalancer = *makeLoadBalancerStatus(nodeBalancer)
+			svc.Status.LoadBalancer = *makeLoadBalancerStatus(svc, nodeBalancer)
 			svc.ObjectMeta.SetAnnotations(map[string]string{
 				annLinodeProxyProtocol: string(tc.proxyProtocolConfig),
 			})
@@ -636,7 +958,7 @@ func testUpdateLoadBalancerAddNodeBalancerID(t *testing.T, client *linodego.Clie
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
+	lb := &loadbalancers{client: client, zone: "us-west"}
 	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
 
 	fakeClientset := fake.NewSimpleClientset()
@@ -649,7 +971,7 @@ func testUpdateLoadBalancerAddNodeBalancerID(t *testing.T, client *linodego.Clie
 		t.Fatalf("failed to create NodeBalancer: %s", err)
 	}
 
-	svc.Status.LoadBalancer = *makeLoadBalancerStatus(nodeBalancer)
+	svc.Status.LoadBalancer = *makeLoadBalancerStatus(svc, nodeBalancer)
 
 	newNodeBalancer, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
 		Region: lb.zone,
@@ -672,7 +994,7 @@ func testUpdateLoadBalancerAddNodeBalancerID(t *testing.T, client *linodego.Clie
 		t.Errorf("GetLoadBalancer returned an error: %s", err)
 	}
 
-	expectedLBStatus := makeLoadBalancerStatus(newNodeBalancer)
+	expectedLBStatus := makeLoadBalancerStatus(svc, newNodeBalancer)
 	if !reflect.DeepEqual(expectedLBStatus, lbStatus) {
 		t.Errorf("LoadBalancer status mismatch: expected %v, got %v", expectedLBStatus, lbStatus)
 	}
@@ -682,338 +1004,4994 @@ func testUpdateLoadBalancerAddNodeBalancerID(t *testing.T, client *linodego.Clie
 	}
 }
 
-func Test_getConnectionThrottle(t *testing.T) {
-	testcases := []struct {
-		name     string
-		service  *v1.Service
-		expected int
-	}{
-		{
-			"throttle not specified",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:        randString(10),
-					UID:         "abc123",
-					Annotations: map[string]string{},
-				},
-			},
-			20,
-		},
-		{
-			"throttle value is a string",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeThrottle: "foo",
-					},
-				},
+func testUpdateLoadBalancerDrainNodes(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDrainSeconds: "60",
 			},
-			20,
 		},
-		{
-			"throttle value is less than 0",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeThrottle: "-123",
-					},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
 				},
 			},
-			0,
 		},
+	}
+
+	nodes := []*v1.Node{
 		{
-			"throttle value is valid",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeThrottle: "1",
-					},
-				},
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
 			},
-			1,
 		},
 		{
-			"throttle value is too high",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeThrottle: "21",
-					},
-				},
+			ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.2"}},
 			},
-			20,
 		},
 	}
 
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
-			connThrottle := getConnectionThrottle(test.service)
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
 
-			if test.expected != connThrottle {
-				t.Fatalf("expected throttle value (%d) does not match actual value (%d)", test.expected, connThrottle)
-			}
-		})
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
 	}
-}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
 
-func Test_getPortConfig(t *testing.T) {
-	testcases := []struct {
-		name               string
-		service            *v1.Service
-		expectedPortConfig portConfig
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	getNodes := func() []linodego.NodeBalancerNode {
+		configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+		if err != nil || len(configs) != 1 {
+			t.Fatalf("failed to list NodeBalancer configs: %v", err)
+		}
+		nbNodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil)
+		if err != nil {
+			t.Fatalf("failed to list NodeBalancer nodes: %s", err)
+		}
+		return nbNodes
+	}
+
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes[:1]); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+
+	nbNodes := getNodes()
+	if len(nbNodes) != 2 {
+		t.Fatalf("expected removed node to be kept while draining, got %d nodes", len(nbNodes))
+	}
+	for _, node := range nbNodes {
+		expectedMode := linodego.ModeAccept
+		if node.Address == "127.0.0.2:30000" {
+			expectedMode = linodego.ModeDrain
+		}
+		if node.Mode != expectedMode {
+			t.Errorf("expected node (%s) mode to be %s; got %s", node.Address, expectedMode, node.Mode)
+		}
+	}
+
+	// simulate the grace period elapsing
+	for key := range lb.drains.draining {
+		lb.drains.draining[key] = time.Now().Add(-time.Minute)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes[:1]); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+
+	nbNodes = getNodes()
+	if len(nbNodes) != 1 || nbNodes[0].Address != "127.0.0.1:30000" {
+		t.Errorf("expected drained node to be removed after the grace period, got %v", nbNodes)
+	}
+	if len(lb.drains.draining) != 0 {
+		t.Errorf("expected no nodes to be tracked as draining, got %d", len(lb.drains.draining))
+	}
+}
+
+func testUpdateLoadBalancerLocalTrafficPolicy(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeLocal,
+		},
+	}
+
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.2"}},
+			},
+		},
+	}
+
+	nodeName := "node-2"
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: svc.Name},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: []v1.EndpointAddress{{IP: "10.2.0.5", NodeName: &nodeName}},
+		}},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+	if _, err := fakeClientset.CoreV1().Endpoints("").Create(endpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	getNodes := func() []linodego.NodeBalancerNode {
+		configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+		if err != nil || len(configs) != 1 {
+			t.Fatalf("failed to list NodeBalancer configs: %v", err)
+		}
+		nbNodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil)
+		if err != nil {
+			t.Fatalf("failed to list NodeBalancer nodes: %s", err)
+		}
+		return nbNodes
+	}
+
+	if nbNodes := getNodes(); len(nbNodes) != 1 || nbNodes[0].Address != "127.0.0.2:30000" {
+		t.Errorf("expected only the node running an endpoint to be a backend, got %v", nbNodes)
+	}
+
+	endpoints.Subsets = nil
+	if _, err = fakeClientset.CoreV1().Endpoints("").Update(endpoints); err != nil {
+		t.Fatal(err)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+
+	if nbNodes := getNodes(); len(nbNodes) != 0 {
+		t.Errorf("expected no backends without endpoints, got %v", nbNodes)
+	}
+}
+
+func testEnsureLoadBalancerSharedNodeBalancer(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	nodeBalancer, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Region: "us-west",
+	})
+	if err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+
+	newService := func(uid string, port int32) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: randString(10),
+				UID:  types.UID(uid),
+				Annotations: map[string]string{
+					annLinodeNodeBalancerID: strconv.Itoa(nodeBalancer.ID),
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{
+						Name:     randString(10),
+						Protocol: "TCP",
+						Port:     port,
+						NodePort: int32(30000),
+					},
+				},
+			},
+		}
+	}
+	svcA := newService("uid-a", 80)
+	svcB := newService("uid-b", 443)
+	svcC := newService("uid-c", 80)
+
+	nodes := []*v1.Node{
+		{
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+
+	for _, svc := range []*v1.Service{svcA, svcB} {
+		lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+		if err != nil {
+			t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+		}
+		svc.Status.LoadBalancer = *lbStatus
+	}
+
+	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nodeBalancer.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Errorf("expected shared NodeBalancer to have 2 configs, got %d", len(configs))
+	}
+
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svcC, nodes); err == nil {
+		t.Error("expected EnsureLoadBalancer to fail for a port used by another service")
+	}
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svcA); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if fakeAPI.didRequestOccur(http.MethodDelete, fmt.Sprintf("/nodebalancers/%d", nodeBalancer.ID), "") {
+		t.Fatal("expected shared NodeBalancer not to be deleted while in use by another service")
+	}
+
+	configs, err = client.ListNodeBalancerConfigs(context.TODO(), nodeBalancer.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Port != 443 {
+		t.Errorf("expected only the port 443 config to remain, got %v", configs)
+	}
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svcB); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if !fakeAPI.didRequestOccur(http.MethodDelete, fmt.Sprintf("/nodebalancers/%d", nodeBalancer.ID), "") {
+		t.Error("expected NodeBalancer to be deleted by its last service")
+	}
+}
+
+func testUpdateLoadBalancerReconcileIdentity(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "test", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeTags: "team:web, env:prod",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	expectedTags := []string{"ccm-cluster:test", "ccm-service-uid:foobar123", "ccm:80:foobar123", "env:prod", "team:web"}
+	if !reflect.DeepEqual(nb.Tags, expectedTags) {
+		t.Error("unexpected tags on creation")
+		t.Logf("expected: %v", expectedTags)
+		t.Logf("actual: %v", nb.Tags)
+	}
+	if *nb.Label != "ccm-foobar123-9f86d081" {
+		t.Errorf("expected label ccm-foobar123-9f86d081, got %s", *nb.Label)
+	}
+
+	renamed := "renamed"
+	stripped := []string{"manual"}
+	if _, err = client.UpdateNodeBalancer(context.TODO(), nb.ID, linodego.NodeBalancerUpdateOptions{Label: &renamed, Tags: &stripped}); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb.recorder = recorder
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "NodeBalancerRelabeled") || !strings.Contains(event, `from "renamed" to "ccm-foobar123-9f86d081"`) {
+			t.Errorf("expected a NodeBalancerRelabeled event, got %q", event)
+		}
+	default:
+		t.Error("expected a NodeBalancerRelabeled event")
+	}
+
+	nb, err = client.GetNodeBalancer(context.TODO(), nb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTags = []string{"ccm-cluster:test", "ccm-service-uid:foobar123", "ccm:80:foobar123", "env:prod", "manual", "team:web"}
+	if !reflect.DeepEqual(nb.Tags, expectedTags) {
+		t.Error("unexpected tags after reconciliation")
+		t.Logf("expected: %v", expectedTags)
+		t.Logf("actual: %v", nb.Tags)
+	}
+	if *nb.Label != "ccm-foobar123-9f86d081" {
+		t.Errorf("expected label to be restored to ccm-foobar123-9f86d081, got %s", *nb.Label)
+	}
+
+	svc.Annotations[annLinodeLabel] = "web-prod.lb"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+
+	nb, err = client.GetNodeBalancer(context.TODO(), nb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *nb.Label != "web-prod.lb" {
+		t.Errorf("expected label to be set from the annotation, got %s", *nb.Label)
+	}
+	if !reflect.DeepEqual(nb.Tags, expectedTags) {
+		t.Error("unexpected tags after relabeling")
+		t.Logf("expected: %v", expectedTags)
+		t.Logf("actual: %v", nb.Tags)
+	}
+}
+
+func testGetLoadBalancerOtherCluster(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "test", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	nb, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Region: "us-west",
+		Tags:   []string{clusterTagPrefix + "other", "ccm:80:other-uid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+	}
+	svc.Status.LoadBalancer = *makeLoadBalancerStatus(svc, nb)
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+
+	if _, exists, err := lb.GetLoadBalancer(context.TODO(), "lnodelb", svc); err != nil || exists {
+		t.Errorf("expected the other cluster's NodeBalancer not to be found by IP, got exists=%t (%v)", exists, err)
+	}
+
+	svc.Annotations = map[string]string{annLinodeNodeBalancerID: strconv.Itoa(nb.ID)}
+	if _, _, err := lb.GetLoadBalancer(context.TODO(), "lnodelb", svc); err == nil {
+		t.Error("expected an error for a nodebalancer-id annotation pointing to the other cluster's NodeBalancer")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodeBalancerInUse") {
+		t.Errorf("expected NodeBalancerInUse event, got %q", event)
+	}
+}
+
+func testGetLoadBalancerServiceUIDTag(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "test", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "web",
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	// A Service recreated under another name with the same UID and without a status still maps to
+	// the NodeBalancer.
+	renamed := svc.DeepCopy()
+	renamed.Name = "web-renamed"
+	renamed.Status = v1.ServiceStatus{}
+	status, exists, err := lb.GetLoadBalancer(context.TODO(), "lnodelb", renamed)
+	if err != nil || !exists {
+		t.Fatalf("expected the NodeBalancer to be found via its UID tag, got exists=%t (%v)", exists, err)
+	}
+	if status.Ingress[0].IP != lbStatus.Ingress[0].IP {
+		t.Errorf("expected the NodeBalancer with IP %s, got %s", lbStatus.Ingress[0].IP, status.Ingress[0].IP)
+	}
+
+	// NodeBalancers created before UID tags are found by their label, and tagged once reconciled.
+	legacySvc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "legacy",
+			UID:  "legacy-uid",
+		},
+		Spec: svc.Spec,
+	}
+	label := nodeBalancerLabel(legacySvc)
+	legacy, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Label:  &label,
+		Region: "us-west",
+		Tags:   []string{"ccm-cluster:test", "ccm:80:legacy-uid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), legacy.ID) }()
+	stubService(fakeClientset, legacySvc)
+
+	if _, exists, err = lb.GetLoadBalancer(context.TODO(), "lnodelb", legacySvc); err != nil || !exists {
+		t.Fatalf("expected the legacy NodeBalancer to be found via its label, got exists=%t (%v)", exists, err)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", legacySvc, []*v1.Node{}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	nb, err := client.GetNodeBalancer(context.TODO(), legacy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(nb.Tags, "ccm-service-uid:legacy-uid") {
+		t.Errorf("expected the legacy NodeBalancer to be tagged with the UID of its Service, got %v", nb.Tags)
+	}
+}
+
+func testEnsureLoadBalancerHostnameOnly(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeHostnameOnlyIngress: "true",
+				annLinodeHostname:            "app.example.com",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	expected := []v1.LoadBalancerIngress{{Hostname: "app.example.com"}}
+	if !reflect.DeepEqual(lbStatus.Ingress, expected) {
+		t.Errorf("expected ingress %v, got %v", expected, lbStatus.Ingress)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+
+	nb, err := lb.getNodeBalancerForService(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer from a hostname-only status: %s", err)
+	}
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
+
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	nbs, err := client.ListNodeBalancers(context.TODO(), nil)
+	if err != nil {
+		t.Fatalf("failed to list NodeBalancers: %s", err)
+	}
+	if len(nbs) != 1 {
+		t.Errorf("expected the NodeBalancer to be reused, found %d NodeBalancers", len(nbs))
+	}
+
+	invalid := svc.DeepCopy()
+	invalid.Annotations[annLinodeHostname] = "not a hostname"
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", invalid, nodes); err == nil {
+		t.Error("expected EnsureLoadBalancer to fail for an invalid hostname")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidHostname") {
+		t.Errorf("expected InvalidHostname event, got %q", event)
+	}
+}
+
+func testEnsureLoadBalancerSkipPort(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodePortSkipPrefix + "8080": "true",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Name: "http", Protocol: "TCP", Port: int32(80), NodePort: int32(30000)},
+				{Name: "admin", Protocol: "TCP", Port: int32(8080), NodePort: int32(30001)},
+			},
+		},
+	}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	ensure := func() *linodego.NodeBalancer {
+		lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+		if err != nil {
+			t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+		}
+		svc.Status.LoadBalancer = *lbStatus
+
+		nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+		if err != nil {
+			t.Fatalf("failed to get NodeBalancer: %s", err)
+		}
+		return nb
+	}
+	configPorts := func(nb *linodego.NodeBalancer) []int {
+		configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+		if err != nil {
+			t.Fatalf("failed to list NodeBalancer configs: %s", err)
+		}
+		ports := make([]int, 0, len(configs))
+		for _, config := range configs {
+			ports = append(ports, config.Port)
+		}
+		sort.Ints(ports)
+		return ports
+	}
+
+	nb := ensure()
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
+
+	if ports := configPorts(nb); !reflect.DeepEqual(ports, []int{80}) {
+		t.Errorf("expected only port 80 to have a config, got %v", ports)
+	}
+	if owners := getPortOwners(nb); len(owners) != 1 || owners[80] != "foobar123" {
+		t.Errorf("expected only port 80 to be owned by the service, got %v", owners)
+	}
+
+	delete(svc.Annotations, annLinodePortSkipPrefix+"8080")
+	nb = ensure()
+	if ports := configPorts(nb); !reflect.DeepEqual(ports, []int{80, 8080}) {
+		t.Errorf("expected port 8080 to be added back, got %v", ports)
+	}
+
+	svc.Annotations[annLinodePortSkipPrefix+"8080"] = "true"
+	nb = ensure()
+	if ports := configPorts(nb); !reflect.DeepEqual(ports, []int{80}) {
+		t.Errorf("expected the config of port 8080 to be deleted, got %v", ports)
+	}
+}
+
+func testEnsureLoadBalancerReservedIPv4(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeReservedIPv4: "203.0.113.10",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: int32(80), NodePort: int32(30000)}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil); err == nil {
+		t.Fatal("expected EnsureLoadBalancer to refuse creating a NodeBalancer with a reserved IPv4 address")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "ReservedIPv4Unsupported") {
+		t.Errorf("expected ReservedIPv4Unsupported event, got %q", event)
+	}
+	nbs, err := client.ListNodeBalancers(context.TODO(), nil)
+	if err != nil {
+		t.Fatalf("failed to list NodeBalancers: %s", err)
+	}
+	if len(nbs) != 0 {
+		t.Errorf("expected no NodeBalancer to be created, got %v", nbs)
+	}
+}
+
+func testEnsureLoadBalancerRegion(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeRegion: "eu-west",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	newNode := func(name, address, region string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{kubeletapis.LabelZoneRegion: region},
+			},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: address}},
+			},
+		}
+	}
+	nodes := []*v1.Node{
+		newNode("node-1", "127.0.0.1", "us-west"),
+		newNode("node-2", "127.0.0.2", "eu-west"),
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
+
+	if nb.Region != "eu-west" {
+		t.Errorf("expected NodeBalancer in region eu-west, got %s", nb.Region)
+	}
+
+	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil || len(configs) != 1 {
+		t.Fatalf("failed to list NodeBalancer configs: %v", err)
+	}
+	nbNodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil)
+	if err != nil {
+		t.Fatalf("failed to list NodeBalancer nodes: %s", err)
+	}
+	if len(nbNodes) != 1 || nbNodes[0].Address != "127.0.0.2:30000" {
+		t.Errorf("expected only the node in eu-west to be a backend, got %v", nbNodes)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodesOutsideRegion") || !strings.Contains(event, "node-1") {
+		t.Errorf("expected NodesOutsideRegion event for node-1, got %q", event)
+	}
+
+	invalid := svc.DeepCopy()
+	invalid.Status = v1.ServiceStatus{}
+	invalid.Annotations[annLinodeRegion] = "mars-north"
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", invalid, nodes); err == nil {
+		t.Error("expected EnsureLoadBalancer to fail for an unknown region")
+	}
+}
+
+func testEnsureLoadBalancerFirewall(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeFirewallACL: `{"allowList": {"ipv4": ["203.0.113.7"]}}`,
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	nodes := []*v1.Node{
+		{
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	owned, err := lb.getServiceFirewall(context.TODO(), svc)
+	if err != nil || owned == nil {
+		t.Fatalf("expected a firewall to be created for the service: %v", err)
+	}
+	expectedRule := linodego.FirewallRule{
+		Ports:     "80",
+		Protocol:  linodego.TCP,
+		Addresses: linodego.NetworkAddresses{IPv4: []string{"203.0.113.7/32"}, IPv6: []string{}},
+	}
+	if !reflect.DeepEqual(owned.Rules.Inbound, []linodego.FirewallRule{expectedRule}) {
+		t.Errorf("unexpected firewall rules: %v", owned.Rules.Inbound)
+	}
+	if devices := fakeAPI.fwd[owned.ID]; len(devices) != 1 || devices[0].Entity.ID != nb.ID {
+		t.Errorf("expected firewall to be attached to NodeBalancer (%d), got %v", nb.ID, devices)
+	}
+
+	svc.Annotations[annLinodeFirewallACL] = `{"allowList": {"ipv4": ["198.51.100.0/24"]}}`
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if rules := fakeAPI.fw[owned.ID].Rules.Inbound; len(rules) != 1 || rules[0].Addresses.IPv4[0] != "198.51.100.0/24" {
+		t.Errorf("expected firewall rules to be updated, got %v", rules)
+	}
+
+	existing, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{Label: "existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Annotations[annLinodeFirewallID] = strconv.Itoa(existing.ID)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "FirewallACLIgnored") {
+		t.Errorf("expected FirewallACLIgnored event, got %q", event)
+	}
+	if _, found := fakeAPI.fw[owned.ID]; found {
+		t.Error("expected the firewall created for the ACL to be deleted")
+	}
+	if devices := fakeAPI.fwd[existing.ID]; len(devices) != 1 || devices[0].Entity.ID != nb.ID {
+		t.Errorf("expected existing firewall to be attached to NodeBalancer (%d), got %v", nb.ID, devices)
+	}
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if _, found := fakeAPI.fw[existing.ID]; !found {
+		t.Error("expected the firewall referenced by ID not to be deleted")
+	}
+}
+
+func testEnsureLoadBalancerFirewallIDChange(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	first, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{Label: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{Label: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeFirewallID: strconv.Itoa(first.ID),
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	nodes := []*v1.Node{
+		{
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: record.NewFakeRecorder(10)}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	expectAttached := func(firewallID int, attached bool) {
+		t.Helper()
+		devices := fakeAPI.fwd[firewallID]
+		if attached && (len(devices) != 1 || devices[0].Entity.ID != nb.ID) {
+			t.Errorf("expected firewall (%d) to be attached to NodeBalancer (%d), got %v", firewallID, nb.ID, devices)
+		}
+		if !attached && len(devices) != 0 {
+			t.Errorf("expected firewall (%d) not to be attached, got %v", firewallID, devices)
+		}
+	}
+	expectAttached(first.ID, true)
+
+	// The attachment is recorded on the firewall, so it is detached after a restart too.
+	if !containsString(fakeAPI.fw[first.ID].Tags, firewallAttachedTag(svc)) {
+		t.Errorf("expected the attachment to be recorded by the firewall's tags, got %v", fakeAPI.fw[first.ID].Tags)
+	}
+	lb.firewallNames = firewallNameCache{}
+
+	svc.Annotations[annLinodeFirewallID] = strconv.Itoa(second.ID)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectAttached(first.ID, false)
+	expectAttached(second.ID, true)
+	if containsString(fakeAPI.fw[first.ID].Tags, firewallAttachedTag(svc)) {
+		t.Errorf("expected the tag of the detached firewall to be removed, got %v", fakeAPI.fw[first.ID].Tags)
+	}
+
+	lb.firewallNames = firewallNameCache{}
+	delete(svc.Annotations, annLinodeFirewallID)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectAttached(second.ID, false)
+	if len(fakeAPI.fw[second.ID].Tags) != 0 {
+		t.Errorf("expected the tag of the detached firewall to be removed, got %v", fakeAPI.fw[second.ID].Tags)
+	}
+	for _, id := range []int{first.ID, second.ID} {
+		if _, found := fakeAPI.fw[id]; !found {
+			t.Errorf("expected the firewall (%d) referenced by ID not to be deleted", id)
+		}
+	}
+}
+
+func testEnsureLoadBalancerSharedFirewall(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	rules := linodego.FirewallRuleSet{Inbound: []linodego.FirewallRule{{
+		Ports:     "443",
+		Protocol:  linodego.TCP,
+		Addresses: linodego.NetworkAddresses{IPv4: []string{"192.0.2.0/24"}, IPv6: []string{}},
+	}}}
+	shared, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{
+		Label:   "shared",
+		Rules:   rules,
+		Devices: linodego.DevicesCreationOptions{NodeBalancers: []int{999}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeFirewallID: strconv.Itoa(shared.ID),
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	expectDevices := func(stage string, nbIDs ...int) {
+		var attached []int
+		for _, device := range fakeAPI.fwd[shared.ID] {
+			attached = append(attached, device.Entity.ID)
+		}
+		sort.Ints(attached)
+		sort.Ints(nbIDs)
+		if !reflect.DeepEqual(attached, nbIDs) {
+			t.Errorf("%s: expected firewall to be attached to NodeBalancers %v, got %v", stage, nbIDs, attached)
+		}
+		if !reflect.DeepEqual(fakeAPI.fw[shared.ID].Rules, rules) {
+			t.Errorf("%s: expected firewall rules to be untouched, got %v", stage, fakeAPI.fw[shared.ID].Rules)
+		}
+	}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+	expectDevices("create", nb.ID, 999)
+
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectDevices("update", nb.ID, 999)
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if _, found := fakeAPI.fw[shared.ID]; !found {
+		t.Fatal("expected the shared firewall not to be deleted")
+	}
+	expectDevices("delete", 999)
+}
+
+func testEnsureLoadBalancerCreationDisabled(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder, disableCreation: true}
+
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil); err == nil {
+		t.Fatal("expected EnsureLoadBalancer to fail without a NodeBalancer ID")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodeBalancerCreationDisabled") {
+		t.Errorf("expected NodeBalancerCreationDisabled event, got %q", event)
+	}
+	if len(fakeAPI.nb) != 0 {
+		t.Errorf("expected no NodeBalancer to be created, got %d", len(fakeAPI.nb))
+	}
+
+	nodeBalancer, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+	if err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+	svc.Annotations = map[string]string{annLinodeNodeBalancerID: strconv.Itoa(nodeBalancer.ID)}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	if nb, err := lb.getNodeBalancerForService(context.TODO(), svc); err != nil || nb.ID != nodeBalancer.ID {
+		t.Errorf("expected the referenced NodeBalancer (%d) to be used, got %v (%v)", nodeBalancer.ID, nb, err)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Errorf("expected no NodeBalancer to be created, got %d", len(fakeAPI.nb))
+	}
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+}
+
+func testEnsureLoadBalancerSourceRanges(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+			LoadBalancerSourceRanges: []string{"203.0.113.0/24", "2001:db8::/32"},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	owned, err := lb.getServiceFirewall(context.TODO(), svc)
+	if err != nil || owned == nil {
+		t.Fatalf("expected a firewall to be created for the source ranges: %v", err)
+	}
+	expectedRule := linodego.FirewallRule{
+		Ports:     "80",
+		Protocol:  linodego.TCP,
+		Addresses: linodego.NetworkAddresses{IPv4: []string{"203.0.113.0/24"}, IPv6: []string{"2001:db8::/32"}},
+	}
+	if !reflect.DeepEqual(owned.Rules.Inbound, []linodego.FirewallRule{expectedRule}) {
+		t.Errorf("unexpected firewall rules: %v", owned.Rules.Inbound)
+	}
+	if devices := fakeAPI.fwd[owned.ID]; len(devices) != 1 || devices[0].Entity.ID != nb.ID {
+		t.Errorf("expected firewall to be attached to NodeBalancer (%d), got %v", nb.ID, devices)
+	}
+
+	svc.Spec.LoadBalancerSourceRanges = []string{"198.51.100.0/24"}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if owned, _ = lb.getServiceFirewall(context.TODO(), svc); owned == nil || !reflect.DeepEqual(owned.Rules.Inbound[0].Addresses.IPv4, []string{"198.51.100.0/24"}) {
+		t.Errorf("expected firewall rules to follow the source ranges, got %v", owned)
+	}
+
+	existing, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{Label: "existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Annotations = map[string]string{annLinodeFirewallID: strconv.Itoa(existing.ID)}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "SourceRangesIgnored") {
+		t.Errorf("expected SourceRangesIgnored event, got %q", event)
+	}
+	if _, found := fakeAPI.fw[owned.ID]; found {
+		t.Error("expected the firewall created for the source ranges to be deleted")
+	}
+
+	delete(svc.Annotations, annLinodeFirewallID)
+	svc.Spec.LoadBalancerSourceRanges = []string{"not-a-cidr"}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err == nil {
+		t.Fatal("expected UpdateLoadBalancer to fail for invalid source ranges")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidSourceRanges") {
+		t.Errorf("expected InvalidSourceRanges event, got %q", event)
+	}
+
+	svc.Spec.LoadBalancerSourceRanges = []string{"198.51.100.0/24"}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if owned, _ = lb.getServiceFirewall(context.TODO(), svc); owned != nil {
+		t.Errorf("expected the firewall of the source ranges to be deleted with the service, got %v", owned)
+	}
+}
+
+func Test_getFirewallRules(t *testing.T) {
+	svc := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Port: 80}, {Port: 443}},
+		},
+	}
+
+	rules, err := getFirewallRules(svc, `{"allowList": {"ipv4": ["10.0.0.0/8"], "ipv6": ["2001:db8::1"]}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := linodego.FirewallRuleSet{
+		Inbound: []linodego.FirewallRule{{
+			Ports:     "80,443",
+			Protocol:  linodego.TCP,
+			Addresses: linodego.NetworkAddresses{IPv4: []string{"10.0.0.0/8"}, IPv6: []string{"2001:db8::1/128"}},
+		}},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Error("unexpected firewall rules")
+		t.Logf("expected: %v", expected)
+		t.Logf("actual: %v", rules)
+	}
+
+	udpSvc := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Port: 53, Protocol: v1.ProtocolUDP}, {Port: 8053, Protocol: v1.ProtocolTCP}},
+		},
+	}
+	rules, err = getFirewallRules(udpSvc, `{"allowList": {"ipv4": ["10.0.0.0/8"]}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules.Inbound) != 2 || rules.Inbound[0].Protocol != linodego.TCP || rules.Inbound[0].Ports != "8053" ||
+		rules.Inbound[1].Protocol != linodego.UDP || rules.Inbound[1].Ports != "53" {
+		t.Errorf("expected a TCP rule for port 8053 and a UDP rule for port 53, got %v", rules.Inbound)
+	}
+
+	for _, acl := range []string{
+		`not json`,
+		`{}`,
+		`{"allowList": {"ipv4": ["10.0.0.1"]}, "denyList": {"ipv4": ["10.0.0.2"]}}`,
+		`{"allowList": {"ipv4": ["2001:db8::1"]}}`,
+		`{"allowList": {"ipv4": ["bogus"]}}`,
+		`{"allowList": {"ipv4": ["10.0.0.1"]}, "ports": [0]}`,
+	} {
+		if _, err := getFirewallRules(svc, acl); err == nil {
+			t.Errorf("expected an error for ACL %s", acl)
+		}
+	}
+}
+
+func testEnsureLoadBalancerDryRun(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	nodeBalancer, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Region: "us-west",
+	})
+	if err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+
+	mutatingRequests := func() int {
+		count := 0
+		for req := range fakeAPI.requests {
+			if req.Method != http.MethodGet {
+				count++
+			}
+		}
+		return count
+	}
+	before := mutatingRequests()
+
+	existing := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeNodeBalancerID: strconv.Itoa(nodeBalancer.ID),
+				annLinodeThrottle:       "5",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+	created := existing.DeepCopy()
+	created.Name = randString(10)
+	created.Annotations = map[string]string{}
+
+	nodes := []*v1.Node{
+		{
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west", dryRun: true}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", existing, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if lbStatus.Ingress[0].IP != *nodeBalancer.IPv4 {
+		t.Errorf("expected status of existing NodeBalancer, got %v", lbStatus)
+	}
+
+	lbStatus, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", created, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if len(lbStatus.Ingress) != 0 {
+		t.Errorf("expected empty status for NodeBalancer created in dry-run mode, got %v", lbStatus)
+	}
+
+	existing.Status.LoadBalancer = *makeLoadBalancerStatus(existing, nodeBalancer)
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", existing); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+
+	if after := mutatingRequests(); after != before {
+		t.Errorf("expected no mutating requests in dry-run mode, got %d", after-before)
+	}
+}
+
+func Test_getConnectionThrottle(t *testing.T) {
+	testcases := []struct {
+		name     string
+		service  *v1.Service
+		expected int
+	}{
+		{
+			"throttle not specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        randString(10),
+					UID:         "abc123",
+					Annotations: map[string]string{},
+				},
+			},
+			20,
+		},
+		{
+			"throttle value is a string",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeThrottle: "foo",
+					},
+				},
+			},
+			20,
+		},
+		{
+			"throttle value is less than 0",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeThrottle: "-123",
+					},
+				},
+			},
+			0,
+		},
+		{
+			"throttle value is valid",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeThrottle: "1",
+					},
+				},
+			},
+			1,
+		},
+		{
+			"throttle value is too high",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeThrottle: "21",
+					},
+				},
+			},
+			20,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			connThrottle := getConnectionThrottle(test.service)
+
+			if test.expected != connThrottle {
+				t.Fatalf("expected throttle value (%d) does not match actual value (%d)", test.expected, connThrottle)
+			}
+		})
+	}
+}
+
+func TestEnsureLoadBalancerWaitsForIP(t *testing.T) {
+	fake := newFake(t)
+	var mu sync.Mutex
+	pendingGets := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isCreate := r.Method == http.MethodPost && r.URL.Path == "/nodebalancers"
+		isGet := r.Method == http.MethodGet && strings.Count(r.URL.Path, "/") == 2 && strings.HasPrefix(r.URL.Path, "/nodebalancers/")
+
+		mu.Lock()
+		withoutIP := isCreate || (isGet && pendingGets > 0)
+		if isGet && pendingGets > 0 {
+			pendingGets--
+		}
+		mu.Unlock()
+		if !withoutIP {
+			fake.ServeHTTP(w, r)
+			return
+		}
+
+		// Simulate a NodeBalancer whose IPv4 address is still being assigned.
+		rec := httptest.NewRecorder()
+		fake.ServeHTTP(rec, r)
+		var nb map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &nb); err != nil {
+			t.Fatal(err)
+		}
+		nb["ipv4"] = nil
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(rec.Code)
+		_ = json.NewEncoder(w).Encode(nb)
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	nodeBalancerIPPollInterval = 10 * time.Millisecond
+	Options.NodeBalancerIPTimeout = time.Second
+	defer func() {
+		nodeBalancerIPPollInterval = 2 * time.Second
+		Options.NodeBalancerIPTimeout = 0
+	}()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: record.NewFakeRecorder(10)}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if len(lbStatus.Ingress) != 1 || lbStatus.Ingress[0].IP == "" {
+		t.Errorf("expected the ingress to have the IP assigned after the wait, got %v", lbStatus.Ingress)
+	}
+	if pendingGets != 0 {
+		t.Errorf("expected the NodeBalancer to be polled until it has an IP, %d polls left", pendingGets)
+	}
+
+	svc.Status.LoadBalancer = *lbStatus
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	mu.Lock()
+	pendingGets = 1 << 30
+	mu.Unlock()
+	Options.NodeBalancerIPTimeout = 50 * time.Millisecond
+	nb.IPv4 = nil
+	if _, err = lb.waitForNodeBalancerIP(context.TODO(), svc, nb); err == nil || !strings.Contains(err.Error(), "wasn't assigned an IPv4 address") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestUpdateLoadBalancerIdentityFailure(t *testing.T) {
+	fakeAPI := newFake(t)
+	var mu sync.Mutex
+	failUpdate := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failUpdate && r.Method == http.MethodPut && strings.Count(r.URL.Path, "/") == 2 && strings.HasPrefix(r.URL.Path, "/nodebalancers/")
+		mu.Unlock()
+		if !fail {
+			fakeAPI.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors": [{"reason": "Invalid tags"}]}`))
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: record.NewFakeRecorder(10)}
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	// Tags removed from the dashboard are restored, and the failure of that update is reported
+	// for the NodeBalancer.
+	fakeAPI.nb[strconv.Itoa(nb.ID)].Tags = nil
+	mu.Lock()
+	failUpdate = true
+	mu.Unlock()
+	err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if expected := fmt.Sprintf("error reconciling label and tags of NodeBalancer (%d)", nb.ID); err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected an error reconciling the label and tags, got %v", err)
+	}
+}
+
+func TestThrottleCollapsedOnChange(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodePortThrottlePrefix + "80":  "5",
+				annLinodePortThrottlePrefix + "443": "10",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000},
+				{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30001},
+			},
+		},
+	}
+
+	collapsedEvents := func(recorder *record.FakeRecorder) int {
+		count := 0
+		for len(recorder.Events) > 0 {
+			if strings.Contains(<-recorder.Events, "ThrottleCollapsed") {
+				count++
+			}
+		}
+		return count
+	}
+
+	fakeClientset := fake.NewSimpleClientset()
+	recorder := record.NewFakeRecorder(100)
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	if count := collapsedEvents(recorder); count != 1 {
+		t.Errorf("expected a ThrottleCollapsed event on create, got %d", count)
+	}
+
+	// The throttle already applied isn't reported again.
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if count := collapsedEvents(recorder); count != 0 {
+		t.Errorf("expected no ThrottleCollapsed event for an unchanged throttle, got %d", count)
+	}
+
+	svc.Annotations[annLinodePortThrottlePrefix+"80"] = "15"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if count := collapsedEvents(recorder); count != 1 {
+		t.Errorf("expected a ThrottleCollapsed event for the changed throttle, got %d", count)
+	}
+}
+
+func TestEnsureLoadBalancerDeletedRetriesFirewallDeletion(t *testing.T) {
+	fakeAPI := newFake(t)
+	var mu sync.Mutex
+	failDelete := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failDelete && r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/networking/firewalls/")
+		failDelete = failDelete && !fail
+		mu.Unlock()
+		if !fail {
+			fakeAPI.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors": [{"reason": "Firewall is busy"}]}`))
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeFirewallACL: `{"allowList": {"ipv4": ["203.0.113.7"]}}`},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: record.NewFakeRecorder(10)}
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	if len(fakeAPI.fw) != 1 {
+		t.Fatalf("expected a firewall to be created for the service, got %d", len(fakeAPI.fw))
+	}
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err == nil {
+		t.Fatal("expected the failed firewall deletion to fail the deletion")
+	}
+	if len(fakeAPI.nb) != 0 {
+		t.Fatalf("expected the NodeBalancer to be deleted, got %d", len(fakeAPI.nb))
+	}
+
+	// The retry doesn't find the NodeBalancer anymore, and still deletes the firewall.
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if len(fakeAPI.fw) != 0 {
+		t.Errorf("expected the firewall of the service to be deleted, got %d", len(fakeAPI.fw))
+	}
+}
+
+func TestGetNodeBalancerForServiceListsOnce(t *testing.T) {
+	fakeAPI := newFake(t)
+	var mu sync.Mutex
+	lists := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/nodebalancers" {
+			mu.Lock()
+			lists++
+			mu.Unlock()
+		}
+		fakeAPI.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+	if _, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Service whose NodeBalancer is gone goes through every lookup.
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: randString(10), UID: "foobar123"},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "203.0.113.1"}}},
+		},
+	}
+	lb := &loadbalancers{client: &client, zone: "us-west"}
+	if _, err := lb.getNodeBalancerForService(context.TODO(), svc); err == nil {
+		t.Fatal("expected no NodeBalancer to be found")
+	} else if _, ok := err.(lbNotFoundError); !ok {
+		t.Fatalf("expected lbNotFoundError, got %v", err)
+	}
+	if lists != 1 {
+		t.Errorf("expected the NodeBalancers to be listed once, got %d lists", lists)
+	}
+}
+
+func TestEnsureLoadBalancerAdoptsPartiallyCreatedNodeBalancer(t *testing.T) {
+	fakeAPI := newFake(t)
+	var mu sync.Mutex
+	failCreate := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failCreate && r.Method == http.MethodPost && r.URL.Path == "/nodebalancers"
+		failCreate = failCreate && !fail
+		mu.Unlock()
+		if !fail {
+			fakeAPI.ServeHTTP(w, r)
+			return
+		}
+
+		// Simulate a creation failing after the NodeBalancer was created, but not its configs.
+		var createOpts map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&createOpts); err != nil {
+			t.Fatal(err)
+		}
+		delete(createOpts, "configs")
+		raw, err := json.Marshal(createOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fakeAPI.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.Method, r.URL.String(), strings.NewReader(string(raw))))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"errors": [{"reason": "Internal server error"}]}`))
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fake.NewSimpleClientset()}
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err == nil {
+		t.Fatal("expected EnsureLoadBalancer to fail with the creation")
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Fatalf("expected the failed creation to leave a NodeBalancer, got %d", len(fakeAPI.nb))
+	}
+
+	// The next reconcile adopts the NodeBalancer and adds its missing config.
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Errorf("expected the NodeBalancer to be adopted instead of creating another one, got %d NodeBalancers", len(fakeAPI.nb))
+	}
+
+	svc.Status.LoadBalancer = *lbStatus
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil {
+		t.Fatalf("failed to list NodeBalancer configs: %s", err)
+	}
+	if len(configs) != 1 || configs[0].Port != 80 {
+		t.Fatalf("expected the config of port 80 to be created, got %+v", configs)
+	}
+	if len(fakeAPI.nbn) != 1 {
+		t.Errorf("expected the node to be added to the config, got %d nodes", len(fakeAPI.nbn))
+	}
+}
+
+func TestUpdateLoadBalancerDrainsRemovedPorts(t *testing.T) {
+	fakeAPI := newFake(t)
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			mu.Lock()
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+		}
+		fakeAPI.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	Options.ConfigDrainGracePeriod = 50 * time.Millisecond
+	defer func() { Options.ConfigDrainGracePeriod = 0 }()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000},
+				{Name: "admin", Protocol: "TCP", Port: 8080, NodePort: 30001},
+			},
+		},
+	}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+			},
+		},
+	}
+
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset}
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	configIDs := make(map[int]int)
+	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil {
+		t.Fatalf("failed to list NodeBalancer configs: %s", err)
+	}
+	for _, config := range configs {
+		configIDs[config.Port] = config.ID
+	}
+	removedNodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configIDs[8080], nil)
+	if err != nil || len(removedNodes) != 1 {
+		t.Fatalf("expected a node in the config of port 8080, got %v (%v)", removedNodes, err)
+	}
+
+	mu.Lock()
+	requests = nil
+	mu.Unlock()
+
+	// The sync returns once the nodes are drained, and the config is deleted by the first sync
+	// after the grace period.
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	Options.ConfigDrainGracePeriod = time.Hour
+	start := time.Now()
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Minute {
+		t.Errorf("expected the sync not to wait for the grace period, took %s", elapsed)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+
+	configRequests := func() []string {
+		var filtered []string
+		for _, request := range requests {
+			if strings.Contains(request, "/configs/") {
+				filtered = append(filtered, request)
+			}
+		}
+		return filtered
+	}
+	drain := fmt.Sprintf("PUT /nodebalancers/%d/configs/%d/nodes/%d", nb.ID, configIDs[8080], removedNodes[0].ID)
+	deleteConfig := fmt.Sprintf("DELETE /nodebalancers/%d/configs/%d", nb.ID, configIDs[8080])
+	if filtered := configRequests(); len(filtered) != 1 || filtered[0] != drain {
+		t.Errorf("expected the node of port 8080 to be drained and its config kept during the grace period, got %v", filtered)
+	}
+
+	Options.ConfigDrainGracePeriod = 50 * time.Millisecond
+	time.Sleep(Options.ConfigDrainGracePeriod)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if filtered := configRequests(); len(filtered) != 2 || filtered[1] != deleteConfig {
+		t.Errorf("expected the config of port 8080 to be deleted after the grace period, got %v", filtered)
+	}
+	for _, request := range requests {
+		if strings.Contains(request, fmt.Sprintf("/configs/%d/", configIDs[80])) {
+			t.Errorf("expected the config of port 80 to be left alone, got %s", request)
+		}
+	}
+
+	// Configs are deleted right away when the Service is being deleted.
+	svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Name: "admin", Protocol: "TCP", Port: 8080, NodePort: 30001})
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	deletionTimestamp := metav1.Now()
+	svc.DeletionTimestamp = &deletionTimestamp
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	mu.Lock()
+	requests = nil
+	mu.Unlock()
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if len(requests) == 0 || !strings.HasPrefix(requests[0], "DELETE") {
+		t.Errorf("expected the config to be deleted without draining, got %v", requests)
+	}
+}
+
+func TestEnsureLoadBalancerWaitsForBackends(t *testing.T) {
+	fake := newFake(t)
+	var mu sync.Mutex
+	pendingLists := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		fake.ServeHTTP(rec, r)
+
+		mu.Lock()
+		defer mu.Unlock()
+		isList := r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/nodes")
+		if !isList || pendingLists <= 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(rec.Code)
+			_, _ = w.Write(rec.Body.Bytes())
+			return
+		}
+		pendingLists--
+
+		// Simulate backends whose health checks haven't passed yet.
+		var page map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range page["data"].([]interface{}) {
+			node.(map[string]interface{})["status"] = "DOWN"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(rec.Code)
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	backendStatusPollInterval = 10 * time.Millisecond
+	defer func() {
+		backendStatusPollInterval = 5 * time.Second
+		Options.WaitForBackendsStrict = false
+	}()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeWaitForBackends: "1s"},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}}},
+	}}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: &client, zone: "us-west", recorder: recorder}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	mu.Lock()
+	if pendingLists != 0 {
+		t.Errorf("expected the backends to be polled until they are UP, %d polls left", pendingLists)
+	}
+	mu.Unlock()
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event for backends UP in time, got %q", <-recorder.Events)
+	}
+
+	svc.Status.LoadBalancer = *lbStatus
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+
+	mu.Lock()
+	pendingLists = 1 << 30
+	mu.Unlock()
+	svc.Annotations[annLinodeWaitForBackends] = "50ms"
+	if err = lb.waitForBackends(context.TODO(), svc, nb); err != nil {
+		t.Errorf("expected backends that aren't UP in time only to be reported, got %s", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "BackendsNotUp") || !strings.Contains(event, "port(s) 80") {
+		t.Errorf("expected BackendsNotUp event, got %q", event)
+	}
+
+	Options.WaitForBackendsStrict = true
+	if err = lb.waitForBackends(context.TODO(), svc, nb); err == nil || !strings.Contains(err.Error(), "is UP after 50ms") {
+		t.Errorf("expected a timeout error in strict mode, got %v", err)
+	}
+}
+
+func Test_makeLoadBalancerStatus(t *testing.T) {
+	ipv4 := "192.0.2.1"
+	ipv6 := "2001:db8::1"
+	hostname := "nb-192-0-2-1.newark.nodebalancer.linode.com"
+	nb := &linodego.NodeBalancer{IPv4: &ipv4, IPv6: &ipv6, Hostname: &hostname}
+
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		nb          *linodego.NodeBalancer
+		expected    []v1.LoadBalancerIngress
+	}{
+		{
+			"IPv6 ingress not enabled",
+			map[string]string{},
+			nb,
+			[]v1.LoadBalancerIngress{{IP: ipv4, Hostname: hostname}},
+		},
+		{
+			"IPv6 ingress enabled",
+			map[string]string{annLinodeEnableIPv6Ingress: "true"},
+			nb,
+			[]v1.LoadBalancerIngress{{IP: ipv4, Hostname: hostname}, {IP: ipv6}},
+		},
+		{
+			"IPv6 ingress disabled",
+			map[string]string{annLinodeEnableIPv6Ingress: "false"},
+			nb,
+			[]v1.LoadBalancerIngress{{IP: ipv4, Hostname: hostname}},
+		},
+		{
+			"IPv6 ingress enabled without IPv6 address",
+			map[string]string{annLinodeEnableIPv6Ingress: "true"},
+			&linodego.NodeBalancer{IPv4: &ipv4, Hostname: &hostname},
+			[]v1.LoadBalancerIngress{{IP: ipv4, Hostname: hostname}},
+		},
+		{
+			"custom hostname",
+			map[string]string{annLinodeHostname: "app.example.com"},
+			nb,
+			[]v1.LoadBalancerIngress{{IP: ipv4, Hostname: "app.example.com"}},
+		},
+		{
+			"invalid custom hostname",
+			map[string]string{annLinodeHostname: "App_Example"},
+			nb,
+			[]v1.LoadBalancerIngress{{IP: ipv4, Hostname: hostname}},
+		},
+		{
+			"hostname only",
+			map[string]string{annLinodeHostnameOnlyIngress: "true", annLinodeEnableIPv6Ingress: "true"},
+			nb,
+			[]v1.LoadBalancerIngress{{Hostname: hostname}},
+		},
+		{
+			"hostname only with custom hostname",
+			map[string]string{annLinodeHostnameOnlyIngress: "true", annLinodeHostname: "app.example.com"},
+			nb,
+			[]v1.LoadBalancerIngress{{Hostname: "app.example.com"}},
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        randString(10),
+					UID:         "abc123",
+					Annotations: test.annotations,
+				},
+			}
+
+			status := makeLoadBalancerStatus(svc, test.nb)
+			if !reflect.DeepEqual(status.Ingress, test.expected) {
+				t.Errorf("expected ingress %v, got %v", test.expected, status.Ingress)
+			}
+		})
+	}
+}
+
+func Test_getPortProxyProtocol(t *testing.T) {
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		expected    linodego.ConfigProxyProtocol
+		err         bool
+	}{
+		{
+			"proxy protocol not specified",
+			map[string]string{},
+			linodego.ProxyProtocolNone,
+			false,
+		},
+		{
+			"service proxy protocol",
+			map[string]string{annLinodeProxyProtocol: "v1"},
+			linodego.ProxyProtocolV1,
+			false,
+		},
+		{
+			"port proxy protocol overrides service proxy protocol",
+			map[string]string{
+				annLinodeProxyProtocol:                  "v1",
+				annLinodePortProxyProtocolPrefix + "80": "v2",
+			},
+			linodego.ProxyProtocolV2,
+			false,
+		},
+		{
+			"port proxy protocol for another port",
+			map[string]string{annLinodePortProxyProtocolPrefix + "443": "v2"},
+			linodego.ProxyProtocolNone,
+			false,
+		},
+		{
+			"invalid port proxy protocol",
+			map[string]string{annLinodePortProxyProtocolPrefix + "80": "v3"},
+			"",
+			true,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			proxyProtocol, err := getPortProxyProtocol(svc, 80)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if proxyProtocol != test.expected {
+				t.Error("unexpected proxy protocol")
+				t.Logf("expected: %q", test.expected)
+				t.Logf("actual: %q", proxyProtocol)
+			}
+		})
+	}
+}
+
+func Test_buildNodeBalancerConfigProxyProtocol(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol:                  "http",
+				annLinodePortConfigPrefix + "9000":        `{"protocol": "tcp"}`,
+				annLinodePortProxyProtocolPrefix + "9000": "v2",
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{recorder: recorder}
+
+	config, err := lb.buildNodeBalancerConfig(svc, 9000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.ProxyProtocol != linodego.ProxyProtocolV2 {
+		t.Errorf("expected ProxyProtocol to be %s; got %s", linodego.ProxyProtocolV2, config.ProxyProtocol)
+	}
+
+	config, err = lb.buildNodeBalancerConfig(svc, 80)
+	if err != nil || config.ProxyProtocol != linodego.ProxyProtocolNone {
+		t.Errorf("expected http port to have no proxy protocol; got %s (%v)", config.ProxyProtocol, err)
+	}
+
+	svc.Annotations[annLinodePortProxyProtocolPrefix+"80"] = "v1"
+	if _, err = lb.buildNodeBalancerConfig(svc, 80); err == nil {
+		t.Fatal("expected an error for proxy protocol on an http port")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidProxyProtocol") {
+		t.Errorf("expected InvalidProxyProtocol event, got %q", event)
+	}
+}
+
+func Test_buildNodeBalancerConfigHealthCheck(t *testing.T) {
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		expected    linodego.NodeBalancerConfig
+		err         bool
+	}{
+		{
+			"connection check ignores http settings",
+			map[string]string{
+				annLinodeHealthCheckType:     "connection",
+				annLinodeCheckPath:           "/healthz",
+				annLinodeCheckBody:           "ok",
+				annLinodeHealthCheckInterval: "3",
+				annLinodeHealthCheckTimeout:  "1",
+				annLinodeHealthCheckAttempts: "5",
+			},
+			linodego.NodeBalancerConfig{Check: linodego.CheckConnection, CheckInterval: 3, CheckTimeout: 1, CheckAttempts: 5},
+			false,
+		},
+		{
+			"http check",
+			map[string]string{
+				annLinodeHealthCheckType: "http",
+				annLinodeCheckPath:       "/healthz",
+			},
+			linodego.NodeBalancerConfig{Check: linodego.CheckHTTP, CheckPath: "/healthz", CheckInterval: 5, CheckTimeout: 3, CheckAttempts: 2},
+			false,
+		},
+		{
+			"interval not greater than timeout",
+			map[string]string{
+				annLinodeHealthCheckType:     "connection",
+				annLinodeHealthCheckInterval: "3",
+				annLinodeHealthCheckTimeout:  "3",
+			},
+			linodego.NodeBalancerConfig{},
+			true,
+		},
+		{
+			"no attempts",
+			map[string]string{
+				annLinodeHealthCheckType:     "connection",
+				annLinodeHealthCheckAttempts: "0",
+			},
+			linodego.NodeBalancerConfig{},
+			true,
+		},
+		{
+			// The check annotations are ignored and kept at their defaults.
+			"no check isn't validated",
+			map[string]string{
+				annLinodeHealthCheckType:     "none",
+				annLinodeHealthCheckAttempts: "0",
+			},
+			linodego.NodeBalancerConfig{Check: linodego.CheckNone, CheckInterval: 5, CheckTimeout: 3, CheckAttempts: 2},
+			false,
+		},
+		{
+			"invalid check type",
+			map[string]string{annLinodeHealthCheckType: "tcp"},
+			linodego.NodeBalancerConfig{},
+			true,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: test.annotations}}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			config, err := lb.buildNodeBalancerConfig(svc, 9000)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.err {
+				if event := <-recorder.Events; !strings.Contains(event, "InvalidHealthCheck") {
+					t.Errorf("expected InvalidHealthCheck event, got %q", event)
+				}
+				return
+			}
+
+			actual := linodego.NodeBalancerConfig{
+				Check:         config.Check,
+				CheckPath:     config.CheckPath,
+				CheckBody:     config.CheckBody,
+				CheckInterval: config.CheckInterval,
+				CheckTimeout:  config.CheckTimeout,
+				CheckAttempts: config.CheckAttempts,
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Error("unexpected health check")
+				t.Logf("expected: %+v", test.expected)
+				t.Logf("actual: %+v", actual)
+			}
+		})
+	}
+}
+
+func Test_nodeBalancerLabel(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{UID: "6e5a4f2b-8d3c-4b1a-9f0e-7c6d5b4a3e2f"}}
+
+	if label := nodeBalancerLabel(svc); label != "ccm-6e5a4f2b8d3c4b1a9f0e7c6d5b4a" {
+		t.Errorf("unexpected label without cluster name: %s", label)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "test", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	label := nodeBalancerLabel(svc)
+	if label != "ccm-6e5a4f2b8d3c4b1a9f0-9f86d081" {
+		t.Errorf("unexpected label with cluster name: %s", label)
+	}
+	if len(label) > 32 {
+		t.Errorf("label %s is longer than 32 characters", label)
+	}
+}
+
+func Test_getNodeBalancerLabel(t *testing.T) {
+	testcases := []struct {
+		name     string
+		label    string
+		expected string
+		invalid  bool
+	}{
+		{"valid", "web_prod-1.lb", "web_prod-1.lb", false},
+		{"too short", "ab", "ccm-foobar123", true},
+		{"too long", strings.Repeat("a", 33), "ccm-foobar123", true},
+		{"invalid character", "web prod", "ccm-foobar123", true},
+		{"ends with hyphen", "web-", "ccm-foobar123", true},
+		{"repeated separator", "web--prod", "ccm-foobar123", true},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					UID:         "foobar123",
+					Annotations: map[string]string{annLinodeLabel: test.label},
+				},
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			if label := lb.getNodeBalancerLabel(svc); label != test.expected {
+				t.Errorf("expected label %q, got %q", test.expected, label)
+			}
+			if test.invalid {
+				if event := <-recorder.Events; !strings.Contains(event, "InvalidLabel") {
+					t.Errorf("expected InvalidLabel event, got %q", event)
+				}
+			} else if len(recorder.Events) != 0 {
+				t.Errorf("expected no event for a valid label, got %q", <-recorder.Events)
+			}
+		})
+	}
+}
+
+func Test_getNodeBalancerLabelTemplate(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "prod-cluster", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	generated := nodeBalancerLabel(&v1.Service{ObjectMeta: metav1.ObjectMeta{UID: "foo-bar-123"}})
+	testcases := []struct {
+		name        string
+		template    string
+		annotations map[string]string
+		expected    string
+		invalid     bool
+	}{
+		{name: "no template", expected: generated},
+		{name: "service and cluster", template: "{{ .Labels.env }}-{{ .Cluster }}-{{ .Name }}", expected: "staging-prod-cluster-web"},
+		{name: "namespace and uid", template: "{{ .Namespace }}.{{ .UID }}", expected: "shop.foobar123"},
+		{name: "label annotation takes precedence", template: "{{ .Name }}-lb", annotations: map[string]string{annLinodeLabel: "custom"}, expected: "custom"},
+		{name: "truncated", template: "{{ .Labels.env }}-{{ .Cluster }}-abcdefghijklmn-{{ .Name }}", expected: "staging-prod-cluster-abcdefghijk"},
+		{name: "truncated before a separator", template: "{{ .Labels.env }}-{{ .Cluster }}-abcdefghij-{{ .Name }}", expected: "staging-prod-cluster-abcdefghij"},
+		{name: "missing key", template: "{{ .Labels.team }}-{{ .Name }}", expected: generated, invalid: true},
+		{name: "invalid character", template: "{{ .Namespace }}/{{ .Name }}", expected: generated, invalid: true},
+		{name: "too short", template: `{{ printf "%.2s" .Name }}`, expected: generated, invalid: true},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "web",
+					Namespace:   "shop",
+					UID:         "foo-bar-123",
+					Labels:      map[string]string{"env": "staging"},
+					Annotations: test.annotations,
+				},
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder, defaults: loadBalancerConfig{NodeBalancerLabelTemplate: test.template}}
+
+			if label := lb.getNodeBalancerLabel(svc); label != test.expected {
+				t.Errorf("expected label %q, got %q", test.expected, label)
+			}
+			if test.invalid {
+				if event := <-recorder.Events; !strings.Contains(event, "InvalidLabelTemplate") {
+					t.Errorf("expected InvalidLabelTemplate event, got %q", event)
+				}
+			} else if len(recorder.Events) != 0 {
+				t.Errorf("expected no event for a valid label, got %q", <-recorder.Events)
+			}
+		})
+	}
+}
+
+func testEnsureLoadBalancerLabelTemplate(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "shop",
+			UID:       "foobar123",
+			Labels:    map[string]string{"env": "staging"},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west", defaults: loadBalancerConfig{NodeBalancerLabelTemplate: "{{ .Labels.env }}-{{ .Name }}"}}
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *nb.Label != "staging-web" {
+		t.Errorf("expected NodeBalancer label staging-web, got %s", *nb.Label)
+	}
+
+	// NodeBalancers are found by their tags, so a new template relabels the NodeBalancer rather
+	// than orphaning it.
+	lb.defaults.NodeBalancerLabelTemplate = "{{ .Namespace }}-{{ .Name }}"
+	svc.Status = v1.ServiceStatus{}
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Fatalf("expected the NodeBalancer to be kept, got %d NodeBalancers", len(fakeAPI.nb))
+	}
+	if relabeled := fakeAPI.nb[strconv.Itoa(nb.ID)]; relabeled == nil || *relabeled.Label != "shop-web" {
+		t.Errorf("expected NodeBalancer (%d) to be relabeled shop-web, got %v", nb.ID, relabeled)
+	}
+
+	// Let the deferred EnsureLoadBalancerDeleted find the NodeBalancer.
+	svc.Status.LoadBalancer = *lbStatus
+}
+
+func Test_buildNodeBalancerTagsTemplates(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "test", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "billing",
+			UID:       "foobar123",
+			Annotations: map[string]string{
+				annLinodeTags: "team:{namespace}, app:{service}, {cluster}, env:prod",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Port: 80}},
+		},
+	}
+
+	testcases := []struct {
+		name     string
+		tags     []string
+		expected []string
+	}{
+		{
+			"new NodeBalancer",
+			nil,
+			[]string{"app:web", "ccm-cluster:test", "ccm-service-uid:foobar123", "ccm:80:foobar123", "env:prod", "team:billing", "test"},
+		},
+		{
+			"stale expansions are replaced",
+			[]string{"team:payments", "app:web", "manual", "ccm:80:foobar123"},
+			[]string{"app:web", "ccm-cluster:test", "ccm-service-uid:foobar123", "ccm:80:foobar123", "env:prod", "manual", "team:billing", "test"},
+		},
+		{
+			"tags of other Services sharing the NodeBalancer are kept",
+			[]string{"team:payments", "ccm:443:other-uid"},
+			[]string{"app:web", "ccm-cluster:test", "ccm-service-uid:foobar123", "ccm:443:other-uid", "ccm:80:foobar123", "env:prod", "team:billing", "team:payments", "test"},
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			tags := buildNodeBalancerTags(&linodego.NodeBalancer{Tags: test.tags}, svc)
+			if !reflect.DeepEqual(tags, test.expected) {
+				t.Errorf("expected tags %v, got %v", test.expected, tags)
+			}
+			if again := buildNodeBalancerTags(&linodego.NodeBalancer{Tags: tags}, svc); !reflect.DeepEqual(again, tags) {
+				t.Errorf("expected expansion to be idempotent, got %v then %v", tags, again)
+			}
+		})
+	}
+
+	Options.ClusterNameFlag = nil
+	if tags := buildNodeBalancerTags(&linodego.NodeBalancer{}, svc); containsString(tags, "") || len(tags) != 5 {
+		t.Errorf("expected {cluster} to be skipped without a cluster name, got %v", tags)
+	}
+}
+
+func Test_getNodePort(t *testing.T) {
+	ports := []v1.ServicePort{
+		{Port: 80, NodePort: 30080},
+		{Port: 443, NodePort: 30443},
+	}
+
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		portRange   utilnet.PortRange
+		unallocated bool
+		expected    int32
+		err         bool
+		event       string
+	}{
+		{
+			name:     "no override",
+			expected: 30080,
+		},
+		{
+			name:        "no NodePort allocated",
+			unallocated: true,
+			err:         true,
+			event:       "NodePortNotAllocated",
+		},
+		{
+			name:        "override without NodePort allocated",
+			annotations: map[string]string{annLinodePortNodePortPrefix + "80": "31000"},
+			unallocated: true,
+			expected:    31000,
+		},
+		{
+			name:        "override in the default range",
+			annotations: map[string]string{annLinodePortNodePortPrefix + "80": "31000"},
+			expected:    31000,
+		},
+		{
+			name:        "override outside the default range",
+			annotations: map[string]string{annLinodePortNodePortPrefix + "80": "8080"},
+			err:         true,
+			event:       "InvalidNodePort",
+		},
+		{
+			name:        "override in an allowed range",
+			annotations: map[string]string{annLinodePortNodePortPrefix + "80": "8080"},
+			portRange:   utilnet.PortRange{Base: 8000, Size: 1000},
+			expected:    8080,
+		},
+		{
+			name:        "invalid override",
+			annotations: map[string]string{annLinodePortNodePortPrefix + "80": "http"},
+			err:         true,
+			event:       "InvalidNodePort",
+		},
+		{
+			name:        "override conflicting with another NodePort",
+			annotations: map[string]string{annLinodePortNodePortPrefix + "80": "30443"},
+			expected:    30443,
+			event:       "NodePortConflict",
+		},
+		{
+			name:        "override of another port",
+			annotations: map[string]string{annLinodePortNodePortPrefix + "443": "31000"},
+			expected:    30080,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			Options.NodePortRange = test.portRange
+			defer func() { Options.NodePortRange = utilnet.PortRange{} }()
+
+			// Services with allocateLoadBalancerNodePorts set to false have no NodePorts.
+			ports := append([]v1.ServicePort(nil), ports...)
+			if test.unallocated {
+				for i := range ports {
+					ports[i].NodePort = 0
+				}
+			}
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: test.annotations},
+				Spec:       v1.ServiceSpec{Ports: ports},
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			nodePort, err := lb.getNodePort(svc, ports[0])
+			if test.err != (err != nil) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if nodePort != test.expected {
+				t.Errorf("expected node port %d, got %d", test.expected, nodePort)
+			}
+
+			var event string
+			if len(recorder.Events) > 0 {
+				event = <-recorder.Events
+			}
+			if !strings.Contains(event, test.event) || (test.event == "" && event != "") {
+				t.Errorf("expected event %q, got %q", test.event, event)
+			}
+		})
+	}
+}
+
+func Test_getPortAlgorithm(t *testing.T) {
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		expected    linodego.ConfigAlgorithm
+		err         bool
+	}{
+		{
+			"algorithm not specified",
+			map[string]string{},
+			linodego.AlgorithmRoundRobin,
+			false,
+		},
+		{
+			"service algorithm",
+			map[string]string{annLinodeAlgorithm: "leastconn"},
+			linodego.AlgorithmLeastConn,
+			false,
+		},
+		{
+			"port algorithm overrides service algorithm",
+			map[string]string{
+				annLinodeAlgorithm:                  "leastconn",
+				annLinodePortAlgorithmPrefix + "80": "source",
+			},
+			linodego.AlgorithmSource,
+			false,
+		},
+		{
+			"port algorithm for another port",
+			map[string]string{annLinodePortAlgorithmPrefix + "443": "source"},
+			linodego.AlgorithmRoundRobin,
+			false,
+		},
+		{
+			"invalid port algorithm",
+			map[string]string{annLinodePortAlgorithmPrefix + "80": "wrr"},
+			"",
+			true,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			algorithm, err := getPortAlgorithm(svc, 80)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if algorithm != test.expected {
+				t.Error("unexpected algorithm")
+				t.Logf("expected: %q", test.expected)
+				t.Logf("actual: %q", algorithm)
+			}
+		})
+	}
+}
+
+func Test_buildNodeBalancerConfigAlgorithm(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			Annotations: map[string]string{
+				annLinodePortAlgorithmPrefix + "80": "leastconn",
+			},
+		},
+		Spec: v1.ServiceSpec{SessionAffinity: v1.ServiceAffinityClientIP},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{recorder: recorder}
+
+	config, err := lb.buildNodeBalancerConfig(svc, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Algorithm != linodego.AlgorithmLeastConn {
+		t.Errorf("expected Algorithm to be %s; got %s", linodego.AlgorithmLeastConn, config.Algorithm)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "SessionAffinityIgnored") {
+		t.Errorf("expected SessionAffinityIgnored event, got %q", event)
+	}
+
+	svc.Annotations[annLinodePortAlgorithmPrefix+"80"] = "source"
+	if _, err = lb.buildNodeBalancerConfig(svc, 80); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event for the source algorithm, got %q", <-recorder.Events)
+	}
+
+	svc.Annotations[annLinodePortAlgorithmPrefix+"80"] = "random"
+	if _, err = lb.buildNodeBalancerConfig(svc, 80); err == nil {
+		t.Fatal("expected an error for an unknown algorithm")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidAlgorithm") {
+		t.Errorf("expected InvalidAlgorithm event, got %q", event)
+	}
+}
+
+func Test_buildNodeBalancerConfigSessionAffinity(t *testing.T) {
+	timeout := int32(600)
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: randString(10)},
+		Spec: v1.ServiceSpec{
+			SessionAffinity: v1.ServiceAffinityClientIP,
+			SessionAffinityConfig: &v1.SessionAffinityConfig{
+				ClientIP: &v1.ClientIPConfig{TimeoutSeconds: &timeout},
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{recorder: recorder}
+
+	config, err := lb.buildNodeBalancerConfig(svc, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Algorithm != linodego.AlgorithmSource {
+		t.Errorf("expected Algorithm to be %s; got %s", linodego.AlgorithmSource, config.Algorithm)
+	}
+	if config.Stickiness != linodego.StickinessTable {
+		t.Errorf("expected Stickiness to be %s; got %s", linodego.StickinessTable, config.Stickiness)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "SessionAffinityTimeoutIgnored") || !strings.Contains(event, "600 seconds") {
+		t.Errorf("expected SessionAffinityTimeoutIgnored event, got %q", event)
+	}
+
+	svc.Spec.SessionAffinity = v1.ServiceAffinityNone
+	svc.Spec.SessionAffinityConfig = nil
+	if config, err = lb.buildNodeBalancerConfig(svc, 80); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Algorithm != linodego.AlgorithmRoundRobin || config.Stickiness != "" {
+		t.Errorf("expected the default algorithm without stickiness, got %s and %q", config.Algorithm, config.Stickiness)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event without session affinity, got %q", <-recorder.Events)
+	}
+}
+
+func Test_buildNodeBalancerConfigCheckBodyMatch(t *testing.T) {
+	testcases := []struct {
+		name     string
+		body     string
+		match    string
+		expected string
+		err      string
+	}{
+		{name: "default", body: `"status":\s*"ok"`, expected: `"status":\s*"ok"`},
+		{name: "regex", body: `"status":\s*"(ok|degraded)"`, match: "regex", expected: `"status":\s*"(ok|degraded)"`},
+		{name: "substring", body: `{"status": "ok"}`, match: "substring", expected: `\{"status": "ok"\}`},
+		{name: "invalid regex", body: `"status": (ok`, match: "regex", err: "invalid regex"},
+		{name: "invalid match", body: "ok", match: "exact", err: `invalid value "exact"`},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: map[string]string{
+				annLinodeHealthCheckType: "http_body",
+				annLinodeCheckBody:       test.body,
+			}}}
+			if test.match != "" {
+				svc.Annotations[annLinodeCheckBodyMatch] = test.match
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			config, err := lb.buildNodeBalancerConfig(svc, 80)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				if event := <-recorder.Events; !strings.Contains(event, "InvalidCheckBody") {
+					t.Errorf("expected InvalidCheckBody event, got %q", event)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if config.CheckBody != test.expected {
+				t.Errorf("expected check body %q, got %q", test.expected, config.CheckBody)
+			}
+			if test.match == "substring" && !regexp.MustCompile(config.CheckBody).MatchString(`[{"status": "ok"}]`) {
+				t.Errorf("expected check body %q to match the body literally", config.CheckBody)
+			}
+		})
+	}
+}
+
+func Test_buildNodeBalancerConfigHTTPCheckModes(t *testing.T) {
+	testcases := []struct {
+		name         string
+		annotations  map[string]string
+		expectedBody string
+		event        string
+		err          string
+	}{
+		{
+			name:        "status check",
+			annotations: map[string]string{annLinodeHealthCheckType: "http", annLinodeCheckPath: "/healthz"},
+		},
+		{
+			name:        "status check ignores the body",
+			annotations: map[string]string{annLinodeHealthCheckType: "http", annLinodeCheckPath: "/healthz", annLinodeCheckBody: "ok"},
+			event:       "CheckBodyIgnored",
+		},
+		{
+			name:         "body check",
+			annotations:  map[string]string{annLinodeHealthCheckType: "http_body", annLinodeCheckPath: "/healthz", annLinodeCheckBody: "ok"},
+			expectedBody: "ok",
+		},
+		{
+			name:        "body check without a body",
+			annotations: map[string]string{annLinodeHealthCheckType: "http_body", annLinodeCheckPath: "/healthz"},
+			event:       "InvalidHealthCheck",
+			err:         "requires the regex matching the response body of /healthz",
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: test.annotations}}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			config, err := lb.buildNodeBalancerConfig(svc, 80)
+			switch {
+			case test.event == "" && len(recorder.Events) != 0:
+				t.Errorf("expected no event, got %q", <-recorder.Events)
+			case test.event != "" && len(recorder.Events) == 0:
+				t.Errorf("expected a %s event, got none", test.event)
+			case test.event != "":
+				if event := <-recorder.Events; !strings.Contains(event, test.event) {
+					t.Errorf("expected a %s event, got %q", test.event, event)
+				}
+			}
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if config.Check != linodego.ConfigCheck(test.annotations[annLinodeHealthCheckType]) || config.CheckPath != "/healthz" {
+				t.Errorf("expected a %s check of /healthz, got a %s check of %q", test.annotations[annLinodeHealthCheckType], config.Check, config.CheckPath)
+			}
+			if config.CheckBody != test.expectedBody {
+				t.Errorf("expected check body %q, got %q", test.expectedBody, config.CheckBody)
+			}
+		})
+	}
+}
+
+func Test_buildNodeBalancerConfigChecksDisabled(t *testing.T) {
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		protocol    v1.Protocol
+		passive     bool
+		ignored     bool
+	}{
+		{
+			name:        "service-wide",
+			annotations: map[string]string{annLinodeHealthCheckType: "none"},
+		},
+		{
+			name:        "port",
+			annotations: map[string]string{annLinodeHealthCheckType: "http", annLinodePortCheckTypePrefix + "80": "none"},
+		},
+		{
+			name:        "udp port",
+			annotations: map[string]string{annLinodePortCheckTypePrefix + "80": "none"},
+			protocol:    v1.ProtocolUDP,
+		},
+		{
+			name:        "passive checks only",
+			annotations: map[string]string{annLinodeHealthCheckType: "none", annLinodeHealthCheckPassive: "true"},
+			passive:     true,
+		},
+		{
+			name: "other check annotations are ignored",
+			annotations: map[string]string{
+				annLinodeHealthCheckType:     "none",
+				annLinodeCheckPath:           "/healthz",
+				annLinodeCheckBody:           "ok",
+				annLinodeHealthCheckInterval: "invalid",
+				annLinodeHealthCheckTimeout:  "60",
+			},
+			ignored: true,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			protocol := test.protocol
+			if protocol == "" {
+				protocol = v1.ProtocolTCP
+			}
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: test.annotations},
+				Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "test", Protocol: protocol, Port: 80, NodePort: 30000}}},
+			}
+			if err := validateServiceAnnotations(svc); err != nil {
+				t.Fatalf("unexpected invalid annotations: %s", err)
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			config, err := lb.buildNodeBalancerConfig(svc, 80)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if config.Check != linodego.CheckNone || config.CheckPassive != test.passive {
+				t.Errorf("expected check %s with passive checks %t, got %s with %t", linodego.CheckNone, test.passive, config.Check, config.CheckPassive)
+			}
+			if config.CheckPath != "" || config.CheckBody != "" || config.CheckInterval != 5 || config.CheckTimeout != 3 || config.CheckAttempts != 2 {
+				t.Errorf("expected the settings of active checks to be ignored, got %+v", config)
+			}
+			if test.ignored {
+				if event := <-recorder.Events; !strings.Contains(event, "HealthCheckAnnotationsIgnored") || !strings.Contains(event, annLinodeCheckPath) {
+					t.Errorf("expected a HealthCheckAnnotationsIgnored event, got %q", event)
+				}
+			} else if len(recorder.Events) != 0 {
+				t.Errorf("expected no event, got %q", <-recorder.Events)
+			}
+		})
+	}
+
+	// Passive checks alone aren't supported on UDP ports.
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: map[string]string{annLinodeHealthCheckType: "none", annLinodeHealthCheckPassive: "true"}},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "dns", Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30000}}},
+	}
+	if err := validateServiceAnnotations(svc); err == nil || !strings.Contains(err.Error(), "doesn't support the passive checks") {
+		t.Errorf("expected passive checks on a udp port to be invalid, got %v", err)
+	}
+}
+
+func Test_buildNodeBalancerConfigCheckPassive(t *testing.T) {
+	testcases := []struct {
+		name     string
+		check    string
+		passive  string
+		expected bool
+	}{
+		{name: "default with active checks", check: "http", expected: true},
+		{name: "default without active checks", check: "none", expected: false},
+		{name: "enabled with active checks", check: "http", passive: "true", expected: true},
+		{name: "disabled with active checks", check: "http", passive: "false", expected: false},
+		{name: "enabled without active checks", check: "none", passive: "true", expected: true},
+		{name: "disabled without active checks", check: "none", passive: "false", expected: false},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			annotations := map[string]string{annLinodeHealthCheckType: test.check, annLinodeCheckPath: "/healthz"}
+			if test.passive != "" {
+				annotations[annLinodeHealthCheckPassive] = test.passive
+			}
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: annotations},
+				Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "test", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30000}}},
+			}
+			lb := &loadbalancers{recorder: record.NewFakeRecorder(10)}
+
+			config, err := lb.buildNodeBalancerConfig(svc, 80)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if config.Check != linodego.ConfigCheck(test.check) {
+				t.Errorf("expected the passive checks to leave check %s, got %s", test.check, config.Check)
+			}
+			if config.CheckPassive != test.expected {
+				t.Errorf("expected passive checks %t, got %t", test.expected, config.CheckPassive)
+			}
+		})
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: map[string]string{annLinodeHealthCheckPassive: "sometimes"}},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "test", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30000}}},
+	}
+	lb := &loadbalancers{recorder: record.NewFakeRecorder(10)}
+	if _, err := lb.buildNodeBalancerConfig(svc, 80); err == nil || !strings.Contains(err.Error(), "must be a bool") {
+		t.Errorf("expected an invalid value error, got %v", err)
+	}
+}
+
+func Test_buildNodeBalancerConfigStickiness(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		affinity    v1.ServiceAffinity
+		stickiness  linodego.ConfigStickiness
+		event       string
+	}{
+		{
+			name:        "none",
+			annotations: map[string]string{annLinodePortStickinessPrefix + "80": "none"},
+			stickiness:  linodego.StickinessNone,
+		},
+		{
+			name:        "table",
+			annotations: map[string]string{annLinodePortStickinessPrefix + "80": "table"},
+			stickiness:  linodego.StickinessTable,
+		},
+		{
+			name: "http_cookie",
+			annotations: map[string]string{
+				annLinodeDefaultProtocol:             "http",
+				annLinodePortStickinessPrefix + "80": "http_cookie",
+			},
+			stickiness: linodego.StickinessHTTPCookie,
+		},
+		{
+			name: "http_cookie overrides ClientIP affinity",
+			annotations: map[string]string{
+				annLinodeDefaultProtocol:             "http",
+				annLinodePortStickinessPrefix + "80": "http_cookie",
+			},
+			affinity:   v1.ServiceAffinityClientIP,
+			stickiness: linodego.StickinessHTTPCookie,
+		},
+		{
+			name:        "http_cookie on tcp port",
+			annotations: map[string]string{annLinodePortStickinessPrefix + "80": "http_cookie"},
+			event:       "port 80: stickiness http_cookie requires protocol http or https, not tcp",
+		},
+		{
+			name:        "invalid stickiness",
+			annotations: map[string]string{annLinodePortStickinessPrefix + "80": "cookie"},
+			event:       "invalid NodeBalancer stickiness value 'cookie' for port 80",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: test.annotations},
+				Spec:       v1.ServiceSpec{SessionAffinity: test.affinity},
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			config, err := lb.buildNodeBalancerConfig(svc, 80)
+			if test.event != "" {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if event := <-recorder.Events; !strings.Contains(event, "InvalidStickiness") || !strings.Contains(event, test.event) {
+					t.Errorf("expected InvalidStickiness event %q, got %q", test.event, event)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if config.Stickiness != test.stickiness {
+				t.Errorf("expected Stickiness to be %s; got %s", test.stickiness, config.Stickiness)
+			}
+		})
+	}
+}
+
+func Test_buildNodeBalancerConfigCipherSuite(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		port        int
+		cipherSuite linodego.ConfigCipher
+		event       string
+	}{
+		{
+			name:        "https defaults to recommended",
+			annotations: map[string]string{annLinodePortTLSSecretPrefix + "443": "tls-secret"},
+			port:        443,
+			cipherSuite: linodego.CipherRecommended,
+		},
+		{
+			name: "legacy",
+			annotations: map[string]string{
+				annLinodePortTLSSecretPrefix + "443": "tls-secret",
+				annLinodePortSSLCipherPrefix + "443": "legacy",
+			},
+			port:        443,
+			cipherSuite: linodego.CipherLegacy,
+		},
+		{
+			name:        "tcp has no cipher suite",
+			annotations: map[string]string{},
+			port:        80,
+		},
+		{
+			name:        "cipher suite on tcp port",
+			annotations: map[string]string{annLinodePortSSLCipherPrefix + "80": "recommended"},
+			port:        80,
+			event:       "port 80 uses protocol tcp, but cipher suites only apply to https",
+		},
+		{
+			name: "invalid cipher suite",
+			annotations: map[string]string{
+				annLinodePortTLSSecretPrefix + "443": "tls-secret",
+				annLinodePortSSLCipherPrefix + "443": "modern",
+			},
+			port:  443,
+			event: "invalid NodeBalancer cipher suite value 'modern' for port 443",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: randString(10), Annotations: test.annotations},
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder, kubeClient: fake.NewSimpleClientset()}
+			addTLSSecret(t, lb.kubeClient)
+
+			config, err := lb.buildNodeBalancerConfig(svc, test.port)
+			if test.event != "" {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if event := <-recorder.Events; !strings.Contains(event, "InvalidSSLCipher") || !strings.Contains(event, test.event) {
+					t.Errorf("expected InvalidSSLCipher event %q, got %q", test.event, event)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if config.CipherSuite != test.cipherSuite {
+				t.Errorf("expected CipherSuite to be %q; got %q", test.cipherSuite, config.CipherSuite)
+			}
+		})
+	}
+}
+
+func Test_buildNodeBalancerConfigTimeout(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			Annotations: map[string]string{
+				annLinodePortTimeoutPrefix + "443": "300",
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{recorder: recorder}
+
+	if _, err := lb.buildNodeBalancerConfig(svc, 443); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "TimeoutUnsupported") || !strings.Contains(event, "port 443") {
+		t.Errorf("expected TimeoutUnsupported event, got %q", event)
+	}
+
+	if _, err := lb.buildNodeBalancerConfig(svc, 80); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event for a port without a timeout, got %q", <-recorder.Events)
+	}
+}
+
+func Test_getPortConnectionThrottle(t *testing.T) {
+	testcases := []struct {
+		name     string
+		service  *v1.Service
+		expected int
+		err      error
+	}{
+		{
+			"port throttle not specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeThrottle: "10",
+					},
+				},
+			},
+			10,
+			nil,
+		},
+		{
+			"port throttle overrides service throttle",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeThrottle:                  "10",
+						annLinodePortThrottlePrefix + "80": "5",
+					},
+				},
+			},
+			5,
+			nil,
+		},
+		{
+			"port throttle disabled",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortThrottlePrefix + "80": "0",
+					},
+				},
+			},
+			0,
+			nil,
+		},
+		{
+			"port throttle is out of range",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeThrottle:                  "10",
+						annLinodePortThrottlePrefix + "80": "21",
+					},
+				},
+			},
+			10,
+			fmt.Errorf("invalid throttle %q for port %d: must be a number between 0 and 20", "21", 80),
+		},
+		{
+			"port throttle is a string",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortThrottlePrefix + "80": "foo",
+					},
+				},
+			},
+			20,
+			fmt.Errorf("invalid throttle %q for port %d: must be a number between 0 and 20", "foo", 80),
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			connThrottle, err := getPortConnectionThrottle(test.service, 80)
+
+			if test.expected != connThrottle {
+				t.Fatalf("expected throttle value (%d) does not match actual value (%d)", test.expected, connThrottle)
+			}
+
+			if !reflect.DeepEqual(err, test.err) {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.err)
+				t.Logf("actual: %v", err)
+			}
+		})
+	}
+}
+
+func Test_getNodeBalancerThrottle(t *testing.T) {
+	testcases := []struct {
+		name        string
+		annotations map[string]string
+		expected    int
+		collapsed   bool
+		events      int
+	}{
+		{
+			"no port throttles",
+			map[string]string{annLinodeThrottle: "15"},
+			15,
+			false,
+			0,
+		},
+		{
+			"most restrictive port throttle is used",
+			map[string]string{
+				annLinodePortThrottlePrefix + "80":  "5",
+				annLinodePortThrottlePrefix + "443": "10",
+			},
+			5,
+			true,
+			0,
+		},
+		{
+			"disabled port throttle is least restrictive",
+			map[string]string{
+				annLinodePortThrottlePrefix + "80":  "0",
+				annLinodePortThrottlePrefix + "443": "10",
+			},
+			10,
+			true,
+			0,
+		},
+		{
+			"invalid service throttle emits an event",
+			map[string]string{annLinodeThrottle: "foo"},
+			20,
+			false,
+			1,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        randString(10),
+					UID:         "abc123",
+					Annotations: test.annotations,
+				},
+				Spec: v1.ServiceSpec{
+					Ports: []v1.ServicePort{{Port: 80}, {Port: 443}},
+				},
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			connThrottle, collapsed := lb.getNodeBalancerThrottle(svc)
+			if test.expected != connThrottle {
+				t.Fatalf("expected throttle value (%d) does not match actual value (%d)", test.expected, connThrottle)
+			}
+			if test.collapsed != collapsed {
+				t.Errorf("expected collapsed %t, got %t", test.collapsed, collapsed)
+			}
+			if len(recorder.Events) != test.events {
+				t.Errorf("expected %d events, got %d", test.events, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func Test_getPortConfig(t *testing.T) {
+	testcases := []struct {
+		name               string
+		service            *v1.Service
+		expectedPortConfig portConfig
 		err                error
 	}{
 		{
-			"default no protocol specified",
-			&v1.Service{
+			"default no protocol specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+				},
+			},
+			portConfig{Port: 443, Protocol: "tcp"},
+
+			nil,
+		},
+		{
+			"default tcp protocol specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeDefaultProtocol: "tcp",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "tcp"},
+			nil,
+		},
+		{
+			"default capitalized protocol specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeDefaultProtocol: "HTTP",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "http"},
+			nil,
+		},
+		{
+			"default invalid protocol",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeDefaultProtocol: "invalid",
+					},
+				},
+			},
+			portConfig{},
+			fmt.Errorf("invalid protocol: %q specified", "invalid"),
+		},
+		{
+			"port config falls back to default",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeDefaultProtocol:          "http",
+						annLinodePortConfigPrefix + "443": `{}`,
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "http"},
+			nil,
+		},
+		{
+			"port config capitalized protocol",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortConfigPrefix + "443": `{ "protocol": "HTTp" }`,
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "http"},
+			nil,
+		},
+		{
+			"tls secret defaults to https",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortTLSSecretPrefix + "443": "tls-secret",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "https", TLSSecretName: "tls-secret"},
+			nil,
+		},
+		{
+			"tls secret overrides port config secret",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortConfigPrefix + "443":    `{ "protocol": "https", "tls-secret-name": "old-secret" }`,
+						annLinodePortTLSSecretPrefix + "443": "tls-secret",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "https", TLSSecretName: "tls-secret"},
+			nil,
+		},
+		{
+			"protocol annotation overrides default",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeProtocolDeprecated: "http",
+						annLinodeDefaultProtocol:    "tcp",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "http"},
+			nil,
+		},
+		{
+			"port config without protocol falls back to protocol annotation",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortConfigPrefix + "443": `{}`,
+						annLinodeProtocolDeprecated:       "http",
+						annLinodeDefaultProtocol:          "tcp",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "http"},
+			nil,
+		},
+		{
+			"port config protocol overrides protocol annotation",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortConfigPrefix + "443": `{ "protocol": "tcp" }`,
+						annLinodeProtocolDeprecated:       "http",
+						annLinodeDefaultProtocol:          "http",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "tcp"},
+			nil,
+		},
+		{
+			"tls secret overrides protocol annotation",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortTLSSecretPrefix + "443": "tls-secret",
+						annLinodeProtocolDeprecated:          "http",
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "https", TLSSecretName: "tls-secret"},
+			nil,
+		},
+		{
+			"deprecated tls annotation secret with port config",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortConfigPrefix + "443":  `{}`,
+						annLinodeLoadBalancerTLSDeprecated: `[ { "tls-secret-name": "tls-secret", "port": 443 } ]`,
+					},
+				},
+			},
+			portConfig{Port: 443, Protocol: "https", TLSSecretName: "tls-secret"},
+			nil,
+		},
+		{
+			"protocol annotation invalid protocol",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeProtocolDeprecated: "invalid",
+					},
+				},
+			},
+			portConfig{},
+			fmt.Errorf("invalid protocol: %q specified", "invalid"),
+		},
+		{
+			"port config invalid protocol",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: randString(10),
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodePortConfigPrefix + "443": `{ "protocol": "invalid" }`,
+					},
+				},
+			},
+			portConfig{},
+			fmt.Errorf("invalid protocol: %q specified", "invalid"),
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			testPort := 443
+			portConfig, err := getPortConfig(test.service, testPort)
+
+			if !reflect.DeepEqual(portConfig, test.expectedPortConfig) {
+				t.Error("unexpected port config")
+				t.Logf("expected: %q", test.expectedPortConfig)
+				t.Logf("actual: %q", portConfig)
+			}
+
+			if !reflect.DeepEqual(err, test.err) {
+				t.Error("unexpected error")
+				t.Logf("expected: %q", test.err)
+				t.Logf("actual: %q", err)
+			}
+		})
+	}
+}
+
+func Test_getHealthCheckType(t *testing.T) {
+	testcases := []struct {
+		name       string
+		service    *v1.Service
+		healthType linodego.ConfigCheck
+		err        error
+	}{
+		{
+			"no type specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        randString(10),
+					UID:         "abc123",
+					Annotations: map[string]string{},
+				},
+			},
+			linodego.CheckConnection,
+			nil,
+		},
+		{
+			"http specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeHealthCheckType: "http",
+					},
+				},
+			},
+			linodego.CheckHTTP,
+			nil,
+		},
+		{
+			"invalid specified",
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					UID:  "abc123",
+					Annotations: map[string]string{
+						annLinodeHealthCheckType: "invalid",
+					},
+				},
+			},
+			"",
+			fmt.Errorf("invalid health check type: %q specified in annotation: %q", "invalid", annLinodeHealthCheckType),
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			hType, err := getHealthCheckType(test.service)
+			if !reflect.DeepEqual(hType, test.healthType) {
+				t.Error("unexpected health check type")
+				t.Logf("expected: %v", test.healthType)
+				t.Logf("actual: %v", hType)
+			}
+
+			if !reflect.DeepEqual(err, test.err) {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.err)
+				t.Logf("actual: %v", err)
+			}
+		})
+	}
+}
+
+func Test_getNodeInternalIP(t *testing.T) {
+	testcases := []struct {
+		name    string
+		node    *v1.Node
+		address string
+	}{
+		{
+			"node internal ip specified",
+			&v1.Node{
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{
+						{
+							Type:    v1.NodeInternalIP,
+							Address: "127.0.0.1",
+						},
+					},
+				},
+			},
+			"127.0.0.1",
+		},
+		{
+			"node internal ip not specified",
+			&v1.Node{
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{
+						{
+							Type:    v1.NodeExternalIP,
+							Address: "127.0.0.1",
+						},
+					},
+				},
+			},
+			"",
+		},
+		{
+			"dual-stack node",
+			&v1.Node{
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{
+						{
+							Type:    v1.NodeInternalIP,
+							Address: "fd00::1",
+						},
+						{
+							Type:    v1.NodeInternalIP,
+							Address: "192.168.133.10",
+						},
+					},
+				},
+			},
+			"192.168.133.10",
+		},
+		{
+			"ipv6-only node",
+			&v1.Node{
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{
+						{
+							Type:    v1.NodeInternalIP,
+							Address: "fd00::1",
+						},
+					},
+				},
+			},
+			"",
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			ip := getNodeInternalIP(test.node)
+			if ip != test.address {
+				t.Error("unexpected certificate")
+				t.Logf("expected: %q", test.address)
+				t.Logf("actual: %q", ip)
+			}
+		})
+	}
+
+}
+
+func Test_buildNodeBalancerNodesIPv6OnlyNodes(t *testing.T) {
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "dual-stack"},
+			Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "fd00::1"},
+				{Type: v1.NodeInternalIP, Address: "192.168.133.10"},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ipv6-only"},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "fd00::2"}}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{recorder: recorder}
+	nbNodes, err := lb.buildNodeBalancerNodes(&v1.Service{}, nodes, 30000, linodego.AlgorithmRoundRobin)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nbNodes) != 1 || nbNodes[0].Address != "192.168.133.10:30000" {
+		t.Errorf("expected only the IPv4 address of the dual-stack node to be used, got %+v", nbNodes)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodeWithoutIPv4") || !strings.Contains(event, "ipv6-only") {
+		t.Errorf("expected NodeWithoutIPv4 event, got %q", event)
+	}
+}
+
+func Test_getNodeBackendIP(t *testing.T) {
+	node := func(addresses ...string) *v1.Node {
+		n := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+		for _, address := range addresses {
+			n.Status.Addresses = append(n.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: address})
+		}
+		return n
+	}
+	mixed := node("192.168.133.7", "10.0.0.5")
+	mixed.Status.Addresses = append(mixed.Status.Addresses,
+		v1.NodeAddress{Type: v1.NodeExternalIP, Address: "2600:3c00::1"},
+		v1.NodeAddress{Type: v1.NodeExternalIP, Address: "203.0.113.10"},
+	)
+
+	testcases := []struct {
+		name         string
+		node         *v1.Node
+		ipType       nodeBackendIPType
+		backendRange string
+		address      string
+		inRange      bool
+		err          bool
+	}{
+		{
+			name:    "no backend range uses internal ip",
+			node:    node("203.0.113.10"),
+			address: "203.0.113.10",
+		},
+		{
+			name:         "vpc address preferred over private ip",
+			node:         node("192.168.133.7", "10.0.0.5"),
+			backendRange: "10.0.0.0/24",
+			address:      "10.0.0.5",
+			inRange:      true,
+		},
+		{
+			name:         "falls back to private ip",
+			node:         node("203.0.113.10", "192.168.133.7"),
+			backendRange: "10.0.0.0/24",
+			address:      "192.168.133.7",
+		},
+		{
+			name:         "neither vpc address nor private ip",
+			node:         node("203.0.113.10"),
+			backendRange: "10.0.0.0/24",
+			err:          true,
+		},
+		{
+			name:         "private preference",
+			node:         mixed,
+			ipType:       backendIPTypePrivate,
+			backendRange: "10.0.0.0/24",
+			address:      "192.168.133.7",
+		},
+		{
+			name:    "public preference",
+			node:    mixed,
+			ipType:  backendIPTypePublic,
+			address: "203.0.113.10",
+		},
+		{
+			name:         "vpc preference",
+			node:         mixed,
+			ipType:       backendIPTypeVPC,
+			backendRange: "10.0.0.0/24",
+			address:      "10.0.0.5",
+			inRange:      true,
+		},
+		{
+			name:   "private preference without private ip",
+			node:   node("10.0.0.5"),
+			ipType: backendIPTypePrivate,
+			err:    true,
+		},
+		{
+			name:   "public preference without external ip",
+			node:   node("192.168.133.7", "203.0.113.10"),
+			ipType: backendIPTypePublic,
+			err:    true,
+		},
+		{
+			name:         "vpc preference doesn't fall back to private ip",
+			node:         node("192.168.133.7"),
+			ipType:       backendIPTypeVPC,
+			backendRange: "10.0.0.0/24",
+			err:          true,
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if test.backendRange != "" {
+				svc.Annotations[annLinodeBackendIPv4Range] = test.backendRange
+			}
+
+			backendRange, err := getBackendIPv4Range(svc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			address, inRange, err := getNodeBackendIP(test.node, test.ipType, backendRange)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if address != test.address || inRange != test.inRange {
+				t.Error("unexpected backend address")
+				t.Logf("expected: %q (in range: %t)", test.address, test.inRange)
+				t.Logf("actual: %q (in range: %t)", address, inRange)
+			}
+		})
+	}
+}
+func Test_buildNodeBalancerNodesVPCWithoutRange(t *testing.T) {
+	lb := &loadbalancers{defaults: loadBalancerConfig{BackendIPType: backendIPTypeVPC}}
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.5"}}},
+	}}
+	if _, err := lb.buildNodeBalancerNodes(&v1.Service{}, nodes, 30000, linodego.AlgorithmRoundRobin); err == nil || !strings.Contains(err.Error(), "requires a backend IPv4 range") {
+		t.Errorf("expected an error for backend-ip-type vpc without a backend range, got %v", err)
+	}
+}
+
+func Test_setNodeBalancerIDAnnotationConflict(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: randString(10), Namespace: "default"}}
+	fakeClientset := fake.NewSimpleClientset(svc)
+	lb := &loadbalancers{kubeClient: fakeClientset}
+
+	// The Service is modified by another writer between the read and the update of the first
+	// attempt.
+	conflicts := 0
+	fakeClientset.PrependReactor("update", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			conflicts++
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "services"}, svc.Name, fmt.Errorf("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	if err := lb.setNodeBalancerIDAnnotation(svc, 123); err != nil {
+		t.Fatalf("setNodeBalancerIDAnnotation returned an error: %s", err)
+	}
+	current, err := fakeClientset.CoreV1().Services("default").Get(svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := current.Annotations[annLinodeNodeBalancerID]; conflicts != 1 || id != "123" {
+		t.Errorf("expected %s to be set to 123 after a conflict, got %q after %d conflicts", annLinodeNodeBalancerID, id, conflicts)
+	}
+}
+
+func Test_getBackendIPv4Range(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.1", "fd00::/64", "bogus"} {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annLinodeBackendIPv4Range: cidr}}}
+		if _, err := getBackendIPv4Range(svc); err == nil {
+			t.Errorf("expected an error for backend range %q", cidr)
+		}
+	}
+}
+
+func testBuildLoadBalancerRequest(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol: "tcp",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node-1",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node-2",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node-3",
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	nb, err := lb.buildLoadBalancerRequest(context.TODO(), svc, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nb == nil {
+		t.Error("unexpected nodeID")
+		t.Logf("expected: != \"\"")
+		t.Logf("actual: %v", lb)
+	}
+	if !reflect.DeepEqual(err, err) {
+		t.Error("unexpected error")
+		t.Logf("expected: %v", nil)
+		t.Logf("actual: %v", err)
+	}
+
+	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configs) != len(svc.Spec.Ports) {
+		t.Error("unexpected nodebalancer config count")
+		t.Logf("expected: %v", len(svc.Spec.Ports))
+		t.Logf("actual: %v", len(configs))
+	}
+
+	nbNodes, _ := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil)
+
+	if len(nbNodes) != len(nodes) {
+		t.Error("unexpected nodebalancer nodes count")
+		t.Logf("expected: %v", len(nodes))
+		t.Logf("actual: %v", len(nbNodes))
+	}
+
+}
+
+func testEnsureLoadBalancerPreserveAnnotation(t *testing.T, client *linodego.Client, fake *fakeAPI) {
+	testServiceSpec := v1.ServiceSpec{
+		Ports: []v1.ServicePort{
+			{
+				Name:     "test",
+				Protocol: "TCP",
+				Port:     int32(80),
+				NodePort: int32(30000),
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	for _, test := range []struct {
+		name        string
+		deleted     bool
+		annotations map[string]string
+	}{
+		{
+			name:        "load balancer preserved",
+			annotations: map[string]string{annLinodeLoadBalancerPreserve: "true"},
+			deleted:     false,
+		},
+		{
+			name:        "load balancer not preserved (deleted)",
+			annotations: map[string]string{annLinodeLoadBalancerPreserve: "false"},
+			deleted:     true,
+		},
+		{
+			name:        "invalid value treated as false (deleted)",
+			annotations: map[string]string{annLinodeLoadBalancerPreserve: "bogus"},
+			deleted:     true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
+					Name:        "test",
+					UID:         types.UID("foobar" + randString(10)),
+					Annotations: test.annotations,
+				},
+				Spec: testServiceSpec,
+			}
+
+			nb, err := lb.createNodeBalancer(context.TODO(), svc, []*linodego.NodeBalancerConfigCreateOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			svc.Status.LoadBalancer = *makeLoadBalancerStatus(svc, nb)
+			err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+			didDelete := fake.didRequestOccur(http.MethodDelete, fmt.Sprintf("/nodebalancers/%d", nb.ID), "")
+			if didDelete && !test.deleted {
+				t.Fatal("load balancer was unexpectedly deleted")
+			} else if !didDelete && test.deleted {
+				t.Fatal("load balancer was unexpectedly preserved")
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func testEnsureLoadBalancerPaused(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(100)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	defer func() {
+		delete(svc.Annotations, annLinodePaused)
+		_ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+	}()
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	svc.Annotations[annLinodePaused] = "true"
+	svc.Annotations[annLinodeThrottle] = "5"
+	fakeAPI.mu.Lock()
+	fakeAPI.requests = make(map[fakeRequest]struct{})
+	fakeAPI.mu.Unlock()
+
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if !reflect.DeepEqual(status, lbStatus) {
+		t.Errorf("expected the current status %v to be reported, got %v", lbStatus, status)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err == nil {
+		t.Error("expected the deletion of a paused service to fail")
+	}
+
+	for request := range fakeAPI.requests {
+		if request.Method != http.MethodGet {
+			t.Errorf("expected no change while paused, got %s %s", request.Method, request.Path)
+		}
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "ReconcilePaused") {
+		t.Errorf("expected ReconcilePaused event, got %q", event)
+	}
+
+	// Resuming the service applies the changes made while it was paused.
+	delete(svc.Annotations, annLinodePaused)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	nb, err := lb.getNodeBalancerForService(context.TODO(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb.ClientConnThrottle != 5 {
+		t.Errorf("expected the throttle to be updated once resumed, got %d", nb.ClientConnThrottle)
+	}
+
+	svc.Annotations[annLinodePaused] = "true"
+	lb.forceDeletePaused = true
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("expected a forced deletion of a paused service to succeed, got %s", err)
+	}
+	if !fakeAPI.didRequestOccur(http.MethodDelete, fmt.Sprintf("/nodebalancers/%d", nb.ID), "") {
+		t.Error("expected the NodeBalancer to be deleted")
+	}
+}
+
+func testEnsureLoadBalancerDeletedNamespaceTerminating(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+	deletionTimestamp := metav1.Now()
+
+	for _, test := range []struct {
+		name      string
+		retain    bool
+		namespace *v1.Namespace
+		retained  bool
+	}{
+		{
+			name:      "namespace terminating",
+			retain:    true,
+			namespace: &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web", DeletionTimestamp: &deletionTimestamp}},
+			retained:  true,
+		},
+		{
+			name:      "namespace terminating phase",
+			retain:    true,
+			namespace: &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}, Status: v1.NamespaceStatus{Phase: v1.NamespaceTerminating}},
+			retained:  true,
+		},
+		{
+			name:     "namespace gone",
+			retain:   true,
+			retained: true,
+		},
+		{
+			name:      "namespace active",
+			retain:    true,
+			namespace: &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+		},
+		{
+			name:      "retention disabled",
+			namespace: &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web", DeletionTimestamp: &deletionTimestamp}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "web",
+					Name:      randString(10),
+					UID:       types.UID("foobar" + randString(10)),
+				},
+				Spec: v1.ServiceSpec{
+					Type:  v1.ServiceTypeLoadBalancer,
+					Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+				},
+			}
+
+			kubeClient := fake.NewSimpleClientset()
+			if test.namespace != nil {
+				if _, err := kubeClient.CoreV1().Namespaces().Create(test.namespace); err != nil {
+					t.Fatal(err)
+				}
+			}
+			lb := &loadbalancers{client: client, zone: "us-west", kubeClient: kubeClient, retainOnNamespaceDelete: test.retain}
+
+			lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+			if err != nil {
+				t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+			}
+			svc.Status.LoadBalancer = *lbStatus
+			nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+			if err != nil {
+				t.Fatalf("failed to get NodeBalancer: %s", err)
+			}
+			defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
+
+			if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+				t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+			}
+
+			deleted := fakeAPI.didRequestOccur(http.MethodDelete, fmt.Sprintf("/nodebalancers/%d", nb.ID), "")
+			if deleted == test.retained {
+				t.Fatalf("expected NodeBalancer to be retained: %t; deleted: %t", test.retained, deleted)
+			}
+			if !test.retained {
+				return
+			}
+
+			retained, err := client.GetNodeBalancer(context.TODO(), nb.ID)
+			if err != nil {
+				t.Fatalf("failed to get retained NodeBalancer: %s", err)
+			}
+			if !containsString(retained.Tags, retainedTag) || !containsString(retained.Tags, portOwnerTag(80, svc)) {
+				t.Errorf("expected the retained NodeBalancer to keep its port owner and be tagged %s, got %v", retainedTag, retained.Tags)
+			}
+			configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+			if err != nil || len(configs) != 1 {
+				t.Fatalf("failed to list NodeBalancer configs: %v", err)
+			}
+			if nbNodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil); err != nil || len(nbNodes) != 0 {
+				t.Errorf("expected the retained NodeBalancer to have no backends, got %v (%v)", nbNodes, err)
+			}
+
+			gc := &nodeBalancerGC{clusterTag: clusterTagPrefix + "test"}
+			retained.Tags = append(retained.Tags, gc.clusterTag)
+			if gc.isOrphaned(retained, map[string]bool{}) {
+				t.Error("expected the retained NodeBalancer not to be garbage-collected")
+			}
+		})
+	}
+}
+
+func testEnsureLoadBalancerPreserveTypeChange(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeLoadBalancerPreserve: "true"},
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west", kubeClient: fake.NewSimpleClientset()}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+	defer func() { _ = client.DeleteNodeBalancer(context.TODO(), nb.ID) }()
+
+	getNodes := func() []linodego.NodeBalancerNode {
+		configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+		if err != nil || len(configs) != 1 {
+			t.Fatalf("failed to list NodeBalancer configs: %v", err)
+		}
+		nbNodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil)
+		if err != nil {
+			t.Fatalf("failed to list NodeBalancer nodes: %s", err)
+		}
+		return nbNodes
+	}
+
+	// The Service becomes of type ClusterIP.
+	svc.Spec.Type = v1.ServiceTypeClusterIP
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = v1.LoadBalancerStatus{}
+
+	preserved, err := client.GetNodeBalancer(context.TODO(), nb.ID)
+	if err != nil {
+		t.Fatalf("expected NodeBalancer to be preserved: %s", err)
+	}
+	if expected := []string{"ccm-preserved:foobar123"}; !reflect.DeepEqual(preserved.Tags, expected) {
+		t.Error("unexpected tags on preserved NodeBalancer")
+		t.Logf("expected: %v", expected)
+		t.Logf("actual: %v", preserved.Tags)
+	}
+	if nbNodes := getNodes(); len(nbNodes) != 0 {
+		t.Errorf("expected preserved NodeBalancer to have no backends, got %v", nbNodes)
+	}
+	if _, exists, err := lb.GetLoadBalancer(context.TODO(), "lnodelb", svc); err != nil || exists {
+		t.Errorf("expected no load balancer for a ClusterIP service, got exists=%t (%v)", exists, err)
+	}
+
+	// The Service becomes of type LoadBalancer again.
+	svc.Spec.Type = v1.ServiceTypeLoadBalancer
+	if _, exists, err := lb.GetLoadBalancer(context.TODO(), "lnodelb", svc); err != nil || !exists {
+		t.Errorf("expected the preserved load balancer to be found, got exists=%t (%v)", exists, err)
+	}
+
+	lbStatus, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if lbStatus.Ingress[0].IP != *nb.IPv4 {
+		t.Errorf("expected the preserved IP %s to be re-adopted, got %s", *nb.IPv4, lbStatus.Ingress[0].IP)
+	}
+
+	readopted, err := client.GetNodeBalancer(context.TODO(), nb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ccm-service-uid:foobar123", "ccm:80:foobar123"}; !reflect.DeepEqual(readopted.Tags, expected) {
+		t.Error("unexpected tags on re-adopted NodeBalancer")
+		t.Logf("expected: %v", expected)
+		t.Logf("actual: %v", readopted.Tags)
+	}
+	if nbNodes := getNodes(); len(nbNodes) != 1 {
+		t.Errorf("expected re-adopted NodeBalancer to have its backend back, got %v", nbNodes)
+	}
+}
+
+func testEnsureLoadBalancerDeleted(t *testing.T, client *linodego.Client, fake *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol: "tcp",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
 				},
 			},
-			portConfig{Port: 443, Protocol: "tcp"},
-
+		},
+	}
+	testcases := []struct {
+		name        string
+		clusterName string
+		service     *v1.Service
+		err         error
+	}{
+		{
+			"load balancer delete",
+			"linodelb",
+			svc,
 			nil,
 		},
 		{
-			"default tcp protocol specified",
+			"load balancer not exists",
+			"linodelb",
 			&v1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
+					Name: "notexists",
+					UID:  "notexists123",
 					Annotations: map[string]string{
 						annLinodeDefaultProtocol: "tcp",
 					},
 				},
+				Spec: v1.ServiceSpec{
+					Ports: []v1.ServicePort{
+						{
+							Name:     "test",
+							Protocol: "TCP",
+							Port:     int32(80),
+							NodePort: int32(30000),
+						},
+					},
+				},
 			},
-			portConfig{Port: 443, Protocol: "tcp"},
 			nil,
 		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	configs := []*linodego.NodeBalancerConfigCreateOptions{}
+	_, err := lb.createNodeBalancer(context.TODO(), svc, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			err := lb.EnsureLoadBalancerDeleted(context.TODO(), test.clusterName, test.service)
+			if !reflect.DeepEqual(err, test.err) {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.err)
+				t.Logf("actual: %v", err)
+			}
+		})
+	}
+}
+
+func testEnsureExistingLoadBalancer(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "testensure",
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol:           "tcp",
+				annLinodePortConfigPrefix + "8443": `{ "protocol": "https", "tls-secret-name": "tls-secret"}`,
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(8443),
+					NodePort: int32(30000),
+				},
+				{
+					Name:     "test2",
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30001),
+				},
+			},
+		},
+	}
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	lb.kubeClient = fake.NewSimpleClientset()
+	addTLSSecret(t, lb.kubeClient)
+
+	configs := []*linodego.NodeBalancerConfigCreateOptions{}
+	nb, err := lb.createNodeBalancer(context.TODO(), svc, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc.Status.LoadBalancer = *makeLoadBalancerStatus(svc, nb)
+	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+	getLBStatus, exists, err := lb.GetLoadBalancer(context.TODO(), "linodelb", svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("Node balancer not found")
+	}
+
+	testcases := []struct {
+		name        string
+		service     *v1.Service
+		nodes       []*v1.Node
+		clusterName string
+		nbIP        string
+		err         error
+	}{
 		{
-			"default capitalized protocol specified",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeDefaultProtocol: "HTTP",
+			"update load balancer",
+			svc,
+			[]*v1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-1",
+					},
+					Status: v1.NodeStatus{
+						Addresses: []v1.NodeAddress{
+							{
+								Type:    v1.NodeInternalIP,
+								Address: "127.0.0.1",
+							},
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-2",
+					},
+					Status: v1.NodeStatus{
+						Addresses: []v1.NodeAddress{
+							{
+								Type:    v1.NodeInternalIP,
+								Address: "127.0.0.2",
+							},
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "node-3",
+					},
+					Status: v1.NodeStatus{
+						Addresses: []v1.NodeAddress{
+							{
+								Type:    v1.NodeInternalIP,
+								Address: "127.0.0.3",
+							},
+						},
 					},
 				},
 			},
-			portConfig{Port: 443, Protocol: "http"},
+			"linodelb",
+			getLBStatus.Ingress[0].IP,
 			nil,
 		},
-		{
-			"default invalid protocol",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeDefaultProtocol: "invalid",
-					},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), test.clusterName, test.service, test.nodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lbStatus.Ingress[0].IP != test.nbIP {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.nbIP)
+				t.Logf("actual: %v", lbStatus.Ingress)
+			}
+			if !reflect.DeepEqual(err, test.err) {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.err)
+				t.Logf("actual: %v", err)
+			}
+		})
+	}
+}
+
+func testGetNodeBalancerForServiceIDDoesNotExist(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	bogusNodeBalancerID := "123456"
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeNodeBalancerID: bogusNodeBalancerID,
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(8443),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	_, err := lb.getNodeBalancerForService(context.TODO(), svc)
+	if err == nil {
+		t.Fatal("expected getNodeBalancerForService to return an error")
+	}
+
+	expectedErr := fmt.Sprintf("%s annotation points to a NodeBalancer that does not exist: LoadBalancer (%s) not found for service (%s)",
+		annLinodeNodeBalancerID, bogusNodeBalancerID, getServiceNn(svc))
+
+	if err.Error() != expectedErr {
+		t.Errorf("expected error to be '%s' but got '%s'", expectedErr, err)
+	}
+}
+
+func testUpdateLoadBalancerDeletedNodeBalancerID(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	nodeBalancer, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Region: "us-west",
+	})
+	if err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeNodeBalancerID: strconv.Itoa(nodeBalancer.ID),
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
 				},
 			},
-			portConfig{},
-			fmt.Errorf("invalid protocol: %q specified", "invalid"),
 		},
-		{
-			"port config falls back to default",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeDefaultProtocol:          "http",
-						annLinodePortConfigPrefix + "443": `{}`,
-					},
-				},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+
+	if err = client.DeleteNodeBalancer(context.TODO(), nodeBalancer.ID); err != nil {
+		t.Fatalf("failed to delete NodeBalancer: %s", err)
+	}
+
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+
+	updated, err := fakeClientset.CoreV1().Services("").Get(svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newID := updated.Annotations[annLinodeNodeBalancerID]
+	if newID == strconv.Itoa(nodeBalancer.ID) || fakeAPI.nb[newID] == nil {
+		t.Fatalf("expected %s to point to the recreated NodeBalancer, got %q", annLinodeNodeBalancerID, newID)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodeBalancerRecreated") || !strings.Contains(event, newID) {
+		t.Errorf("expected NodeBalancerRecreated event mentioning NodeBalancer (%s), got %q", newID, event)
+	}
+
+	// A retry with the stale annotation, e.g. after failing to update it, reuses the replacement.
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Errorf("expected the replacement NodeBalancer to be reused, got %d NodeBalancers", len(fakeAPI.nb))
+	}
+}
+
+func testEnsureNewLoadBalancerWithNodeBalancerID(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	nodeBalancer, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+		Region: lb.zone,
+	})
+	if err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "testensure",
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeNodeBalancerID: strconv.Itoa(nodeBalancer.ID),
 			},
-			portConfig{Port: 443, Protocol: "http"},
-			nil,
 		},
-		{
-			"port config capitalized protocol",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodePortConfigPrefix + "443": `{ "protocol": "HTTp" }`,
-					},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(8443),
+					NodePort: int32(30000),
 				},
 			},
-			portConfig{Port: 443, Protocol: "http"},
-			nil,
 		},
+	}
+
+	nodes := []*v1.Node{
 		{
-			"port config invalid protocol",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: randString(10),
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodePortConfigPrefix + "443": `{ "protocol": "invalid" }`,
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node-1",
+			},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{
+					{
+						Type:    v1.NodeInternalIP,
+						Address: "127.0.0.1",
 					},
 				},
 			},
-			portConfig{},
-			fmt.Errorf("invalid protocol: %q specified", "invalid"),
 		},
 	}
 
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
-			testPort := 443
-			portConfig, err := getPortConfig(test.service, testPort)
+	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
 
-			if !reflect.DeepEqual(portConfig, test.expectedPortConfig) {
-				t.Error("unexpected port config")
-				t.Logf("expected: %q", test.expectedPortConfig)
-				t.Logf("actual: %q", portConfig)
-			}
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatal(err)
+	}
+}
 
-			if !reflect.DeepEqual(err, test.err) {
-				t.Error("unexpected error")
-				t.Logf("expected: %q", test.err)
-				t.Logf("actual: %q", err)
-			}
-		})
+func testEnsureLoadBalancerDefaultNodeBalancer(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	defaultNB, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+	if err != nil {
+		t.Fatalf("failed to create NodeBalancer: %s", err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder, defaults: loadBalancerConfig{DefaultNodeBalancerID: defaultNB.ID}}
+
+	newService := func(uid string, port int32, annotations map[string]string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: randString(10), UID: types.UID(uid), Annotations: annotations},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeLoadBalancer,
+				Ports: []v1.ServicePort{{Name: "test", Protocol: "TCP", Port: port, NodePort: 30000}},
+			},
+		}
+	}
+	ensure := func(svc *v1.Service) (*linodego.NodeBalancer, error) {
+		status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+		if err != nil {
+			return nil, err
+		}
+		svc.Status.LoadBalancer = *status
+		return lb.getNodeBalancerByStatus(context.TODO(), svc)
+	}
+	ports := func() []int {
+		configs, err := client.ListNodeBalancerConfigs(context.TODO(), defaultNB.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports := make([]int, 0, len(configs))
+		for _, config := range configs {
+			ports = append(ports, config.Port)
+		}
+		sort.Ints(ports)
+		return ports
+	}
+
+	// Services without annotations share the default NodeBalancer on distinct ports.
+	web, api := newService("web", 80, nil), newService("api", 8080, nil)
+	for _, svc := range []*v1.Service{web, api} {
+		nb, err := ensure(svc)
+		if err != nil {
+			t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+		}
+		if nb.ID != defaultNB.ID {
+			t.Errorf("expected service (%s) to use the default NodeBalancer (%d), got NodeBalancer (%d)", svc.UID, defaultNB.ID, nb.ID)
+		}
+	}
+	if actual := ports(); !reflect.DeepEqual(actual, []int{80, 8080}) {
+		t.Errorf("expected the default NodeBalancer to have configs for ports [80 8080], got %v", actual)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Errorf("expected no other NodeBalancer to be created, got %d NodeBalancers", len(fakeAPI.nb))
+	}
+
+	// Ports already used by another Service on the default NodeBalancer conflict.
+	if _, err = ensure(newService("conflict", 80, nil)); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("expected a port conflict, got %v", err)
+	}
+
+	// The annotation takes precedence over the default.
+	own := newService("own", 80, map[string]string{})
+	other, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	own.Annotations[annLinodeNodeBalancerID] = strconv.Itoa(other.ID)
+	if nb, err := ensure(own); err != nil || nb.ID != other.ID {
+		t.Errorf("expected the annotated service to use NodeBalancer (%d), got %v, %v", other.ID, nb, err)
+	}
+
+	// The default NodeBalancer is kept once the last Service sharing it is deleted.
+	for _, svc := range []*v1.Service{web, api} {
+		if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "linodelb", svc); err != nil {
+			t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+		}
+	}
+	if _, ok := fakeAPI.nb[strconv.Itoa(defaultNB.ID)]; !ok {
+		t.Fatalf("expected the default NodeBalancer (%d) to be kept", defaultNB.ID)
+	}
+	if actual := ports(); len(actual) != 0 {
+		t.Errorf("expected the configs of the deleted services to be removed, got %v", actual)
+	}
+	if nb, err := client.GetNodeBalancer(context.TODO(), defaultNB.ID); err != nil || len(getPortOwners(nb)) != 0 {
+		t.Errorf("expected the default NodeBalancer to be released, got %v, %v", nb, err)
+	}
+
+	// A default NodeBalancer that doesn't exist isn't replaced.
+	if err = client.DeleteNodeBalancer(context.TODO(), defaultNB.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ensure(newService("missing", 80, nil)); err == nil || !strings.Contains(err.Error(), "default NodeBalancer") {
+		t.Errorf("expected the missing default NodeBalancer to fail the reconcile, got %v", err)
+	}
+	if len(fakeAPI.nb) != 1 {
+		t.Errorf("expected no NodeBalancer to be created, got %d NodeBalancers", len(fakeAPI.nb))
 	}
 }
 
-func Test_getHealthCheckType(t *testing.T) {
-	testcases := []struct {
-		name       string
-		service    *v1.Service
-		healthType linodego.ConfigCheck
-		err        error
-	}{
-		{
-			"no type specified",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:        randString(10),
-					UID:         "abc123",
-					Annotations: map[string]string{},
-				},
+func testEnsureNewLoadBalancer(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "testensure",
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol:           "tcp",
+				annLinodePortConfigPrefix + "8443": `{ "protocol": "https", "tls-secret-name": "tls-secret"}`,
 			},
-			linodego.CheckConnection,
-			nil,
 		},
-		{
-			"http specified",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "test",
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeHealthCheckType: "http",
-					},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(8443),
+					NodePort: int32(30000),
+				},
+				{
+					Name:     "test2",
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30001),
 				},
 			},
-			linodego.CheckHTTP,
-			nil,
 		},
+	}
+
+	nodes := []*v1.Node{
 		{
-			"invalid specified",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "test",
-					UID:  "abc123",
-					Annotations: map[string]string{
-						annLinodeHealthCheckType: "invalid",
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "node-1",
+			},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{
+					{
+						Type:    v1.NodeInternalIP,
+						Address: "127.0.0.1",
 					},
 				},
 			},
-			"",
-			fmt.Errorf("invalid health check type: %q specified in annotation: %q", "invalid", annLinodeHealthCheckType),
 		},
 	}
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	lb.kubeClient = fake.NewSimpleClientset()
+	addTLSSecret(t, lb.kubeClient)
 
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
-			hType, err := getHealthCheckType(test.service)
-			if !reflect.DeepEqual(hType, test.healthType) {
-				t.Error("unexpected health check type")
-				t.Logf("expected: %v", test.healthType)
-				t.Logf("actual: %v", hType)
-			}
+	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
 
-			if !reflect.DeepEqual(err, test.err) {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.err)
-				t.Logf("actual: %v", err)
-			}
-		})
+	_, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testGetLoadBalancer(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeDefaultProtocol: "tcp",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30000),
+				},
+			},
+		},
 	}
-}
 
-func Test_getNodeInternalIP(t *testing.T) {
+	configs := []*linodego.NodeBalancerConfigCreateOptions{}
+	nb, err := lb.createNodeBalancer(context.TODO(), svc, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+
+	lbStatus := makeLoadBalancerStatus(svc, nb)
+	svc.Status.LoadBalancer = *lbStatus
+
 	testcases := []struct {
-		name    string
-		node    *v1.Node
-		address string
+		name        string
+		service     *v1.Service
+		clusterName string
+		found       bool
+		err         error
 	}{
 		{
-			"node internal ip specified",
-			&v1.Node{
-				Status: v1.NodeStatus{
-					Addresses: []v1.NodeAddress{
-						{
-							Type:    v1.NodeInternalIP,
-							Address: "127.0.0.1",
-						},
-					},
-				},
-			},
-			"127.0.0.1",
+			"Load balancer exists",
+			svc,
+			"linodelb",
+			true,
+			nil,
 		},
 		{
-			"node internal ip not specified",
-			&v1.Node{
-				Status: v1.NodeStatus{
-					Addresses: []v1.NodeAddress{
+			"Load balancer not exists",
+
+			&v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "notexists",
+					UID:  "notexists123",
+					Annotations: map[string]string{
+						annLinodeDefaultProtocol: "tcp",
+					},
+				},
+				Spec: v1.ServiceSpec{
+					Ports: []v1.ServicePort{
 						{
-							Type:    v1.NodeExternalIP,
-							Address: "127.0.0.1",
+							Name:     "test",
+							Protocol: "TCP",
+							Port:     int32(80),
+							NodePort: int32(30000),
 						},
 					},
 				},
 			},
-			"",
+			"linodelb",
+			false,
+			nil,
 		},
 	}
 
 	for _, test := range testcases {
 		t.Run(test.name, func(t *testing.T) {
-			ip := getNodeInternalIP(test.node)
-			if ip != test.address {
-				t.Error("unexpected certificate")
-				t.Logf("expected: %q", test.address)
-				t.Logf("actual: %q", ip)
+
+			_, found, err := lb.GetLoadBalancer(context.TODO(), test.clusterName, test.service)
+			if found != test.found {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.found)
+				t.Logf("actual: %v", found)
+			}
+			if !reflect.DeepEqual(err, test.err) {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.err)
+				t.Logf("actual: %v", err)
 			}
 		})
 	}
-
 }
 
-func testBuildLoadBalancerRequest(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+func Test_getPortConfigAnnotation(t *testing.T) {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "test",
-			UID:  "foobar123",
-			Annotations: map[string]string{
-				annLinodeDefaultProtocol: "tcp",
-			},
 		},
 		Spec: v1.ServiceSpec{
 			Ports: []v1.ServicePort{
@@ -1026,141 +6004,247 @@ func testBuildLoadBalancerRequest(t *testing.T, client *linodego.Client, _ *fake
 			},
 		},
 	}
-	nodes := []*v1.Node{
+
+	testcases := []struct {
+		name     string
+		ann      map[string]string
+		expected portConfigAnnotation
+		err      string
+	}{
 		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "node-1",
+			name: "Test single port annotation",
+			ann:  map[string]string{annLinodePortConfigPrefix + "443": `{ "tls-secret-name": "prod-app-tls", "protocol": "https" }`},
+			expected: portConfigAnnotation{
+				TLSSecretName: "prod-app-tls",
+				Protocol:      "https",
 			},
+			err: "",
 		},
 		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "node-2",
+			name: "Test multiple port annotation",
+			ann: map[string]string{
+				annLinodePortConfigPrefix + "443": `{ "tls-secret-name": "prod-app-tls", "protocol": "https" }`,
+				annLinodePortConfigPrefix + "80":  `{ "protocol": "http" }`,
+			},
+			expected: portConfigAnnotation{
+				TLSSecretName: "prod-app-tls",
+				Protocol:      "https",
 			},
+			err: "",
 		},
 		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "node-3",
+			name: "Test no port annotation",
+			ann:  map[string]string{},
+			expected: portConfigAnnotation{
+				Protocol: "",
 			},
+			err: "",
+		},
+		{
+			name: "Test invalid json",
+			ann: map[string]string{
+				annLinodePortConfigPrefix + "443": `{ "tls-secret-name": "prod-app-tls" `,
+			},
+			expected: portConfigAnnotation{},
+			err:      "unexpected end of JSON input",
 		},
 	}
-
-	lb := &loadbalancers{client, "us-west", nil}
-	nb, err := lb.buildLoadBalancerRequest(context.TODO(), svc, nodes)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if nb == nil {
-		t.Error("unexpected nodeID")
-		t.Logf("expected: != \"\"")
-		t.Logf("actual: %v", lb)
-	}
-	if !reflect.DeepEqual(err, err) {
-		t.Error("unexpected error")
-		t.Logf("expected: %v", nil)
-		t.Logf("actual: %v", err)
-	}
-
-	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if len(configs) != len(svc.Spec.Ports) {
-		t.Error("unexpected nodebalancer config count")
-		t.Logf("expected: %v", len(svc.Spec.Ports))
-		t.Logf("actual: %v", len(configs))
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			svc.Annotations = test.ann
+			ann, err := getPortConfigAnnotation(svc, 443)
+			if !reflect.DeepEqual(ann, test.expected) {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.expected)
+				t.Logf("actual: %v", ann)
+			}
+			if test.err != "" && test.err != err.Error() {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.err)
+				t.Logf("actual: %v", err)
+			}
+		})
 	}
+}
 
-	nbNodes, _ := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil)
+func Test_getTLSCertInfo(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	addTLSSecret(t, kubeClient)
 
-	if len(nbNodes) != len(nodes) {
-		t.Error("unexpected nodebalancer nodes count")
-		t.Logf("expected: %v", len(nodes))
-		t.Logf("actual: %v", len(nbNodes))
+	testcases := []struct {
+		name       string
+		portConfig portConfig
+		namespace  string
+		cert       string
+		key        string
+		err        error
+	}{
+		{
+			name: "Test valid Cert info",
+			portConfig: portConfig{
+				TLSSecretName: "tls-secret",
+				Port:          8080,
+			},
+			namespace: "test",
+			cert:      testCert,
+			key:       testKey,
+			err:       nil,
+		},
+		{
+			name: "Test unspecified Cert info",
+			portConfig: portConfig{
+				Port: 8080,
+			},
+			namespace: "test",
+			cert:      "",
+			key:       "",
+			err:       fmt.Errorf("TLS secret name for port 8080 is not specified"),
+		},
+		{
+			name: "Test blank Cert info",
+			portConfig: portConfig{
+				TLSSecretName: "",
+				Port:          8080,
+			},
+			namespace: "test",
+			cert:      "",
+			key:       "",
+			err:       fmt.Errorf("TLS secret name for port 8080 is not specified"),
+		},
+		{
+			name: "Test no secret found",
+			portConfig: portConfig{
+				TLSSecretName: "secret",
+				Port:          8080,
+			},
+			namespace: "test",
+			cert:      "",
+			key:       "",
+			err: errors.NewNotFound(schema.GroupResource{
+				Group:    "",
+				Resource: "secrets",
+			}, "secret"), /*{}(`secrets "secret" not found`)*/
+		},
 	}
 
-}
-
-func testEnsureLoadBalancerPreserveAnnotation(t *testing.T, client *linodego.Client, fake *fakeAPI) {
-	testServiceSpec := v1.ServiceSpec{
-		Ports: []v1.ServicePort{
-			{
-				Name:     "test",
-				Protocol: "TCP",
-				Port:     int32(80),
-				NodePort: int32(30000),
-			},
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			cert, key, err := getTLSCertInfo(kubeClient, test.namespace, test.portConfig)
+			if cert != test.cert {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.cert)
+				t.Logf("actual: %v", cert)
+			}
+			if key != test.key {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.key)
+				t.Logf("actual: %v", key)
+			}
+			if !reflect.DeepEqual(err, test.err) {
+				t.Error("unexpected error")
+				t.Logf("expected: %v", test.err)
+				t.Logf("actual: %v", err)
+			}
+		})
+	}
+}
+
+func addTLSSecret(t *testing.T, kubeClient kubernetes.Interface) {
+	_, err := kubeClient.CoreV1().Secrets("test").Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tls-secret",
+		},
+		Data: map[string][]byte{
+			v1.TLSCertKey:       []byte(testCert),
+			v1.TLSPrivateKeyKey: []byte(testKey),
 		},
+		StringData: nil,
+		Type:       "kubernetes.io/tls",
+	})
+	if err != nil {
+		t.Error(err)
 	}
+}
 
-	lb := &loadbalancers{client, "us-west", nil}
+func testEnsureLoadBalancerMixedProtocols(t *testing.T, client *linodego.Client, _ *fakeAPI) {
 	for _, test := range []struct {
 		name        string
-		deleted     bool
 		annotations map[string]string
 	}{
 		{
-			name:        "load balancer preserved",
-			annotations: map[string]string{annLinodeLoadBalancerPreserve: "true"},
-			deleted:     false,
-		},
-		{
-			name:        "load balancer not preserved (deleted)",
-			annotations: map[string]string{annLinodeLoadBalancerPreserve: "false"},
-			deleted:     true,
+			name: "port config protocol over protocol annotation",
+			annotations: map[string]string{
+				annLinodeProtocolDeprecated:       "tcp",
+				annLinodePortConfigPrefix + "443": `{ "protocol": "https", "tls-secret-name": "tls-secret" }`,
+			},
 		},
 		{
-			name:        "invalid value treated as false (deleted)",
-			annotations: map[string]string{annLinodeLoadBalancerPreserve: "bogus"},
-			deleted:     true,
+			name: "tls secret over default protocol",
+			annotations: map[string]string{
+				annLinodeDefaultProtocol:             "http",
+				annLinodePortConfigPrefix + "80":     `{ "protocol": "tcp" }`,
+				annLinodePortTLSSecretPrefix + "443": "tls-secret",
+			},
 		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			svc := &v1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:        "test",
-					UID:         types.UID("foobar" + randString(10)),
+					Name:        randString(10),
+					Namespace:   "test",
+					UID:         "foobar123",
 					Annotations: test.annotations,
 				},
-				Spec: testServiceSpec,
+				Spec: v1.ServiceSpec{
+					Ports: []v1.ServicePort{
+						{Name: "http", Protocol: "TCP", Port: int32(80), NodePort: int32(30000)},
+						{Name: "https", Protocol: "TCP", Port: int32(443), NodePort: int32(30001)},
+					},
+				},
 			}
 
-			nb, err := lb.createNodeBalancer(context.TODO(), svc, []*linodego.NodeBalancerConfigCreateOptions{})
+			kubeClient := fake.NewSimpleClientset()
+			addTLSSecret(t, kubeClient)
+			lb := &loadbalancers{client: client, zone: "us-west", kubeClient: kubeClient}
+
+			// The fake API fails the test if the https config is created without a certificate.
+			status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
 			if err != nil {
-				t.Fatal(err)
+				t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
 			}
-
-			svc.Status.LoadBalancer = *makeLoadBalancerStatus(nb)
-			err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
-
-			didDelete := fake.didRequestOccur(http.MethodDelete, fmt.Sprintf("/nodebalancers/%d", nb.ID), "")
-			if didDelete && !test.deleted {
-				t.Fatal("load balancer was unexpectedly deleted")
-			} else if !didDelete && test.deleted {
-				t.Fatal("load balancer was unexpectedly preserved")
+			svc.Status.LoadBalancer = *status
+			nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+			if err != nil {
+				t.Fatal(err)
 			}
+			defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "linodelb", svc) }()
 
+			configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
 			if err != nil {
-				t.Fatalf("unexpected error: %s", err)
+				t.Fatal(err)
+			}
+			protocols := make(map[int]linodego.ConfigProtocol)
+			for _, config := range configs {
+				protocols[config.Port] = config.Protocol
+			}
+			expected := map[int]linodego.ConfigProtocol{80: linodego.ProtocolTCP, 443: linodego.ProtocolHTTPS}
+			if !reflect.DeepEqual(protocols, expected) {
+				t.Errorf("expected config protocols %v, got %v", expected, protocols)
 			}
 		})
 	}
 }
 
-func testEnsureLoadBalancerDeleted(t *testing.T, client *linodego.Client, fake *fakeAPI) {
+func testUpdateLoadBalancerDuplicateConfigs(t *testing.T, client *linodego.Client, _ *fakeAPI) {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "test",
+			Name: randString(10),
 			UID:  "foobar123",
-			Annotations: map[string]string{
-				annLinodeDefaultProtocol: "tcp",
-			},
 		},
 		Spec: v1.ServiceSpec{
 			Ports: []v1.ServicePort{
 				{
-					Name:     "test",
+					Name:     randString(10),
 					Protocol: "TCP",
 					Port:     int32(80),
 					NodePort: int32(30000),
@@ -1168,600 +6252,682 @@ func testEnsureLoadBalancerDeleted(t *testing.T, client *linodego.Client, fake *
 			},
 		},
 	}
-	testcases := []struct {
-		name        string
-		clusterName string
-		service     *v1.Service
-		err         error
-	}{
-		{
-			"load balancer delete",
-			"linodelb",
-			svc,
-			nil,
-		},
-		{
-			"load balancer not exists",
-			"linodelb",
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "notexists",
-					UID:  "notexists123",
-					Annotations: map[string]string{
-						annLinodeDefaultProtocol: "tcp",
-					},
-				},
-				Spec: v1.ServiceSpec{
-					Ports: []v1.ServicePort{
-						{
-							Name:     "test",
-							Protocol: "TCP",
-							Port:     int32(80),
-							NodePort: int32(30000),
-						},
-					},
-				},
-			},
-			nil,
-		},
+
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
 	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
 
-	lb := &loadbalancers{client, "us-west", nil}
-	configs := []*linodego.NodeBalancerConfigCreateOptions{}
-	_, err := lb.createNodeBalancer(context.TODO(), svc, configs)
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
 	if err != nil {
+		t.Fatalf("failed to get NodeBalancer by status: %v", err)
+	}
+	cfgs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil || len(cfgs) != 1 {
+		t.Fatalf("expected a single NodeBalancer config, got %v (%v)", cfgs, err)
+	}
+	original := cfgs[0]
+
+	// An interrupted reconcile left a second config on port 80 behind.
+	checkPassive := true
+	if _, err = client.CreateNodeBalancerConfig(context.TODO(), nb.ID, linodego.NodeBalancerConfigCreateOptions{
+		Port:         80,
+		Protocol:     linodego.ProtocolHTTP,
+		CheckPassive: &checkPassive,
+	}); err != nil {
 		t.Fatal(err)
 	}
-	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
 
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
-			err := lb.EnsureLoadBalancerDeleted(context.TODO(), test.clusterName, test.service)
-			if !reflect.DeepEqual(err, test.err) {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.err)
-				t.Logf("actual: %v", err)
-			}
-		})
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+
+	cfgs, err = client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil {
+		t.Fatalf("error getting NodeBalancer configs: %v", err)
+	}
+	if len(cfgs) != 1 {
+		t.Fatalf("expected exactly one config to remain, got %d", len(cfgs))
+	}
+	if cfgs[0].ID != original.ID || cfgs[0].Protocol != linodego.ProtocolTCP {
+		t.Errorf("expected the config matching the service (%d) to be retained, got config %d with protocol %s", original.ID, cfgs[0].ID, cfgs[0].Protocol)
 	}
 }
 
-func testEnsureExistingLoadBalancer(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+func testUpdateLoadBalancerBackupNodes(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "testensure",
+			Name: randString(10),
 			UID:  "foobar123",
 			Annotations: map[string]string{
-				annLinodeDefaultProtocol:           "tcp",
-				annLinodePortConfigPrefix + "8443": `{ "protocol": "https", "tls-secret-name": "tls-secret"}`,
+				annLinodeBackupNodeLabel: "pool=backup",
 			},
 		},
 		Spec: v1.ServiceSpec{
-			Ports: []v1.ServicePort{
-				{
-					Name:     "test",
-					Protocol: "TCP",
-					Port:     int32(8443),
-					NodePort: int32(30000),
-				},
-				{
-					Name:     "test2",
-					Protocol: "TCP",
-					Port:     int32(80),
-					NodePort: int32(30001),
-				},
-			},
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
 		},
 	}
 
-	lb := &loadbalancers{client, "us-west", nil}
-	lb.kubeClient = fake.NewSimpleClientset()
-	addTLSSecret(t, lb.kubeClient)
-
-	configs := []*linodego.NodeBalancerConfigCreateOptions{}
-	nb, err := lb.createNodeBalancer(context.TODO(), svc, configs)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	svc.Status.LoadBalancer = *makeLoadBalancerStatus(nb)
-	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
-	getLBStatus, exists, err := lb.GetLoadBalancer(context.TODO(), "linodelb", svc)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !exists {
-		t.Fatal("Node balancer not found")
-	}
-
-	testcases := []struct {
-		name        string
-		service     *v1.Service
-		nodes       []*v1.Node
-		clusterName string
-		nbIP        string
-		err         error
-	}{
+	nodes := []*v1.Node{
 		{
-			"update load balancer",
-			svc,
-			[]*v1.Node{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "node-1",
-					},
-					Status: v1.NodeStatus{
-						Addresses: []v1.NodeAddress{
-							{
-								Type:    v1.NodeInternalIP,
-								Address: "127.0.0.1",
-							},
-						},
-					},
-				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "node-2",
-					},
-					Status: v1.NodeStatus{
-						Addresses: []v1.NodeAddress{
-							{
-								Type:    v1.NodeInternalIP,
-								Address: "127.0.0.2",
-							},
-						},
-					},
-				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "node-3",
-					},
-					Status: v1.NodeStatus{
-						Addresses: []v1.NodeAddress{
-							{
-								Type:    v1.NodeInternalIP,
-								Address: "127.0.0.3",
-							},
-						},
-					},
-				},
+			ObjectMeta: metav1.ObjectMeta{Name: "primary", Labels: map[string]string{"pool": "primary"}},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Labels: map[string]string{"pool": "backup"}},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.2"}},
 			},
-			"linodelb",
-			getLBStatus.Ingress[0].IP,
-			nil,
 		},
 	}
 
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
-			lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), test.clusterName, test.service, test.nodes)
-			if err != nil {
-				t.Fatal(err)
-			}
-			if lbStatus.Ingress[0].IP != test.nbIP {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.nbIP)
-				t.Logf("actual: %v", lbStatus.Ingress)
-			}
-			if !reflect.DeepEqual(err, test.err) {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.err)
-				t.Logf("actual: %v", err)
-			}
-		})
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	expectModes := func(stage string, expected map[string]linodego.NodeMode) {
+		modes := make(map[string]linodego.NodeMode)
+		for _, node := range fakeAPI.nbn {
+			modes[node.Label] = node.Mode
+		}
+		if !reflect.DeepEqual(modes, expected) {
+			t.Errorf("%s: expected node modes %v, got %v", stage, expected, modes)
+		}
+	}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	expectModes("create", map[string]linodego.NodeMode{"primary": linodego.ModeAccept, "backup": linodego.ModeBackup})
+
+	// The backup node is promoted and the primary one demoted.
+	nodes[0].Labels["pool"] = "backup"
+	nodes[1].Labels["pool"] = "primary"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectModes("swap", map[string]linodego.NodeMode{"primary": linodego.ModeBackup, "backup": linodego.ModeAccept})
+
+	delete(svc.Annotations, annLinodeBackupNodeLabel)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectModes("annotation removed", map[string]linodego.NodeMode{"primary": linodego.ModeAccept, "backup": linodego.ModeAccept})
+
+	svc.Annotations[annLinodeBackupNodeLabel] = "pool in (backup"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err == nil {
+		t.Error("expected an error for an invalid selector")
 	}
 }
 
-func testGetNodeBalancerForServiceIDDoesNotExist(t *testing.T, client *linodego.Client, _ *fakeAPI) {
-	lb := &loadbalancers{client, "us-west", nil}
-	bogusNodeBalancerID := "123456"
+func testUpdateLoadBalancerExcludedNodes(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	Options.ExcludeNodeLabel = "pool=gpu"
+	defer func() { Options.ExcludeNodeLabel = "" }()
 
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "test",
-			UID:  "foobar123",
-			Annotations: map[string]string{
-				annLinodeNodeBalancerID: bogusNodeBalancerID,
-			},
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{},
 		},
 		Spec: v1.ServiceSpec{
-			Ports: []v1.ServicePort{
-				{
-					Name:     "test",
-					Protocol: "TCP",
-					Port:     int32(8443),
-					NodePort: int32(30000),
-				},
-			},
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
 		},
 	}
 
-	_, err := lb.getNodeBalancerForService(context.TODO(), svc)
-	if err == nil {
-		t.Fatal("expected getNodeBalancerForService to return an error")
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Labels: map[string]string{"pool": "web"}},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "gpu", Labels: map[string]string{"pool": "gpu"}},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.2"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "spot", Labels: map[string]string{"pool": "spot"}},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.3"}},
+			},
+		},
 	}
 
-	expectedErr := fmt.Sprintf("%s annotation points to a NodeBalancer that does not exist: LoadBalancer (%s) not found for service (%s)",
-		annLinodeNodeBalancerID, bogusNodeBalancerID, getServiceNn(svc))
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
 
-	if err.Error() != expectedErr {
-		t.Errorf("expected error to be '%s' but got '%s'", expectedErr, err)
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	expectNodes := func(stage string, expected ...string) {
+		var actual []string
+		for _, node := range fakeAPI.nbn {
+			actual = append(actual, node.Label)
+		}
+		sort.Strings(actual)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expected NodeBalancer nodes %v, got %v", stage, expected, actual)
+		}
 	}
-}
 
-func testEnsureNewLoadBalancerWithNodeBalancerID(t *testing.T, client *linodego.Client, _ *fakeAPI) {
-	lb := &loadbalancers{client, "us-west", nil}
-	nodeBalancer, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
-		Region: lb.zone,
-	})
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
 	if err != nil {
-		t.Fatalf("failed to create NodeBalancer: %s", err)
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	expectNodes("create", "spot", "web")
+
+	// The spot node gains the well-known exclude label and is removed from the existing config.
+	nodes[2].Labels[labelNodeExcludeFromLoadBalancers] = ""
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectNodes("label added", "web")
+
+	// The spot node loses the label and is added back.
+	delete(nodes[2].Labels, labelNodeExcludeFromLoadBalancers)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectNodes("label removed", "spot", "web")
+
+	// The annotation overrides the cluster-wide selector.
+	svc.Annotations[annLinodeExcludeNodeLabel] = "pool=spot"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectNodes("annotation override", "gpu", "web")
+
+	svc.Annotations[annLinodeExcludeNodeLabel] = "pool in (spot"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err == nil {
+		t.Error("expected an error for an invalid selector")
 	}
+}
 
+func testUpdateLoadBalancerControlPlaneNodes(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "testensure",
-			UID:  "foobar123",
-			Annotations: map[string]string{
-				annLinodeNodeBalancerID: strconv.Itoa(nodeBalancer.ID),
-			},
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeIncludeControlPlane: "true"},
 		},
 		Spec: v1.ServiceSpec{
-			Ports: []v1.ServicePort{
-				{
-					Name:     "test",
-					Protocol: "TCP",
-					Port:     int32(8443),
-					NodePort: int32(30000),
-				},
-			},
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
 		},
 	}
 
-	nodes := []*v1.Node{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "node-1",
-			},
+	newNode := func(name, address string, labels map[string]string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
 			Status: v1.NodeStatus{
-				Addresses: []v1.NodeAddress{
-					{
-						Type:    v1.NodeInternalIP,
-						Address: "127.0.0.1",
-					},
-				},
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: address}},
 			},
-		},
+		}
+	}
+	nodes := []*v1.Node{
+		newNode("control-plane", "10.0.0.1", map[string]string{"node-role.kubernetes.io/control-plane": ""}),
+		newNode("master", "10.0.0.2", map[string]string{"node-role.kubernetes.io/master": ""}),
+		newNode("worker-1", "10.0.0.3", nil),
+		newNode("worker-2", "10.0.0.4", map[string]string{"node-role.kubernetes.io/worker": ""}),
 	}
 
-	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
 
-	if _, err = lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
-		t.Fatal(err)
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	expectNodes := func(stage string, expected ...string) {
+		var actual []string
+		for _, node := range fakeAPI.nbn {
+			actual = append(actual, node.Label)
+		}
+		sort.Strings(actual)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expected NodeBalancer nodes %v, got %v", stage, expected, actual)
+		}
+	}
+
+	// The annotation opts the control-plane nodes in, like the NodeBalancers created before they
+	// were excluded by default.
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	expectNodes("included", "control-plane", "master", "worker-1", "worker-2")
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event, got %q", <-recorder.Events)
+	}
+
+	// Without it, they are removed from the existing config.
+	delete(svc.Annotations, annLinodeIncludeControlPlane)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectNodes("excluded", "worker-1", "worker-2")
+	if event := <-recorder.Events; !strings.Contains(event, "ControlPlaneNodesExcluded") || !strings.Contains(event, "control-plane, master") {
+		t.Errorf("expected a ControlPlaneNodesExcluded event for both control-plane nodes, got %q", event)
 	}
 }
 
-func testEnsureNewLoadBalancer(t *testing.T, client *linodego.Client, _ *fakeAPI) {
+func testUpdateLoadBalancerNotReadyNodes(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "testensure",
+			Name: randString(10),
 			UID:  "foobar123",
-			Annotations: map[string]string{
-				annLinodeDefaultProtocol:           "tcp",
-				annLinodePortConfigPrefix + "8443": `{ "protocol": "https", "tls-secret-name": "tls-secret"}`,
-			},
 		},
 		Spec: v1.ServiceSpec{
-			Ports: []v1.ServicePort{
-				{
-					Name:     "test",
-					Protocol: "TCP",
-					Port:     int32(8443),
-					NodePort: int32(30000),
-				},
-				{
-					Name:     "test2",
-					Protocol: "TCP",
-					Port:     int32(80),
-					NodePort: int32(30001),
-				},
-			},
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
 		},
 	}
 
-	nodes := []*v1.Node{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "node-1",
-			},
+	// The nodes are read from the node informer, which is stubbed by an indexer.
+	nodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder, nodes: v1listers.NewNodeLister(nodeIndexer)}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	setNode := func(name, address string, ready v1.ConditionStatus, unschedulable bool) *v1.Node {
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1.NodeSpec{Unschedulable: unschedulable},
 			Status: v1.NodeStatus{
-				Addresses: []v1.NodeAddress{
-					{
-						Type:    v1.NodeInternalIP,
-						Address: "127.0.0.1",
-					},
-				},
+				Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: address}},
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}},
 			},
-		},
+		}
+		if _, err := fakeClientset.CoreV1().Nodes().Update(node); err != nil {
+			if _, err = fakeClientset.CoreV1().Nodes().Create(node); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := nodeIndexer.Update(node); err != nil {
+			t.Fatal(err)
+		}
+		return node
 	}
-	lb := &loadbalancers{client, "us-west", nil}
-	lb.kubeClient = fake.NewSimpleClientset()
-	addTLSSecret(t, lb.kubeClient)
+	worker1 := setNode("worker-1", "10.0.0.1", v1.ConditionTrue, false)
+	worker2 := setNode("worker-2", "10.0.0.2", v1.ConditionTrue, false)
+	setNode("cordoned", "10.0.0.3", v1.ConditionFalse, true)
 
-	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
 
-	_, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	expectModes := func(stage string, expected map[string]linodego.NodeMode) {
+		actual := make(map[string]linodego.NodeMode)
+		for _, node := range fakeAPI.nbn {
+			actual[node.Label] = node.Mode
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expected NodeBalancer node modes %v, got %v", stage, expected, actual)
+		}
+	}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{worker1, worker2})
 	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	expectModes("ready", map[string]linodego.NodeMode{"worker-1": linodego.ModeAccept, "worker-2": linodego.ModeAccept})
+
+	// The service controller leaves out the node once it is NotReady, but its backend is drained
+	// rather than removed. Unschedulable nodes that aren't ready aren't added.
+	worker2 = setNode("worker-2", "10.0.0.2", v1.ConditionUnknown, false)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{worker1}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectModes("not ready", map[string]linodego.NodeMode{"worker-1": linodego.ModeAccept, "worker-2": linodego.ModeDrain})
+	if event := <-recorder.Events; !strings.Contains(event, "NodesNotReady") || !strings.Contains(event, "worker-2") {
+		t.Errorf("expected a NodesNotReady event for worker-2, got %q", event)
+	}
+
+	// It accepts connections again once it is Ready.
+	worker2 = setNode("worker-2", "10.0.0.2", v1.ConditionTrue, false)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{worker1, worker2}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectModes("ready again", map[string]linodego.NodeMode{"worker-1": linodego.ModeAccept, "worker-2": linodego.ModeAccept})
+
+	// Nodes deleted from the cluster are removed.
+	if err = fakeClientset.CoreV1().Nodes().Delete("worker-2", &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = nodeIndexer.Delete(worker2); err != nil {
 		t.Fatal(err)
 	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{worker1}); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectModes("deleted", map[string]linodego.NodeMode{"worker-1": linodego.ModeAccept})
+
+	for _, action := range fakeClientset.Actions() {
+		if action.Matches("list", "nodes") {
+			t.Errorf("expected the nodes to be read from the lister, got %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
 }
 
-func testGetLoadBalancer(t *testing.T, client *linodego.Client, _ *fakeAPI) {
-	lb := &loadbalancers{client, "us-west", nil}
+func testUpdateLoadBalancerDisableHealthChecks(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "test",
+			Name: randString(10),
 			UID:  "foobar123",
 			Annotations: map[string]string{
-				annLinodeDefaultProtocol: "tcp",
+				annLinodeHealthCheckType: "http",
+				annLinodeCheckPath:       "/healthz",
 			},
 		},
 		Spec: v1.ServiceSpec{
 			Ports: []v1.ServicePort{
-				{
-					Name:     "test",
-					Protocol: "TCP",
-					Port:     int32(80),
-					NodePort: int32(30000),
-				},
+				{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000},
+				{Name: "metrics", Protocol: "TCP", Port: 9000, NodePort: 30001},
 			},
 		},
 	}
 
-	configs := []*linodego.NodeBalancerConfigCreateOptions{}
-	nb, err := lb.createNodeBalancer(context.TODO(), svc, configs)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer func() { _ = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc) }()
+	lb := &loadbalancers{client: client, zone: "us-west"}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
 
-	lbStatus := makeLoadBalancerStatus(nb)
-	svc.Status.LoadBalancer = *lbStatus
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
 
-	testcases := []struct {
-		name        string
-		service     *v1.Service
-		clusterName string
-		found       bool
-		err         error
-	}{
-		{
-			"Load balancer exists",
-			svc,
-			"linodelb",
-			true,
-			nil,
-		},
-		{
-			"Load balancer not exists",
+	expectChecks := func(stage string, expected map[int]linodego.ConfigCheck) {
+		t.Helper()
+		if len(fakeAPI.nbc) != len(expected) {
+			t.Fatalf("%s: expected %d configs, got %d", stage, len(expected), len(fakeAPI.nbc))
+		}
+		for _, config := range fakeAPI.nbc {
+			check := expected[config.Port]
+			if config.Check != check {
+				t.Errorf("%s: expected port %d to have a %s check, got %s", stage, config.Port, check, config.Check)
+			}
+			if check == linodego.CheckNone && config.CheckPassive {
+				t.Errorf("%s: expected port %d to have no passive checks", stage, config.Port)
+			}
+			if check == linodego.CheckHTTP && (config.CheckPath != "/healthz" || !config.CheckPassive) {
+				t.Errorf("%s: expected port %d to check /healthz with passive checks, got %q with %t", stage, config.Port, config.CheckPath, config.CheckPassive)
+			}
+		}
+	}
 
-			&v1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "notexists",
-					UID:  "notexists123",
-					Annotations: map[string]string{
-						annLinodeDefaultProtocol: "tcp",
-					},
-				},
-				Spec: v1.ServiceSpec{
-					Ports: []v1.ServicePort{
-						{
-							Name:     "test",
-							Protocol: "TCP",
-							Port:     int32(80),
-							NodePort: int32(30000),
-						},
-					},
-				},
-			},
-			"linodelb",
-			false,
-			nil,
-		},
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	expectChecks("create", map[int]linodego.ConfigCheck{80: linodego.CheckHTTP, 9000: linodego.CheckHTTP})
+
+	// The checks of a single port are turned off.
+	svc.Annotations[annLinodePortCheckTypePrefix+"9000"] = "none"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
 	}
+	expectChecks("port disabled", map[int]linodego.ConfigCheck{80: linodego.CheckHTTP, 9000: linodego.CheckNone})
 
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
+	// And of every port.
+	svc.Annotations[annLinodeHealthCheckType] = "none"
+	delete(svc.Annotations, annLinodePortCheckTypePrefix+"9000")
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectChecks("service disabled", map[int]linodego.ConfigCheck{80: linodego.CheckNone, 9000: linodego.CheckNone})
 
-			_, found, err := lb.GetLoadBalancer(context.TODO(), test.clusterName, test.service)
-			if found != test.found {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.found)
-				t.Logf("actual: %v", found)
-			}
-			if !reflect.DeepEqual(err, test.err) {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.err)
-				t.Logf("actual: %v", err)
-			}
-		})
+	// Switching back re-enables the active and passive checks with the kept check path.
+	svc.Annotations[annLinodeHealthCheckType] = "http"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
 	}
+	expectChecks("re-enabled", map[int]linodego.ConfigCheck{80: linodego.CheckHTTP, 9000: linodego.CheckHTTP})
 }
 
-func Test_getPortConfigAnnotation(t *testing.T) {
+func testUpdateLoadBalancerNodeWeights(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "test",
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeNodeWeightLabel: "weight",
+			},
 		},
 		Spec: v1.ServiceSpec{
-			Ports: []v1.ServicePort{
-				{
-					Name:     "test",
-					Protocol: "TCP",
-					Port:     int32(80),
-					NodePort: int32(30000),
-				},
-			},
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
 		},
 	}
 
-	testcases := []struct {
-		name     string
-		ann      map[string]string
-		expected portConfigAnnotation
-		err      string
-	}{
-		{
-			name: "Test single port annotation",
-			ann:  map[string]string{annLinodePortConfigPrefix + "443": `{ "tls-secret-name": "prod-app-tls", "protocol": "https" }`},
-			expected: portConfigAnnotation{
-				TLSSecretName: "prod-app-tls",
-				Protocol:      "https",
-			},
-			err: "",
-		},
-		{
-			name: "Test multiple port annotation",
-			ann: map[string]string{
-				annLinodePortConfigPrefix + "443": `{ "tls-secret-name": "prod-app-tls", "protocol": "https" }`,
-				annLinodePortConfigPrefix + "80":  `{ "protocol": "http" }`,
+	newNode := func(name, address string, labels map[string]string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: address}},
 			},
-			expected: portConfigAnnotation{
-				TLSSecretName: "prod-app-tls",
-				Protocol:      "https",
+		}
+	}
+	nodes := []*v1.Node{
+		newNode("large", "10.0.0.1", map[string]string{"weight": "200"}),
+		newNode("small", "10.0.0.2", map[string]string{"weight": "50"}),
+		newNode("unlabeled", "10.0.0.3", nil),
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	expectWeights := func(stage string, expected map[string]int) {
+		weights := make(map[string]int)
+		for _, node := range fakeAPI.nbn {
+			weights[node.Label] = node.Weight
+		}
+		if !reflect.DeepEqual(weights, expected) {
+			t.Errorf("%s: expected node weights %v, got %v", stage, expected, weights)
+		}
+	}
+	expectEvent := func(stage, reason string) {
+		select {
+		case event := <-recorder.Events:
+			if !strings.Contains(event, reason) {
+				t.Errorf("%s: expected a %s event, got %q", stage, reason, event)
+			}
+		default:
+			t.Errorf("%s: expected a %s event", stage, reason)
+		}
+	}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	expectWeights("create", map[string]int{"large": 200, "small": 50, "unlabeled": 100})
+
+	nodes[0].Labels["weight"] = "1000"
+	nodes[1].Labels["weight"] = "heavy"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectWeights("invalid labels", map[string]int{"large": 255, "small": 100, "unlabeled": 100})
+	expectEvent("out of range label", "InvalidNodeWeight")
+	expectEvent("non-integer label", "InvalidNodeWeight")
+
+	svc.Annotations[annLinodeAlgorithm] = string(linodego.AlgorithmLeastConn)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectWeights("leastconn", map[string]int{"large": 100, "small": 100, "unlabeled": 100})
+	expectEvent("leastconn", "NodeWeightIgnored")
+}
+
+func testUpdateLoadBalancerHTTPSRedirect(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeHTTPSRedirect:            "true",
+				annLinodePortConfigPrefix + "443": `{ "protocol": "https", "tls-secret-name": "tls-secret"}`,
 			},
-			err: "",
 		},
-		{
-			name: "Test no port annotation",
-			ann:  map[string]string{},
-			expected: portConfigAnnotation{
-				Protocol: "",
-			},
-			err: "",
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30001}},
 		},
+	}
+
+	nodes := []*v1.Node{
 		{
-			name: "Test invalid json",
-			ann: map[string]string{
-				annLinodePortConfigPrefix + "443": `{ "tls-secret-name": "prod-app-tls" `,
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
 			},
-			expected: portConfigAnnotation{},
-			err:      "unexpected end of JSON input",
 		},
 	}
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
-			svc.Annotations = test.ann
-			ann, err := getPortConfigAnnotation(svc, 443)
-			if !reflect.DeepEqual(ann, test.expected) {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.expected)
-				t.Logf("actual: %v", ann)
-			}
-			if test.err != "" && test.err != err.Error() {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.err)
-				t.Logf("actual: %v", err)
-			}
-		})
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: client, zone: "us-west", recorder: recorder}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+	addTLSSecret(t, lb.kubeClient)
+
+	defer lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc)
+
+	expectConfigs := func(stage string, expected map[int]linodego.ConfigProtocol) {
+		configs := make(map[int]linodego.ConfigProtocol)
+		for _, config := range fakeAPI.nbc {
+			configs[config.Port] = config.Protocol
+		}
+		if !reflect.DeepEqual(configs, expected) {
+			t.Errorf("%s: expected configs %v, got %v", stage, expected, configs)
+		}
+	}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
+	expectConfigs("create", map[int]linodego.ConfigProtocol{80: linodego.ProtocolHTTP, 443: linodego.ProtocolHTTPS})
+
+	for _, node := range fakeAPI.nbn {
+		if node.Address != "10.0.0.1:30001" {
+			t.Errorf("expected the nodes of both configs to target the NodePort of port 443, got %s", node.Address)
+		}
+	}
+
+	delete(svc.Annotations, annLinodeHTTPSRedirect)
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectConfigs("annotation removed", map[int]linodego.ConfigProtocol{443: linodego.ProtocolHTTPS})
+
+	svc.Annotations[annLinodeHTTPSRedirect] = "true"
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectConfigs("annotation restored", map[int]linodego.ConfigProtocol{80: linodego.ProtocolHTTP, 443: linodego.ProtocolHTTPS})
+
+	// Without TLS termination on port 443 the redirect is refused with a warning.
+	delete(svc.Annotations, annLinodePortConfigPrefix+"443")
+	if err = lb.UpdateLoadBalancer(context.TODO(), "lnodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expectConfigs("no https port", map[int]linodego.ConfigProtocol{443: linodego.ProtocolTCP})
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "HTTPSRedirectIgnored") {
+			t.Errorf("expected an HTTPSRedirectIgnored event, got %q", event)
+		}
+	default:
+		t.Error("expected an event for the ignored redirect")
 	}
 }
 
-func Test_getTLSCertInfo(t *testing.T) {
-	kubeClient := fake.NewSimpleClientset()
-	addTLSSecret(t, kubeClient)
+func testEnsureLoadBalancerSecondaryAccount(t *testing.T, client *linodego.Client, fakeAPI *fakeAPI) {
+	secondary := newFake(t)
+	ts := httptest.NewServer(secondary)
+	defer ts.Close()
 
-	testcases := []struct {
-		name       string
-		portConfig portConfig
-		namespace  string
-		cert       string
-		key        string
-		err        error
-	}{
-		{
-			name: "Test valid Cert info",
-			portConfig: portConfig{
-				TLSSecretName: "tls-secret",
-				Port:          8080,
-			},
-			namespace: "test",
-			cert:      testCert,
-			key:       testKey,
-			err:       nil,
-		},
-		{
-			name: "Test unspecified Cert info",
-			portConfig: portConfig{
-				Port: 8080,
+	secondaryClient := linodego.NewClient(http.DefaultClient)
+	secondaryClient.SetBaseURL(ts.URL)
+
+	account := &loadbalancers{client: &secondaryClient, zone: "eu-west"}
+	lb := &loadbalancers{client: client, zone: "us-west", accounts: map[string]*loadbalancers{"eu-west": account}}
+	fakeClientset := fake.NewSimpleClientset()
+	lb.kubeClient = fakeClientset
+	account.kubeClient = fakeClientset
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodeRegion: "eu-west",
 			},
-			namespace: "test",
-			cert:      "",
-			key:       "",
-			err:       fmt.Errorf("TLS secret name for port 8080 is not specified"),
 		},
-		{
-			name: "Test blank Cert info",
-			portConfig: portConfig{
-				TLSSecretName: "",
-				Port:          8080,
-			},
-			namespace: "test",
-			cert:      "",
-			key:       "",
-			err:       fmt.Errorf("TLS secret name for port 8080 is not specified"),
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
 		},
+	}
+	nodes := []*v1.Node{
 		{
-			name: "Test no secret found",
-			portConfig: portConfig{
-				TLSSecretName: "secret",
-				Port:          8080,
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: v1.NodeStatus{
+				Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
 			},
-			namespace: "test",
-			cert:      "",
-			key:       "",
-			err: errors.NewNotFound(schema.GroupResource{
-				Group:    "",
-				Resource: "secrets",
-			}, "secret"), /*{}(`secrets "secret" not found`)*/
 		},
 	}
 
-	for _, test := range testcases {
-		t.Run(test.name, func(t *testing.T) {
-			cert, key, err := getTLSCertInfo(kubeClient, test.namespace, test.portConfig)
-			if cert != test.cert {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.cert)
-				t.Logf("actual: %v", cert)
-			}
-			if key != test.key {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.key)
-				t.Logf("actual: %v", key)
-			}
-			if !reflect.DeepEqual(err, test.err) {
-				t.Error("unexpected error")
-				t.Logf("expected: %v", test.err)
-				t.Logf("actual: %v", err)
-			}
-		})
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
 	}
-}
+	svc.Status.LoadBalancer = *lbStatus
+	stubService(fakeClientset, svc)
 
-func addTLSSecret(t *testing.T, kubeClient kubernetes.Interface) {
-	_, err := kubeClient.CoreV1().Secrets("test").Create(&v1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "tls-secret",
-		},
-		Data: map[string][]byte{
-			v1.TLSCertKey:       []byte(testCert),
-			v1.TLSPrivateKeyKey: []byte(testKey),
-		},
-		StringData: nil,
-		Type:       "kubernetes.io/tls",
-	})
-	if err != nil {
-		t.Error(err)
+	if len(fakeAPI.nb) != 0 || len(secondary.nb) != 1 {
+		t.Fatalf("expected the NodeBalancer to be created in the secondary account, got %d and %d NodeBalancers", len(fakeAPI.nb), len(secondary.nb))
+	}
+	for _, nb := range secondary.nb {
+		if nb.Region != "eu-west" {
+			t.Errorf("expected the NodeBalancer to be in eu-west, got %s", nb.Region)
+		}
+	}
+
+	if _, exists, err := lb.GetLoadBalancer(context.TODO(), "lnodelb", svc); err != nil || !exists {
+		t.Errorf("expected the NodeBalancer of the secondary account to be found, got %v (%v)", exists, err)
+	}
+
+	if err = lb.EnsureLoadBalancerDeleted(context.TODO(), "lnodelb", svc); err != nil {
+		t.Fatalf("EnsureLoadBalancerDeleted returned an error: %s", err)
+	}
+	if len(secondary.nb) != 0 {
+		t.Errorf("expected the NodeBalancer of the secondary account to be deleted, got %d", len(secondary.nb))
 	}
 }
@@ -0,0 +1,103 @@
+package linode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// jsonLogOutput is where log entries are written with the json log format.
+var (
+	jsonLogOutput   io.Writer = os.Stderr
+	jsonLogOutputMu sync.Mutex
+)
+
+func validateLogFormat(format string) error {
+	switch format {
+	case "", logFormatText, logFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid --log-format %q: must be %s or %s", format, logFormatText, logFormatJSON)
+	}
+}
+
+// logEntry holds the fields of a log entry of the reconcile paths. With the json log format they
+// are written as a JSON object alongside the message, otherwise the message is logged with klog.
+type logEntry struct {
+	Operation      string `json:"operation,omitempty"`
+	Service        string `json:"service,omitempty"`
+	NodeBalancerID int    `json:"nodebalancer_id,omitempty"`
+	LinodeID       int    `json:"linode_id,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// serviceLog returns the log entry of operation on the NodeBalancer nodeBalancerID of service,
+// where nodeBalancerID is 0 when it isn't known.
+func serviceLog(operation string, service *v1.Service, nodeBalancerID int) logEntry {
+	return logEntry{Operation: operation, Service: getServiceNn(service), NodeBalancerID: nodeBalancerID}
+}
+
+func (e logEntry) withError(err error) logEntry {
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+func (e logEntry) infof(format string, args ...interface{}) {
+	e.log("info", format, args...)
+}
+
+func (e logEntry) warningf(format string, args ...interface{}) {
+	e.log("warning", format, args...)
+}
+
+func (e logEntry) errorf(format string, args ...interface{}) {
+	e.log("error", format, args...)
+}
+
+func (e logEntry) log(level, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	if Options.LogFormat != logFormatJSON {
+		if e.Error != "" {
+			msg += ": " + e.Error
+		}
+		// The depth skips log and the level method, so that klog reports the caller's line.
+		switch level {
+		case "error":
+			klog.ErrorDepth(2, msg)
+		case "warning":
+			klog.WarningDepth(2, msg)
+		default:
+			klog.InfoDepth(2, msg)
+		}
+		return
+	}
+
+	line, err := json.Marshal(struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"msg"`
+		logEntry
+	}{time.Now().UTC().Format(time.RFC3339Nano), level, msg, e})
+	if err != nil {
+		klog.Errorf("failed to encode log entry %q: %s", msg, err)
+		return
+	}
+
+	jsonLogOutputMu.Lock()
+	defer jsonLogOutputMu.Unlock()
+	_, _ = jsonLogOutput.Write(append(line, '\n'))
+}
@@ -0,0 +1,60 @@
+package linode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLogEntryJSON(t *testing.T) {
+	var buf bytes.Buffer
+	jsonLogOutput = &buf
+	Options.LogFormat = logFormatJSON
+	defer func() {
+		jsonLogOutput = os.Stderr
+		Options.LogFormat = ""
+	}()
+
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	serviceLog("delete-nodebalancer", svc, 42).withError(errors.New("[404] Not found")).errorf("failed to delete NodeBalancer (%d)", 42)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log entry, got %q: %s", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"level":           "error",
+		"msg":             "failed to delete NodeBalancer (42)",
+		"operation":       "delete-nodebalancer",
+		"service":         "default/web",
+		"nodebalancer_id": float64(42),
+		"error":           "[404] Not found",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Error("expected the entry to have a time")
+	}
+	if _, ok := entry["linode_id"]; ok {
+		t.Error("expected unset fields to be omitted")
+	}
+}
+
+func TestValidateLogFormat(t *testing.T) {
+	for _, format := range []string{"", "text", "json"} {
+		if err := validateLogFormat(format); err != nil {
+			t.Errorf("unexpected error for format %q: %s", format, err)
+		}
+	}
+	if err := validateLogFormat("logfmt"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,163 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// metadataServiceURL is the base URL of the Linode metadata service, which is only reachable from
+// the Linode itself.
+var metadataServiceURL = "http://169.254.169.254"
+
+// metadataTimeout bounds the requests to the metadata service, so that a CCM that isn't running
+// on a Linode with the metadata service falls back to the API quickly.
+const metadataTimeout = 2 * time.Second
+
+// metadataRetryInterval is how long the API is used without trying the metadata service again
+// after it failed, so that lookups aren't slowed down by a metadata service that isn't there.
+var metadataRetryInterval = 5 * time.Minute
+
+// metadataTokenExpiry is how long the tokens of the metadata service are requested for, in
+// seconds. A token is only used for the lookup it was requested for, as the metadata is cached.
+const metadataTokenExpiry = "60"
+
+// instanceMetadata is the metadata of the Linode the CCM runs on that the CCM uses.
+type instanceMetadata struct {
+	ID     int    `json:"id"`
+	Label  string `json:"label"`
+	Region string `json:"region"`
+	Type   string `json:"type"`
+}
+
+// metadataClient reads the ID, label, region and type of the Linode the CCM runs on from the
+// Linode metadata service, e.g. when it runs as a node component, instead of spending API
+// requests on them. The metadata is cached once read, as it doesn't change while the Linode is
+// running.
+type metadataClient struct {
+	baseURL    string
+	httpClient *http.Client
+
+	now func() time.Time
+
+	mu       sync.Mutex
+	instance *instanceMetadata
+	failedAt time.Time
+}
+
+var (
+	sharedMetadataClient     *metadataClient
+	sharedMetadataClientOnce sync.Once
+)
+
+// getMetadataClient returns the client of the metadata service shared by instances and zones, or
+// nil unless Options.UseMetadataService is set.
+func getMetadataClient() *metadataClient {
+	if !Options.UseMetadataService {
+		return nil
+	}
+	sharedMetadataClientOnce.Do(func() {
+		sharedMetadataClient = newMetadataClient(metadataServiceURL)
+	})
+	return sharedMetadataClient
+}
+
+func newMetadataClient(baseURL string) *metadataClient {
+	return &metadataClient{baseURL: baseURL, httpClient: &http.Client{Timeout: metadataTimeout}, now: time.Now}
+}
+
+// getInstance returns the metadata of the Linode the CCM runs on. Failures are returned without
+// trying again for metadataRetryInterval.
+func (c *metadataClient) getInstance(ctx context.Context) (*instanceMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.instance != nil {
+		return c.instance, nil
+	}
+	if !c.failedAt.IsZero() && c.now().Sub(c.failedAt) < metadataRetryInterval {
+		return nil, fmt.Errorf("the metadata service failed less than %s ago", metadataRetryInterval)
+	}
+
+	instance, err := c.fetchInstance(ctx)
+	if err != nil {
+		c.failedAt = c.now()
+		return nil, err
+	}
+	c.instance = instance
+	return instance, nil
+}
+
+func (c *metadataClient) fetchInstance(ctx context.Context) (*instanceMetadata, error) {
+	token, err := c.do(ctx, http.MethodPut, "/v1/token", http.Header{"Metadata-Token-Expiry-Seconds": {metadataTokenExpiry}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a metadata service token: %v", err)
+	}
+
+	body, err := c.do(ctx, http.MethodGet, "/v1/instance", http.Header{
+		"Metadata-Token": {strings.TrimSpace(string(token))},
+		"Accept":         {"application/json"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the instance metadata: %v", err)
+	}
+
+	var instance instanceMetadata
+	if err := json.Unmarshal(body, &instance); err != nil {
+		return nil, fmt.Errorf("malformed instance metadata: %v", err)
+	}
+	if instance.ID == 0 || instance.Label == "" {
+		return nil, fmt.Errorf("instance metadata has no ID or label")
+	}
+	return &instance, nil
+}
+
+func (c *metadataClient) do(ctx context.Context, method, path string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header = header
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return body, nil
+}
+
+// getLocalInstance returns the metadata of the Linode the CCM runs on if nodeName is that Linode,
+// or nil if it isn't, or if the metadata service is disabled or unreachable, in which case the
+// API is used instead.
+func (c *metadataClient) getLocalInstance(ctx context.Context, nodeName types.NodeName) *instanceMetadata {
+	if c == nil {
+		return nil
+	}
+
+	instance, err := c.getInstance(ctx)
+	if err != nil {
+		klog.V(2).Infof("falling back to the Linode API to look up node %s: %s", nodeName, err)
+		return nil
+	}
+	if instance.Label != string(nodeName) {
+		return nil
+	}
+	return instance
+}
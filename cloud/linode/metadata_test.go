@@ -0,0 +1,115 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+)
+
+func newFakeMetadataService(t *testing.T, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/token":
+			if r.Header.Get("Metadata-Token-Expiry-Seconds") == "" {
+				t.Error("expected the token to be requested with an expiry")
+			}
+			_, _ = w.Write([]byte("metadata-token"))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/instance":
+			if r.Header.Get("Metadata-Token") != "metadata-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id": 123, "label": "local-node", "region": "eu-west", "type": "g6-standard-2"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMetadataInstances(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	var metadataRequests int32
+	metadataService := newFakeMetadataService(t, &metadataRequests)
+	defer metadataService.Close()
+
+	metadata := newMetadataClient(metadataService.URL)
+	i := &instances{client: &client, cache: newInstanceCache(0), metadata: metadata}
+	z := zones{client: &client, region: "us-west", metadata: metadata}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if id, err := i.InstanceID(context.TODO(), "local-node"); err != nil || id != "123" {
+			t.Errorf("expected the ID of the local node from the metadata service, got %q (%v)", id, err)
+		}
+	}
+	if instanceType, err := i.InstanceType(context.TODO(), "local-node"); err != nil || instanceType != "g6-standard-2" {
+		t.Errorf("expected the type of the local node from the metadata service, got %q (%v)", instanceType, err)
+	}
+	if zone, err := z.GetZoneByNodeName(context.TODO(), "local-node"); err != nil || zone.Region != "eu-west" {
+		t.Errorf("expected the region of the local node from the metadata service, got %v (%v)", zone, err)
+	}
+
+	if len(fakeAPI.requests) != 0 {
+		t.Errorf("expected the local node not to be looked up with the API, got %v", fakeAPI.requests)
+	}
+	if requests := atomic.LoadInt32(&metadataRequests); requests != 2 {
+		t.Errorf("expected the metadata to be read once and cached, got %d requests", requests)
+	}
+
+	// Other nodes are looked up with the API.
+	if id, err := i.InstanceID(context.TODO(), "test-instance"); err != nil || id != "123" {
+		t.Errorf("expected the ID of another node from the API, got %q (%v)", id, err)
+	}
+	if !fakeAPI.didRequestOccur(http.MethodGet, "/linode/instances", "") {
+		t.Error("expected another node to be looked up with the API")
+	}
+}
+
+func TestMetadataServiceUnreachable(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	var metadataRequests int32
+	metadataService := newFakeMetadataService(t, &metadataRequests)
+	metadataService.Close()
+
+	now := time.Now()
+	metadata := newMetadataClient(metadataService.URL)
+	metadata.now = func() time.Time { return now }
+	i := &instances{client: &client, cache: newInstanceCache(0), metadata: metadata}
+
+	if id, err := i.InstanceID(context.TODO(), "test-instance"); err != nil || id != "123" {
+		t.Errorf("expected the API to be used when the metadata service is unreachable, got %q (%v)", id, err)
+	}
+	if _, err := metadata.getInstance(context.TODO()); err == nil {
+		t.Error("expected an error for an unreachable metadata service")
+	}
+
+	// The metadata service is tried again once the retry interval passed.
+	restarted := newFakeMetadataService(t, &metadataRequests)
+	defer restarted.Close()
+	metadata.baseURL = restarted.URL
+	if _, err := metadata.getInstance(context.TODO()); err == nil {
+		t.Error("expected the metadata service not to be retried before the retry interval")
+	}
+	now = now.Add(metadataRetryInterval)
+	if instance, err := metadata.getInstance(context.TODO()); err != nil || instance.ID != 123 {
+		t.Errorf("expected the metadata service to be retried, got %+v (%v)", instance, err)
+	}
+}
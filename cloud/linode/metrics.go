@@ -0,0 +1,124 @@
+package linode
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+)
+
+const metricsNamespace = "linode_ccm"
+
+var (
+	apiRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_retries_total",
+			Help:      "Number of Linode API requests retried, by method and endpoint.",
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	apiRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_requests_total",
+			Help:      "Number of Linode API requests made, by method, endpoint and response code.",
+		},
+		[]string{"method", "endpoint", "code"},
+	)
+
+	loadBalancerOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "loadbalancer_operations_total",
+			Help:      "Number of LoadBalancer operations, by operation and result.",
+		},
+		[]string{"operation", "result"},
+	)
+
+	loadBalancerOperationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "loadbalancer_operation_duration_seconds",
+			Help:      "Duration of LoadBalancer operations, by operation.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"operation"},
+	)
+
+	nodeBalancerTransfer = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "nodebalancer_transfer_bytes",
+			Help:      "Transfer of the NodeBalancer of a Service so far this month, by namespace, service and direction (in, out or total).",
+		},
+		[]string{"namespace", "service", "direction"},
+	)
+
+	nodeBalancerNodeChanges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "nodebalancer_node_changes_total",
+			Help:      "Number of backend nodes added to, removed from or changing mode in a NodeBalancer, by namespace, service, NodeBalancer and change (add, remove or mode).",
+		},
+		[]string{"namespace", "service", "nodebalancer", "change"},
+	)
+
+	nodeBalancerTLSCertExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "nodebalancer_tls_cert_expiry_timestamp_seconds",
+			Help:      "Expiry of the TLS certificate of an https port of the NodeBalancer of a Service, as a Unix timestamp, by namespace, service and port.",
+		},
+		[]string{"namespace", "service", "port"},
+	)
+)
+
+// The collectors are registered with the default registry, which the cloud controller manager
+// serves on its /metrics endpoint.
+func init() {
+	prometheus.MustRegister(apiRetries, apiRequests, loadBalancerOperations, loadBalancerOperationDuration, nodeBalancerTransfer, nodeBalancerNodeChanges, nodeBalancerTLSCertExpiry)
+}
+
+// observeLoadBalancerOperation records the duration and result of a LoadBalancer operation that
+// started at start. It is meant to be deferred with a pointer to the operation's named error.
+func observeLoadBalancerOperation(operation string, start time.Time, err *error) {
+	result := "success"
+	if *err != nil {
+		result = "error"
+	}
+
+	loadBalancerOperations.WithLabelValues(operation, result).Inc()
+	loadBalancerOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// observeNodeBalancerNodeChange counts a change of the backend nodes of NodeBalancer
+// nodeBalancerID made through the Linode API on behalf of service, which is nil for changes not
+// made on behalf of a Service.
+func observeNodeBalancerNodeChange(service *v1.Service, nodeBalancerID int, change string) {
+	var namespace, name string
+	if service != nil {
+		namespace, name = service.Namespace, service.Name
+	}
+	nodeBalancerNodeChanges.WithLabelValues(namespace, name, strconv.Itoa(nodeBalancerID), change).Inc()
+}
+
+// metricsTransport is an http.RoundTripper counting the Linode API requests going through it.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequests.WithLabelValues(req.Method, normalizeEndpoint(req.URL.Path), code).Inc()
+
+	return resp, err
+}
@@ -0,0 +1,58 @@
+package linode
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := counter.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func Test_observeLoadBalancerOperation(t *testing.T) {
+	successes := counterValue(t, loadBalancerOperations.WithLabelValues("test", "success"))
+	errs := counterValue(t, loadBalancerOperations.WithLabelValues("test", "error"))
+
+	var err error
+	observeLoadBalancerOperation("test", time.Now(), &err)
+	err = errors.New("failed")
+	observeLoadBalancerOperation("test", time.Now(), &err)
+
+	if actual := counterValue(t, loadBalancerOperations.WithLabelValues("test", "success")); actual != successes+1 {
+		t.Errorf("expected %v successful operations, got %v", successes+1, actual)
+	}
+	if actual := counterValue(t, loadBalancerOperations.WithLabelValues("test", "error")); actual != errs+1 {
+		t.Errorf("expected %v failed operations, got %v", errs+1, actual)
+	}
+}
+
+func TestMetricsTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	counter := apiRequests.WithLabelValues(http.MethodGet, "/v4/nodebalancers/{id}", "404")
+	before := counterValue(t, counter)
+
+	client := &http.Client{Transport: metricsTransport{next: http.DefaultTransport}}
+	resp, err := client.Get(ts.URL + "/v4/nodebalancers/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if actual := counterValue(t, counter); actual != before+1 {
+		t.Errorf("expected %v requests, got %v", before+1, actual)
+	}
+}
@@ -0,0 +1,99 @@
+package linode
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// annLinodeNodeTagTemplate is the annotation holding a text/template generating the labels of the
+// NodeBalancer nodes of a Service, e.g. {{ .Namespace }}.{{ .Name }}.{{ .Node }}, so that the
+// Service a backend belongs to can be told from a shared NodeBalancer. NodeBalancer nodes can't be
+// tagged, so their label encodes the Service instead.
+const annLinodeNodeTagTemplate = "service.beta.kubernetes.io/linode-loadbalancer-node-tag-template"
+
+// nodeBalancerNodeLabelData is what the node-tag-template annotation is executed with for each
+// node: the fields of the nodebalancer-label-template along with the node.
+type nodeBalancerNodeLabelData struct {
+	nodeBalancerLabelData
+	// Node and NodeLabels are the name and labels of the node.
+	Node       string
+	NodeLabels map[string]string
+}
+
+// getNodeLabelTemplate returns the parsed node-tag-template annotation of service, or nil if it
+// has none. Missing keys are errors, like in the nodebalancer-label-template.
+func getNodeLabelTemplate(service *v1.Service) (*template.Template, error) {
+	text, ok := getServiceAnnotation(service, annLinodeNodeTagTemplate)
+	if !ok {
+		return nil, nil
+	}
+	tmpl, err := template.New("node-tag").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", annLinodeNodeTagTemplate, text, err)
+	}
+	return tmpl, nil
+}
+
+// executeNodeLabelTemplate returns the label tmpl generates for the NodeBalancer nodes of node.
+// Labels the Linode API doesn't accept are sanitized like node names, so the label only depends on
+// the Service and the node and doesn't change between reconciles.
+func executeNodeLabelTemplate(tmpl *template.Template, service *v1.Service, node *v1.Node) (string, error) {
+	var label strings.Builder
+	err := tmpl.Execute(&label, nodeBalancerNodeLabelData{
+		nodeBalancerLabelData: nodeBalancerLabelData{
+			Namespace: service.Namespace,
+			Name:      service.Name,
+			UID:       strings.Replace(string(service.UID), "-", "", -1),
+			Cluster:   getClusterName(),
+			Labels:    service.Labels,
+		},
+		Node:       node.Name,
+		NodeLabels: node.Labels,
+	})
+	if err != nil {
+		return "", err
+	}
+	if label.Len() == 0 {
+		return "", fmt.Errorf("the label of node %s is empty", node.Name)
+	}
+	return nodeBalancerNodeLabel(label.String()), nil
+}
+
+// getNodeBalancerNodeLabels returns the labels of the NodeBalancer nodes of nodes for service, by
+// node name. Nodes the node-tag-template annotation fails for get the label of their name, with
+// a single event for all of them that is only recorded again once they change, like the events
+// of skipped nodes.
+func (l *loadbalancers) getNodeBalancerNodeLabels(service *v1.Service, nodes []*v1.Node) (map[string]string, error) {
+	tmpl, err := getNodeLabelTemplate(service)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(nodes))
+	var failed []string
+	var firstErr error
+	for _, node := range nodes {
+		labels[node.Name] = nodeBalancerNodeLabel(node.Name)
+		if tmpl == nil {
+			continue
+		}
+		label, err := executeNodeLabelTemplate(tmpl, service, node)
+		if err != nil {
+			failed = append(failed, node.Name)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		labels[node.Name] = label
+	}
+
+	if len(failed) > 0 {
+		l.recordNodesEvent(service, v1.EventTypeWarning, "InvalidNodeTagTemplate", fmt.Sprintf("%s failed for %s (%s), labeling them with their name instead: %s",
+			annLinodeNodeTagTemplate, countNodes(failed), describeSkippedNodes(failed), firstErr))
+	}
+	return labels, nil
+}
@@ -0,0 +1,130 @@
+package linode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestNodeBalancerNodeLabels(t *testing.T) {
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": "general"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+	}
+
+	for _, test := range []struct {
+		name     string
+		template string
+		expected map[string]string
+		event    string
+	}{
+		{
+			name:     "without template",
+			expected: map[string]string{"node-1": "node-1", "node-2": "node-2"},
+		},
+		{
+			name:     "service and node",
+			template: "{{ .Namespace }}.{{ .Name }}.{{ .Node }}",
+			expected: map[string]string{"node-1": "default.web.node-1", "node-2": "default.web.node-2"},
+		},
+		{
+			name:     "sanitized",
+			template: "{{ .Labels.team }}/{{ .Name }}/{{ .UID }}/{{ .Node }}",
+			expected: map[string]string{
+				"node-1": nodeBalancerNodeLabel("payments/web/foobar123/node-1"),
+				"node-2": nodeBalancerNodeLabel("payments/web/foobar123/node-2"),
+			},
+		},
+		{
+			name:     "missing key",
+			template: "{{ .NodeLabels.pool }}-{{ .Node }}",
+			expected: map[string]string{"node-1": "general-node-1", "node-2": "node-2"},
+			event:    "InvalidNodeTagTemplate service.beta.kubernetes.io/linode-loadbalancer-node-tag-template failed for 1 node (node-2)",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "web",
+					Namespace: "default",
+					UID:       "foobar123",
+					Labels:    map[string]string{"team": "payments"},
+				},
+			}
+			if test.template != "" {
+				svc.Annotations = map[string]string{annLinodeNodeTagTemplate: test.template}
+			}
+			recorder := record.NewFakeRecorder(10)
+			lb := &loadbalancers{recorder: recorder}
+
+			labels, err := lb.getNodeBalancerNodeLabels(svc, nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for name, expected := range test.expected {
+				if labels[name] != expected {
+					t.Errorf("expected node %s to be labeled %q, got %q", name, expected, labels[name])
+				}
+				if len(labels[name]) > maxNodeLabelLength || invalidNodeLabelChars.MatchString(labels[name]) {
+					t.Errorf("expected node %s to have a valid label, got %q", name, labels[name])
+				}
+			}
+
+			if test.event == "" {
+				if len(recorder.Events) != 0 {
+					t.Errorf("expected no events, got %q", <-recorder.Events)
+				}
+			} else if event := <-recorder.Events; !strings.Contains(event, test.event) {
+				t.Errorf("expected an event containing %q, got %q", test.event, event)
+			}
+
+			// The labels don't change between reconciles.
+			again, err := lb.getNodeBalancerNodeLabels(svc, nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for name := range test.expected {
+				if again[name] != labels[name] {
+					t.Errorf("expected node %s to keep label %q, got %q", name, labels[name], again[name])
+				}
+			}
+		})
+	}
+}
+
+func TestNodeLabelTemplateBackends(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{annLinodeNodeTagTemplate: "{{ .Name }}-{{ .Node }}"},
+		},
+	}
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}}
+	lb := &loadbalancers{recorder: record.NewFakeRecorder(10)}
+
+	nbNodes, err := lb.buildNodeBalancerNodes(svc, nodes, 30000, linodego.AlgorithmRoundRobin)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nbNodes) != 1 || nbNodes[0].Label != "web-node-1" || nbNodes[0].Address != "10.0.0.1:30000" {
+		t.Errorf("expected node web-node-1 at 10.0.0.1:30000, got %v", nbNodes)
+	}
+}
+
+func Test_getNodeLabelTemplate(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annLinodeNodeTagTemplate: "{{ .Node"}}}
+	if _, err := getNodeLabelTemplate(svc); err == nil {
+		t.Error("expected an error for a template that can't be parsed")
+	}
+	if err := validateServiceAnnotations(svc); err == nil || !strings.Contains(err.Error(), annLinodeNodeTagTemplate) {
+		t.Errorf("expected the annotations to be invalid, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/wait"
+	"github.com/linode/linodego"
+	"k8s.io/apimachinery/pkg/labels"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// clusterTagPrefix prefixes the tag recording which cluster created a NodeBalancer, e.g.
+// "ccm-cluster:kubernetes".
+const clusterTagPrefix = "ccm-cluster:"
+
+// defaultClusterName is the default of --cluster-name. Clusters sharing a Linode account all
+// tag their NodeBalancers with it unless they are given their own name, so it doesn't tell their
+// NodeBalancers apart.
+const defaultClusterName = "kubernetes"
+
+// getClusterName returns the --cluster-name of the cloud controller manager, or an empty string if
+// it isn't known.
+func getClusterName() string {
+	if Options.ClusterNameFlag == nil {
+		return ""
+	}
+	return Options.ClusterNameFlag.Value.String()
+}
+
+// getClusterTag returns the tag identifying NodeBalancers created for this cluster, or an empty
+// string if the cluster name isn't known.
+func getClusterTag() string {
+	if clusterName := getClusterName(); clusterName != "" {
+		return clusterTagPrefix + clusterName
+	}
+	return ""
+}
+
+// getGCClusterTag returns the tag of the NodeBalancers the GC may delete. The GC refuses to run
+// without a unique cluster name, as it would otherwise take the NodeBalancers of other clusters
+// of the account using the default name for its own orphans.
+func getGCClusterTag() (string, error) {
+	switch getClusterName() {
+	case "":
+		return "", fmt.Errorf("--cluster-name is required to garbage-collect NodeBalancers")
+	case defaultClusterName:
+		return "", fmt.Errorf("--cluster-name must be set to a name unique to the cluster to garbage-collect NodeBalancers, not the default %q", defaultClusterName)
+	}
+	return getClusterTag(), nil
+}
+
+// belongsToOtherCluster reports whether nb is tagged as used by another cluster. The check is
+// skipped if the cluster name isn't known or is the default, which other clusters may share.
+func belongsToOtherCluster(nb *linodego.NodeBalancer) bool {
+	clusterTag := getClusterTag()
+	if clusterTag == "" || getClusterName() == defaultClusterName || containsString(nb.Tags, clusterTag) {
+		return false
+	}
+	for _, tag := range nb.Tags {
+		if strings.HasPrefix(tag, clusterTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeBalancerGC periodically deletes the NodeBalancers created for this cluster whose Services
+// were deleted while the CCM wasn't running.
+type nodeBalancerGC struct {
+	loadbalancers *loadbalancers
+	services      v1listers.ServiceLister
+	hasSynced     cache.InformerSynced
+	clusterTag    string
+}
+
+func newNodeBalancerGC(loadbalancers *loadbalancers, informer cache.SharedIndexInformer, clusterTag string) *nodeBalancerGC {
+	return &nodeBalancerGC{
+		loadbalancers: loadbalancers,
+		services:      v1listers.NewServiceLister(informer.GetIndexer()),
+		hasSynced:     informer.HasSynced,
+		clusterTag:    clusterTag,
+	}
+}
+
+func (g *nodeBalancerGC) Run(interval time.Duration, stopCh <-chan struct{}) {
+	// A partially synced cache would make NodeBalancers in use look orphaned.
+	if !cache.WaitForCacheSync(stopCh, g.hasSynced) {
+		klog.Errorf("NodeBalancer GC failed to sync the service cache")
+		return
+	}
+
+	wait.Until(func() {
+		if err := g.collect(context.Background()); err != nil {
+			klog.Errorf("NodeBalancer GC failed: %s", err)
+		}
+	}, interval, stopCh)
+}
+
+// collect deletes the orphaned NodeBalancers of this cluster.
+func (g *nodeBalancerGC) collect(ctx context.Context) error {
+	services, err := g.services.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	serviceUIDs := make(map[string]bool, len(services))
+	for _, service := range services {
+		serviceUIDs[string(service.UID)] = true
+	}
+
+	nbs, err := g.loadbalancers.client.ListNodeBalancers(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for i := range nbs {
+		nb := &nbs[i]
+		if !g.isOrphaned(nb, serviceUIDs) {
+			continue
+		}
+
+		if g.loadbalancers.dryRun {
+			g.loadbalancers.logDryRun(nil, dryRunChange{Action: "delete-orphaned-nodebalancer", NodeBalancerID: nb.ID, Current: nb})
+			continue
+		}
+
+		klog.Infof("deleting orphaned NodeBalancer (%d) with tags %v", nb.ID, nb.Tags)
+		if err := g.loadbalancers.client.DeleteNodeBalancer(ctx, nb.ID); err != nil {
+			klog.Errorf("failed to delete orphaned NodeBalancer (%d): %s", nb.ID, err)
+			continue
+		}
+		g.loadbalancers.drains.forgetConfig(nb.ID, 0)
+
+		// The firewalls created for the owners' ACLs or source ranges aren't deleted with nb.
+		if err := g.loadbalancers.deleteOwnedFirewalls(ctx, getNodeBalancerOwners(nb)); err != nil {
+			klog.Errorf("failed to delete the firewalls of orphaned NodeBalancer (%d): %s", nb.ID, err)
+		}
+	}
+	return nil
+}
+
+// isOrphaned reports whether nb was created for this cluster and none of the Services owning it,
+// by their UID tag or its ports, exist anymore. NodeBalancers without owners are never considered
+// orphaned, as they may have been created manually or be preserved, and retained NodeBalancers
+// are left for manual review.
+func (g *nodeBalancerGC) isOrphaned(nb *linodego.NodeBalancer, serviceUIDs map[string]bool) bool {
+	hasClusterTag := false
+	for _, tag := range nb.Tags {
+		if tag == g.clusterTag {
+			hasClusterTag = true
+			break
+		}
+	}
+	if !hasClusterTag || containsString(nb.Tags, retainedTag) {
+		return false
+	}
+
+	owners := getNodeBalancerOwners(nb)
+	if len(owners) == 0 {
+		return false
+	}
+	for _, uid := range owners {
+		if serviceUIDs[uid] {
+			return false
+		}
+	}
+	return true
+}
+
+// getNodeBalancerOwners returns the UIDs of the Services owning nb by its UID tag or its ports.
+func getNodeBalancerOwners(nb *linodego.NodeBalancer) []string {
+	owners := getServiceUIDs(nb)
+	for _, uid := range getPortOwners(nb) {
+		owners = append(owners, uid)
+	}
+	return owners
+}
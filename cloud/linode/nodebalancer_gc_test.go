@@ -0,0 +1,167 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linode/linodego"
+	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNodeBalancerGC(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	const clusterTag = clusterTagPrefix + "test"
+	newNodeBalancer := func(tags ...string) *linodego.NodeBalancer {
+		nb, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+			Region: "us-west",
+			Tags:   tags,
+		})
+		if err != nil {
+			t.Fatalf("failed to create NodeBalancer: %s", err)
+		}
+		return nb
+	}
+
+	orphaned := newNodeBalancer(clusterTag, "ccm:80:deleted-uid")
+	inUse := newNodeBalancer(clusterTag, "ccm:80:existing-uid")
+	partlyInUse := newNodeBalancer(clusterTag, "ccm:80:deleted-uid", "ccm:443:existing-uid")
+	otherCluster := newNodeBalancer(clusterTagPrefix+"other", "ccm:80:deleted-uid")
+	untagged := newNodeBalancer("ccm:80:deleted-uid")
+	unowned := newNodeBalancer(clusterTag)
+	uidInUse := newNodeBalancer(clusterTag, "ccm-service-uid:existing-uid", "ccm:80:deleted-uid")
+	uidOrphaned := newNodeBalancer(clusterTag, "ccm-service-uid:deleted-uid")
+
+	newFirewall := func(tags ...string) *linodego.Firewall {
+		firewall, err := client.CreateFirewall(context.TODO(), linodego.FirewallCreateOptions{Tags: tags})
+		if err != nil {
+			t.Fatalf("failed to create firewall: %s", err)
+		}
+		return firewall
+	}
+
+	orphanedFirewall := newFirewall(firewallOwnerTagPrefix + "deleted-uid")
+	inUseFirewall := newFirewall(firewallOwnerTagPrefix + "existing-uid")
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "existing", UID: "existing-uid"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	gc := &nodeBalancerGC{
+		loadbalancers: &loadbalancers{client: &client, zone: "us-west"},
+		services:      v1listers.NewServiceLister(indexer),
+		clusterTag:    clusterTag,
+	}
+	if err := gc.collect(context.TODO()); err != nil {
+		t.Fatalf("collect returned an error: %s", err)
+	}
+
+	for _, test := range []struct {
+		nb      *linodego.NodeBalancer
+		deleted bool
+	}{
+		{orphaned, true},
+		{inUse, false},
+		{partlyInUse, false},
+		{otherCluster, false},
+		{untagged, false},
+		{unowned, false},
+		{uidInUse, false},
+		{uidOrphaned, true},
+	} {
+		deleted := fake.didRequestOccur(http.MethodDelete, fmt.Sprintf("/nodebalancers/%d", test.nb.ID), "")
+		if deleted != test.deleted {
+			t.Errorf("expected NodeBalancer with tags %v to be deleted: %t; deleted: %t", test.nb.Tags, test.deleted, deleted)
+		}
+	}
+
+	for _, test := range []struct {
+		firewall *linodego.Firewall
+		deleted  bool
+	}{
+		{orphanedFirewall, true},
+		{inUseFirewall, false},
+	} {
+		if _, found := fake.fw[test.firewall.ID]; found == test.deleted {
+			t.Errorf("expected firewall with tags %v to be deleted: %t; found: %t", test.firewall.Tags, test.deleted, found)
+		}
+	}
+}
+
+func TestBelongsToOtherCluster(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("cluster-name", "test", "")
+	Options.ClusterNameFlag = flags.Lookup("cluster-name")
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	for _, test := range []struct {
+		name     string
+		tags     []string
+		expected bool
+	}{
+		{"untagged", nil, false},
+		{"this cluster", []string{clusterTagPrefix + "test"}, false},
+		{"other cluster", []string{clusterTagPrefix + "other"}, true},
+		{"shared with this cluster", []string{clusterTagPrefix + "other", clusterTagPrefix + "test"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := belongsToOtherCluster(&linodego.NodeBalancer{Tags: test.tags}); actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+		})
+	}
+
+	Options.ClusterNameFlag = nil
+	if belongsToOtherCluster(&linodego.NodeBalancer{Tags: []string{clusterTagPrefix + "other"}}) {
+		t.Error("expected no NodeBalancer to belong to another cluster when the cluster name isn't known")
+	}
+}
+
+func TestGetGCClusterTag(t *testing.T) {
+	defer func() { Options.ClusterNameFlag = nil }()
+
+	if _, err := getGCClusterTag(); err == nil {
+		t.Error("expected the GC to refuse to run without a cluster name")
+	}
+
+	for _, test := range []struct {
+		clusterName string
+		expected    string
+	}{
+		{defaultClusterName, ""},
+		{"test", clusterTagPrefix + "test"},
+	} {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.String("cluster-name", test.clusterName, "")
+		Options.ClusterNameFlag = flags.Lookup("cluster-name")
+
+		tag, err := getGCClusterTag()
+		if test.expected == "" && err == nil {
+			t.Errorf("%s: expected the GC to refuse to run, got tag %q", test.clusterName, tag)
+		}
+		if test.expected != "" && (err != nil || tag != test.expected) {
+			t.Errorf("%s: expected tag %q, got %q, %v", test.clusterName, test.expected, tag, err)
+		}
+	}
+
+	// Clusters using the default name may share it, so their tag doesn't tell them apart.
+	if err := Options.ClusterNameFlag.Value.Set(defaultClusterName); err != nil {
+		t.Fatal(err)
+	}
+	if belongsToOtherCluster(&linodego.NodeBalancer{Tags: []string{clusterTagPrefix + "other"}}) {
+		t.Error("expected the ownership check to be skipped with the default cluster name")
+	}
+}
@@ -0,0 +1,171 @@
+package linode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sync"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// defaultNodeConcurrency is the number of node requests syncNodeBalancerNodes makes at once when
+// Options.NodeBalancerNodeConcurrency isn't set.
+const defaultNodeConcurrency = 10
+
+const (
+	// minNodeLabelLength and maxNodeLabelLength are the bounds of the length of NodeBalancer node
+	// labels accepted by the Linode API.
+	minNodeLabelLength = 3
+	maxNodeLabelLength = 32
+
+	// nodeLabelHashLength is the number of hex digits of the hash suffixing sanitized labels.
+	nodeLabelHashLength = 8
+)
+
+// invalidNodeLabelChars matches the characters the Linode API rejects in NodeBalancer node labels.
+var invalidNodeLabelChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// nodeBalancerNodeLabel returns the label of the NodeBalancer nodes of the Kubernetes node name.
+// Names the Linode API accepts are used as is. Others, e.g. the long names of some managed node
+// pools, have their invalid characters replaced and are cut to fit, suffixed with a hash of the
+// whole name so that names sharing a prefix keep distinct labels. The label only depends on the
+// name, so it doesn't change between reconciles.
+func nodeBalancerNodeLabel(name string) string {
+	if len(name) >= minNodeLabelLength && len(name) <= maxNodeLabelLength && !invalidNodeLabelChars.MatchString(name) {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:nodeLabelHashLength]
+	prefix := invalidNodeLabelChars.ReplaceAllString(name, "_")
+	if max := maxNodeLabelLength - len(suffix); len(prefix) > max {
+		prefix = prefix[:max]
+	}
+	return prefix + suffix
+}
+
+// nodeOperation is a request creating, updating or deleting a single NodeBalancer node.
+type nodeOperation func(ctx context.Context) error
+
+// syncNodeBalancerNodes makes the backend nodes of config match desired, creating, updating and
+// deleting nodes concurrently with at most Options.NodeBalancerNodeConcurrency requests at once.
+// Nodes are matched by address, so the order of desired doesn't matter. The errors of individual
+// nodes are aggregated rather than aborting the sync, so that one failing node doesn't keep the
+// others from being synced.
+func (l *loadbalancers) syncNodeBalancerNodes(ctx context.Context, service *v1.Service, config *linodego.NodeBalancerConfig, desired []linodego.NodeBalancerNodeCreateOptions) error {
+	return l.syncNodeBalancerNodesWithThreshold(ctx, service, config, desired, Options.NodeBalancerNodeFailureThreshold)
+}
+
+// syncNodeBalancerNodesWithThreshold is syncNodeBalancerNodes tolerating the failures of less than
+// failureThreshold percent of the nodes. A failureThreshold of 0 fails on any node.
+func (l *loadbalancers) syncNodeBalancerNodesWithThreshold(ctx context.Context, service *v1.Service, config *linodego.NodeBalancerConfig, desired []linodego.NodeBalancerNodeCreateOptions, failureThreshold int) error {
+	var current []linodego.NodeBalancerNode
+
+	// Configs created during a dry run don't exist yet, so they have no nodes.
+	if !l.dryRun || config.ID != 0 {
+		var err error
+		if current, err = l.client.ListNodeBalancerNodes(ctx, config.NodeBalancerID, config.ID, nil); err != nil {
+			return err
+		}
+	}
+
+	err := runNodeOperations(ctx, getNodeConcurrency(), l.diffNodeBalancerNodes(service, config, current, desired))
+	if err == nil {
+		return nil
+	}
+
+	// A few nodes in a bad state shouldn't keep the other backends from being updated, so their
+	// failures are only reported unless they reach the threshold.
+	failed, total := len(err.(utilerrors.Aggregate).Errors()), countSyncedNodes(current, desired)
+	if failed*100 < total*failureThreshold {
+		l.recordEvent(service, v1.EventTypeWarning, "NodeSyncPartiallyFailed",
+			"%d of %d nodes of NodeBalancer (%d) config (%d) failed to sync: %s", failed, total, config.NodeBalancerID, config.ID, err)
+		return nil
+	}
+	return err
+}
+
+// countSyncedNodes returns the number of nodes a sync from current to desired involves, i.e. the
+// desired nodes and the current ones being deleted.
+func countSyncedNodes(current []linodego.NodeBalancerNode, desired []linodego.NodeBalancerNodeCreateOptions) int {
+	addresses := make(map[string]bool, len(desired)+len(current))
+	for _, node := range desired {
+		addresses[node.Address] = true
+	}
+	for _, node := range current {
+		addresses[node.Address] = true
+	}
+	return len(addresses)
+}
+
+// diffNodeBalancerNodes returns the operations turning the current nodes of config into desired.
+func (l *loadbalancers) diffNodeBalancerNodes(service *v1.Service, config *linodego.NodeBalancerConfig, current []linodego.NodeBalancerNode, desired []linodego.NodeBalancerNodeCreateOptions) []nodeOperation {
+	currentByAddress := make(map[string]linodego.NodeBalancerNode, len(current))
+	for _, node := range current {
+		currentByAddress[node.Address] = node
+	}
+
+	var operations []nodeOperation
+	for _, node := range desired {
+		node := node
+		existing, ok := currentByAddress[node.Address]
+		if !ok {
+			operations = append(operations, func(ctx context.Context) error {
+				return l.createNodeBalancerNode(ctx, service, config, node)
+			})
+			continue
+		}
+		delete(currentByAddress, node.Address)
+
+		if !nodeNeedsUpdate(existing, node) {
+			continue
+		}
+		update := linodego.NodeBalancerNodeUpdateOptions{Label: node.Label, Weight: node.Weight, Mode: node.Mode}
+		operations = append(operations, func(ctx context.Context) error {
+			return l.updateNodeBalancerNode(ctx, service, config, existing, update)
+		})
+	}
+
+	for _, node := range currentByAddress {
+		node := node
+		operations = append(operations, func(ctx context.Context) error {
+			return l.deleteNodeBalancerNode(ctx, service, config, node)
+		})
+	}
+	return operations
+}
+
+func nodeNeedsUpdate(current linodego.NodeBalancerNode, desired linodego.NodeBalancerNodeCreateOptions) bool {
+	return current.Label != desired.Label ||
+		(desired.Weight != 0 && current.Weight != desired.Weight) ||
+		(desired.Mode != "" && current.Mode != desired.Mode)
+}
+
+// runNodeOperations runs operations with at most concurrency of them at once and returns their
+// aggregated errors.
+func runNodeOperations(ctx context.Context, concurrency int, operations []nodeOperation) error {
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	workqueue.Parallelize(concurrency, len(operations), func(i int) {
+		if err := operations[i](ctx); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+	})
+	return utilerrors.NewAggregate(errs)
+}
+
+func getNodeConcurrency() int {
+	if Options.NodeBalancerNodeConcurrency > 0 {
+		return Options.NodeBalancerNodeConcurrency
+	}
+	return defaultNodeConcurrency
+}
@@ -0,0 +1,419 @@
+package linode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+)
+
+func newNodeSyncTest(tb testing.TB, handler func(http.Handler) http.Handler) (*loadbalancers, *linodego.NodeBalancerConfig) {
+	fake := newFake(tb)
+	ts := httptest.NewServer(handler(fake))
+	tb.Cleanup(ts.Close)
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	nb, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	config, err := client.CreateNodeBalancerConfig(context.TODO(), nb.ID, linodego.NodeBalancerConfigCreateOptions{
+		Port:         80,
+		Protocol:     linodego.ProtocolTCP,
+		CheckPassive: new(bool),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &loadbalancers{client: &client, zone: "us-west"}, config
+}
+
+func TestSyncNodeBalancerNodes(t *testing.T) {
+	lb, config := newNodeSyncTest(t, func(h http.Handler) http.Handler { return h })
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "foobar123"}}
+
+	newNode := func(label, address string, mode linodego.NodeMode) linodego.NodeBalancerNodeCreateOptions {
+		return linodego.NodeBalancerNodeCreateOptions{Address: address, Label: label, Mode: mode, Weight: 100}
+	}
+	for _, node := range []linodego.NodeBalancerNodeCreateOptions{
+		newNode("node-a", "10.0.0.1:30000", linodego.ModeAccept),
+		newNode("node-b", "10.0.0.2:30000", linodego.ModeAccept),
+		newNode("node-c", "10.0.0.3:30000", linodego.ModeAccept),
+	} {
+		if _, err := lb.client.CreateNodeBalancerNode(context.TODO(), config.NodeBalancerID, config.ID, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	desired := []linodego.NodeBalancerNodeCreateOptions{
+		newNode("node-d", "10.0.0.4:30000", linodego.ModeAccept),
+		newNode("node-b", "10.0.0.2:30000", linodego.ModeDrain),
+		newNode("node-a", "10.0.0.1:30000", linodego.ModeAccept),
+	}
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err != nil {
+		t.Fatalf("syncNodeBalancerNodes returned an error: %s", err)
+	}
+
+	nodes, err := lb.client.ListNodeBalancerNodes(context.TODO(), config.NodeBalancerID, config.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		actual = append(actual, fmt.Sprintf("%s %s %s", node.Label, node.Address, node.Mode))
+	}
+	sort.Strings(actual)
+
+	expected := []string{
+		"node-a 10.0.0.1:30000 accept",
+		"node-b 10.0.0.2:30000 drain",
+		"node-d 10.0.0.4:30000 accept",
+	}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Error("unexpected nodes")
+		t.Logf("expected: %v", expected)
+		t.Logf("actual: %v", actual)
+	}
+}
+
+func TestSyncNodeBalancerNodesChangeMetrics(t *testing.T) {
+	lb, config := newNodeSyncTest(t, func(h http.Handler) http.Handler { return h })
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "churn", Namespace: "default", UID: "foobar123"}}
+
+	newNode := func(label, address string, mode linodego.NodeMode) linodego.NodeBalancerNodeCreateOptions {
+		return linodego.NodeBalancerNodeCreateOptions{Address: address, Label: label, Mode: mode, Weight: 100}
+	}
+	for _, node := range []linodego.NodeBalancerNodeCreateOptions{
+		newNode("node-a", "10.0.0.1:30000", linodego.ModeAccept),
+		newNode("node-b", "10.0.0.2:30000", linodego.ModeAccept),
+		newNode("node-c", "10.0.0.3:30000", linodego.ModeAccept),
+	} {
+		if _, err := lb.client.CreateNodeBalancerNode(context.TODO(), config.NodeBalancerID, config.ID, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := func() map[string]float64 {
+		values := make(map[string]float64)
+		for _, change := range []string{"add", "remove", "mode"} {
+			counter := nodeBalancerNodeChanges.WithLabelValues("default", "churn", strconv.Itoa(config.NodeBalancerID), change)
+			values[change] = counterValue(t, counter)
+		}
+		return values
+	}
+	expectChanges := func(stage string, before map[string]float64, expected map[string]float64) {
+		for change, value := range changes() {
+			if value-before[change] != expected[change] {
+				t.Errorf("%s: expected %v %s changes, got %v", stage, expected[change], change, value-before[change])
+			}
+		}
+	}
+
+	desired := []linodego.NodeBalancerNodeCreateOptions{
+		newNode("node-d", "10.0.0.4:30000", linodego.ModeAccept),
+		newNode("node-b", "10.0.0.2:30000", linodego.ModeDrain),
+		newNode("node-a", "10.0.0.1:30000", linodego.ModeAccept),
+		newNode("node-e", "10.0.0.5:30000", linodego.ModeAccept),
+	}
+	before := changes()
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err != nil {
+		t.Fatalf("syncNodeBalancerNodes returned an error: %s", err)
+	}
+	expectChanges("synced", before, map[string]float64{"add": 2, "remove": 1, "mode": 1})
+
+	// Syncs without changes make no API calls, so they aren't counted.
+	before = changes()
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err != nil {
+		t.Fatalf("syncNodeBalancerNodes returned an error: %s", err)
+	}
+	expectChanges("no-op", before, nil)
+
+	// Neither are the changes only logged in dry-run mode.
+	lb.dryRun = true
+	lb.onDryRun = func(dryRunChange) {}
+	before = changes()
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired[:1]); err != nil {
+		t.Fatalf("syncNodeBalancerNodes returned an error: %s", err)
+	}
+	expectChanges("dry run", before, nil)
+}
+
+func TestSyncNodeBalancerNodesPartialFailure(t *testing.T) {
+	failing := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/nodes") {
+				body, _ := ioutil.ReadAll(r.Body)
+				if strings.Contains(string(body), "10.0.0.3") {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors": [{"reason": "Address must be a private IPv4 address"}]}`))
+					return
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "foobar123"}}
+
+	desired := make([]linodego.NodeBalancerNodeCreateOptions, 0, 4)
+	for i := 1; i <= 4; i++ {
+		desired = append(desired, linodego.NodeBalancerNodeCreateOptions{
+			Address: fmt.Sprintf("10.0.0.%d:30000", i),
+			Label:   fmt.Sprintf("node-%d", i),
+			Mode:    linodego.ModeAccept,
+			Weight:  100,
+		})
+	}
+
+	lb, config := newNodeSyncTest(t, failing)
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err == nil {
+		t.Error("expected the failure to fail the sync without a threshold")
+	}
+
+	Options.NodeBalancerNodeFailureThreshold = 50
+	defer func() { Options.NodeBalancerNodeFailureThreshold = 0 }()
+
+	recorder := record.NewFakeRecorder(10)
+	lb, config = newNodeSyncTest(t, failing)
+	lb.recorder = recorder
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err != nil {
+		t.Fatalf("expected one of four node failures to be tolerated, got %s", err)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "NodeSyncPartiallyFailed") || !strings.Contains(event, "1 of 4 nodes") {
+		t.Errorf("expected NodeSyncPartiallyFailed event, got %q", event)
+	}
+	nodes, err := lb.client.ListNodeBalancerNodes(context.TODO(), config.NodeBalancerID, config.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Errorf("expected the other 3 nodes to be added, got %d", len(nodes))
+	}
+
+	lb, config = newNodeSyncTest(t, failing)
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired[1:3]); err == nil {
+		t.Error("expected one of two node failures to fail the sync")
+	}
+}
+
+func TestDetachServiceBackendsFailsOnAnyNode(t *testing.T) {
+	Options.NodeBalancerNodeFailureThreshold = 50
+	defer func() { Options.NodeBalancerNodeFailureThreshold = 0 }()
+
+	var failingPath string
+	recorder := record.NewFakeRecorder(10)
+	lb, config := newNodeSyncTest(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodDelete && r.URL.Path == failingPath {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors": [{"reason": "Node could not be removed"}]}`))
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	lb.recorder = recorder
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "foobar123"}}
+
+	for i := 1; i <= 4; i++ {
+		node, err := lb.client.CreateNodeBalancerNode(context.TODO(), config.NodeBalancerID, config.ID, linodego.NodeBalancerNodeCreateOptions{
+			Address: fmt.Sprintf("10.0.0.%d:30000", i),
+			Label:   fmt.Sprintf("node-%d", i),
+			Mode:    linodego.ModeAccept,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			failingPath = fmt.Sprintf("/nodebalancers/%d/configs/%d/nodes/%d", config.NodeBalancerID, config.ID, node.ID)
+		}
+	}
+	nb, err := lb.client.GetNodeBalancer(context.TODO(), config.NodeBalancerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One of four nodes is below the failure threshold, but the backends left behind target
+	// NodePorts released along with the Service.
+	if err := lb.detachServiceBackends(context.TODO(), svc, nb); err == nil {
+		t.Error("expected the node failing to be removed to fail the detach")
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("expected the failure not to be tolerated, got event %q", event)
+	default:
+	}
+}
+
+func TestRunNodeOperations(t *testing.T) {
+	var ran int32
+	operations := make([]nodeOperation, 0, 5)
+	for i := 0; i < 5; i++ {
+		i := i
+		operations = append(operations, func(context.Context) error {
+			atomic.AddInt32(&ran, 1)
+			if i%2 == 0 {
+				return fmt.Errorf("operation %d failed", i)
+			}
+			return nil
+		})
+	}
+
+	err := runNodeOperations(context.TODO(), 2, operations)
+	if ran != 5 {
+		t.Errorf("expected all 5 operations to run despite failures, %d did", ran)
+	}
+	aggregate, ok := err.(utilerrors.Aggregate)
+	if !ok || len(aggregate.Errors()) != 3 {
+		t.Errorf("expected the 3 failures to be aggregated, got %v", err)
+	}
+
+	if err := runNodeOperations(context.TODO(), 2, nil); err != nil {
+		t.Errorf("expected no error without operations, got %v", err)
+	}
+}
+
+// BenchmarkSyncNodeBalancerNodes adds 300 nodes to a config through an API answering each request
+// after 2ms, comparing serial and concurrent syncs.
+func BenchmarkSyncNodeBalancerNodes(b *testing.B) {
+	slow := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(2 * time.Millisecond)
+			h.ServeHTTP(w, r)
+		})
+	}
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "foobar123"}}
+
+	desired := make([]linodego.NodeBalancerNodeCreateOptions, 0, 300)
+	for i := 0; i < 300; i++ {
+		desired = append(desired, linodego.NodeBalancerNodeCreateOptions{
+			Address: fmt.Sprintf("10.0.%d.%d:30000", i/250, i%250+1),
+			Label:   fmt.Sprintf("node-%d", i),
+			Mode:    linodego.ModeAccept,
+			Weight:  100,
+		})
+	}
+
+	for _, concurrency := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			Options.NodeBalancerNodeConcurrency = concurrency
+			defer func() { Options.NodeBalancerNodeConcurrency = 0 }()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				lb, config := newNodeSyncTest(b, slow)
+				b.StartTimer()
+
+				if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeBalancerNodeLabel(t *testing.T) {
+	validLabel := regexp.MustCompile(`^[a-zA-Z0-9._-]{3,32}$`)
+	long := "gke-production-cluster-default-pool-4f7c9a1b-"
+
+	for _, test := range []struct {
+		name     string
+		node     string
+		expected string
+	}{
+		{name: "valid name", node: "node-a", expected: "node-a"},
+		{name: "longest valid name", node: strings.Repeat("a", 32), expected: strings.Repeat("a", 32)},
+		{name: "long name", node: long + "x1z2"},
+		{name: "long name with the same prefix", node: long + "x1z3"},
+		{name: "short name", node: "a"},
+		{name: "invalid characters", node: "node:a/b"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			label := nodeBalancerNodeLabel(test.node)
+			if !validLabel.MatchString(label) {
+				t.Errorf("expected a valid label for %q, got %q", test.node, label)
+			}
+			if test.expected != "" && label != test.expected {
+				t.Errorf("expected label %q for %q, got %q", test.expected, test.node, label)
+			}
+			if again := nodeBalancerNodeLabel(test.node); again != label {
+				t.Errorf("expected the label of %q to be stable, got %q and %q", test.node, label, again)
+			}
+		})
+	}
+
+	if a, b := nodeBalancerNodeLabel(long+"x1z2"), nodeBalancerNodeLabel(long+"x1z3"); a == b {
+		t.Errorf("expected distinct labels for nodes sharing a prefix, got %q", a)
+	}
+}
+
+func TestSyncNodeBalancerNodesLongNames(t *testing.T) {
+	var writes int32
+	counting := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				atomic.AddInt32(&writes, 1)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+	lb, config := newNodeSyncTest(t, counting)
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "foobar123"}}
+
+	var desired []linodego.NodeBalancerNodeCreateOptions
+	for i := 0; i < 3; i++ {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", strings.Repeat("pool-", 20), i)}}
+		desired = append(desired, lb.buildNodeBalancerNodeCreateOptions(nodeBalancerNodeLabel(node.Name), fmt.Sprintf("10.0.0.%d", i+1), 30000, linodego.ModeAccept, 100))
+	}
+
+	atomic.StoreInt32(&writes, 0)
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err != nil {
+		t.Fatalf("syncNodeBalancerNodes returned an error: %s", err)
+	}
+	if count := atomic.LoadInt32(&writes); count != 3 {
+		t.Errorf("expected the 3 nodes to be created, got %d requests", count)
+	}
+
+	// The labels don't change, so the nodes aren't updated again.
+	atomic.StoreInt32(&writes, 0)
+	if err := lb.syncNodeBalancerNodes(context.TODO(), svc, config, desired); err != nil {
+		t.Fatalf("syncNodeBalancerNodes returned an error: %s", err)
+	}
+	if count := atomic.LoadInt32(&writes); count != 0 {
+		t.Errorf("expected no changes to the nodes, got %d requests", count)
+	}
+
+	nodes, err := lb.client.ListNodeBalancerNodes(context.TODO(), config.NodeBalancerID, config.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if len(node.Label) > maxNodeLabelLength {
+			t.Errorf("expected labels of at most %d characters, got %q", maxNodeLabelLength, node.Label)
+		}
+		labels[node.Label] = true
+	}
+	if len(labels) != 3 {
+		t.Errorf("expected 3 distinct labels, got %v", labels)
+	}
+}
@@ -0,0 +1,122 @@
+package linode
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/appscode/go/wait"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+// nodeBalancerResyncer periodically reconciles the NodeBalancers of the LoadBalancer Services of
+// the cluster, correcting changes made to them outside of the CCM, e.g. from the Cloud Manager.
+// The service controller only reconciles a Service when it or the nodes change.
+type nodeBalancerResyncer struct {
+	loadbalancers *loadbalancers
+	kubeClient    kubernetes.Interface
+	services      v1listers.ServiceLister
+	hasSynced     cache.InformerSynced
+
+	// limiter caps how many Services are reconciled per minute, spreading the calls to the
+	// Linode API of a resync of many Services.
+	limiter flowcontrol.RateLimiter
+}
+
+func newNodeBalancerResyncer(loadbalancers *loadbalancers, kubeClient kubernetes.Interface, informer cache.SharedIndexInformer, maxPerMinute int) *nodeBalancerResyncer {
+	return &nodeBalancerResyncer{
+		loadbalancers: loadbalancers,
+		kubeClient:    kubeClient,
+		services:      v1listers.NewServiceLister(informer.GetIndexer()),
+		hasSynced:     informer.HasSynced,
+		limiter:       flowcontrol.NewTokenBucketRateLimiter(float32(maxPerMinute)/60, 1),
+	}
+}
+
+func (r *nodeBalancerResyncer) Run(period time.Duration, stopCh <-chan struct{}) {
+	if !cache.WaitForCacheSync(stopCh, r.hasSynced) {
+		klog.Errorf("NodeBalancer resync failed to sync the service cache")
+		return
+	}
+
+	// The first resync waits for a period, as the service controller reconciles every Service
+	// on startup.
+	select {
+	case <-time.After(period):
+	case <-stopCh:
+		return
+	}
+	wait.Until(func() {
+		if err := r.resync(context.Background()); err != nil {
+			klog.Errorf("NodeBalancer resync failed: %s", err)
+		}
+	}, period, stopCh)
+}
+
+// resync reconciles the NodeBalancer of each LoadBalancer Service the CCM already reconciled,
+// like the service controller does, and updates the status of the Services whose NodeBalancer
+// changed. Services backing off after failed reconciles are skipped by EnsureLoadBalancer until
+// their backoff expires.
+func (r *nodeBalancerResyncer) resync(ctx context.Context) error {
+	services, err := r.services.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	nodes, err := listLoadBalancerNodes(r.kubeClient)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		if !isResyncedService(service) {
+			continue
+		}
+
+		// The Services of the lister are shared with the other controllers.
+		service = service.DeepCopy()
+		r.limiter.Accept()
+		status, err := r.loadbalancers.EnsureLoadBalancer(ctx, getClusterName(), service, nodes)
+		if err != nil {
+			klog.Errorf("failed to resync NodeBalancer of service (%s): %s", getServiceNn(service), err)
+			continue
+		}
+		if err = r.updateStatus(service, status); err != nil {
+			klog.Errorf("failed to update status of service (%s) after resyncing its NodeBalancer: %s", getServiceNn(service), err)
+		}
+	}
+	return nil
+}
+
+// isResyncedService reports whether the NodeBalancer of service is resynced: it must be a
+// LoadBalancer Service that isn't being deleted and was already given an ingress, so that Services
+// the service controller is still creating a NodeBalancer for aren't reconciled concurrently.
+func isResyncedService(service *v1.Service) bool {
+	return service.Spec.Type == v1.ServiceTypeLoadBalancer &&
+		service.DeletionTimestamp == nil &&
+		len(service.Status.LoadBalancer.Ingress) > 0
+}
+
+// updateStatus records status as the load balancer status of service if it changed, e.g. as the
+// NodeBalancer was recreated, as the service controller only updates it on its own reconciles.
+func (r *nodeBalancerResyncer) updateStatus(service *v1.Service, status *v1.LoadBalancerStatus) error {
+	if status == nil || reflect.DeepEqual(service.Status.LoadBalancer, *status) {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := r.kubeClient.CoreV1().Services(service.Namespace).Get(service.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current.Status.LoadBalancer = *status
+		_, err = r.kubeClient.CoreV1().Services(service.Namespace).UpdateStatus(current)
+		return err
+	})
+}
@@ -0,0 +1,157 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestNodeBalancerResync(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: v1.NodeStatus{
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "127.0.0.1"}},
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+	if _, err := fakeClientset.CoreV1().Nodes().Create(node); err != nil {
+		t.Fatal(err)
+	}
+
+	newService := func(name string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID(name + "-uid"),
+			},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeLoadBalancer,
+				Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+			},
+		}
+	}
+	svc := newService("reconciled")
+	pending := newService("pending")
+	for _, service := range []*v1.Service{svc, pending} {
+		if _, err := fakeClientset.CoreV1().Services("default").Create(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, []*v1.Node{node})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *status
+	if _, err = fakeClientset.CoreV1().Services("default").UpdateStatus(svc); err != nil {
+		t.Fatal(err)
+	}
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The NodeBalancer drifts, e.g. edited from the Cloud Manager.
+	for _, config := range fakeAPI.nbc {
+		config.Algorithm = linodego.AlgorithmSource
+	}
+	for id := range fakeAPI.nbn {
+		delete(fakeAPI.nbn, id)
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, service := range []*v1.Service{svc, pending} {
+		if err = indexer.Add(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resyncer := &nodeBalancerResyncer{
+		loadbalancers: lb,
+		kubeClient:    fakeClientset,
+		services:      v1listers.NewServiceLister(indexer),
+		limiter:       flowcontrol.NewFakeAlwaysRateLimiter(),
+	}
+	if err = resyncer.resync(context.TODO()); err != nil {
+		t.Fatalf("resync returned an error: %s", err)
+	}
+
+	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("expected 1 NodeBalancer config, got %d", len(configs))
+	}
+	if configs[0].Algorithm != linodego.AlgorithmRoundRobin {
+		t.Errorf("expected the algorithm to be reset to %q, got %q", linodego.AlgorithmRoundRobin, configs[0].Algorithm)
+	}
+	nodes, err := client.ListNodeBalancerNodes(context.TODO(), nb.ID, configs[0].ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Address != "127.0.0.1:30000" {
+		t.Errorf("expected the node to be added back, got %v", nodes)
+	}
+
+	// Services the service controller hasn't given a NodeBalancer yet are left to it.
+	if _, err = lb.getNodeBalancerByOwner(context.TODO(), pending); err == nil {
+		t.Error("expected no NodeBalancer to be created for the pending service")
+	}
+}
+
+func Test_isResyncedService(t *testing.T) {
+	now := metav1.Now()
+	ingress := v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "192.0.2.1"}}}
+	for _, test := range []struct {
+		name     string
+		service  *v1.Service
+		expected bool
+	}{
+		{
+			name:     "reconciled",
+			service:  &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer}, Status: v1.ServiceStatus{LoadBalancer: ingress}},
+			expected: true,
+		},
+		{
+			name:    "without ingress",
+			service: &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer}},
+		},
+		{
+			name: "being deleted",
+			service: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+				Status:     v1.ServiceStatus{LoadBalancer: ingress},
+			},
+		},
+		{
+			name:    "not a load balancer",
+			service: &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeNodePort}, Status: v1.ServiceStatus{LoadBalancer: ingress}},
+		},
+	} {
+		if actual := isResyncedService(test.service); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, actual)
+		}
+	}
+}
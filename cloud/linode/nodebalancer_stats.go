@@ -0,0 +1,95 @@
+package linode
+
+import (
+	"context"
+	"time"
+
+	"github.com/appscode/go/wait"
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// bytesPerTransferMB converts the transfer the Linode API reports in MB to bytes.
+const bytesPerTransferMB = 1024 * 1024
+
+// nodeBalancerStatsPoller periodically exports the transfer of the NodeBalancers created for this
+// cluster as metrics of the Services owning their ports.
+type nodeBalancerStatsPoller struct {
+	loadbalancers *loadbalancers
+	services      v1listers.ServiceLister
+	hasSynced     cache.InformerSynced
+	clusterTag    string
+}
+
+func newNodeBalancerStatsPoller(loadbalancers *loadbalancers, informer cache.SharedIndexInformer, clusterTag string) *nodeBalancerStatsPoller {
+	return &nodeBalancerStatsPoller{
+		loadbalancers: loadbalancers,
+		services:      v1listers.NewServiceLister(informer.GetIndexer()),
+		hasSynced:     informer.HasSynced,
+		clusterTag:    clusterTag,
+	}
+}
+
+func (p *nodeBalancerStatsPoller) Run(interval time.Duration, stopCh <-chan struct{}) {
+	if !cache.WaitForCacheSync(stopCh, p.hasSynced) {
+		klog.Errorf("NodeBalancer stats poller failed to sync the service cache")
+		return
+	}
+
+	wait.Until(func() {
+		if err := p.poll(context.Background()); err != nil {
+			klog.Errorf("failed to poll NodeBalancer stats: %s", err)
+		}
+	}, interval, stopCh)
+}
+
+// poll replaces the transfer metrics with the ones of the NodeBalancers of this cluster, so that
+// Services that were deleted or lost their NodeBalancer stop being reported.
+func (p *nodeBalancerStatsPoller) poll(ctx context.Context) error {
+	services, err := p.services.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	servicesByUID := make(map[string]*v1.Service, len(services))
+	for _, service := range services {
+		servicesByUID[string(service.UID)] = service
+	}
+
+	// The metrics are reset at once for the NodeBalancers of every account.
+	var nbs []linodego.NodeBalancer
+	for _, lb := range append([]*loadbalancers{p.loadbalancers}, p.loadbalancers.accountLoadBalancers()...) {
+		accountNBs, err := lb.client.ListNodeBalancers(ctx, nil)
+		if err != nil {
+			return err
+		}
+		nbs = append(nbs, accountNBs...)
+	}
+
+	nodeBalancerTransfer.Reset()
+	for i := range nbs {
+		nb := &nbs[i]
+		if !containsString(nb.Tags, p.clusterTag) {
+			continue
+		}
+
+		for _, uid := range getPortOwners(nb) {
+			if service, ok := servicesByUID[uid]; ok {
+				setNodeBalancerTransfer(service, nb.Transfer)
+			}
+		}
+	}
+	return nil
+}
+
+func setNodeBalancerTransfer(service *v1.Service, transfer linodego.NodeBalancerTransfer) {
+	for direction, mb := range map[string]*float64{"in": transfer.In, "out": transfer.Out, "total": transfer.Total} {
+		if mb != nil {
+			nodeBalancerTransfer.WithLabelValues(service.Namespace, service.Name, direction).Set(*mb * bytesPerTransferMB)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/linode/linodego"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func gaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	m := &dto.Metric{}
+	if err := gauge.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestNodeBalancerStatsPoller(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	const clusterTag = clusterTagPrefix + "test"
+	newNodeBalancer := func(in, out float64, tags ...string) {
+		nb, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+			Region: "us-west",
+			Tags:   tags,
+		})
+		if err != nil {
+			t.Fatalf("failed to create NodeBalancer: %s", err)
+		}
+		total := in + out
+		fake.nb[strconv.Itoa(nb.ID)].Transfer = linodego.NodeBalancerTransfer{In: &in, Out: &out, Total: &total}
+	}
+
+	newNodeBalancer(1, 2, clusterTag, "ccm:80:web-uid", "ccm:443:web-uid")
+	newNodeBalancer(3, 4, clusterTagPrefix+"other", "ccm:80:other-uid")
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, service := range []*v1.Service{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "web-uid"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "other", UID: "other-uid"}},
+	} {
+		if err := indexer.Add(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Series of Services without a NodeBalancer anymore are dropped.
+	nodeBalancerTransfer.WithLabelValues("default", "deleted", "in").Set(1)
+
+	poller := &nodeBalancerStatsPoller{
+		loadbalancers: &loadbalancers{client: &client, zone: "us-west"},
+		services:      v1listers.NewServiceLister(indexer),
+		clusterTag:    clusterTag,
+	}
+	if err := poller.poll(context.TODO()); err != nil {
+		t.Fatalf("poll returned an error: %s", err)
+	}
+
+	for direction, expected := range map[string]float64{"in": 1, "out": 2, "total": 3} {
+		if actual := gaugeValue(t, nodeBalancerTransfer.WithLabelValues("default", "web", direction)); actual != expected*bytesPerTransferMB {
+			t.Errorf("expected %s transfer of %v bytes, got %v", direction, expected*bytesPerTransferMB, actual)
+		}
+	}
+
+	metrics := make(chan prometheus.Metric, 10)
+	nodeBalancerTransfer.Collect(metrics)
+	close(metrics)
+	if len(metrics) != 3 {
+		t.Errorf("expected only the transfer of this cluster's service to be reported, got %d series", len(metrics))
+	}
+}
@@ -0,0 +1,120 @@
+package linode
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// reconcileStatusRefreshInterval is how old the last-sync-time of an unchanged reconcile status
+// gets before it is written again. Annotation changes make the service controller reconcile the
+// Service again, so writing every reconcile would never settle.
+const reconcileStatusRefreshInterval = 10 * time.Minute
+
+// reconcileStatusMaxMessage is the length the error messages of reconcile statuses are cut to.
+const reconcileStatusMaxMessage = 1024
+
+// reconcileStatus is the outcome of the last reconcile of a Service by EnsureLoadBalancer or
+// UpdateLoadBalancer, recorded in its annLinodeReconcileStatus annotation.
+type reconcileStatus struct {
+	NodeBalancerID int `json:"nodebalancer-id,omitempty"`
+	// LastSyncTime is when the Service was last reconciled, as RFC 3339.
+	LastSyncTime string `json:"last-sync-time"`
+	Succeeded    bool   `json:"succeeded"`
+	// Message is the error of a failed reconcile.
+	Message string `json:"message,omitempty"`
+}
+
+// getReconcileStatus returns the reconcile status recorded on service, if any.
+func getReconcileStatus(service *v1.Service) (reconcileStatus, bool) {
+	var status reconcileStatus
+	raw, ok := getServiceAnnotation(service, annLinodeReconcileStatus)
+	if !ok || json.Unmarshal([]byte(raw), &status) != nil {
+		return reconcileStatus{}, false
+	}
+	return status, true
+}
+
+// needsUpdate reports whether current, the recorded status, differs from s other than by its
+// last-sync-time, or was last synced more than reconcileStatusRefreshInterval before s.
+func (s reconcileStatus) needsUpdate(current reconcileStatus) bool {
+	if s.NodeBalancerID != current.NodeBalancerID || s.Succeeded != current.Succeeded || s.Message != current.Message {
+		return true
+	}
+	lastSync, err := time.Parse(time.RFC3339, current.LastSyncTime)
+	if err != nil {
+		return true
+	}
+	now, err := time.Parse(time.RFC3339, s.LastSyncTime)
+	return err != nil || now.Sub(lastSync) >= reconcileStatusRefreshInterval
+}
+
+// setReconcileStatus records the outcome of a reconcile of service with nb, its NodeBalancer if
+// known, on service if Options.ReconcileStatus is set. Updates are retried on conflicts with
+// other writers of the Service. Failures are logged rather than failing the reconcile, as the
+// NodeBalancer has been reconciled regardless.
+func (l *loadbalancers) setReconcileStatus(service *v1.Service, nb *linodego.NodeBalancer, reconcileErr error, now time.Time) {
+	if !Options.ReconcileStatus {
+		return
+	}
+
+	status := reconcileStatus{LastSyncTime: now.UTC().Format(time.RFC3339), Succeeded: reconcileErr == nil}
+	if nb != nil {
+		status.NodeBalancerID = nb.ID
+	}
+	if reconcileErr != nil {
+		status.Message = reconcileErr.Error()
+		if len(status.Message) > reconcileStatusMaxMessage {
+			status.Message = status.Message[:reconcileStatusMaxMessage]
+		}
+	}
+
+	if l.dryRun {
+		l.logDryRun(service, dryRunChange{Action: "update-reconcile-status-annotation", NodeBalancerID: status.NodeBalancerID})
+		return
+	}
+	if err := l.retrieveKubeClient(); err != nil {
+		serviceLog("reconcile-status", service, status.NodeBalancerID).warningf("failed to record the reconcile status of service (%s): %s", getServiceNn(service), err)
+		return
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := l.kubeClient.CoreV1().Services(service.Namespace).Get(service.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		desired := status
+		recorded, ok := getReconcileStatus(current)
+		// The NodeBalancer of a reconcile failing before it is found is still the last one known.
+		if desired.NodeBalancerID == 0 {
+			desired.NodeBalancerID = recorded.NodeBalancerID
+		}
+		if ok && !desired.needsUpdate(recorded) {
+			return nil
+		}
+
+		raw, err := json.Marshal(desired)
+		if err != nil {
+			return err
+		}
+		if current.Annotations == nil {
+			current.Annotations = make(map[string]string)
+		}
+		current.Annotations[annLinodeReconcileStatus] = string(raw)
+		_, err = l.kubeClient.CoreV1().Services(service.Namespace).Update(current)
+		return err
+	})
+	// The Service was deleted while it was reconciled.
+	if errors.IsNotFound(err) {
+		return
+	}
+	if err != nil {
+		serviceLog("reconcile-status", service, status.NodeBalancerID).warningf("failed to record the reconcile status of service (%s): %s", getServiceNn(service), err)
+	}
+}
@@ -0,0 +1,146 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReconcileStatus(t *testing.T) {
+	Options.ReconcileStatus = true
+	defer func() { Options.ReconcileStatus = false }()
+
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: randString(10), Namespace: "default", UID: "foobar123"},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	if _, err := fakeClientset.CoreV1().Services("default").Create(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	getStatus := func() reconcileStatus {
+		t.Helper()
+		current, err := fakeClientset.CoreV1().Services("default").Get(svc.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, ok := getReconcileStatus(current)
+		if !ok {
+			t.Fatalf("expected a reconcile status annotation, got %v", current.Annotations)
+		}
+		return status
+	}
+
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), &v1.Service{Status: v1.ServiceStatus{LoadBalancer: *status}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := getStatus()
+	if !recorded.Succeeded || recorded.NodeBalancerID != nb.ID || recorded.Message != "" {
+		t.Errorf("expected a successful reconcile of NodeBalancer (%d), got %+v", nb.ID, recorded)
+	}
+	if _, err = time.Parse(time.RFC3339, recorded.LastSyncTime); err != nil {
+		t.Errorf("expected an RFC 3339 last-sync-time: %s", err)
+	}
+
+	// Failures are recorded along with the last NodeBalancer known.
+	failing := svc.DeepCopy()
+	failing.Annotations = map[string]string{annLinodePortConfigPrefix + "80": `{"protocol": "https"}`}
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "linodelb", failing, nil); err == nil {
+		t.Fatal("expected EnsureLoadBalancer to fail")
+	}
+	recorded = getStatus()
+	if recorded.Succeeded || recorded.NodeBalancerID != nb.ID || !strings.Contains(recorded.Message, "no TLS secret") {
+		t.Errorf("expected a failed reconcile of NodeBalancer (%d), got %+v", nb.ID, recorded)
+	}
+
+	// Conflicting updates of the Service are retried.
+	conflicts := 0
+	fakeClientset.PrependReactor("update", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			conflicts++
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "services"}, svc.Name, nil)
+		}
+		return false, nil, nil
+	})
+	current, _ := fakeClientset.CoreV1().Services("default").Get(svc.Name, metav1.GetOptions{})
+	if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", current, nil); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if recorded = getStatus(); conflicts != 1 || !recorded.Succeeded {
+		t.Errorf("expected the status to be recorded after a conflict, got %+v after %d conflicts", recorded, conflicts)
+	}
+}
+
+func TestSetReconcileStatusRefresh(t *testing.T) {
+	Options.ReconcileStatus = true
+	defer func() { Options.ReconcileStatus = false }()
+
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+	fakeClientset := fake.NewSimpleClientset(svc)
+	lb := &loadbalancers{kubeClient: fakeClientset}
+	nb := &linodego.NodeBalancer{ID: 42}
+
+	updates := func() int {
+		count := 0
+		for _, action := range fakeClientset.Actions() {
+			if action.GetVerb() == "update" {
+				count++
+			}
+		}
+		fakeClientset.ClearActions()
+		return count
+	}
+
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	lb.setReconcileStatus(svc, nb, nil, now)
+	if count := updates(); count != 1 {
+		t.Errorf("expected the status to be written, got %d updates", count)
+	}
+
+	// Writing the same outcome again would make the service controller reconcile it forever.
+	lb.setReconcileStatus(svc, nb, nil, now.Add(time.Minute))
+	if count := updates(); count != 0 {
+		t.Errorf("expected the unchanged status not to be written, got %d updates", count)
+	}
+
+	lb.setReconcileStatus(svc, nb, nil, now.Add(reconcileStatusRefreshInterval))
+	if count := updates(); count != 1 {
+		t.Errorf("expected the stale last-sync-time to be refreshed, got %d updates", count)
+	}
+
+	Options.ReconcileStatus = false
+	lb.setReconcileStatus(svc, nb, errors.NewBadRequest("failed"), now)
+	if count := updates(); count != 0 {
+		t.Errorf("expected no status to be written unless enabled, got %d updates", count)
+	}
+}
@@ -0,0 +1,271 @@
+package linode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+
+	// retriesExhaustedMessage marks the errors returned when retryable Linode API requests keep
+	// failing; it allows callers to recognize them once linodego has flattened them into a
+	// linodego.Error.
+	retriesExhaustedMessage = "giving up after retries"
+
+	// notRetriedMessage marks the errors returned for the 503 responses of requests that aren't
+	// idempotent, which linodego would otherwise resend.
+	notRetriedMessage = "not retried as the request may have taken effect"
+)
+
+var numericPathSegment = regexp.MustCompile(`/[0-9]+(/|$)`)
+
+// retryTransport is an http.RoundTripper that retries Linode API requests failing with 429, 5xx
+// or timeout errors, using exponential backoff with full jitter and honoring the Retry-After
+// header. Other errors are returned immediately, as are the 5xx and timeout errors of requests
+// that aren't idempotent, which aren't safe to retry.
+//
+// Each attempt is cancelled once it takes longer than timeout, which then counts as a timeout
+// error, so that a hung connection fails the attempt instead of blocking the reconcile that made
+// the request. The deadline of the caller's context still bounds all of the attempts.
+//
+// linodego retries 429 and 503 responses on its own with no meaningful cap, so once the retries
+// are exhausted an error is returned instead of the response to keep linodego from retrying it.
+// With maxRetries set to 0, responses and errors are returned as is and retries are left to
+// linodego.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	timeout    time.Duration
+
+	// sleep waits for d or until the request is cancelled; it is replaced in tests.
+	sleep func(req *http.Request, d time.Duration) error
+}
+
+func newRetryTransport(next http.RoundTripper, maxRetries int, timeout time.Duration) *retryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &retryTransport{next: next, maxRetries: maxRetries, timeout: timeout, sleep: sleepForRequest}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, err := bufferRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.roundTripAttempt(req)
+		if !isRetryableResponse(resp, err) {
+			return resp, err
+		}
+
+		if t.maxRetries == 0 {
+			return resp, err
+		}
+		if !isIdempotent(req) && (resp == nil || resp.StatusCode != http.StatusTooManyRequests) {
+			// linodego resends 503 responses on its own, so they are turned into an error. Other
+			// failures are returned as is, so that linodego reports their status.
+			if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
+				return nil, fmt.Errorf("%s %s: %v: %s", req.Method, normalizeEndpoint(req.URL.Path), responseError(resp), notRetriedMessage)
+			}
+			return resp, err
+		}
+
+		if attempt >= t.maxRetries {
+			return nil, retriesExhaustedError(req, resp, err, attempt)
+		}
+
+		delay := retryDelay(resp, attempt)
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		endpoint := normalizeEndpoint(req.URL.Path)
+		apiRetries.WithLabelValues(req.Method, endpoint).Inc()
+		klog.V(2).Infof("retrying Linode API request %s %s in %s (attempt %d/%d)", req.Method, endpoint, delay, attempt+1, t.maxRetries)
+
+		if err := t.sleep(req, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// bufferRequestBody returns a copy of req whose body can be replayed. The GetBody of the requests
+// made by linodego returns what is left of the body once it has been sent, which is nothing.
+func bufferRequestBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(req.Context())
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return req, nil
+}
+
+// roundTripAttempt sends a single attempt of req, cancelling it after t.timeout. The attempt's
+// context lives until the body of its response is closed, so the timeout covers reading it.
+func (t *retryTransport) roundTripAttempt(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func sleepForRequest(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// isIdempotent reports whether req can be retried after timing out or failing with a 5xx. A POST
+// attempt failing that way may still have created a NodeBalancer, config, node or firewall, and
+// retrying it would create another one, so only its 429 responses, which are rejected before
+// anything is created, are retried; the next reconcile then adopts what was created by its tags.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryableResponse reports whether a request should be retried given its outcome.
+func isRetryableResponse(resp *http.Response, err error) bool {
+	if err != nil {
+		netErr, ok := err.(net.Error)
+		return ok && netErr.Timeout()
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryDelay returns how long to wait before retrying, preferring the response's Retry-After
+// header over exponential backoff with full jitter.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	backoff := retryBaseDelay << uint(attempt)
+	if backoff <= 0 || backoff > retryMaxDelay {
+		backoff = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// retriesExhaustedError returns the error of req giving up after retries, keeping the status and
+// the reasons of the Linode API error of resp, if any.
+func retriesExhaustedError(req *http.Request, resp *http.Response, err error, retries int) error {
+	cause := err
+	if resp != nil {
+		cause = responseError(resp)
+	}
+	return fmt.Errorf("%s %s: %s (%d): %v", req.Method, normalizeEndpoint(req.URL.Path), retriesExhaustedMessage, retries, cause)
+}
+
+// maxErrorBodySize caps how much of the body of a failed response is read into its error.
+const maxErrorBodySize = 64 << 10
+
+// responseError returns an error holding the status of resp and the reasons of the Linode API
+// error in its body, e.g. "503 Service Unavailable: Unavailable", falling back to the raw body if
+// it isn't a Linode API error. The body of resp is closed.
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil || len(bytes.TrimSpace(body)) == 0 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	var apiErr struct {
+		Errors []struct {
+			Reason string `json:"reason"`
+			Field  string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &apiErr) != nil || len(apiErr.Errors) == 0 {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	reasons := make([]string, 0, len(apiErr.Errors))
+	for _, e := range apiErr.Errors {
+		if e.Field != "" {
+			reasons = append(reasons, fmt.Sprintf("[%s] %s", e.Field, e.Reason))
+		} else {
+			reasons = append(reasons, e.Reason)
+		}
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.Join(reasons, "; "))
+}
+
+// normalizeEndpoint replaces the IDs in a Linode API path so that it can be used as a metric label.
+func normalizeEndpoint(path string) string {
+	for numericPathSegment.MatchString(path) {
+		path = numericPathSegment.ReplaceAllString(path, "/{id}$1")
+	}
+	return path
+}
+
+// isRetryableError reports whether err is a Linode API error that is expected to go away if the
+// request is retried later.
+func isRetryableError(err error) bool {
+	return classifyAPIError(err) == apiErrorRetryable
+}
@@ -0,0 +1,283 @@
+package linode
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+)
+
+func newRetryTestClient(t *testing.T, maxRetries int, handler http.HandlerFunc) (*linodego.Client, *[]time.Duration) {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	var delays []time.Duration
+	transport := newRetryTransport(http.DefaultTransport, maxRetries, 0)
+	transport.sleep = func(_ *http.Request, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	client := linodego.NewClient(&http.Client{Transport: transport})
+	client.SetBaseURL(ts.URL)
+	return &client, &delays
+}
+
+func TestRetryTransport(t *testing.T) {
+	t.Run("retries 429 honoring Retry-After", func(t *testing.T) {
+		calls := 0
+		client, delays := newRetryTestClient(t, 3, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			calls++
+			if calls < 3 {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"errors": [{"reason": "Too many requests"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"id": 123}`))
+		})
+
+		nb, err := client.GetNodeBalancer(context.TODO(), 123)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if nb.ID != 123 {
+			t.Errorf("unexpected NodeBalancer ID %d", nb.ID)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 requests, got %d", calls)
+		}
+		for _, d := range *delays {
+			if d != 7*time.Second {
+				t.Errorf("expected Retry-After delay of 7s, got %s", d)
+			}
+		}
+	})
+
+	t.Run("does not retry 4xx", func(t *testing.T) {
+		calls := 0
+		client, _ := newRetryTestClient(t, 3, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			calls++
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Not found"}]}`))
+		})
+
+		_, err := client.GetNodeBalancer(context.TODO(), 123)
+		if apiErr, ok := err.(*linodego.Error); !ok || apiErr.Code != http.StatusNotFound {
+			t.Errorf("expected 404 error, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 request, got %d", calls)
+		}
+	})
+
+	t.Run("sends POST requests answered with 503 once", func(t *testing.T) {
+		calls := 0
+		client, _ := newRetryTestClient(t, 3, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Unavailable"}]}`))
+		})
+
+		_, err := client.CreateNodeBalancerConfig(context.TODO(), 123, linodego.NodeBalancerConfigCreateOptions{Port: 80})
+		if !isRetryableError(err) || !strings.Contains(err.Error(), "503 Service Unavailable: Unavailable") || !strings.Contains(err.Error(), notRetriedMessage) {
+			t.Errorf("expected the POST not to be retried after a 503, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 request, got %d", calls)
+		}
+	})
+
+	t.Run("returns the 5xx of POST requests", func(t *testing.T) {
+		calls := 0
+		client, _ := newRetryTestClient(t, 3, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Internal error"}]}`))
+		})
+
+		_, err := client.CreateNodeBalancerConfig(context.TODO(), 123, linodego.NodeBalancerConfigCreateOptions{Port: 80})
+		if apiErr, ok := err.(*linodego.Error); !ok || apiErr.Code != http.StatusInternalServerError {
+			t.Errorf("expected the 500 error of the POST, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 request, got %d", calls)
+		}
+	})
+
+	t.Run("leaves POST requests to linodego without retries", func(t *testing.T) {
+		calls := 0
+		client, _ := newRetryTestClient(t, 0, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Bad gateway"}]}`))
+		})
+
+		_, err := client.CreateNodeBalancerConfig(context.TODO(), 123, linodego.NodeBalancerConfigCreateOptions{Port: 80})
+		if apiErr, ok := err.(*linodego.Error); !ok || apiErr.Code != http.StatusBadGateway || strings.Contains(err.Error(), retriesExhaustedMessage) {
+			t.Errorf("expected the 502 error of the POST unchanged, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 request, got %d", calls)
+		}
+	})
+
+	t.Run("retries only 429 for NodeBalancer creations", func(t *testing.T) {
+		calls := 0
+		client, _ := newRetryTestClient(t, 3, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			calls++
+			if calls == 1 && r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"errors": [{"reason": "Too many requests"}]}`))
+				return
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Unavailable"}]}`))
+		})
+
+		_, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{Region: "us-west"})
+		if !isRetryableError(err) || !strings.Contains(err.Error(), "may have taken effect") {
+			t.Errorf("expected the creation not to be retried after a 503, got %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("expected the 429 to be retried and the 503 not, got %d requests", calls)
+		}
+	})
+
+	t.Run("replays the body of retried requests", func(t *testing.T) {
+		var bodies []string
+		client, _ := newRetryTestClient(t, 3, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			w.Header().Set("Content-Type", "application/json")
+			if len(bodies) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"errors": [{"reason": "Unavailable"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"id": 123}`))
+		})
+
+		throttle := 5
+		if _, err := client.UpdateNodeBalancer(context.TODO(), 123, linodego.NodeBalancerUpdateOptions{ClientConnThrottle: &throttle}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(bodies) != 2 || bodies[0] == "" || bodies[1] != bodies[0] {
+			t.Errorf("expected the retried request to be sent with the same body, got %q", bodies)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		client, delays := newRetryTestClient(t, 2, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"errors": [{"reason": "Unavailable"}]}`))
+		})
+
+		_, err := client.GetNodeBalancer(context.TODO(), 123)
+		if !isRetryableError(err) || !strings.Contains(err.Error(), "503 Service Unavailable: Unavailable") {
+			t.Errorf("expected retries exhausted error with the reason of the API error, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 requests, got %d", calls)
+		}
+		for i, d := range *delays {
+			if max := retryBaseDelay << uint(i); d <= 0 || d > max {
+				t.Errorf("expected backoff delay %d to be in (0, %s], got %s", i, max, d)
+			}
+		}
+	})
+}
+
+func TestRetryTransportTimeout(t *testing.T) {
+	// hung is the number of the next requests hanging until they are cancelled.
+	var calls, hung int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.AddInt32(&hung, -1) >= 0 {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 123}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	transport := newRetryTransport(http.DefaultTransport, 3, 50*time.Millisecond)
+	transport.sleep = func(*http.Request, time.Duration) error { return nil }
+	client := linodego.NewClient(&http.Client{Transport: transport})
+	client.SetBaseURL(ts.URL)
+
+	t.Run("retries hung attempts", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		atomic.StoreInt32(&hung, 2)
+		nb, err := client.GetNodeBalancer(context.TODO(), 123)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if nb.ID != 123 {
+			t.Errorf("unexpected NodeBalancer ID %d", nb.ID)
+		}
+		if n := atomic.LoadInt32(&calls); n != 3 {
+			t.Errorf("expected 3 requests, got %d", n)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		atomic.StoreInt32(&hung, 10)
+		start := time.Now()
+		_, err := client.GetNodeBalancer(context.TODO(), 123)
+		if !isRetryableError(err) {
+			t.Errorf("expected retries exhausted error, got %v", err)
+		}
+		if n := atomic.LoadInt32(&calls); n != 4 {
+			t.Errorf("expected 4 requests, got %d", n)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("expected the hung attempts to be cancelled, took %s", elapsed)
+		}
+	})
+
+	t.Run("caller deadline bounds the attempts", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		atomic.StoreInt32(&hung, 10)
+		ctx, cancel := context.WithTimeout(context.Background(), 75*time.Millisecond)
+		defer cancel()
+		transport.sleep = sleepForRequest
+
+		_, err := client.GetNodeBalancer(ctx, 123)
+		if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+			t.Errorf("expected the caller's deadline to be exceeded, got %v", err)
+		}
+		if n := atomic.LoadInt32(&calls); n > 2 {
+			t.Errorf("expected at most 2 requests before the caller's deadline, got %d", n)
+		}
+	})
+}
+
+func Test_normalizeEndpoint(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/v4/nodebalancers":                       "/v4/nodebalancers",
+		"/v4/nodebalancers/123":                   "/v4/nodebalancers/{id}",
+		"/v4/nodebalancers/123/configs/4/rebuild": "/v4/nodebalancers/{id}/configs/{id}/rebuild",
+	} {
+		if actual := normalizeEndpoint(path); actual != expected {
+			t.Errorf("expected %q to normalize to %q, got %q", path, expected, actual)
+		}
+	}
+}
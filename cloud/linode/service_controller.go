@@ -2,7 +2,6 @@ package linode
 
 import (
 	"context"
-	"net/http"
 	"time"
 
 	"github.com/appscode/go/wait"
@@ -73,16 +72,20 @@ func (s *serviceController) processNextDeletion() bool {
 	}
 
 	err := s.handleServiceDeleted(service)
-	switch deleteErr := err.(type) {
+	switch err.(type) {
 	case nil:
 		break
 
 	case *linodego.Error:
-		if deleteErr.Code >= http.StatusInternalServerError || deleteErr.Code == http.StatusTooManyRequests {
+		if isRetryableError(err) {
 			klog.Errorf("failed to delete NodeBalancer for service (%s); retrying in 1 minute: %s", getServiceNn(service), err)
 			s.queue.AddAfter(service, retryInterval)
 		}
 
+	case tokenSecretNotFoundError:
+		klog.Errorf("failed to delete NodeBalancer for service (%s) until its token secret is recreated; retrying in 1 minute: %s", getServiceNn(service), err)
+		s.queue.AddAfter(service, retryInterval)
+
 	default:
 		klog.Errorf("failed to delete NodeBalancer for service (%s); will not retry: %s", getServiceNn(service), err)
 	}
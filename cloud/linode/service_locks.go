@@ -0,0 +1,55 @@
+package linode
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// serviceLocks serializes the operations on the NodeBalancer of each Service, while the
+// NodeBalancers of different Services are reconciled in parallel. The service controller only
+// syncs a Service in one of its --concurrent-service-syncs workers at a time, but the controllers
+// of the CCM, e.g. the deletion and TLS secret controllers, reconcile the same Services on their
+// own.
+type serviceLocks struct {
+	mu    sync.Mutex
+	locks map[string]*serviceLock
+}
+
+type serviceLock struct {
+	sync.Mutex
+	// refs is the number of holders and waiters of the lock, which is forgotten once it drops to
+	// 0 so that the locks of deleted Services don't pile up.
+	refs int
+}
+
+// lock blocks until no other operation holds the lock of service, and returns the function
+// releasing it, e.g. for `defer l.serviceLocks.lock(service)()`. Services are identified by
+// namespace and name, like in the queue of the service controller, so that a Service recreated
+// with the same name waits for the deletion of the previous one.
+func (s *serviceLocks) lock(service *v1.Service) func() {
+	key := getServiceNn(service)
+
+	s.mu.Lock()
+	if s.locks == nil {
+		s.locks = make(map[string]*serviceLock)
+	}
+	lock, ok := s.locks[key]
+	if !ok {
+		lock = &serviceLock{}
+		s.locks[key] = lock
+	}
+	lock.refs++
+	s.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(s.locks, key)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// inFlightAPI counts the requests to the fake Linode API in flight, and holds each NodeBalancer
+// creation until another request is in flight or a timeout expires.
+type inFlightAPI struct {
+	next http.Handler
+
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	arrived  chan struct{}
+}
+
+func (a *inFlightAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	a.inFlight++
+	if a.inFlight > a.max {
+		a.max = a.inFlight
+	}
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.inFlight--
+		a.mu.Unlock()
+	}()
+
+	if r.Method == http.MethodPost && r.URL.Path == "/nodebalancers" {
+		select {
+		case a.arrived <- struct{}{}:
+		case <-a.arrived:
+		case <-time.After(time.Second):
+		}
+	}
+	a.next.ServeHTTP(w, r)
+}
+
+func (a *inFlightAPI) maxInFlight() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.max
+}
+
+func newLockTestService(name string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+}
+
+func TestEnsureLoadBalancerConcurrency(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		services    []*v1.Service
+		maxInFlight int
+	}{
+		{
+			name:        "different services are reconciled concurrently",
+			services:    []*v1.Service{newLockTestService("web"), newLockTestService("api")},
+			maxInFlight: 2,
+		},
+		{
+			name:        "a service is reconciled by one operation at a time",
+			services:    []*v1.Service{newLockTestService("web"), newLockTestService("web")},
+			maxInFlight: 1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			api := &inFlightAPI{next: newFake(t), arrived: make(chan struct{})}
+			ts := httptest.NewServer(api)
+			defer ts.Close()
+
+			client := linodego.NewClient(http.DefaultClient)
+			client.SetBaseURL(ts.URL)
+			lb := &loadbalancers{client: &client, zone: "us-west"}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, len(test.services))
+			for _, svc := range test.services {
+				wg.Add(1)
+				go func(svc *v1.Service) {
+					defer wg.Done()
+					_, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+					errs <- err
+				}(svc)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Errorf("EnsureLoadBalancer returned an error: %s", err)
+				}
+			}
+
+			if actual := api.maxInFlight(); actual != test.maxInFlight {
+				t.Errorf("expected at most %d Linode API requests in flight, got %d", test.maxInFlight, actual)
+			}
+			if len(lb.serviceLocks.locks) != 0 {
+				t.Errorf("expected the locks of the services to be released, got %v", lb.serviceLocks.locks)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package linode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// skippedNodesEventInterval is how long an event reporting the same nodes skipped for the same
+// reason isn't recorded again for a Service, as every reconcile skips them again.
+var skippedNodesEventInterval = 10 * time.Minute
+
+// maxSkippedNodeNames is how many of the nodes skipped for a reason are named in an event; the
+// others are only counted.
+const maxSkippedNodeNames = 5
+
+type skippedNodesEvent struct {
+	message    string
+	recordedAt time.Time
+}
+
+// skippedNodesEvents records the last event reporting skipped nodes of each Service by reason,
+// so that events are only recorded when the skipped nodes change or once per
+// skippedNodesEventInterval.
+type skippedNodesEvents struct {
+	mu     sync.Mutex
+	events map[types.UID]map[string]skippedNodesEvent
+}
+
+// shouldRecord reports whether message should be recorded as the reason event of the Service
+// uid at now, and if so remembers it as recorded.
+func (e *skippedNodesEvents) shouldRecord(uid types.UID, reason, message string, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	last, ok := e.events[uid][reason]
+	if ok && last.message == message && now.Sub(last.recordedAt) < skippedNodesEventInterval {
+		return false
+	}
+
+	if e.events == nil {
+		e.events = make(map[types.UID]map[string]skippedNodesEvent)
+	}
+	if e.events[uid] == nil {
+		e.events[uid] = make(map[string]skippedNodesEvent)
+	}
+	e.events[uid][reason] = skippedNodesEvent{message: message, recordedAt: now}
+	return true
+}
+
+// forget forgets the events recorded for the Service uid.
+func (e *skippedNodesEvents) forget(uid types.UID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.events, uid)
+}
+
+// describeSkippedNodes returns the sorted names of the skipped nodes, naming at most
+// maxSkippedNodeNames of them.
+func describeSkippedNodes(names []string) string {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	if len(sorted) <= maxSkippedNodeNames {
+		return strings.Join(sorted, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(sorted[:maxSkippedNodeNames], ", "), len(sorted)-maxSkippedNodeNames)
+}
+
+// recordSkippedNodes records a reason event for service reporting the nodes left out of its
+// NodeBalancer backends and why, unless the same event was recorded recently.
+func (l *loadbalancers) recordSkippedNodes(service *v1.Service, eventType, reason, why string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	message := fmt.Sprintf("not using %s as NodeBalancer backends (%s): %s", countNodes(names), why, describeSkippedNodes(names))
+	l.recordNodesEvent(service, eventType, reason, message)
+}
+
+// recordDrainingNodes records a NodesNotReady event for service reporting the nodes whose
+// NodeBalancer backends are drained as they aren't ready, unless the same event was recorded
+// recently.
+func (l *loadbalancers) recordDrainingNodes(service *v1.Service, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	message := fmt.Sprintf("draining the NodeBalancer backends of %s (not ready): %s", countNodes(names), describeSkippedNodes(names))
+	l.recordNodesEvent(service, v1.EventTypeWarning, "NodesNotReady", message)
+}
+
+func (l *loadbalancers) recordNodesEvent(service *v1.Service, eventType, reason, message string) {
+	if !l.skippedNodes.shouldRecord(service.UID, reason, message, time.Now()) {
+		return
+	}
+	l.recordEvent(service, eventType, reason, "%s", message)
+}
+
+// countNodes returns the number of names as a count of nodes, e.g. "2 nodes".
+func countNodes(names []string) string {
+	if len(names) == 1 {
+		return "1 node"
+	}
+	return fmt.Sprintf("%d nodes", len(names))
+}
@@ -0,0 +1,143 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	kubeletapis "k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+func TestSkippedNodesEvents(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	recorder := record.NewFakeRecorder(10)
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			Namespace:   "default",
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodeRegion: "eu-west"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	newNode := func(name, address, region string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{kubeletapis.LabelZoneRegion: region}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: address}}},
+		}
+	}
+	notReady := newNode("node-4", "127.0.0.4", "eu-west")
+	notReady.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+	nodes := []*v1.Node{
+		newNode("node-1", "127.0.0.1", "us-west"),
+		newNode("node-2", "127.0.0.2", "us-east"),
+		newNode("node-3", "127.0.0.3", "eu-west"),
+		notReady,
+	}
+
+	if _, err := fakeClientset.CoreV1().Services("default").Create(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	events := func() []string {
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+
+	status, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nodes)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	expected := []string{
+		"Normal NodesOutsideRegion not using 2 nodes as NodeBalancer backends (outside of region eu-west): node-1, node-2",
+		"Warning NodesNotReady draining the NodeBalancer backends of 1 node (not ready): node-4",
+	}
+	if actual := events(); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events %q, got %q", expected, actual)
+	}
+
+	// Reconciles skipping the same nodes don't record the events again.
+	svc.Status.LoadBalancer = *status
+	if _, err = fakeClientset.CoreV1().Services("default").UpdateStatus(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	if actual := events(); len(actual) != 0 {
+		t.Errorf("expected no events, got %q", actual)
+	}
+
+	// Skipping other nodes does.
+	nodes = append(nodes, newNode("node-5", "127.0.0.5", "us-west"))
+	if err = lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nodes); err != nil {
+		t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+	}
+	expected = []string{"Normal NodesOutsideRegion not using 3 nodes as NodeBalancer backends (outside of region eu-west): node-1, node-2, node-5"}
+	if actual := events(); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events %q, got %q", expected, actual)
+	}
+}
+
+func TestSkippedNodesEventsShouldRecord(t *testing.T) {
+	var events skippedNodesEvents
+	now := time.Now()
+
+	for _, test := range []struct {
+		name     string
+		message  string
+		at       time.Time
+		expected bool
+	}{
+		{name: "first event", message: "a", at: now, expected: true},
+		{name: "same event", message: "a", at: now.Add(time.Minute), expected: false},
+		{name: "other event", message: "b", at: now.Add(2 * time.Minute), expected: true},
+		{name: "same event after the interval", message: "b", at: now.Add(2*time.Minute + skippedNodesEventInterval), expected: true},
+	} {
+		if actual := events.shouldRecord("uid", "NodesOutsideRegion", test.message, test.at); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, actual)
+		}
+	}
+
+	events.forget("uid")
+	if !events.shouldRecord("uid", "NodesOutsideRegion", "b", now.Add(3*time.Minute)) {
+		t.Error("expected the event to be recorded once the service was forgotten")
+	}
+}
+
+func Test_describeSkippedNodes(t *testing.T) {
+	for _, test := range []struct {
+		names    []string
+		expected string
+	}{
+		{names: []string{"node-2", "node-1"}, expected: "node-1, node-2"},
+		{names: []string{"node-7", "node-6", "node-5", "node-4", "node-3", "node-2", "node-1"}, expected: "node-1, node-2, node-3, node-4, node-5 and 2 more"},
+	} {
+		if actual := describeSkippedNodes(test.names); actual != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, actual)
+		}
+	}
+}
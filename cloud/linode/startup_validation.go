@@ -0,0 +1,65 @@
+package linode
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/linode/linodego"
+	"k8s.io/klog"
+)
+
+// startupValidationTimeout bounds the Linode API requests made by validateStartup.
+var startupValidationTimeout = time.Minute
+
+// startupCheck is a Linode API client checked on startup, with the regions whose NodeBalancers
+// it manages.
+type startupCheck struct {
+	// name names the token of client in the errors, e.g. LINODE_API_TOKEN.
+	name   string
+	client *linodego.Client
+
+	// regions are checked to exist, and are named by regionsFrom in the errors.
+	regions     []string
+	regionsFrom string
+}
+
+// validateStartup checks that the Linode API accepts the token of each check and knows its
+// regions, so that a misconfigured token or region fails startup with a clear message instead of
+// failing the first reconciles. apiToken is the token read from LINODE_API_TOKEN, if used. Only
+// the errors proving the configuration wrong fail startup: others, e.g. the API being
+// unreachable, are logged and the CCM starts anyway.
+func validateStartup(apiToken string, checks []startupCheck) error {
+	if apiToken != strings.TrimSpace(apiToken) {
+		return fmt.Errorf("%s has leading or trailing whitespace, e.g. the newline of the file its Secret was created from", accessTokenEnv)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupValidationTimeout)
+	defer cancel()
+
+	for _, check := range checks {
+		if err := check.run(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c startupCheck) run(ctx context.Context) error {
+	if _, err := c.client.GetProfile(ctx); classifyAPIError(err) == apiErrorUnauthorized {
+		return fmt.Errorf("the Linode API rejected the token of %s, check that it is valid and not expired or revoked: %v", c.name, err)
+	} else if err != nil {
+		klog.Warningf("failed to check the token of %s with the Linode API, starting anyway: %s", c.name, err)
+		return nil
+	}
+
+	for _, region := range c.regions {
+		if _, err := c.client.GetRegion(ctx, region); classifyAPIError(err) == apiErrorNotFound {
+			return fmt.Errorf("region %s of %s doesn't exist, check the regions listed by the Linode API", region, c.regionsFrom)
+		} else if err != nil {
+			klog.Warningf("failed to check region %s of %s with the Linode API, starting anyway: %s", region, c.regionsFrom, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package linode
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+)
+
+func TestValidateStartup(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	newClient := func(token string) *linodego.Client {
+		client := linodego.NewClient(http.DefaultClient)
+		client.SetBaseURL(ts.URL)
+		client.SetToken(token)
+		return &client
+	}
+
+	for _, test := range []struct {
+		name     string
+		apiToken string
+		checks   []startupCheck
+		err      string
+	}{
+		{
+			name:     "valid",
+			apiToken: "token",
+			checks: []startupCheck{
+				{name: accessTokenEnv, client: newClient("token"), regions: []string{"us-west"}, regionsFrom: regionEnv},
+				{name: "account secondary", client: newClient("secondary"), regions: []string{"eu-west"}, regionsFrom: "account secondary"},
+			},
+		},
+		{
+			name:     "token with a trailing newline",
+			apiToken: "token\n",
+			checks:   []startupCheck{{name: accessTokenEnv, client: newClient("token\n"), regions: []string{"us-west"}, regionsFrom: regionEnv}},
+			err:      "LINODE_API_TOKEN has leading or trailing whitespace",
+		},
+		{
+			name:     "revoked token",
+			apiToken: fakeRevokedToken,
+			checks:   []startupCheck{{name: accessTokenEnv, client: newClient(fakeRevokedToken), regions: []string{"us-west"}, regionsFrom: regionEnv}},
+			err:      "the Linode API rejected the token of LINODE_API_TOKEN",
+		},
+		{
+			name:     "revoked account token",
+			apiToken: "token",
+			checks: []startupCheck{
+				{name: accessTokenEnv, client: newClient("token"), regions: []string{"us-west"}, regionsFrom: regionEnv},
+				{name: "account secondary", client: newClient(fakeRevokedToken), regions: []string{"eu-west"}, regionsFrom: "account secondary"},
+			},
+			err: "the Linode API rejected the token of account secondary",
+		},
+		{
+			name:     "unknown region",
+			apiToken: "token",
+			checks:   []startupCheck{{name: accessTokenEnv, client: newClient("token"), regions: []string{"us-mars"}, regionsFrom: regionEnv}},
+			err:      "region us-mars of LINODE_REGION doesn't exist",
+		},
+		{
+			name: "unknown account region",
+			checks: []startupCheck{
+				{name: "--linode-token-file", client: newClient("token"), regions: []string{"us-west"}, regionsFrom: regionEnv},
+				{name: "account secondary", client: newClient("secondary"), regions: []string{"eu-west", "eu-mars"}, regionsFrom: "account secondary"},
+			},
+			err: "region eu-mars of account secondary doesn't exist",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateStartup(test.apiToken, test.checks)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateStartupAPIUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	// linodego retries unavailable APIs until the timeout.
+	defer func(timeout time.Duration) { startupValidationTimeout = timeout }(startupValidationTimeout)
+	startupValidationTimeout = time.Second
+
+	// The CCM starts anyway when the configuration can't be checked.
+	checks := []startupCheck{{name: accessTokenEnv, client: &client, regions: []string{"us-west"}, regionsFrom: regionEnv}}
+	if err := validateStartup("token", checks); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+}
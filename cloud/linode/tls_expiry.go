@@ -0,0 +1,168 @@
+package linode
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/appscode/go/wait"
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// tlsExpiryCheckInterval is how often the certificates of the NodeBalancers of this cluster are
+// checked for expiry.
+var tlsExpiryCheckInterval = time.Hour
+
+// tlsExpiryChecker periodically reports the certificates of the https configs of the NodeBalancers
+// created for this cluster that expire within the warning window, as events on the Services
+// owning their ports and as metrics. It only reads from the Linode API and the TLS Secrets.
+type tlsExpiryChecker struct {
+	loadbalancers *loadbalancers
+	services      v1listers.ServiceLister
+	hasSynced     cache.InformerSynced
+	clusterTag    string
+	window        time.Duration
+
+	now func() time.Time
+}
+
+func newTLSExpiryChecker(loadbalancers *loadbalancers, informer cache.SharedIndexInformer, clusterTag string, window time.Duration) *tlsExpiryChecker {
+	return &tlsExpiryChecker{
+		loadbalancers: loadbalancers,
+		services:      v1listers.NewServiceLister(informer.GetIndexer()),
+		hasSynced:     informer.HasSynced,
+		clusterTag:    clusterTag,
+		window:        window,
+		now:           time.Now,
+	}
+}
+
+func (c *tlsExpiryChecker) Run(interval time.Duration, stopCh <-chan struct{}) {
+	if !cache.WaitForCacheSync(stopCh, c.hasSynced) {
+		klog.Errorf("TLS certificate expiry checker failed to sync the service cache")
+		return
+	}
+
+	wait.Until(func() {
+		if err := c.check(context.Background()); err != nil {
+			klog.Errorf("failed to check the expiry of NodeBalancer TLS certificates: %s", err)
+		}
+	}, interval, stopCh)
+}
+
+// check replaces the certificate expiry metrics with the ones of the https configs of the
+// NodeBalancers of this cluster, in every account. A NodeBalancer whose certificates can't be
+// read is logged and skipped.
+func (c *tlsExpiryChecker) check(ctx context.Context) error {
+	services, err := c.services.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	servicesByUID := make(map[string]*v1.Service, len(services))
+	for _, service := range services {
+		servicesByUID[string(service.UID)] = service
+	}
+
+	type accountNodeBalancers struct {
+		lb  *loadbalancers
+		nbs []linodego.NodeBalancer
+	}
+	var accounts []accountNodeBalancers
+	for _, lb := range append([]*loadbalancers{c.loadbalancers}, c.loadbalancers.accountLoadBalancers()...) {
+		nbs, err := lb.client.ListNodeBalancers(ctx, nil)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, accountNodeBalancers{lb, nbs})
+	}
+
+	nodeBalancerTLSCertExpiry.Reset()
+	for _, account := range accounts {
+		for i := range account.nbs {
+			nb := &account.nbs[i]
+			if !containsString(nb.Tags, c.clusterTag) {
+				continue
+			}
+			if err := c.checkNodeBalancer(ctx, account.lb, nb, servicesByUID); err != nil {
+				klog.Warningf("failed to check the TLS certificates of NodeBalancer (%d): %s", nb.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *tlsExpiryChecker) checkNodeBalancer(ctx context.Context, lb *loadbalancers, nb *linodego.NodeBalancer, servicesByUID map[string]*v1.Service) error {
+	owners := getPortOwners(nb)
+
+	nbCfgs, err := lb.client.ListNodeBalancerConfigs(ctx, nb.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, nbCfg := range nbCfgs {
+		service, ok := servicesByUID[owners[nbCfg.Port]]
+		if nbCfg.Protocol != linodego.ProtocolHTTPS || !ok {
+			continue
+		}
+
+		notAfter, err := lb.getTLSCertExpiry(service, nbCfg)
+		if err != nil {
+			klog.V(2).Infof("failed to read the TLS certificate of port %d of NodeBalancer (%d): %s", nbCfg.Port, nb.ID, err)
+			continue
+		}
+		nodeBalancerTLSCertExpiry.WithLabelValues(service.Namespace, service.Name, strconv.Itoa(nbCfg.Port)).Set(float64(notAfter.Unix()))
+
+		if remaining := notAfter.Sub(c.now()); remaining <= 0 {
+			lb.recordEvent(service, v1.EventTypeWarning, "TLSCertExpired",
+				"the TLS certificate of port %d of NodeBalancer (%d) expired on %s", nbCfg.Port, nb.ID, notAfter.UTC().Format(time.RFC3339))
+		} else if remaining < c.window {
+			lb.recordEvent(service, v1.EventTypeWarning, "TLSCertExpiring",
+				"the TLS certificate of port %d of NodeBalancer (%d) expires on %s", nbCfg.Port, nb.ID, notAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// getTLSCertExpiry returns when the certificate of nbCfg expires. The Linode API may redact the
+// certificates of configs, in which case the certificate of the port's TLS Secret, which is the
+// one uploaded to the config, is read instead.
+func (l *loadbalancers) getTLSCertExpiry(service *v1.Service, nbCfg linodego.NodeBalancerConfig) (time.Time, error) {
+	if notAfter, err := parseCertExpiry(nbCfg.SSLCert); err == nil {
+		return notAfter, nil
+	}
+
+	portConfig, err := getPortConfig(service, nbCfg.Port)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err = l.retrieveKubeClient(); err != nil {
+		return time.Time{}, err
+	}
+	cert, _, err := getTLSCertInfo(l.kubeClient, service.Namespace, portConfig)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseCertExpiry(cert)
+}
+
+// parseCertExpiry returns the expiry of the first certificate of the PEM-encoded chain.
+func parseCertExpiry(chain string) (time.Time, error) {
+	block, _ := pem.Decode([]byte(chain))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, fmt.Errorf("no PEM-encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
@@ -0,0 +1,138 @@
+package linode
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestCertificate(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestTLSExpiryChecker(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	const clusterTag = clusterTagPrefix + "test"
+
+	kubeClient := fake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	newService := func(name string, notAfter time.Time) {
+		service := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				UID:       types.UID("uid-" + name),
+				Annotations: map[string]string{
+					annLinodePortTLSSecretPrefix + "443": name + "-tls",
+				},
+			},
+			Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30443}}},
+		}
+		if err := indexer.Add(service); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := kubeClient.CoreV1().Secrets("default").Create(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-tls"},
+			Data: map[string][]byte{
+				v1.TLSCertKey:       []byte(newTestCertificate(t, notAfter)),
+				v1.TLSPrivateKeyKey: []byte(testKey),
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		nb, err := client.CreateNodeBalancer(context.TODO(), linodego.NodeBalancerCreateOptions{
+			Region: "us-west",
+			Tags:   []string{clusterTag, "ccm:443:uid-" + name},
+		})
+		if err != nil {
+			t.Fatalf("failed to create NodeBalancer: %s", err)
+		}
+		// The Linode API redacts the certificates of configs.
+		id := nb.ID + 1
+		fakeAPI.nbc[strconv.Itoa(id)] = &linodego.NodeBalancerConfig{
+			ID:             id,
+			NodeBalancerID: nb.ID,
+			Port:           443,
+			Protocol:       linodego.ProtocolHTTPS,
+			SSLCert:        "<REDACTED>",
+		}
+	}
+
+	expiring := now.Add(10 * 24 * time.Hour)
+	newService("expiring", expiring)
+	newService("expired", now.Add(-time.Hour))
+	newService("valid", now.Add(60*24*time.Hour))
+
+	recorder := record.NewFakeRecorder(10)
+	checker := &tlsExpiryChecker{
+		loadbalancers: &loadbalancers{client: &client, zone: "us-west", kubeClient: kubeClient, recorder: recorder},
+		services:      v1listers.NewServiceLister(indexer),
+		clusterTag:    clusterTag,
+		window:        30 * 24 * time.Hour,
+		now:           func() time.Time { return now },
+	}
+	if err := checker.check(context.TODO()); err != nil {
+		t.Fatalf("check returned an error: %s", err)
+	}
+
+	events := make(map[string]string)
+	for len(recorder.Events) > 0 {
+		event := <-recorder.Events
+		events[strings.Fields(event)[1]] = event
+	}
+	if len(events) != 2 {
+		t.Errorf("expected an event for the expiring and the expired certificate, got %v", events)
+	}
+	if !strings.Contains(events["TLSCertExpiring"], "port 443") || !strings.Contains(events["TLSCertExpiring"], expiring.Format(time.RFC3339)) {
+		t.Errorf("expected a TLSCertExpiring event, got %q", events["TLSCertExpiring"])
+	}
+	if _, ok := events["TLSCertExpired"]; !ok {
+		t.Errorf("expected a TLSCertExpired event, got %v", events)
+	}
+
+	if actual := gaugeValue(t, nodeBalancerTLSCertExpiry.WithLabelValues("default", "expiring", "443")); actual != float64(expiring.Unix()) {
+		t.Errorf("expected the expiry of the certificate to be exported as %d, got %v", expiring.Unix(), actual)
+	}
+}
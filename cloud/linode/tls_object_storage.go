@@ -0,0 +1,226 @@
+package linode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+)
+
+// tlsObjectFetchTimeout bounds the download of a certificate bundle from Object Storage, so that
+// an unreachable bucket doesn't hold up the reconcile of the Service.
+const tlsObjectFetchTimeout = 10 * time.Second
+
+// tlsObjectMaxSize is the size above which a certificate bundle is rejected.
+const tlsObjectMaxSize = 1 << 20
+
+// tlsObjectBundle is a certificate chain and its private key, read from Object Storage.
+type tlsObjectBundle struct {
+	etag string
+	cert string
+	key  string
+}
+
+// tlsObjectCache caches the certificate bundles of the tls-object-url annotations by ETag, and
+// remembers the bundle last uploaded to each NodeBalancer config, so that unchanged bundles are
+// neither downloaded nor uploaded again.
+type tlsObjectCache struct {
+	// httpClient fetches the bundles; nil uses a client timing out after tlsObjectFetchTimeout.
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	bundles  map[string]tlsObjectBundle
+	uploaded map[int]string
+}
+
+// tlsObjectKey returns the key of the bundle of rawURL in the cache: the URL without its query,
+// as the signature of a signed URL changes whenever it is signed again.
+func tlsObjectKey(rawURL string) string {
+	return strings.SplitN(rawURL, "?", 2)[0]
+}
+
+// fetch returns the bundle at rawURL. The request is conditional on the ETag of the cached
+// bundle, which is returned as is if the object didn't change.
+func (c *tlsObjectCache) fetch(rawURL string) (tlsObjectBundle, error) {
+	cached, ok := c.cached(rawURL)
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return tlsObjectBundle{}, err
+	}
+	if ok && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	client := c.httpClient
+	if client == nil {
+		client = &http.Client{Timeout: tlsObjectFetchTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return tlsObjectBundle{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		return cached, nil
+	case resp.StatusCode != http.StatusOK:
+		return tlsObjectBundle{}, fmt.Errorf("GET %s: %s", tlsObjectKey(rawURL), resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, tlsObjectMaxSize+1))
+	if err != nil {
+		return tlsObjectBundle{}, err
+	}
+	if len(body) > tlsObjectMaxSize {
+		return tlsObjectBundle{}, fmt.Errorf("certificate bundle %s is larger than %d bytes", tlsObjectKey(rawURL), tlsObjectMaxSize)
+	}
+
+	bundle, err := parseTLSBundle(body)
+	if err != nil {
+		return tlsObjectBundle{}, fmt.Errorf("certificate bundle %s: %v", tlsObjectKey(rawURL), err)
+	}
+	// Objects served without an ETag are told apart by their content.
+	bundle.etag = resp.Header.Get("ETag")
+	if bundle.etag == "" {
+		sum := sha256.Sum256(body)
+		bundle.etag = hex.EncodeToString(sum[:])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bundles == nil {
+		c.bundles = make(map[string]tlsObjectBundle)
+	}
+	c.bundles[tlsObjectKey(rawURL)] = bundle
+	return bundle, nil
+}
+
+func (c *tlsObjectCache) cached(rawURL string) (tlsObjectBundle, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bundle, ok := c.bundles[tlsObjectKey(rawURL)]
+	return bundle, ok
+}
+
+// isUploaded reports whether the bundle with etag is the one last uploaded to the config configID.
+func (c *tlsObjectCache) isUploaded(configID int, etag string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return etag != "" && c.uploaded[configID] == etag
+}
+
+func (c *tlsObjectCache) setUploaded(configID int, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.uploaded == nil {
+		c.uploaded = make(map[int]string)
+	}
+	c.uploaded[configID] = etag
+}
+
+// parseTLSBundle splits a PEM bundle into its certificate chain, in order, and its private key.
+func parseTLSBundle(data []byte) (tlsObjectBundle, error) {
+	var bundle tlsObjectBundle
+	var certs []string
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		encoded := strings.TrimSpace(string(pem.EncodeToMemory(block)))
+		switch {
+		case block.Type == "CERTIFICATE":
+			certs = append(certs, encoded)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if bundle.key != "" {
+				return bundle, fmt.Errorf("more than one private key")
+			}
+			bundle.key = encoded
+		}
+	}
+
+	if len(certs) == 0 {
+		return bundle, fmt.Errorf("no PEM certificate")
+	}
+	if bundle.key == "" {
+		return bundle, fmt.Errorf("no PEM private key")
+	}
+	bundle.cert = strings.Join(certs, "\n")
+	return bundle, nil
+}
+
+// getTLSObjectURL returns the URL of the certificate bundle of port from its tls-object-url
+// annotation, validated to be an https URL.
+func getTLSObjectURL(service *v1.Service, port int) (string, bool, error) {
+	rawURL, ok := getServiceAnnotation(service, annLinodePortTLSObjectURLPrefix+strconv.Itoa(port))
+	if !ok {
+		return "", false, nil
+	}
+	if parsed, err := url.Parse(rawURL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return "", true, fmt.Errorf("invalid value for %q: must be an https URL", annLinodePortTLSObjectURLPrefix+strconv.Itoa(port))
+	}
+	return rawURL, true, nil
+}
+
+// addTLSObjectCert sets the certificate and key of nbConfig to the bundle at the tls-object-url of
+// config. If the bundle can't be fetched, a warning event is recorded and the last bundle fetched
+// is used, or none at all, which keeps the certificate of an existing config.
+func (l *loadbalancers) addTLSObjectCert(service *v1.Service, nbConfig *linodego.NodeBalancerConfig, config portConfig) {
+	bundle, err := l.tlsObjects.fetch(config.TLSObjectURL)
+	if err != nil {
+		cached, ok := l.tlsObjects.cached(config.TLSObjectURL)
+		if ok {
+			l.recordEvent(service, v1.EventTypeWarning, "TLSObjectFetchFailed", "failed to fetch the certificate of port %d, keeping the last one fetched: %s", config.Port, err)
+		} else {
+			l.recordEvent(service, v1.EventTypeWarning, "TLSObjectFetchFailed", "failed to fetch the certificate of port %d, keeping its current certificate: %s", config.Port, err)
+		}
+		bundle = cached
+	}
+	nbConfig.SSLCert, nbConfig.SSLKey = bundle.cert, bundle.key
+}
+
+// omitUploadedTLSObjectCert removes the certificate and key from desired, the desired settings of
+// the config current of port, if they are the bundle of its tls-object-url last uploaded to
+// current, which is then left with its certificate.
+func (l *loadbalancers) omitUploadedTLSObjectCert(service *v1.Service, port int, current *linodego.NodeBalancerConfig, desired *linodego.NodeBalancerConfig) {
+	if etag := l.tlsObjectETag(service, port, *desired); l.tlsObjects.isUploaded(current.ID, etag) {
+		desired.SSLCert, desired.SSLKey = "", ""
+	}
+}
+
+// recordUploadedTLSObjectCert remembers the bundle of the tls-object-url of port uploaded with
+// desired to the config configID.
+func (l *loadbalancers) recordUploadedTLSObjectCert(service *v1.Service, port, configID int, desired linodego.NodeBalancerConfig) {
+	if etag := l.tlsObjectETag(service, port, desired); etag != "" {
+		l.tlsObjects.setUploaded(configID, etag)
+	}
+}
+
+// tlsObjectETag returns the ETag of the cached bundle of the tls-object-url of port if desired
+// holds its certificate, or "" otherwise.
+func (l *loadbalancers) tlsObjectETag(service *v1.Service, port int, desired linodego.NodeBalancerConfig) string {
+	rawURL, ok, err := getTLSObjectURL(service, port)
+	if !ok || err != nil || desired.SSLCert == "" {
+		return ""
+	}
+	bundle, ok := l.tlsObjects.cached(rawURL)
+	if !ok || bundle.cert != desired.SSLCert {
+		return ""
+	}
+	return bundle.etag
+}
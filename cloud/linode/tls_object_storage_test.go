@@ -0,0 +1,214 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_parseTLSBundle(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "certificate and key", data: testCert + "\n" + testKey},
+		{name: "key first", data: testKey + "\n" + testCert},
+		{name: "no key", data: testCert, err: "no PEM private key"},
+		{name: "no certificate", data: testKey, err: "no PEM certificate"},
+		{name: "two keys", data: testCert + "\n" + testKey + "\n" + testKey, err: "more than one private key"},
+		{name: "not PEM", data: "hello", err: "no PEM certificate"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			bundle, err := parseTLSBundle([]byte(test.data))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if bundle.cert != strings.TrimSpace(testCert) || bundle.key != strings.TrimSpace(testKey) {
+				t.Errorf("unexpected bundle %+v", bundle)
+			}
+		})
+	}
+}
+
+// fakeObjectStorage serves a certificate bundle like a signed Object Storage URL.
+type fakeObjectStorage struct {
+	mu          sync.Mutex
+	etag        string
+	body        string
+	status      int
+	fetches     int
+	conditional int
+}
+
+func (f *fakeObjectStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches++
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == f.etag {
+		f.conditional++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", f.etag)
+	_, _ = w.Write([]byte(f.body))
+}
+
+func (f *fakeObjectStorage) set(etag, body string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.etag, f.body, f.status = etag, body, status
+}
+
+func TestUpdateLoadBalancerTLSObjectURL(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	objects := &fakeObjectStorage{etag: `"v1"`, body: testCert + "\n" + testKey}
+	objectServer := httptest.NewTLSServer(objects)
+	defer objectServer.Close()
+
+	recorder := record.NewFakeRecorder(10)
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+	lb.tlsObjects.httpClient = objectServer.Client()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: randString(10),
+			UID:  "foobar123",
+			Annotations: map[string]string{
+				annLinodePortTLSObjectURLPrefix + "443": objectServer.URL + "/certs/bundle.pem?X-Amz-Signature=1",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30443}},
+		},
+	}
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}}},
+	}}
+
+	if _, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nodes); err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	stubService(fakeClientset, svc)
+
+	certUploads := func() int {
+		fakeAPI.mu.Lock()
+		defer fakeAPI.mu.Unlock()
+		uploads := 0
+		for request := range fakeAPI.requests {
+			if request.Method == http.MethodPut && strings.Contains(request.Path, "/configs/") && strings.Contains(request.Body, "ssl_cert") {
+				uploads++
+			}
+		}
+		fakeAPI.requests = make(map[fakeRequest]struct{})
+		return uploads
+	}
+	update := func() {
+		t.Helper()
+		if err := lb.UpdateLoadBalancer(context.TODO(), "linodelb", svc, nodes); err != nil {
+			t.Fatalf("UpdateLoadBalancer returned an error: %s", err)
+		}
+	}
+
+	// The first update uploads the bundle to the config created along with the NodeBalancer.
+	update()
+	if uploads := certUploads(); uploads != 1 {
+		t.Errorf("expected the certificate to be uploaded once, got %d uploads", uploads)
+	}
+
+	// An unchanged bundle is neither downloaded nor uploaded again, even with a new signature.
+	svc.Annotations[annLinodePortTLSObjectURLPrefix+"443"] = objectServer.URL + "/certs/bundle.pem?X-Amz-Signature=2"
+	update()
+	if uploads := certUploads(); uploads != 0 {
+		t.Errorf("expected the unchanged certificate not to be uploaded, got %d uploads", uploads)
+	}
+	if objects.conditional != 2 {
+		t.Errorf("expected the unchanged bundle to be fetched conditionally, got %d conditional fetches", objects.conditional)
+	}
+
+	// A rotated bundle is uploaded.
+	objects.set(`"v2"`, testKey+"\n"+testCert, 0)
+	update()
+	if uploads := certUploads(); uploads != 1 {
+		t.Errorf("expected the rotated certificate to be uploaded, got %d uploads", uploads)
+	}
+
+	// Failed fetches keep the current certificate.
+	objects.set(`"v3"`, "", http.StatusForbidden)
+	update()
+	if uploads := certUploads(); uploads != 0 {
+		t.Errorf("expected the current certificate to be kept, got %d uploads", uploads)
+	}
+	found := false
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.Contains(event, "TLSObjectFetchFailed") && strings.Contains(event, "403") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected a TLSObjectFetchFailed event")
+	}
+}
+
+func TestEnsureLoadBalancerTLSObjectURLUnavailable(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	objects := &fakeObjectStorage{status: http.StatusNotFound}
+	objectServer := httptest.NewTLSServer(objects)
+	defer objectServer.Close()
+
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fake.NewSimpleClientset(), recorder: record.NewFakeRecorder(10)}
+	lb.tlsObjects.httpClient = objectServer.Client()
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        randString(10),
+			UID:         "foobar123",
+			Annotations: map[string]string{annLinodePortTLSObjectURLPrefix + "443": objectServer.URL + "/bundle.pem"},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "https", Protocol: "TCP", Port: 443, NodePort: 30443}},
+		},
+	}
+
+	// Without a certificate fetched yet, the https config can't be created.
+	_, err := lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+	if err == nil || !strings.Contains(err.Error(), "without a certificate") {
+		t.Fatalf("expected an error creating an https config without a certificate, got %v", err)
+	}
+	if len(fakeAPI.nb) != 0 {
+		t.Errorf("expected no NodeBalancer to be created, got %d", len(fakeAPI.nb))
+	}
+}
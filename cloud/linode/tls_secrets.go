@@ -0,0 +1,239 @@
+package linode
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/appscode/go/wait"
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+// tlsSecretController updates the certificates of NodeBalancer configs when the TLS Secrets they
+// were built from change. The service controller doesn't sync Services on Secret changes, so
+// rotated certificates would otherwise only be picked up by unrelated Service updates.
+type tlsSecretController struct {
+	loadbalancers  *loadbalancers
+	services       v1listers.ServiceLister
+	servicesSynced cache.InformerSynced
+	informer       cache.SharedIndexInformer
+
+	queue workqueue.DelayingInterface
+}
+
+func newTLSSecretController(loadbalancers *loadbalancers, serviceInformer, secretInformer cache.SharedIndexInformer) *tlsSecretController {
+	return &tlsSecretController{
+		loadbalancers:  loadbalancers,
+		services:       v1listers.NewServiceLister(serviceInformer.GetIndexer()),
+		servicesSynced: serviceInformer.HasSynced,
+		informer:       secretInformer,
+		queue:          workqueue.NewDelayingQueue(),
+	}
+}
+
+// canWatchSecrets reports whether the CCM is allowed to list Secrets, which the
+// tlsSecretController needs.
+func canWatchSecrets(kubeClient kubernetes.Interface) bool {
+	_, err := kubeClient.CoreV1().Secrets("").List(metav1.ListOptions{Limit: 1})
+	if errors.IsForbidden(err) {
+		klog.Warningf("not allowed to list secrets, NodeBalancer TLS certificates won't be updated when their secrets change: %s", err)
+		return false
+	}
+	return true
+}
+
+func (c *tlsSecretController) Run(stopCh <-chan struct{}) {
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(*v1.Secret)
+			if !ok {
+				return
+			}
+			secret, ok := newObj.(*v1.Secret)
+			if !ok {
+				return
+			}
+
+			// Periodic resyncs deliver updates without changes.
+			if reflect.DeepEqual(old.Data, secret.Data) {
+				return
+			}
+			c.queue.Add(secret)
+		},
+		DeleteFunc: func(obj interface{}) {
+			secret, ok := obj.(*v1.Secret)
+			if !ok {
+				return
+			}
+			c.handleSecretDeleted(secret)
+		},
+	})
+	go c.informer.Run(stopCh)
+
+	// An unsynced service cache would make Services referencing the Secret look absent.
+	if !cache.WaitForCacheSync(stopCh, c.servicesSynced, c.informer.HasSynced) {
+		klog.Errorf("TLS secret controller failed to sync its caches")
+		return
+	}
+
+	wait.Until(c.worker, time.Second, stopCh)
+}
+
+// worker runs a worker thread that dequeues updated Secrets and updates the certificates of
+// the NodeBalancer configs using them.
+func (c *tlsSecretController) worker() {
+	for c.processNextUpdate() {
+	}
+}
+
+func (c *tlsSecretController) processNextUpdate() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	secret, ok := key.(*v1.Secret)
+	if !ok {
+		klog.Errorf("expected dequeued key to be of type *v1.Secret but got %T", key)
+		return true
+	}
+
+	if err := c.handleSecretUpdated(secret); err != nil {
+		if isRetryableError(err) {
+			klog.Errorf("failed to update TLS certificates from secret (%s/%s); retrying in 1 minute: %s", secret.Namespace, secret.Name, err)
+			c.queue.AddAfter(secret, retryInterval)
+			return true
+		}
+		klog.Errorf("failed to update TLS certificates from secret (%s/%s); will not retry: %s", secret.Namespace, secret.Name, err)
+	}
+	return true
+}
+
+// getReferencingServices returns the LoadBalancer Services using secret, with the configs of the
+// ports using it.
+func (c *tlsSecretController) getReferencingServices(secret *v1.Secret) (map[*v1.Service][]portConfig, error) {
+	services, err := c.services.Services(secret.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	referencing := make(map[*v1.Service][]portConfig)
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		for _, port := range getNodeBalancerPorts(service) {
+			config, err := getPortConfig(service, int(port.Port))
+			if err != nil || config.Protocol != linodego.ProtocolHTTPS || config.TLSSecretName != secret.Name {
+				continue
+			}
+			referencing[service] = append(referencing[service], config)
+		}
+	}
+	return referencing, nil
+}
+
+func (c *tlsSecretController) handleSecretUpdated(secret *v1.Secret) error {
+	referencing, err := c.getReferencingServices(secret)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for service, ports := range referencing {
+		if err := c.loadbalancers.updateTLSCerts(context.Background(), service, ports); err != nil {
+			c.loadbalancers.recordEvent(service, v1.EventTypeWarning, "TLSCertUpdateFailed",
+				"failed to update the certificate from secret %s: %s", secret.Name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// handleSecretDeleted warns the Services using secret. Their NodeBalancers keep the certificate
+// they were last configured with.
+func (c *tlsSecretController) handleSecretDeleted(secret *v1.Secret) {
+	referencing, err := c.getReferencingServices(secret)
+	if err != nil {
+		klog.Errorf("failed to list services using deleted secret (%s/%s): %s", secret.Namespace, secret.Name, err)
+		return
+	}
+
+	for service, ports := range referencing {
+		for _, port := range ports {
+			c.loadbalancers.recordEvent(service, v1.EventTypeWarning, "TLSSecretDeleted",
+				"TLS secret %s of port %d was deleted, the NodeBalancer keeps its current certificate", secret.Name, port.Port)
+		}
+	}
+}
+
+// updateTLSCerts updates the certificates of the configs of service's NodeBalancer for ports from
+// their TLS Secrets. A config whose Secret can't be read keeps its current certificate.
+func (l *loadbalancers) updateTLSCerts(ctx context.Context, service *v1.Service, ports []portConfig) error {
+	account, err := l.forService(service)
+	if err != nil {
+		return err
+	}
+	if account != l {
+		return account.updateTLSCerts(ctx, service, ports)
+	}
+
+	defer l.serviceLocks.lock(service)()
+	if isPaused(service) {
+		l.recordPaused(service, "update-tls-certs")
+		return nil
+	}
+
+	nb, err := l.getNodeBalancerForService(ctx, service)
+	switch err.(type) {
+	case nil:
+		break
+
+	case lbNotFoundError:
+		// The certificates will be used when the NodeBalancer is created.
+		return nil
+
+	default:
+		return err
+	}
+
+	nbCfgs, err := l.client.ListNodeBalancerConfigs(ctx, nb.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, port := range ports {
+		for i := range nbCfgs {
+			current := &nbCfgs[i]
+			if current.Port != port.Port {
+				continue
+			}
+
+			var certs linodego.NodeBalancerConfig
+			if err := l.addTLSCert(service, &certs, port); err != nil {
+				return err
+			}
+
+			update := current.GetUpdateOptions()
+			update.SSLCert = certs.SSLCert
+			update.SSLKey = certs.SSLKey
+			if err := l.updateNodeBalancerConfig(ctx, service, current, update); err != nil {
+				return err
+			}
+
+			klog.Infof("updated TLS certificate of port %d of NodeBalancer (%d) for service (%s)", port.Port, nb.ID, getServiceNn(service))
+			l.recordEvent(service, v1.EventTypeNormal, "TLSCertUpdated", "updated the certificate of port %d from secret %s", port.Port, port.TLSSecretName)
+		}
+	}
+	return nil
+}
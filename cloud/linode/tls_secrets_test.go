@@ -0,0 +1,128 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestTLSSecretController(t *testing.T) {
+	fakeAPI := newFake(t)
+	ts := httptest.NewServer(fakeAPI)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	kubeClient := fake.NewSimpleClientset()
+	addTLSSecret(t, kubeClient)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      randString(10),
+			Namespace: "test",
+			UID:       "foobar123",
+			Annotations: map[string]string{
+				annLinodePortTLSSecretPrefix + "443": "tls-secret",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{
+				{
+					Name:     randString(10),
+					Protocol: "TCP",
+					Port:     int32(443),
+					NodePort: int32(30000),
+				},
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: kubeClient, recorder: recorder}
+
+	lbStatus, err := lb.EnsureLoadBalancer(context.TODO(), "lnodelb", svc, []*v1.Node{})
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *lbStatus
+
+	nb, err := lb.getNodeBalancerByStatus(context.TODO(), svc)
+	if err != nil {
+		t.Fatalf("failed to get NodeBalancer: %s", err)
+	}
+	configs, err := client.ListNodeBalancerConfigs(context.TODO(), nb.ID, nil)
+	if err != nil || len(configs) != 1 {
+		t.Fatalf("failed to list NodeBalancer configs: %v", err)
+	}
+	if configs[0].Protocol != linodego.ProtocolHTTPS {
+		t.Errorf("expected port with a TLS secret to use https, got %s", configs[0].Protocol)
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if err = indexer.Add(svc); err != nil {
+		t.Fatal(err)
+	}
+	controller := &tlsSecretController{loadbalancers: lb, services: v1listers.NewServiceLister(indexer)}
+
+	secret, err := kubeClient.CoreV1().Secrets("test").Get("tls-secret", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Data[v1.TLSCertKey] = []byte("rotated-cert")
+	secret.Data[v1.TLSPrivateKeyKey] = []byte("rotated-key")
+	if secret, err = kubeClient.CoreV1().Secrets("test").Update(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = controller.handleSecretUpdated(secret); err != nil {
+		t.Fatalf("handleSecretUpdated returned an error: %s", err)
+	}
+
+	update := configs[0].GetUpdateOptions()
+	update.SSLCert = "rotated-cert"
+	update.SSLKey = "rotated-key"
+	expectedBody, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/nodebalancers/%d/configs/%d", nb.ID, configs[0].ID)
+	if !fakeAPI.didRequestOccur(http.MethodPut, path, string(expectedBody)) {
+		t.Errorf("expected the config to be updated with the rotated certificate")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "TLSCertUpdated") {
+		t.Errorf("expected TLSCertUpdated event, got %q", event)
+	}
+
+	delete(secret.Data, v1.TLSPrivateKeyKey)
+	if secret, err = kubeClient.CoreV1().Secrets("test").Update(secret); err != nil {
+		t.Fatal(err)
+	}
+	if err = controller.handleSecretUpdated(secret); err == nil {
+		t.Error("expected an error for a secret without a private key")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InvalidTLSSecret") {
+		t.Errorf("expected InvalidTLSSecret event, got %q", event)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "TLSCertUpdateFailed") {
+		t.Errorf("expected TLSCertUpdateFailed event, got %q", event)
+	}
+
+	controller.handleSecretDeleted(secret)
+	if event := <-recorder.Events; !strings.Contains(event, "TLSSecretDeleted") {
+		t.Errorf("expected TLSSecretDeleted event, got %q", event)
+	}
+}
@@ -0,0 +1,96 @@
+package linode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+// tokenFilePollInterval is how often the token file is checked for a rotated token. The kubelet
+// takes up to a minute to update mounted Secrets, so polling more often gains little.
+var tokenFilePollInterval = 30 * time.Second
+
+// tokenFile is the Linode API token read from --linode-token-file, e.g. a key of a mounted
+// Secret. It is reloaded when the file changes so that rotated tokens are used without
+// restarting the CCM.
+type tokenFile struct {
+	path string
+
+	mu    sync.RWMutex
+	token string
+}
+
+// newTokenFile reads the token of path, which must hold a valid token at startup.
+func newTokenFile(path string) (*tokenFile, error) {
+	token, err := readTokenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenFile{path: path, token: token}, nil
+}
+
+// Token returns the last valid token read from the file.
+func (f *tokenFile) Token() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.token
+}
+
+// Run reloads the token every interval until stopCh is closed.
+func (f *tokenFile) Run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(f.reload, interval, stopCh)
+}
+
+// reload reads the file again, keeping the previous token if it is missing, empty or malformed,
+// e.g. while the Secret is being rotated.
+func (f *tokenFile) reload() {
+	token, err := readTokenFile(f.path)
+	if err != nil {
+		klog.Warningf("keeping the current Linode API token: %s", err)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if token != f.token {
+		f.token = token
+		klog.Infof("reloaded the Linode API token from %s", f.path)
+	}
+}
+
+func readTokenFile(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the Linode API token file: %v", err)
+	}
+
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("the Linode API token file %s is empty", path)
+	}
+	if strings.IndexFunc(token, func(r rune) bool { return r <= ' ' || r >= 0x7f }) >= 0 {
+		return "", fmt.Errorf("the Linode API token file %s is malformed: tokens can't contain whitespace or control characters", path)
+	}
+	return token, nil
+}
+
+// tokenTransport is an http.RoundTripper authenticating Linode API requests with the current
+// token. Setting the token per request lets a rotated token be used by the clients sharing it,
+// while requests in flight complete with the token they were sent with.
+type tokenTransport struct {
+	next  http.RoundTripper
+	token func() string
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request they are given.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token())
+	return t.next.RoundTrip(req)
+}
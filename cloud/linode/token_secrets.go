@@ -0,0 +1,169 @@
+package linode
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// annLinodeTokenSecret is the annotation naming a Secret of the namespace of the Service holding
+// the Linode API token of the account its NodeBalancer is managed in, e.g. the account of a team
+// in a multi-tenant cluster.
+const annLinodeTokenSecret = "service.beta.kubernetes.io/linode-loadbalancer-token-secret"
+
+// tokenSecretKey is the key of the token in the Secrets referenced by annLinodeTokenSecret, like
+// in the Secret of LINODE_API_TOKEN.
+const tokenSecretKey = "apiToken"
+
+// tokenSecretAccounts are the loadbalancers of the accounts of the token Secrets referenced by
+// Services, by the namespace/name of their Secret. Each Secret keeps its loadbalancers, and their
+// locks and state, when its token is rotated. Secrets are only shared by the Services of their
+// namespace, which are the only ones able to reference them.
+type tokenSecretAccounts struct {
+	mu       sync.Mutex
+	accounts map[string]*tokenSecretAccount
+
+	// newClient returns a Linode API client authenticated with the token returned by token.
+	newClient func(token func() string) *linodego.Client
+}
+
+func newTokenSecretAccounts() *tokenSecretAccounts {
+	return &tokenSecretAccounts{
+		newClient: func(token func() string) *linodego.Client {
+			return newLinodeClientWithToken(token, "")
+		},
+	}
+}
+
+// tokenSecretAccount is the account of a token Secret.
+type tokenSecretAccount struct {
+	mu    sync.RWMutex
+	token string
+
+	loadbalancers *loadbalancers
+}
+
+// Token returns the last token read from the Secret.
+func (a *tokenSecretAccount) Token() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.token
+}
+
+func (a *tokenSecretAccount) setToken(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = token
+}
+
+// tokenSecretNotFoundError is returned for a Service whose token Secret doesn't exist and whose
+// token wasn't read since the CCM started. The NodeBalancer of such a Service can't be reached
+// until the Secret is recreated, so the service controller retries its deletion.
+type tokenSecretNotFoundError struct {
+	err error
+}
+
+func (e tokenSecretNotFoundError) Error() string {
+	return e.err.Error()
+}
+
+// isTokenSecretNamespaceAllowed reports whether the Services of namespace may reference token
+// Secrets, as allowed by Options.TokenSecretNamespaces.
+func isTokenSecretNamespaceAllowed(namespace string) bool {
+	for _, allowed := range Options.TokenSecretNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// forTokenSecret returns the loadbalancers of the account of the token Secret secretName of the
+// namespace of service, reading the token again so that rotations are followed. The last token
+// read keeps being used once the Secret is deleted, so that the NodeBalancer of a Service deleted
+// along with its Secret, e.g. with their namespace, can still be deleted. That token is only kept
+// in memory, so a tokenSecretNotFoundError is returned for a missing Secret after a restart.
+func (l *loadbalancers) forTokenSecret(service *v1.Service, secretName string) (*loadbalancers, error) {
+	if !isTokenSecretNamespaceAllowed(service.Namespace) {
+		err := fmt.Errorf("%s can't be used in namespace %s, which isn't one of the namespaces of --token-secret-namespaces", annLinodeTokenSecret, service.Namespace)
+		l.recordEvent(service, v1.EventTypeWarning, "TokenSecretRefused", "%s", err)
+		return nil, err
+	}
+
+	key := service.Namespace + "/" + secretName
+	token, err := l.readTokenSecret(service.Namespace, secretName)
+	if errors.IsNotFound(err) {
+		if account := l.tokenSecrets.get(key); account != nil {
+			return account.loadbalancers, nil
+		}
+	}
+	if err != nil {
+		l.recordEvent(service, v1.EventTypeWarning, "TokenSecretFailed", "%s", err)
+		if errors.IsNotFound(err) {
+			return nil, tokenSecretNotFoundError{err: err}
+		}
+		return nil, err
+	}
+	return l.tokenSecrets.getOrCreate(key, token, l), nil
+}
+
+// readTokenSecret returns the token of the Secret name of namespace.
+func (l *loadbalancers) readTokenSecret(namespace, name string) (string, error) {
+	if err := l.retrieveKubeClient(); err != nil {
+		return "", err
+	}
+	secret, err := l.kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if errors.IsForbidden(err) {
+		return "", fmt.Errorf("not allowed to read token secret %s/%s, the CCM needs RBAC permissions to get secrets: %v", namespace, name, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Tokens are never logged, so only their absence is reported.
+	token := strings.TrimSpace(string(secret.Data[tokenSecretKey]))
+	if token == "" {
+		return "", fmt.Errorf("token secret %s/%s has no %s", namespace, name, tokenSecretKey)
+	}
+	return token, nil
+}
+
+func (a *tokenSecretAccounts) get(key string) *tokenSecretAccount {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.accounts[key]
+}
+
+// getOrCreate returns the account of the Secret key, creating loadbalancers for it like parent
+// if it has none yet, or updating its token otherwise.
+func (a *tokenSecretAccounts) getOrCreate(key, token string, parent *loadbalancers) *loadbalancers {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if account, ok := a.accounts[key]; ok {
+		account.setToken(token)
+		return account.loadbalancers
+	}
+
+	// The default NodeBalancer is in the account of LINODE_API_TOKEN.
+	defaults := parent.defaults
+	defaults.DefaultNodeBalancerID = 0
+
+	account := &tokenSecretAccount{token: token}
+	account.loadbalancers = newLoadbalancers(a.newClient(account.Token), parent.zone, defaults).(*loadbalancers)
+	account.loadbalancers.kubeClient = parent.kubeClient
+	account.loadbalancers.recorder = parent.recorder
+	account.loadbalancers.nodes = parent.nodes
+	account.loadbalancers.onDryRun = parent.onDryRun
+
+	if a.accounts == nil {
+		a.accounts = make(map[string]*tokenSecretAccount)
+	}
+	a.accounts[key] = account
+	return account.loadbalancers
+}
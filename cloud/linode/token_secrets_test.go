@@ -0,0 +1,253 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode/linodego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestTokenSecret(t *testing.T) {
+	Options.TokenSecretNamespaces = []string{"team-a"}
+	defer func() { Options.TokenSecretNamespaces = nil }()
+
+	globalAPI := newFake(t)
+	globalServer := httptest.NewServer(globalAPI)
+	defer globalServer.Close()
+	teamAPI := newFake(t)
+	teamServer := httptest.NewServer(teamAPI)
+	defer teamServer.Close()
+
+	globalClient := linodego.NewClient(http.DefaultClient)
+	globalClient.SetBaseURL(globalServer.URL)
+
+	recorder := record.NewFakeRecorder(10)
+	fakeClientset := fake.NewSimpleClientset()
+	lb := &loadbalancers{client: &globalClient, zone: "us-west", kubeClient: fakeClientset, recorder: recorder}
+	lb.tokenSecrets = newTokenSecretAccounts()
+
+	// The clients of the token Secrets reach the fake API of the team, and record the token they
+	// were given.
+	var tokens []func() string
+	lb.tokenSecrets.newClient = func(token func() string) *linodego.Client {
+		tokens = append(tokens, token)
+		client := linodego.NewClient(http.DefaultClient)
+		client.SetBaseURL(teamServer.URL)
+		return &client
+	}
+
+	setSecret := func(namespace, name, token string) {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       map[string][]byte{tokenSecretKey: []byte(token + "\n")},
+		}
+		if _, err := fakeClientset.CoreV1().Secrets(namespace).Update(secret); err != nil {
+			if _, err = fakeClientset.CoreV1().Secrets(namespace).Create(secret); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	setSecret("team-a", "linode", "team-a-token")
+	setSecret("team-b", "linode", "team-b-token")
+
+	newService := func(namespace, name string, annotations map[string]string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				UID:         types.UID(namespace + "-" + name),
+				Annotations: annotations,
+			},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeLoadBalancer,
+				Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+			},
+		}
+	}
+
+	// Services without the annotation use the global token.
+	global := newService("team-a", "global", nil)
+	if account, err := lb.forService(global); err != nil || account != lb {
+		t.Errorf("expected the global loadbalancers, got %v, %v", account, err)
+	}
+
+	// Services with the annotation get their NodeBalancer in the account of the Secret.
+	svc := newService("team-a", "web", map[string]string{annLinodeTokenSecret: "linode"})
+	account, err := lb.forService(svc)
+	if err != nil {
+		t.Fatalf("forService returned an error: %s", err)
+	}
+	if account == lb {
+		t.Fatal("expected the loadbalancers of the token secret")
+	}
+	if len(tokens) != 1 || tokens[0]() != "team-a-token" {
+		t.Fatalf("expected a client authenticated with the token of the secret")
+	}
+	if _, err = lb.EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil); err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	if len(teamAPI.nb) != 1 || len(globalAPI.nb) != 0 {
+		t.Errorf("expected the NodeBalancer to be created with the token of the secret, got %d in the team account and %d in the global one", len(teamAPI.nb), len(globalAPI.nb))
+	}
+
+	// Services sharing the Secret share its client, and rotated tokens are followed.
+	setSecret("team-a", "linode", "rotated-token")
+	other := newService("team-a", "api", map[string]string{annLinodeTokenSecret: "linode"})
+	if again, err := lb.forService(other); err != nil || again != account {
+		t.Errorf("expected the loadbalancers of the secret to be reused, got %v, %v", again, err)
+	}
+	if len(tokens) != 1 || tokens[0]() != "rotated-token" {
+		t.Errorf("expected the client to use the rotated token")
+	}
+
+	// The last token keeps being used once the Secret is deleted.
+	if err = fakeClientset.CoreV1().Secrets("team-a").Delete("linode", &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := lb.forService(svc); err != nil || again != account {
+		t.Errorf("expected the cached loadbalancers of the deleted secret, got %v, %v", again, err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		service *v1.Service
+		event   string
+	}{
+		{
+			name:    "namespace not allowed",
+			service: newService("team-b", "web", map[string]string{annLinodeTokenSecret: "linode"}),
+			event:   "TokenSecretRefused",
+		},
+		{
+			name:    "missing secret",
+			service: newService("team-a", "web", map[string]string{annLinodeTokenSecret: "missing"}),
+			event:   "TokenSecretFailed",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := lb.forService(test.service); err == nil {
+				t.Fatal("expected an error")
+			}
+			if event := <-recorder.Events; !strings.Contains(event, test.event) {
+				t.Errorf("expected a %s event, got %q", test.event, event)
+			}
+		})
+	}
+
+	// Secrets without a token are refused.
+	if _, err = fakeClientset.CoreV1().Secrets("team-a").Create(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "empty"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = lb.forService(newService("team-a", "web", map[string]string{annLinodeTokenSecret: "empty"}))
+	if err == nil || !strings.Contains(err.Error(), "token secret team-a/empty has no apiToken") {
+		t.Errorf("expected an error for the secret without a token, got %v", err)
+	}
+}
+
+// requeueRecorder is a delaying queue recording the items added after a delay.
+type requeueRecorder struct {
+	workqueue.DelayingInterface
+	requeued []interface{}
+}
+
+func (q *requeueRecorder) AddAfter(item interface{}, _ time.Duration) {
+	q.requeued = append(q.requeued, item)
+}
+
+func TestTokenSecretDeletionAfterRestart(t *testing.T) {
+	Options.TokenSecretNamespaces = []string{"team-a"}
+	defer func() { Options.TokenSecretNamespaces = nil }()
+
+	teamAPI := newFake(t)
+	teamServer := httptest.NewServer(teamAPI)
+	defer teamServer.Close()
+
+	fakeClientset := fake.NewSimpleClientset()
+	newLoadbalancers := func() *loadbalancers {
+		client := linodego.NewClient(http.DefaultClient)
+		lb := &loadbalancers{client: &client, zone: "us-west", kubeClient: fakeClientset, recorder: record.NewFakeRecorder(10)}
+		lb.tokenSecrets = newTokenSecretAccounts()
+		lb.tokenSecrets.newClient = func(func() string) *linodego.Client {
+			client := linodego.NewClient(http.DefaultClient)
+			client.SetBaseURL(teamServer.URL)
+			return &client
+		}
+		return lb
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "linode"},
+		Data:       map[string][]byte{tokenSecretKey: []byte("team-a-token")},
+	}
+	if _, err := fakeClientset.CoreV1().Secrets("team-a").Create(secret); err != nil {
+		t.Fatal(err)
+	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "team-a",
+			UID:         "team-a-web",
+			Annotations: map[string]string{annLinodeTokenSecret: "linode"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80, NodePort: 30000}},
+		},
+	}
+	status, err := newLoadbalancers().EnsureLoadBalancer(context.TODO(), "linodelb", svc, nil)
+	if err != nil {
+		t.Fatalf("EnsureLoadBalancer returned an error: %s", err)
+	}
+	svc.Status.LoadBalancer = *status
+
+	// After a restart, the token of a deleted Secret is unknown, so the deletion is retried.
+	if err = fakeClientset.CoreV1().Secrets("team-a").Delete("linode", &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	queue := &requeueRecorder{DelayingInterface: workqueue.NewDelayingQueue()}
+	controller := &serviceController{loadbalancers: newLoadbalancers(), queue: queue}
+	queue.Add(svc)
+	controller.processNextDeletion()
+	if len(queue.requeued) != 1 || len(teamAPI.nb) != 1 {
+		t.Fatalf("expected the deletion to be retried and the NodeBalancer to be kept, got %d retries and %d NodeBalancers", len(queue.requeued), len(teamAPI.nb))
+	}
+
+	// Once the Secret is recreated, the retried deletion deletes the NodeBalancer.
+	if _, err = fakeClientset.CoreV1().Secrets("team-a").Create(secret); err != nil {
+		t.Fatal(err)
+	}
+	queue.Add(queue.requeued[0])
+	controller.processNextDeletion()
+	if len(queue.requeued) != 1 || len(teamAPI.nb) != 0 {
+		t.Errorf("expected the NodeBalancer to be deleted, got %d retries and %d NodeBalancers", len(queue.requeued), len(teamAPI.nb))
+	}
+}
+
+func Test_isTokenSecretNamespaceAllowed(t *testing.T) {
+	defer func() { Options.TokenSecretNamespaces = nil }()
+
+	for _, test := range []struct {
+		allowed  []string
+		expected bool
+	}{
+		{allowed: nil, expected: false},
+		{allowed: []string{"team-b"}, expected: false},
+		{allowed: []string{"team-b", "team-a"}, expected: true},
+		{allowed: []string{"*"}, expected: true},
+	} {
+		Options.TokenSecretNamespaces = test.allowed
+		if actual := isTokenSecretNamespaceAllowed("team-a"); actual != test.expected {
+			t.Errorf("%v: expected %t, got %t", test.allowed, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package linode
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linode/linodego"
+)
+
+func TestTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "linode-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "apiToken")
+
+	writeToken := func(token string) {
+		if err := ioutil.WriteFile(path, []byte(token), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := newTokenFile(path); err == nil {
+		t.Error("expected an error for a missing token file")
+	}
+	writeToken("\n")
+	if _, err := newTokenFile(path); err == nil {
+		t.Error("expected an error for an empty token file")
+	}
+
+	writeToken("token-1\n")
+	token, err := newTokenFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.Token() != "token-1" {
+		t.Errorf("expected token-1, got %q", token.Token())
+	}
+
+	writeToken("token-2")
+	token.reload()
+	if token.Token() != "token-2" {
+		t.Errorf("expected the rotated token-2, got %q", token.Token())
+	}
+
+	for _, invalid := range []string{"", "token 3", "token-3\nextra"} {
+		writeToken(invalid)
+		token.reload()
+		if token.Token() != "token-2" {
+			t.Errorf("expected %q to be ignored, got %q", invalid, token.Token())
+		}
+	}
+
+	os.Remove(path)
+	token.reload()
+	if token.Token() != "token-2" {
+		t.Errorf("expected a missing file to be ignored, got %q", token.Token())
+	}
+}
+
+func TestTokenTransport(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 123}`))
+	}))
+	defer ts.Close()
+
+	current := "token-1"
+	client := linodego.NewClient(&http.Client{
+		Transport: tokenTransport{next: http.DefaultTransport, token: func() string { return current }},
+	})
+	client.SetBaseURL(ts.URL)
+
+	for _, token := range []string{"token-1", "token-2"} {
+		current = token
+		if _, err := client.GetNodeBalancer(context.TODO(), 123); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if authorization != "Bearer "+token {
+			t.Errorf("expected the request to use %s, got %q", token, authorization)
+		}
+	}
+}
@@ -11,14 +11,27 @@ import (
 type zones struct {
 	client *linodego.Client
 	region string
+
+	// accounts are the clients of the other Linode accounts nodes may run in.
+	accounts []*linodego.Client
+
+	// metadata, if set, answers the lookups of the region of the Linode the CCM runs on.
+	metadata *metadataClient
+}
+
+func newZones(client *linodego.Client, zone string, accounts ...*linodego.Client) cloudprovider.Zones {
+	return zones{client, zone, accounts, getMetadataClient()}
 }
 
-func newZones(client *linodego.Client, zone string) cloudprovider.Zones {
-	return zones{client, zone}
+// regionZone returns the zone of a Linode in region. Linode has no zones within a region, so the
+// region is used as the failure domain as well, which sets both the zone and region topology
+// labels of nodes.
+func regionZone(region string) cloudprovider.Zone {
+	return cloudprovider.Zone{FailureDomain: region, Region: region}
 }
 
 func (z zones) GetZone(_ context.Context) (cloudprovider.Zone, error) {
-	return cloudprovider.Zone{Region: z.region}, nil
+	return regionZone(z.region), nil
 }
 
 func (z zones) GetZoneByProviderID(ctx context.Context, providerID string) (cloudprovider.Zone, error) {
@@ -26,18 +39,22 @@ func (z zones) GetZoneByProviderID(ctx context.Context, providerID string) (clou
 	if err != nil {
 		return cloudprovider.Zone{}, err
 	}
-	linode, err := linodeByID(ctx, z.client, id)
+	linode, _, err := findLinodeByID(ctx, append([]*linodego.Client{z.client}, z.accounts...), id)
 	if err != nil {
 		return cloudprovider.Zone{}, err
 	}
 
-	return cloudprovider.Zone{Region: linode.Region}, nil
+	return regionZone(linode.Region), nil
 }
 
 func (z zones) GetZoneByNodeName(ctx context.Context, nodeName types.NodeName) (cloudprovider.Zone, error) {
-	linode, err := linodeByName(ctx, z.client, nodeName)
+	if local := z.metadata.getLocalInstance(ctx, nodeName); local != nil {
+		return regionZone(local.Region), nil
+	}
+
+	linode, _, err := findLinodeByName(ctx, append([]*linodego.Client{z.client}, z.accounts...), nodeName)
 	if err != nil {
 		return cloudprovider.Zone{}, err
 	}
-	return cloudprovider.Zone{Region: linode.Region}, nil
+	return regionZone(linode.Region), nil
 }
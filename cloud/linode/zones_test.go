@@ -0,0 +1,45 @@
+package linode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linode/linodego"
+	"k8s.io/kubernetes/pkg/cloudprovider"
+)
+
+func TestZones(t *testing.T) {
+	fake := newFake(t)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	client := linodego.NewClient(http.DefaultClient)
+	client.SetBaseURL(ts.URL)
+
+	z := newZones(&client, "us-east")
+	expected := cloudprovider.Zone{FailureDomain: "us-east", Region: "us-east"}
+
+	zone, err := z.GetZone(context.TODO())
+	if err != nil || zone != expected {
+		t.Errorf("expected zone %v, got %v (%v)", expected, zone, err)
+	}
+
+	zone, err = z.GetZoneByProviderID(context.TODO(), "linode://123")
+	if err != nil || zone != expected {
+		t.Errorf("expected zone %v by provider ID, got %v (%v)", expected, zone, err)
+	}
+
+	zone, err = z.GetZoneByNodeName(context.TODO(), "test-instance")
+	if err != nil || zone != expected {
+		t.Errorf("expected zone %v by node name, got %v (%v)", expected, zone, err)
+	}
+
+	if _, err = z.GetZoneByProviderID(context.TODO(), "linode://12345"); err == nil {
+		t.Error("expected an error for a Linode that doesn't exist")
+	}
+	if _, err = z.GetZoneByNodeName(context.TODO(), "other-instance"); err == nil {
+		t.Error("expected an error for a node that doesn't exist")
+	}
+}
@@ -2,9 +2,10 @@ package framework
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
+	"net"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/golang/glog"
@@ -156,7 +157,9 @@ func (i *lbInvocation) getLoadBalancerURLs() ([]string, error) {
 	var ports []int32
 	if len(svc.Spec.Ports) > 0 {
 		for _, port := range svc.Spec.Ports {
-			if port.NodePort > 0 {
+			// Skipped ports aren't served by the NodeBalancer.
+			skipped, _ := strconv.ParseBool(svc.Annotations["service.beta.kubernetes.io/linode-loadbalancer-skip-port-"+strconv.Itoa(int(port.Port))])
+			if port.NodePort > 0 && !skipped {
 				ports = append(ports, port.Port)
 			}
 		}
@@ -164,7 +167,7 @@ func (i *lbInvocation) getLoadBalancerURLs() ([]string, error) {
 
 	for _, port := range ports {
 		for _, ip := range ips {
-			u, err := url.Parse(fmt.Sprintf("http://%s:%d", ip, port))
+			u, err := url.Parse("http://" + net.JoinHostPort(ip, strconv.Itoa(int(port))))
 			if err != nil {
 				return nil, err
 			}
@@ -204,3 +207,14 @@ func (i *lbInvocation) testServerServicePorts() []core.ServicePort {
 		},
 	}
 }
+
+func (i *lbInvocation) testServerUDPServicePorts() []core.ServicePort {
+	return []core.ServicePort{
+		{
+			Name:       "udp-1",
+			Port:       53,
+			TargetPort: intstr.FromInt(5353),
+			Protocol:   "UDP",
+		},
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	goflag "flag"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/linode/linode-cloud-controller-manager/cloud/linode"
 	"github.com/linode/linode-cloud-controller-manager/sentry"
+	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	utilflag "k8s.io/apiserver/pkg/util/flag"
 	"k8s.io/apiserver/pkg/util/logs"
@@ -22,6 +25,10 @@ const (
 	sentryDSNVariable         = "SENTRY_DSN"
 	sentryEnvironmentVariable = "SENTRY_ENVIRONMENT"
 	sentryReleaseVariable     = "SENTRY_RELEASE"
+
+	// defaultConcurrentServiceSyncs is the default of --concurrent-service-syncs, low enough not
+	// to run into the rate limits of the Linode API when many Services are created at once.
+	defaultConcurrentServiceSyncs = 4
 )
 
 func initializeSentry() {
@@ -33,30 +40,77 @@ func initializeSentry() {
 	)
 
 	if dsn, ok = os.LookupEnv(sentryDSNVariable); !ok {
-		fmt.Printf("%s not set, not initializing Sentry\n", sentryDSNVariable)
+		fmt.Fprintf(os.Stderr, "%s not set, not initializing Sentry\n", sentryDSNVariable)
 		return
 	}
 
 	if environment, ok = os.LookupEnv(sentryEnvironmentVariable); !ok {
-		fmt.Printf("%s not set, not initializing Sentry\n", sentryEnvironmentVariable)
+		fmt.Fprintf(os.Stderr, "%s not set, not initializing Sentry\n", sentryEnvironmentVariable)
 		return
 	}
 
 	if release, ok = os.LookupEnv(sentryReleaseVariable); !ok {
-		fmt.Printf("%s not set, defaulting to unknown", sentryReleaseVariable)
+		fmt.Fprintf(os.Stderr, "%s not set, defaulting to unknown", sentryReleaseVariable)
 		release = "unknown"
 	}
 
 	if err := sentry.Initialize(dsn, environment, release); err != nil {
-		fmt.Printf("error initializing sentry: %s\n", err.Error())
+		fmt.Fprintf(os.Stderr, "error initializing sentry: %s\n", err.Error())
 		return
 	}
 
-	fmt.Print("Sentry successfully initialized\n")
+	fmt.Fprint(os.Stderr, "Sentry successfully initialized\n")
+}
+
+// newAuditCommand returns the audit subcommand, which reports the NodeBalancers of the cluster
+// matching, drifted from or orphaned by their Services without running the controller. It exits
+// with status 2 if orphaned NodeBalancers are found.
+func newAuditCommand(ctx context.Context) *cobra.Command {
+	var (
+		cloudConfig string
+		jsonOutput  bool
+	)
+
+	command := &cobra.Command{
+		Use:   "audit",
+		Short: "Report the NodeBalancers of the cluster that match, drifted from or are orphaned by their Services",
+		Run: func(cmd *cobra.Command, args []string) {
+			// The audit reads the kubeconfig and cluster name from its own flags
+			linode.Options.KubeconfigFlag = cmd.Flags().Lookup("kubeconfig")
+			linode.Options.ClusterNameFlag = cmd.Flags().Lookup("cluster-name")
+
+			var config io.Reader
+			if cloudConfig != "" {
+				file, err := os.Open(cloudConfig)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					os.Exit(1)
+				}
+				defer file.Close()
+				config = file
+			}
+
+			err := linode.Audit(ctx, config, os.Stdout, jsonOutput)
+			if err == linode.ErrOrphanedNodeBalancers {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(2)
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	command.Flags().String("kubeconfig", "", "path to a kubeconfig file, defaulting to the in-cluster config")
+	command.Flags().String("cluster-name", "kubernetes", "the --cluster-name of the cloud controller manager, whose NodeBalancers are audited")
+	command.Flags().StringVar(&cloudConfig, "cloud-config", "", "path to the cloud provider configuration file")
+	command.Flags().StringVar(&linode.Options.TokenFile, "linode-token-file", "", "path of a file holding the Linode API token, used instead of LINODE_API_TOKEN")
+	command.Flags().BoolVar(&jsonOutput, "json", false, "print the report as JSON")
+	return command
 }
 
 func main() {
-	fmt.Printf("Linode Cloud Controller Manager starting up\n")
+	fmt.Fprintf(os.Stderr, "Linode Cloud Controller Manager starting up\n")
 
 	initializeSentry()
 
@@ -68,6 +122,44 @@ func main() {
 
 	// Add Linode-specific flags
 	command.Flags().BoolVar(&linode.Options.LinodeGoDebug, "linodego-debug", false, "enables debug output for the LinodeAPI wrapper")
+	command.Flags().IntVar(&linode.Options.LinodeAPIMaxRetries, "linode-api-max-retries", 5, "maximum number of times a Linode API request failing with 429, 5xx or a timeout is retried with exponential backoff; POST requests are only retried on 429 (0 leaves retries to linodego)")
+	command.Flags().DurationVar(&linode.Options.LinodeAPITimeout, "linode-api-timeout", 30*time.Second, "timeout of each attempt of a Linode API request, after which it is cancelled and retried like other timeouts (0 disables it)")
+	command.Flags().StringVar(&linode.Options.TokenFile, "linode-token-file", "", "path of a file holding the Linode API token, e.g. a key of a mounted Secret, used instead of LINODE_API_TOKEN and reloaded when the token is rotated")
+	command.Flags().BoolVar(&linode.Options.UseMetadataService, "use-metadata-service", false, "read the ID, region and type of the Linode the CCM runs on, e.g. as a node component, from the Linode metadata service instead of the API, falling back to the API when it is unreachable")
+	command.Flags().BoolVar(&linode.Options.ReconcileStatus, "reconcile-status", false, "record the NodeBalancer ID, time and outcome of the last reconcile of each LoadBalancer service in its linode-loadbalancer-reconcile-status annotation")
+	command.Flags().StringVar(&linode.Options.BackendIPv4Range, "nodebalancer-backend-ipv4-range", "", "CIDR of the VPC subnet the nodes are attached to; NodeBalancer backends use the node address in this range, falling back to its private IP")
+	command.Flags().StringVar(&linode.Options.LogFormat, "log-format", "text", "format of the logs of the LoadBalancer and instance reconciliation, text or json")
+	command.Flags().BoolVar(&linode.Options.ManageDNSRecords, "manage-dns-records", false, "create, update and delete the Linode DNS records requested by the dns-record annotation of Services instead of only reporting the records that don't point to their NodeBalancer")
+	command.Flags().BoolVar(&linode.Options.DryRun, "dry-run", false, "log the NodeBalancer changes that would be made instead of making them")
+	command.Flags().BoolVar(&linode.Options.RetainOnNamespaceDelete, "retain-on-namespace-delete", false, "keep the NodeBalancers of LoadBalancer Services deleted along with their namespace, without backends and tagged ccm-retained for manual review, instead of deleting them")
+	command.Flags().StringVar(&linode.Options.ExcludeNodeLabel, "exclude-node-label", "", "label selector of the nodes never used as NodeBalancer backends, e.g. pool=gpu; nodes labelled node.kubernetes.io/exclude-from-external-load-balancers are always excluded")
+	command.Flags().BoolVar(&linode.Options.ForceDeletePaused, "force-delete-paused", false, "delete the NodeBalancers of deleted Services even if they are paused with the paused annotation, instead of retrying until the annotation is removed")
+	command.Flags().BoolVar(&linode.Options.DisableNodeBalancerCreation, "disable-nodebalancer-creation", false, "only use the existing NodeBalancers referenced by the nodebalancer-id annotation of Services instead of creating NodeBalancers")
+	command.Flags().DurationVar(&linode.Options.MaintenanceGracePeriod, "maintenance-grace-period", 15*time.Minute, "how long an instance that went offline for Linode host maintenance is not reported as shut down (0 disables the grace period)")
+	command.Flags().DurationVar(&linode.Options.InstanceCacheTTL, "instance-cache-ttl", 15*time.Second, "how long Linode instance lookups are cached for (0 disables the cache)")
+	command.Flags().DurationVar(&linode.Options.NodeBalancerGCInterval, "nodebalancer-gc-interval", 0, "how often NodeBalancers created for this cluster whose Services no longer exist are deleted; requires a --cluster-name unique to the cluster (0 disables the garbage collection)")
+	command.Flags().StringSliceVar(&linode.Options.TokenSecretNamespaces, "token-secret-namespaces", nil, "namespaces whose Services may manage their NodeBalancers with the Linode API token of a Secret of their namespace, referenced by their token-secret annotation (* for all namespaces)")
+	command.Flags().BoolVar(&linode.Options.SkipStartupValidation, "skip-startup-validation", false, "don't check on startup that the cloud config has no unknown keys and that the Linode API accepts the tokens and regions, e.g. for offline testing")
+	command.Flags().StringVar(&linode.Options.EmptyBackendPolicy, "empty-backend-policy", "keep-last", "what to do with the NodeBalancer of a service with no nodes eligible as backends: keep-last keeps its current backends, remove-all removes them and fail fails the reconcile")
+	command.Flags().DurationVar(&linode.Options.NodeBalancerResyncPeriod, "nodebalancer-resync-period", 0, "how often the NodeBalancers of all LoadBalancer Services are reconciled to correct changes made to them outside of the CCM (0 disables the resync)")
+	command.Flags().IntVar(&linode.Options.NodeBalancerResyncMaxPerMinute, "nodebalancer-resync-max-per-minute", 30, "how many Services are reconciled per minute at most by a NodeBalancer resync")
+	command.Flags().DurationVar(&linode.Options.NodeBalancerStatsInterval, "nodebalancer-stats-interval", 0, "how often the transfer of the NodeBalancers created for this cluster is exported as metrics (0 disables the metrics)")
+	command.Flags().IntVar(&linode.Options.TLSExpiryWarningDays, "tls-expiry-warning-days", 0, "how many days before the TLS certificate of an https NodeBalancer port created for this cluster expires a warning event is recorded on its Service (0 disables the check)")
+	command.Flags().DurationVar(&linode.Options.LoadBalancerMaxBackoff, "loadbalancer-max-backoff", 5*time.Minute, "maximum delay before retrying a LoadBalancer Service whose reconciliation keeps failing (0 disables the backoff)")
+	command.Flags().Var(&linode.Options.NodePortRange, "nodebalancer-node-port-range", "range of ports the node-port-* annotation may make NodeBalancer nodes target, e.g. 8000-8999 (defaults to 30000-32767)")
+	command.Flags().DurationVar(&linode.Options.ConfigDrainGracePeriod, "config-drain-grace-period", 10*time.Second, "how long the NodeBalancer nodes of a port removed from a Service are drained before its config is deleted on the next sync (0 deletes it immediately)")
+	command.Flags().DurationVar(&linode.Options.NodeBalancerIPTimeout, "nodebalancer-ip-timeout", 30*time.Second, "how long to wait for a NodeBalancer to be assigned an IPv4 address before failing the Service's reconciliation (0 disables the wait)")
+	command.Flags().BoolVar(&linode.Options.WaitForBackendsStrict, "wait-for-backends-strict", false, "fail the reconciliation of Services with the wait-for-backends annotation whose NodeBalancer backends aren't UP in time instead of only recording an event")
+	command.Flags().IntVar(&linode.Options.NodeBalancerNodeConcurrency, "nodebalancer-node-concurrency", 10, "number of NodeBalancer backend node requests made at once when syncing a NodeBalancer config")
+	command.Flags().IntVar(&linode.Options.NodeBalancerNodeFailureThreshold, "nodebalancer-node-failure-threshold", 50, "percentage of the backend nodes of a NodeBalancer config failing to sync from which the Service's reconciliation fails instead of only recording a warning event (0 fails on any node, as does detaching the backends of preserved or retained NodeBalancers)")
+
+	// The service controller reconciles a single Service at a time by default, so that one slow
+	// NodeBalancer creation holds up every other Service. The operations on each Service are
+	// serialized by the CCM regardless of the number of workers.
+	if concurrentSyncs := command.Flags().Lookup("concurrent-service-syncs"); concurrentSyncs != nil {
+		concurrentSyncs.DefValue = strconv.Itoa(defaultConcurrentServiceSyncs)
+		_ = concurrentSyncs.Value.Set(concurrentSyncs.DefValue)
+	}
 
 	// Make the Linode-specific CCM bits aware of the kubeconfig flag
 	linode.Options.KubeconfigFlag = command.Flags().Lookup("kubeconfig")
@@ -78,6 +170,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Tag the NodeBalancers with the cluster name so that orphaned ones can be garbage-collected
+	linode.Options.ClusterNameFlag = command.Flags().Lookup("cluster-name")
+
+	// The audit is read-only and safe to run alongside the controller
+	command.AddCommand(newAuditCommand(ctx))
+
 	pflag.CommandLine.SetNormalizeFunc(utilflag.WordSepNormalizeFunc)
 	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
 